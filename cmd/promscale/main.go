@@ -17,6 +17,12 @@ import (
 func main() {
 	log.InitDefault()
 	args := os.Args[1:]
+	if len(args) > 0 && args[0] == runner.RulesCommand {
+		if err := runner.RunRulesCommand(args[1:]); err != nil {
+			log.Fatal("msg", "rules command failed", "err", err)
+		}
+		os.Exit(0)
+	}
 	if shouldProceed := runner.ParseArgs(args); !shouldProceed {
 		os.Exit(0)
 	}
@@ -0,0 +1,112 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/rules"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+// AlertHistoryQuerier returns the recorded state transitions of the alerts.
+type AlertHistoryQuerier interface {
+	AlertHistory(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) ([]rules.AlertTransition, error)
+}
+
+// AlertHistoryDiscovery has the state transitions of the alerts.
+type AlertHistoryDiscovery struct {
+	Alerts []*AlertTransition `json:"alerts"`
+}
+
+// AlertTransition has info for a state transition of an alert.
+type AlertTransition struct {
+	Labels      labels.Labels `json:"labels"`
+	Annotations labels.Labels `json:"annotations"`
+	State       string        `json:"state"`
+	Time        time.Time     `json:"time"`
+	Value       string        `json:"value"`
+	Group       string        `json:"group"`
+	File        string        `json:"file"`
+}
+
+func AlertHistory(conf *Config, querier AlertHistoryQuerier) http.Handler {
+	hf := corsWrapper(conf, alertHistoryHandler(querier))
+	return gziphandler.GzipHandler(hf)
+}
+
+func alertHistoryHandler(querier AlertHistoryQuerier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("error parsing form values: %w", err), "bad_data")
+			return
+		}
+		start, err := parseTimeParam(r, "start", time.Time{})
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		end, err := parseTimeParam(r, "end", time.Time{})
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		if !start.IsZero() && !end.IsZero() && end.Before(start) {
+			respondError(w, http.StatusBadRequest, errors.New("end timestamp must not be before start time"), "bad_data")
+			return
+		}
+
+		var matchers []*labels.Matcher
+		for _, s := range r.Form["match[]"] {
+			ms, err := parser.ParseMetricSelector(s)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, err, "bad_data")
+				return
+			}
+			matchers = append(matchers, ms...)
+		}
+
+		if querier == nil {
+			respond(w, http.StatusOK, &AlertHistoryDiscovery{Alerts: []*AlertTransition{}})
+			return
+		}
+		transitions, err := querier.AlertHistory(r.Context(), start, end, matchers)
+		if err != nil {
+			switch {
+			case errors.Is(err, tenancy.ErrUnauthorizedTenant):
+				respondError(w, http.StatusForbidden, err, "operation_not_permitted")
+			case errors.Is(err, rules.ErrAlertHistoryDisabled):
+				respondError(w, http.StatusServiceUnavailable, err, "unavailable")
+			default:
+				log.Error("msg", "alert history request failed", "err", err)
+				respondError(w, http.StatusInternalServerError, err, "internal")
+			}
+			return
+		}
+		alerts := make([]*AlertTransition, len(transitions))
+		for i, t := range transitions {
+			alerts[i] = &AlertTransition{
+				Labels:      t.Labels,
+				Annotations: t.Annotations,
+				State:       t.State,
+				Time:        t.Time,
+				Value:       strconv.FormatFloat(t.Value, 'e', -1, 64),
+				Group:       t.Group,
+				File:        t.GroupFile,
+			}
+		}
+		respond(w, http.StatusOK, &AlertHistoryDiscovery{Alerts: alerts})
+	}
+}
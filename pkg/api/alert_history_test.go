@@ -0,0 +1,119 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/rules"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+type mockAlertHistoryQuerier struct {
+	start, end time.Time
+	matchers   []*labels.Matcher
+	err        error
+}
+
+func (m *mockAlertHistoryQuerier) AlertHistory(_ context.Context, start, end time.Time, matchers []*labels.Matcher) ([]rules.AlertTransition, error) {
+	m.start, m.end, m.matchers = start, end, matchers
+	if m.err != nil {
+		return nil, m.err
+	}
+	return []rules.AlertTransition{{
+		Time:        time.Unix(120, 0).UTC(),
+		GroupFile:   "rules.yaml",
+		Group:       "instances",
+		State:       "firing",
+		Labels:      labels.FromStrings(labels.AlertName, "InstanceDown", "instance", "a"),
+		Annotations: labels.FromStrings("summary", "down"),
+		Value:       0,
+	}}, nil
+}
+
+func TestAlertHistory(t *testing.T) {
+	testCases := []struct {
+		name          string
+		query         string
+		err           error
+		expectedCode  int
+		expectedStart time.Time
+		expectedEnd   time.Time
+		expectedMatch []string
+	}{
+		{
+			name:         "no parameters",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:          "time range and matchers",
+			query:         `start=60&end=1970-01-01T00:03:00Z&match[]={alertname="InstanceDown"}&match[]={instance=~"a|b"}`,
+			expectedCode:  http.StatusOK,
+			expectedStart: time.Unix(60, 0).UTC(),
+			expectedEnd:   time.Unix(180, 0).UTC(),
+			expectedMatch: []string{`alertname="InstanceDown"`, `instance=~"a|b"`},
+		},
+		{
+			name:         "invalid time",
+			query:        "start=yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "end before start",
+			query:        "start=60&end=30",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid matcher",
+			query:        "match[]={instance=}",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unauthorized tenant",
+			err:          tenancy.ErrUnauthorizedTenant,
+			expectedCode: http.StatusForbidden,
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			querier := &mockAlertHistoryQuerier{err: c.err}
+			w := httptest.NewRecorder()
+			alertHistoryHandler(querier).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/alerts/history?"+c.query, nil))
+			require.Equal(t, c.expectedCode, w.Code, w.Body.String())
+			if c.expectedCode != http.StatusOK {
+				return
+			}
+			require.Equal(t, c.expectedStart, querier.start)
+			require.Equal(t, c.expectedEnd, querier.end)
+			require.Len(t, querier.matchers, len(c.expectedMatch))
+			for i, m := range c.expectedMatch {
+				require.Equal(t, m, querier.matchers[i].String())
+			}
+
+			var resp struct {
+				Status string                `json:"status"`
+				Data   AlertHistoryDiscovery `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Equal(t, "success", resp.Status)
+			require.Len(t, resp.Data.Alerts, 1)
+			alert := resp.Data.Alerts[0]
+			require.Equal(t, "firing", alert.State)
+			require.Equal(t, time.Unix(120, 0).UTC(), alert.Time)
+			require.Equal(t, "InstanceDown", alert.Labels.Get(labels.AlertName))
+			require.Equal(t, "instances", alert.Group)
+			require.Equal(t, "rules.yaml", alert.File)
+			require.Equal(t, "0e+00", alert.Value)
+		})
+	}
+}
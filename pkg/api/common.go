@@ -20,6 +20,7 @@ import (
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/util/httputil"
+	"github.com/timescale/promscale/pkg/ha"
 	"github.com/timescale/promscale/pkg/log"
 	pgmodel "github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/promql"
@@ -36,9 +37,12 @@ type Config struct {
 	AllowedOrigin    *regexp.Regexp
 	ReadOnly         bool
 	HighAvailability bool
+	HA               ha.Config
 	AdminAPIEnabled  bool
 	TelemetryPath    string
 
+	FederationMaxSeries int
+
 	MultiTenancy tenancy.Authorizer
 	Rules        *rules.Manager
 }
@@ -46,14 +50,19 @@ type Config struct {
 func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
 	fs.BoolVar(&cfg.ReadOnly, "db.read-only", false, "Read-only mode for the connector. Operations related to writing or updating the database are disallowed. It is used when pointing the connector to a TimescaleDB read replica.")
 	fs.BoolVar(&cfg.HighAvailability, "metrics.high-availability", false, "Enable external_labels based HA.")
-	fs.BoolVar(&cfg.AdminAPIEnabled, "web.enable-admin-api", false, "Allow operations via API that are for advanced users. Currently, these operations are limited to deletion of series.")
+	ha.ParseFlags(fs, &cfg.HA)
+	fs.BoolVar(&cfg.AdminAPIEnabled, "web.enable-admin-api", false, "Allow operations via API that are for advanced users. Currently, these operations are limited to deletion of series and management of HA leases.")
 	fs.StringVar(&cfg.TelemetryPath, "web.telemetry-path", "/metrics", "Web endpoint for exposing Promscale's Prometheus metrics.")
+	fs.IntVar(&cfg.FederationMaxSeries, "web.federate.max-series", 10000, "Maximum number of series a single /federate request may return. Requests selecting more series fail. Set to 0 to disable the limit.")
 
 	return cfg
 }
 
 func Validate(cfg *Config) error {
-	return nil
+	if cfg.FederationMaxSeries < 0 {
+		return fmt.Errorf("web.federate.max-series must not be negative")
+	}
+	return ha.Validate(&cfg.HA)
 }
 
 func corsWrapper(conf *Config, f http.HandlerFunc) http.HandlerFunc {
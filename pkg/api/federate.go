@@ -0,0 +1,283 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	pgquerier "github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+// FederationQueryables provides the queryables the federation reads the series from.
+type FederationQueryables interface {
+	// Queryable returns the queryable of the requests without a tenant.
+	Queryable() promql.Queryable
+	// TenantQueryable returns a queryable that only reads the series of the tenant.
+	TenantQueryable(tenant string) (promql.Queryable, error)
+}
+
+// MetadataQueryFunc returns the metadata of the metric families, the latest
+// first.
+type MetadataQueryFunc func(ctx context.Context, metrics []string) (map[string][]model.Metadata, error)
+
+// Federate serves the latest sample of the series selected by the match[]
+// parameters, in the text exposition format, like the /federate endpoint of
+// Prometheus.
+func Federate(conf *Config, queryables FederationQueryables, metadata MetadataQueryFunc, lookbackDelta time.Duration) http.Handler {
+	hf := corsWrapper(conf, federateHandler(queryables, metadata, lookbackDelta, conf.FederationMaxSeries))
+	return gziphandler.GzipHandler(hf)
+}
+
+type federatedSample struct {
+	labels labels.Labels
+	t      int64
+	v      float64
+}
+
+func federateHandler(queryables FederationQueryables, metadata MetadataQueryFunc, lookbackDelta time.Duration, maxSeries int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, fmt.Sprintf("error parsing form values: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		var matcherSets [][]*labels.Matcher
+		for _, s := range r.Form["match[]"] {
+			matchers, err := parser.ParseMetricSelector(s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			matcherSets = append(matcherSets, matchers)
+		}
+
+		ctx := r.Context()
+		queryable := queryables.Queryable()
+		if tenant := tenancy.TenantFromContext(ctx); tenant != "" {
+			var err error
+			queryable, err = queryables.TenantQueryable(tenant)
+			if err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, tenancy.ErrUnauthorizedTenant) {
+					status = http.StatusForbidden
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+		}
+
+		var (
+			maxt = timestamp.FromTime(time.Now())
+			mint = maxt - lookbackDelta.Milliseconds()
+		)
+		q, err := queryable.SamplesQuerier(ctx, mint, maxt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer q.Close()
+
+		if maxSeries > 0 {
+			n, err := countSeries(q, mint, maxt, matcherSets, maxSeries+1)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if n > maxSeries {
+				http.Error(w, fmt.Sprintf("federation selects more than the maximum of %d series, narrow down the match[] selectors", maxSeries), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+
+		hints := &storage.SelectHints{Start: mint, End: maxt}
+		var sets []storage.SeriesSet
+		for _, mset := range matcherSets {
+			s, _ := q.Select(true, hints, nil, nil, mset...)
+			sets = append(sets, s)
+		}
+		set := storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
+
+		var samples []federatedSample
+		for set.Next() {
+			series := set.At()
+			sample, ok, err := latestSample(series.Iterator(), mint, maxt)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				continue
+			}
+			sample.labels = series.Labels()
+			samples = append(samples, sample)
+		}
+		if err := set.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if ws := set.Warnings(); len(ws) > 0 {
+			log.Warn("msg", "Federation request returned warnings", "warnings", fmt.Sprint(ws))
+		}
+
+		var families map[string][]model.Metadata
+		if len(samples) > 0 {
+			if families, err = metadata(ctx, metricNames(samples)); err != nil {
+				// The series are still federated without their type and help.
+				log.Warn("msg", "Failed to get the metadata of the federated series", "err", err)
+			}
+		}
+
+		sort.Slice(samples, func(i, j int) bool {
+			ni, nj := samples[i].labels.Get(labels.MetricName), samples[j].labels.Get(labels.MetricName)
+			if ni != nj {
+				return ni < nj
+			}
+			return labels.Compare(samples[i].labels, samples[j].labels) < 0
+		})
+
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		enc := expfmt.NewEncoder(w, format)
+
+		var family *dto.MetricFamily
+		for _, s := range samples {
+			name := s.labels.Get(labels.MetricName)
+			if name == "" {
+				continue
+			}
+			if family == nil || family.GetName() != name {
+				if family != nil {
+					if err := enc.Encode(family); err != nil {
+						log.Error("msg", "Federation failed", "err", err)
+						return
+					}
+				}
+				family = newMetricFamily(name, families[name])
+			}
+			family.Metric = append(family.Metric, newMetric(family.GetType(), s))
+		}
+		if family != nil {
+			if err := enc.Encode(family); err != nil {
+				log.Error("msg", "Federation failed", "err", err)
+			}
+		}
+	}
+}
+
+// countSeries returns the number of series selected by the matcher sets, counting
+// at most limit series. Only the series are looked up, not their samples.
+func countSeries(q promql.SamplesQuerier, mint, maxt int64, matcherSets [][]*labels.Matcher, limit int) (int, error) {
+	hints := &storage.SelectHints{Start: mint, End: maxt, Func: pgquerier.SeriesFunc}
+	qh := &pgquerier.QueryHints{SeriesLimit: limit}
+	var sets []storage.SeriesSet
+	for _, mset := range matcherSets {
+		s, _ := q.Select(true, hints, qh, nil, mset...)
+		sets = append(sets, s)
+	}
+	set := storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
+	n := 0
+	for n < limit && set.Next() {
+		n++
+	}
+	return n, set.Err()
+}
+
+// metricNames returns the distinct metric names of the samples.
+func metricNames(samples []federatedSample) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, s := range samples {
+		name := s.labels.Get(labels.MetricName)
+		if _, ok := seen[name]; ok || name == "" {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	return names
+}
+
+// latestSample returns the latest sample of the series within the time range. The
+// series are left out once they are marked stale.
+func latestSample(it chunkenc.Iterator, mint, maxt int64) (federatedSample, bool, error) {
+	var (
+		sample federatedSample
+		ok     bool
+	)
+	for it.Next() {
+		t, v := it.At()
+		if t < mint || t > maxt {
+			continue
+		}
+		sample.t, sample.v, ok = t, v, true
+	}
+	if err := it.Err(); err != nil {
+		return federatedSample{}, false, err
+	}
+	if ok && value.IsStaleNaN(sample.v) {
+		return federatedSample{}, false, nil
+	}
+	return sample, ok, nil
+}
+
+// newMetricFamily returns the family of the metric, with the type and help of its
+// latest metadata. The series of other types than counters and gauges are federated
+// individually, so they are untyped.
+func newMetricFamily(name string, metadata []model.Metadata) *dto.MetricFamily {
+	typ := dto.MetricType_UNTYPED
+	family := &dto.MetricFamily{Name: &name, Type: &typ}
+	if len(metadata) == 0 {
+		return family
+	}
+	switch metadata[0].Type {
+	case "counter":
+		typ = dto.MetricType_COUNTER
+	case "gauge":
+		typ = dto.MetricType_GAUGE
+	}
+	if help := metadata[0].Help; help != "" {
+		family.Help = &help
+	}
+	return family
+}
+
+func newMetric(typ dto.MetricType, s federatedSample) *dto.Metric {
+	m := &dto.Metric{TimestampMs: &s.t}
+	for _, l := range s.labels {
+		if l.Name == labels.MetricName || l.Value == "" {
+			continue
+		}
+		l := l
+		m.Label = append(m.Label, &dto.LabelPair{Name: &l.Name, Value: &l.Value})
+	}
+	switch typ {
+	case dto.MetricType_COUNTER:
+		m.Counter = &dto.Counter{Value: &s.v}
+	case dto.MetricType_GAUGE:
+		m.Gauge = &dto.Gauge{Value: &s.v}
+	default:
+		m.Untyped = &dto.Untyped{Value: &s.v}
+	}
+	return m
+}
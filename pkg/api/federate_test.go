@@ -0,0 +1,209 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	pgquerier "github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+type federationQueryables struct {
+	queryable promql.Queryable
+	tenants   []string
+	// selects records the Func hint of the selects.
+	selects []string
+}
+
+func (q *federationQueryables) Queryable() promql.Queryable {
+	return &recordingQueryable{Queryable: q.queryable, selects: &q.selects}
+}
+
+func (q *federationQueryables) TenantQueryable(tenant string) (promql.Queryable, error) {
+	if tenant != "team-a" {
+		return nil, fmt.Errorf("authorization error for tenant %s: %w", tenant, tenancy.ErrUnauthorizedTenant)
+	}
+	q.tenants = append(q.tenants, tenant)
+	return &recordingQueryable{Queryable: q.queryable, selects: &q.selects}, nil
+}
+
+type recordingQueryable struct {
+	promql.Queryable
+	selects *[]string
+}
+
+func (q *recordingQueryable) SamplesQuerier(ctx context.Context, mint, maxt int64) (promql.SamplesQuerier, error) {
+	sq, err := q.Queryable.SamplesQuerier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingQuerier{SamplesQuerier: sq, selects: q.selects}, nil
+}
+
+type recordingQuerier struct {
+	promql.SamplesQuerier
+	selects *[]string
+}
+
+func (q *recordingQuerier) Select(sortSeries bool, hints *storage.SelectHints, qh *pgquerier.QueryHints, nodes []parser.Node, matchers ...*labels.Matcher) (storage.SeriesSet, parser.Node) {
+	f := hints.Func
+	if qh != nil && qh.SeriesLimit > 0 {
+		f = fmt.Sprintf("%s limit %d", f, qh.SeriesLimit)
+	}
+	*q.selects = append(*q.selects, f)
+	return q.SamplesQuerier.Select(sortSeries, hints, qh, nodes, matchers...)
+}
+
+func TestFederate(t *testing.T) {
+	db := promql.NewTestStorage(t)
+	defer db.Close()
+
+	now := time.Now().UnixMilli()
+	app := db.Appender(context.Background())
+	for _, s := range []struct {
+		lset labels.Labels
+		ts   []int64
+		v    float64
+	}{
+		{labels.FromStrings("__name__", "requests_total", "job", "api", "instance", "b"), []int64{now - 60_000, now - 30_000}, 5},
+		{labels.FromStrings("__name__", "requests_total", "job", "api", "instance", "a"), []int64{now - 60_000, now - 30_000}, 3},
+		{labels.FromStrings("__name__", "up", "job", "api", "instance", "a"), []int64{now - 30_000}, 1},
+		{labels.FromStrings("__name__", "job:requests:rate5m", "job", "api"), []int64{now - 30_000}, 0.5},
+		// Outside of the lookback delta.
+		{labels.FromStrings("__name__", "up", "job", "api", "instance", "old"), []int64{now - 10*60_000}, 1},
+		{labels.FromStrings("__name__", "up", "job", "api", "instance", "stale"), []int64{now - 60_000}, 1},
+	} {
+		for _, ts := range s.ts {
+			_, err := app.Append(0, s.lset, ts, s.v)
+			require.NoError(t, err)
+		}
+	}
+	_, err := app.Append(0, labels.FromStrings("__name__", "up", "job", "api", "instance", "stale"), now-30_000, math.Float64frombits(value.StaleNaN))
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	queryables := &federationQueryables{queryable: db}
+	var metadataQueries [][]string
+	metadata := func(_ context.Context, metrics []string) (map[string][]model.Metadata, error) {
+		metadataQueries = append(metadataQueries, metrics)
+		return map[string][]model.Metadata{
+			"requests_total": {{Type: "counter", Help: "Total requests."}, {Type: "counter", Help: "Requests."}},
+			"up":             {{Type: "gauge", Help: "Up."}},
+		}, nil
+	}
+	ts := func(offset int64) int64 { return now - offset }
+
+	testCases := []struct {
+		name      string
+		matchers  []string
+		tenant    string
+		maxSeries int
+		code      int
+		body      string
+		selects   []string
+		metrics   []string
+	}{
+		{
+			name:     "multiple selectors",
+			matchers:  []string{`{job="api", __name__=~"requests_total|up"}`, `job:requests:rate5m`, `up{instance="a"}`},
+			maxSeries: 10,
+			code:      http.StatusOK,
+			selects:   []string{"series limit 11", "series limit 11", "series limit 11", "", "", ""},
+			metrics:   []string{"job:requests:rate5m", "requests_total", "up"},
+			body: fmt.Sprintf(`# TYPE job:requests:rate5m untyped
+job:requests:rate5m{job="api"} 0.5 %d
+# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{instance="a",job="api"} 3 %d
+requests_total{instance="b",job="api"} 5 %d
+# HELP up Up.
+# TYPE up gauge
+up{instance="a",job="api"} 1 %d
+`, ts(30_000), ts(30_000), ts(30_000), ts(30_000)),
+		},
+		{
+			name:     "no series",
+			matchers: []string{`up{job="db"}`},
+			code:     http.StatusOK,
+		},
+		{
+			name: "no selectors",
+			code: http.StatusOK,
+		},
+		{
+			name:     "invalid selector",
+			matchers: []string{`up{`},
+			code:     http.StatusBadRequest,
+		},
+		{
+			name:      "too many series",
+			matchers:  []string{`requests_total`},
+			maxSeries: 1,
+			code:      http.StatusUnprocessableEntity,
+			selects:   []string{"series limit 2"},
+		},
+		{
+			name:     "authorized tenant",
+			matchers: []string{`job:requests:rate5m`},
+			tenant:   "team-a",
+			code:     http.StatusOK,
+			body:     fmt.Sprintf("# TYPE job:requests:rate5m untyped\njob:requests:rate5m{job=\"api\"} 0.5 %d\n", ts(30_000)),
+		},
+		{
+			name:     "unauthorized tenant",
+			matchers: []string{`job:requests:rate5m`},
+			tenant:   "team-b",
+			code:     http.StatusForbidden,
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			metadataQueries = nil
+			queryables.selects = nil
+			handler := federateHandler(queryables, metadata, 5*time.Minute, c.maxSeries)
+			req := httptest.NewRequest(http.MethodGet, "/federate?"+url.Values{"match[]": c.matchers}.Encode(), nil)
+			if c.tenant != "" {
+				req = req.WithContext(tenancy.WithTenant(req.Context(), c.tenant))
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			require.Equal(t, c.code, w.Code)
+			if c.selects != nil {
+				require.Equal(t, c.selects, queryables.selects)
+			}
+			if c.code != http.StatusOK {
+				return
+			}
+			body, err := io.ReadAll(w.Body)
+			require.NoError(t, err)
+			require.Equal(t, c.body, string(body))
+			if c.body == "" {
+				require.Empty(t, metadataQueries)
+			}
+			if c.metrics != nil {
+				require.Equal(t, [][]string{c.metrics}, metadataQueries)
+			}
+		})
+	}
+	require.Equal(t, []string{"team-a"}, queryables.tenants)
+}
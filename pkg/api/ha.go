@@ -0,0 +1,117 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/gorilla/mux"
+
+	"github.com/timescale/promscale/pkg/ha"
+	"github.com/timescale/promscale/pkg/ha/client"
+	"github.com/timescale/promscale/pkg/log"
+)
+
+type haClusterState struct {
+	Cluster               string     `json:"cluster"`
+	Leader                string     `json:"leader"`
+	LeaseStart            time.Time  `json:"leaseStart"`
+	LeaseUntil            time.Time  `json:"leaseUntil"`
+	MaxTimeSeen           *time.Time `json:"maxTimeSeen,omitempty"`
+	MaxTimeInstance       string     `json:"maxTimeInstance,omitempty"`
+	MaxTimeSeenLeader     *time.Time `json:"maxTimeSeenLeader,omitempty"`
+	RecentLeaderWriteTime *time.Time `json:"recentLeaderWriteTime,omitempty"`
+}
+
+func newHAClusterState(lease client.LeaseDBState) haClusterState {
+	return haClusterState{
+		Cluster:    lease.Cluster,
+		Leader:     lease.Leader,
+		LeaseStart: lease.LeaseStart,
+		LeaseUntil: lease.LeaseUntil,
+	}
+}
+
+// HAClusters lists the HA clusters with their current leader and lease.
+func HAClusters(conf *Config, service *ha.Service) http.Handler {
+	hf := corsWrapper(conf, haClustersHandler(conf, service))
+	return gziphandler.GzipHandler(hf)
+}
+
+func haClustersHandler(conf *Config, service *ha.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !conf.AdminAPIEnabled {
+			respondError(w, http.StatusForbidden, fmt.Errorf("listing HA clusters requires admin permissions. Use -web.enable-admin-api flag to allow HA admin operations"), "operation_not_permitted")
+			return
+		}
+		clusters, err := service.Clusters(r.Context())
+		if err != nil {
+			log.Error("msg", "failed to list HA clusters", "err", err)
+			respondError(w, http.StatusInternalServerError, err, "internal")
+			return
+		}
+		result := make([]haClusterState, len(clusters))
+		for i, c := range clusters {
+			result[i] = newHAClusterState(c.LeaseDBState)
+			result[i].MaxTimeSeen = c.MaxTimeSeen
+			result[i].MaxTimeInstance = c.MaxTimeInstance
+			result[i].MaxTimeSeenLeader = c.MaxTimeSeenLeader
+			result[i].RecentLeaderWriteTime = c.RecentLeaderWriteTime
+		}
+		respond(w, http.StatusOK, result)
+	}
+}
+
+// HAChangeLeader forces a leader change of a HA cluster. The new leader takes
+// over when the lease of the current leader expires.
+func HAChangeLeader(conf *Config, service *ha.Service) http.Handler {
+	hf := corsWrapper(conf, haChangeLeaderHandler(conf, service))
+	return gziphandler.GzipHandler(hf)
+}
+
+func haChangeLeaderHandler(conf *Config, service *ha.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if conf.ReadOnly {
+			respondError(w, http.StatusForbidden, fmt.Errorf("read-only connector cannot change the HA leader"), "operation_not_permitted")
+			return
+		}
+		if !conf.AdminAPIEnabled {
+			respondError(w, http.StatusForbidden, fmt.Errorf("changing the HA leader requires admin permissions. Use -web.enable-admin-api flag to allow HA admin operations"), "operation_not_permitted")
+			return
+		}
+		cluster, err := url.PathUnescape(mux.Vars(r)["cluster"])
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("invalid cluster name: %w", err), "bad_data")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, err, "bad_data")
+			return
+		}
+		replica := r.Form.Get("replica")
+		if replica == "" {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("no replica parameter provided"), "bad_data")
+			return
+		}
+
+		newState, err := service.ChangeLeader(r.Context(), cluster, replica)
+		switch {
+		case errors.Is(err, ha.ErrUnknownCluster):
+			respondError(w, http.StatusNotFound, fmt.Errorf("%w: %s", err, cluster), "not_found")
+		case errors.Is(err, ha.ErrLeaderNotChanged):
+			respondError(w, http.StatusConflict, err, "conflict")
+		case err != nil:
+			log.Error("msg", "failed to change HA leader", "cluster", cluster, "replica", replica, "err", err)
+			respondError(w, http.StatusInternalServerError, err, "internal")
+		default:
+			respond(w, http.StatusOK, newHAClusterState(newState))
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/ha"
+	"github.com/timescale/promscale/pkg/ha/client"
+)
+
+func newHATestRouter(conf *Config) *mux.Router {
+	service := ha.MockNewHAService()
+	leaseStart := time.Unix(1, 0).UTC()
+	ha.SetLeaderInMockService(service, []client.LeaseDBState{
+		{Cluster: "cluster", Leader: "replica1", LeaseStart: leaseStart, LeaseUntil: leaseStart.Add(time.Minute)},
+	})
+	router := mux.NewRouter().UseEncodedPath()
+	router.Path("/api/v1/ha/clusters").Methods(http.MethodGet).Handler(HAClusters(conf, service))
+	router.Path("/api/v1/ha/clusters/{cluster}/leader").Methods(http.MethodPost).Handler(HAChangeLeader(conf, service))
+	return router
+}
+
+func TestHAClusters(t *testing.T) {
+	testCases := []struct {
+		name         string
+		adminEnabled bool
+		expectedCode int
+	}{
+		{
+			name:         "admin API disabled",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "list clusters",
+			adminEnabled: true,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			router := newHATestRouter(&Config{AdminAPIEnabled: c.adminEnabled})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/ha/clusters", nil))
+			require.Equal(t, c.expectedCode, w.Code)
+			if c.expectedCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data []haClusterState `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			require.Len(t, resp.Data, 1)
+			require.Equal(t, "cluster", resp.Data[0].Cluster)
+			require.Equal(t, "replica1", resp.Data[0].Leader)
+			require.Equal(t, time.Unix(61, 0).UTC(), resp.Data[0].LeaseUntil.UTC())
+			require.Nil(t, resp.Data[0].MaxTimeSeen)
+		})
+	}
+}
+
+func TestHAChangeLeader(t *testing.T) {
+	testCases := []struct {
+		name           string
+		conf           *Config
+		cluster        string
+		replica        string
+		expectedCode   int
+		expectedLeader string
+	}{
+		{
+			name:         "admin API disabled",
+			conf:         &Config{},
+			cluster:      "cluster",
+			replica:      "replica2",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "read-only connector",
+			conf:         &Config{AdminAPIEnabled: true, ReadOnly: true},
+			cluster:      "cluster",
+			replica:      "replica2",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "no replica",
+			conf:         &Config{AdminAPIEnabled: true},
+			cluster:      "cluster",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unknown cluster",
+			conf:         &Config{AdminAPIEnabled: true},
+			cluster:      "unknown",
+			replica:      "replica2",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:           "change leader",
+			conf:           &Config{AdminAPIEnabled: true},
+			cluster:        "cluster",
+			replica:        "replica2",
+			expectedCode:   http.StatusOK,
+			expectedLeader: "replica2",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			router := newHATestRouter(c.conf)
+			form := url.Values{}
+			if c.replica != "" {
+				form.Set("replica", c.replica)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/ha/clusters/"+c.cluster+"/leader", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, c.expectedCode, w.Code, w.Body.String())
+			if c.expectedCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data haClusterState `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			require.Equal(t, c.expectedLeader, resp.Data.Leader)
+			require.Equal(t, time.Unix(61, 0).UTC(), resp.Data.LeaseStart.UTC())
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+
+	"github.com/jaegertracing/jaeger/proto-gen/api_v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	jaegerStore "github.com/timescale/promscale/pkg/jaeger/store"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+)
+
+// NewJaegerCollectorServer returns the gRPC service of the Jaeger collector,
+// so that Jaeger agents and clients can send span batches directly to Promscale.
+func NewJaegerCollectorServer(i ingestor.DBInserter) api_v2.CollectorServiceServer {
+	return &jaegerCollectorServer{
+		ingestor: i,
+	}
+}
+
+type jaegerCollectorServer struct {
+	ingestor ingestor.DBInserter
+}
+
+func (j *jaegerCollectorServer) PostSpans(ctx context.Context, r *api_v2.PostSpansRequest) (*api_v2.PostSpansResponse, error) {
+	traces, err := jaegerStore.BatchToTraces(&r.Batch)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err = j.ingestor.IngestTraces(ctx, traces); err != nil {
+		return nil, ingestErrToStatus(err)
+	}
+	return &api_v2.PostSpansResponse{}, nil
+}
@@ -0,0 +1,98 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/proto-gen/api_v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+func newJaegerCollectorClient(t *testing.T, inserter ingestor.DBInserter) api_v2.CollectorServiceClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	api_v2.RegisterCollectorServiceServer(server, NewJaegerCollectorServer(inserter))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return api_v2.NewCollectorServiceClient(conn)
+}
+
+func TestJaegerCollectorPostSpans(t *testing.T) {
+	batch := model.Batch{
+		Process: &model.Process{ServiceName: "frontend", Tags: []model.KeyValue{model.String("host.name", "web-1")}},
+		Spans: []*model.Span{
+			{
+				TraceID:       model.NewTraceID(1, 2),
+				SpanID:        model.NewSpanID(3),
+				OperationName: "get",
+				StartTime:     time.Unix(1000, 0),
+				Duration:      time.Second,
+			},
+			{
+				TraceID:       model.NewTraceID(1, 2),
+				SpanID:        model.NewSpanID(4),
+				OperationName: "query",
+				References:    []model.SpanRef{model.NewChildOfRef(model.NewTraceID(1, 2), model.NewSpanID(3))},
+				StartTime:     time.Unix(1000, 0),
+				Duration:      time.Millisecond,
+				Process:       &model.Process{ServiceName: "backend"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name         string
+		inserterErr  error
+		expectedCode codes.Code
+	}{
+		{name: "ok", expectedCode: codes.OK},
+		{name: "overloaded", inserterErr: &ingestor.OverloadedError{RetryAfter: time.Second}, expectedCode: codes.ResourceExhausted},
+		{name: "unauthorized tenant", inserterErr: fmt.Errorf("traces-authorizer process: %w", tenancy.ErrUnauthorizedTenant), expectedCode: codes.PermissionDenied},
+		{name: "ingest error", inserterErr: fmt.Errorf("some error"), expectedCode: codes.Unknown},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			inserter := &mockInserter{err: c.inserterErr}
+			client := newJaegerCollectorClient(t, inserter)
+
+			_, err := client.PostSpans(context.Background(), &api_v2.PostSpansRequest{Batch: batch})
+			require.Equal(t, c.expectedCode, status.Code(err))
+
+			traces := inserter.traces
+			require.Equal(t, 2, traces.SpanCount())
+			require.Equal(t, 2, traces.ResourceSpans().Len())
+			services := map[string]string{}
+			for i := 0; i < traces.ResourceSpans().Len(); i++ {
+				rs := traces.ResourceSpans().At(i)
+				service, ok := rs.Resource().Attributes().Get("service.name")
+				require.True(t, ok)
+				services[rs.ScopeSpans().At(0).Spans().At(0).Name()] = service.Str()
+			}
+			require.Equal(t, map[string]string{"get": "frontend", "query": "backend"}, services)
+		})
+	}
+}
@@ -6,9 +6,16 @@ package api
 
 import (
 	"context"
+	"errors"
 
-	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
 	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
 func NewTraceServer(i ingestor.DBInserter) ptraceotlp.GRPCServer {
@@ -22,5 +29,28 @@ type tracesServer struct {
 }
 
 func (t *tracesServer) Export(ctx context.Context, tr ptraceotlp.Request) (ptraceotlp.Response, error) {
-	return ptraceotlp.NewResponse(), t.ingestor.IngestTraces(ctx, tr.Traces())
+	return ptraceotlp.NewResponse(), ingestErrToStatus(t.ingestor.IngestTraces(ctx, tr.Traces()))
+}
+
+// ingestErrToStatus converts trace ingest errors into gRPC status errors.
+func ingestErrToStatus(err error) error {
+	if errors.Is(err, tenancy.ErrUnauthorizedTenant) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return overloadedToStatus(err)
+}
+
+// overloadedToStatus converts ingest overload errors into the gRPC equivalent of
+// 429 Too Many Requests, so that OTLP exporters back off and retry the request.
+func overloadedToStatus(err error) error {
+	var overloadedErr *ingestor.OverloadedError
+	if !errors.As(err, &overloadedErr) {
+		return err
+	}
+	st, detailsErr := status.New(codes.ResourceExhausted, err.Error()).
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(overloadedErr.RetryAfter)})
+	if detailsErr != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return st.Err()
 }
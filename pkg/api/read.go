@@ -13,7 +13,6 @@ import (
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
-	"github.com/timescale/promscale/pkg/ha"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgmodel/querier"
 	"github.com/timescale/promscale/pkg/prompb"
@@ -53,13 +52,14 @@ func Read(config *Config, reader querier.Reader, metrics *Metrics, updateMetrics
 
 		metrics.RemoteReadReceivedQueries.Add(float64(len(req.Queries)))
 
-		// Drop __replica__ labelSet when
+		// Drop replica labelSet when
 		// Promscale is running in HA mode
 		// as the same lebelSet is dropped during ingestion.
 		if config.HighAvailability {
+			_, replicaLabel := config.HA.Labels()
 			for _, q := range req.Queries {
 				for ind, l := range q.Matchers {
-					if l.Name == ha.ReplicaNameLabel {
+					if l.Name == replicaLabel {
 						q.Matchers = append(q.Matchers[:ind], q.Matchers[ind+1:]...)
 					}
 				}
@@ -5,6 +5,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
@@ -23,9 +24,13 @@ import (
 	jaegerStore "github.com/timescale/promscale/pkg/jaeger/store"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgclient"
+	"github.com/timescale/promscale/pkg/pgmodel/metadata"
 	pgMetrics "github.com/timescale/promscale/pkg/pgmodel/metrics"
+	pgmodel "github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/query"
 	"github.com/timescale/promscale/pkg/telemetry"
+	"github.com/timescale/promscale/pkg/tempo"
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
 type updateMetricCallback func(handler, code, errReason string, duration float64)
@@ -37,10 +42,13 @@ const (
 
 // TODO: Refactor this function to reduce number of paramaters.
 func GenerateRouter(apiConf *Config, promqlConf *query.Config, client *pgclient.Client, store *jaegerStore.Store, authWrapper mux.MiddlewareFunc, reload func() error) (*mux.Router, error) {
-	var writePreprocessors []parser.Preprocessor
+	var (
+		writePreprocessors []parser.Preprocessor
+		haService          *ha.Service
+	)
 	if apiConf.HighAvailability {
-		service := ha.NewService(haClient.NewLeaseClient(client.ReadOnlyConnection()))
-		writePreprocessors = append(writePreprocessors, ha.NewFilter(service))
+		haService = ha.NewService(haClient.NewLeaseClient(client.ReadOnlyConnection()))
+		writePreprocessors = append(writePreprocessors, ha.NewFilterWithConfig(haService, apiConf.HA))
 	}
 	if apiConf.MultiTenancy != nil {
 		writePreprocessors = append(writePreprocessors, apiConf.MultiTenancy.WriteAuthorizer())
@@ -62,9 +70,19 @@ func GenerateRouter(apiConf *Config, promqlConf *query.Config, client *pgclient.
 	if authWrapper != nil {
 		router.Use(authWrapper)
 	}
+	if apiConf.MultiTenancy != nil {
+		// Trace ingest and query read the tenant from the request context.
+		router.Use(tenancy.TenantHandler)
+	}
 
 	router.Path("/write").Methods(http.MethodPost).HandlerFunc(writeHandler)
 
+	zipkinHandler := timeHandler(metrics.HTTPRequestDuration, "zipkin_spans", ZipkinSpans(client))
+	if apiConf.ReadOnly {
+		zipkinHandler = withWarnLog("trying to send zipkin spans while connector is in read-only mode", http.NotFoundHandler())
+	}
+	router.Path("/api/v2/spans").Methods(http.MethodPost).HandlerFunc(zipkinHandler)
+
 	readHandler := timeHandler(metrics.HTTPRequestDuration, "read", Read(apiConf, client, metrics, updateQueryMetrics))
 	router.Path("/read").Methods(http.MethodGet, http.MethodPost).HandlerFunc(readHandler)
 
@@ -99,9 +117,30 @@ func GenerateRouter(apiConf *Config, promqlConf *query.Config, client *pgclient.
 	alertsHandler := timeHandler(metrics.HTTPRequestDuration, "alerts", Alerts(apiConf, updateQueryMetrics))
 	apiV1.Path("/alerts").Methods(http.MethodGet).HandlerFunc(alertsHandler)
 
+	var alertHistoryQuerier AlertHistoryQuerier
+	if apiConf.Rules != nil {
+		alertHistoryQuerier = apiConf.Rules
+		registerRulerAPI(apiV1, apiConf, apiConf.Rules)
+	}
+	alertHistoryHandler := timeHandler(metrics.HTTPRequestDuration, "alerts/history", AlertHistory(apiConf, alertHistoryQuerier))
+	apiV1.Path("/alerts/history").Methods(http.MethodGet, http.MethodPost).HandlerFunc(alertHistoryHandler)
+
 	labelValuesHandler := timeHandler(metrics.HTTPRequestDuration, "label/:name/values", LabelValues(apiConf, queryable))
 	apiV1.Path("/label/{name}/values").Methods(http.MethodGet).HandlerFunc(labelValuesHandler)
 
+	if haService != nil {
+		haClustersHandler := timeHandler(metrics.HTTPRequestDuration, "ha/clusters", HAClusters(apiConf, haService))
+		apiV1.Path("/ha/clusters").Methods(http.MethodGet).HandlerFunc(haClustersHandler)
+
+		haChangeLeaderHandler := timeHandler(metrics.HTTPRequestDuration, "ha/clusters/:cluster/leader", HAChangeLeader(apiConf, haService))
+		apiV1.Path("/ha/clusters/{cluster}/leader").Methods(http.MethodPost, http.MethodPut).HandlerFunc(haChangeLeaderHandler)
+	}
+
+	federateHandler := timeHandler(metrics.HTTPRequestDuration, "federate", Federate(apiConf, client, func(ctx context.Context, metrics []string) (map[string][]pgmodel.Metadata, error) {
+		return metadata.MetricsQuery(ctx, client.ReadOnlyConnection(), metrics)
+	}, promqlConf.LookBackDelta))
+	router.Path("/federate").Methods(http.MethodGet).HandlerFunc(federateHandler)
+
 	healthChecker := func() error { return client.HealthCheck() }
 	router.Path("/healthz").Methods(http.MethodGet, http.MethodOptions, http.MethodHead).HandlerFunc(Health(healthChecker))
 	router.Path(apiConf.TelemetryPath).Methods(http.MethodGet).HandlerFunc(promhttp.Handler().ServeHTTP)
@@ -110,6 +149,8 @@ func GenerateRouter(apiConf *Config, promqlConf *query.Config, client *pgclient.
 	router.Path("/-/reload").Methods(http.MethodPost).HandlerFunc(reloadHandler)
 
 	if store != nil {
+		// Tempo first, it takes the protobuf requests of the trace endpoint shared with Jaeger.
+		tempo.ExtendQueryAPIs(router, store)
 		jaeger.ExtendQueryAPIs(router, client.ReadOnlyConnection(), store)
 	}
 
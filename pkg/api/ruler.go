@@ -0,0 +1,218 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/rules"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+// maxRuleGroupSize limits the size of a rule group definition.
+const maxRuleGroupSize = 1 << 20
+
+// RuleGroupStore manages the rule groups of the Cortex/Mimir compatible ruler API.
+// With multi-tenancy, the rule groups belong to the tenant of the request context.
+type RuleGroupStore interface {
+	Namespace(ctx context.Context, namespace string) ([]rulefmt.RuleGroup, error)
+	Group(ctx context.Context, namespace, name string) (*rulefmt.RuleGroup, error)
+	SetGroup(ctx context.Context, namespace string, group rulefmt.RuleGroup) error
+	DeleteGroup(ctx context.Context, namespace, name string) error
+	DeleteNamespace(ctx context.Context, namespace string) error
+}
+
+// registerRulerAPI adds the ruler API routes to the /api/v1 router. Listing all the
+// namespaces is not supported, since GET /api/v1/rules is the Prometheus rules API.
+func registerRulerAPI(apiV1 *mux.Router, conf *Config, store RuleGroupStore) {
+	namespaceHandler := timeHandler(metrics.HTTPRequestDuration, "rules/:namespace", rulerNamespaceHandler(conf, store))
+	apiV1.Path("/rules/{namespace}").Methods(http.MethodGet).HandlerFunc(namespaceHandler)
+
+	setGroupHandler := timeHandler(metrics.HTTPRequestDuration, "rules/:namespace", rulerSetGroupHandler(conf, store))
+	apiV1.Path("/rules/{namespace}").Methods(http.MethodPost).HandlerFunc(setGroupHandler)
+	apiV1.Path("/rules/{namespace}/{group}").Methods(http.MethodPost).HandlerFunc(setGroupHandler)
+
+	deleteNamespaceHandler := timeHandler(metrics.HTTPRequestDuration, "rules/:namespace", rulerDeleteNamespaceHandler(conf, store))
+	apiV1.Path("/rules/{namespace}").Methods(http.MethodDelete).HandlerFunc(deleteNamespaceHandler)
+
+	groupHandler := timeHandler(metrics.HTTPRequestDuration, "rules/:namespace/:group", rulerGroupHandler(conf, store))
+	apiV1.Path("/rules/{namespace}/{group}").Methods(http.MethodGet).HandlerFunc(groupHandler)
+
+	deleteGroupHandler := timeHandler(metrics.HTTPRequestDuration, "rules/:namespace/:group", rulerDeleteGroupHandler(conf, store))
+	apiV1.Path("/rules/{namespace}/{group}").Methods(http.MethodDelete).HandlerFunc(deleteGroupHandler)
+}
+
+func rulerNamespaceHandler(conf *Config, store RuleGroupStore) http.HandlerFunc {
+	return corsWrapper(conf, func(w http.ResponseWriter, r *http.Request) {
+		namespace, ok := pathVar(w, r, "namespace")
+		if !ok {
+			return
+		}
+		groups, err := store.Namespace(r.Context(), namespace)
+		if err != nil {
+			respondRulerError(w, err)
+			return
+		}
+		respondYAML(w, map[string][]rulefmt.RuleGroup{namespace: groups})
+	})
+}
+
+func rulerGroupHandler(conf *Config, store RuleGroupStore) http.HandlerFunc {
+	return corsWrapper(conf, func(w http.ResponseWriter, r *http.Request) {
+		namespace, ok := pathVar(w, r, "namespace")
+		if !ok {
+			return
+		}
+		name, ok := pathVar(w, r, "group")
+		if !ok {
+			return
+		}
+		group, err := store.Group(r.Context(), namespace, name)
+		if err != nil {
+			respondRulerError(w, err)
+			return
+		}
+		respondYAML(w, group)
+	})
+}
+
+func rulerSetGroupHandler(conf *Config, store RuleGroupStore) http.HandlerFunc {
+	return corsWrapper(conf, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRulerAdmin(w, conf) {
+			return
+		}
+		namespace, ok := pathVar(w, r, "namespace")
+		if !ok {
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRuleGroupSize+1))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("reading rule group: %w", err), "bad_data")
+			return
+		}
+		if len(body) > maxRuleGroupSize {
+			respondError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("rule group exceeds %d bytes", maxRuleGroupSize), "bad_data")
+			return
+		}
+		group, errs := rules.ParseGroup(body)
+		if len(errs) > 0 {
+			msgs := make([]string, len(errs))
+			for i, err := range errs {
+				msgs[i] = err.Error()
+			}
+			respondError(w, http.StatusBadRequest, fmt.Errorf("invalid rule group: %s", strings.Join(msgs, "; ")), "bad_data")
+			return
+		}
+		if _, ok := mux.Vars(r)["group"]; ok {
+			name, ok := pathVar(w, r, "group")
+			if !ok {
+				return
+			}
+			if group.Name != name {
+				respondError(w, http.StatusBadRequest, fmt.Errorf("rule group name %q does not match %q", group.Name, name), "bad_data")
+				return
+			}
+		}
+		if err = store.SetGroup(r.Context(), namespace, group); err != nil {
+			respondRulerError(w, err)
+			return
+		}
+		respond(w, http.StatusAccepted, nil)
+	})
+}
+
+func rulerDeleteNamespaceHandler(conf *Config, store RuleGroupStore) http.HandlerFunc {
+	return corsWrapper(conf, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRulerAdmin(w, conf) {
+			return
+		}
+		namespace, ok := pathVar(w, r, "namespace")
+		if !ok {
+			return
+		}
+		if err := store.DeleteNamespace(r.Context(), namespace); err != nil {
+			respondRulerError(w, err)
+			return
+		}
+		respond(w, http.StatusAccepted, nil)
+	})
+}
+
+func rulerDeleteGroupHandler(conf *Config, store RuleGroupStore) http.HandlerFunc {
+	return corsWrapper(conf, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRulerAdmin(w, conf) {
+			return
+		}
+		namespace, ok := pathVar(w, r, "namespace")
+		if !ok {
+			return
+		}
+		name, ok := pathVar(w, r, "group")
+		if !ok {
+			return
+		}
+		if err := store.DeleteGroup(r.Context(), namespace, name); err != nil {
+			respondRulerError(w, err)
+			return
+		}
+		respond(w, http.StatusAccepted, nil)
+	})
+}
+
+func checkRulerAdmin(w http.ResponseWriter, conf *Config) bool {
+	if !conf.AdminAPIEnabled {
+		respondError(w, http.StatusForbidden, fmt.Errorf("changing rule groups requires admin permissions. Use -web.enable-admin-api flag to allow rule group changes"), "operation_not_permitted")
+		return false
+	}
+	return true
+}
+
+// pathVar returns the unescaped value of a path variable.
+func pathVar(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	value, err := url.PathUnescape(mux.Vars(r)[name])
+	if err != nil || value == "" {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("invalid %s", name), "bad_data")
+		return "", false
+	}
+	return value, true
+}
+
+func respondRulerError(w http.ResponseWriter, err error) {
+	if errors.Is(err, rules.ErrNamespaceNotFound) || errors.Is(err, rules.ErrGroupNotFound) {
+		respondError(w, http.StatusNotFound, err, "not_found")
+		return
+	}
+	if errors.Is(err, tenancy.ErrUnauthorizedTenant) {
+		respondError(w, http.StatusForbidden, err, "operation_not_permitted")
+		return
+	}
+	log.Error("msg", "ruler API request failed", "err", err)
+	respondError(w, http.StatusInternalServerError, err, "internal")
+}
+
+func respondYAML(w http.ResponseWriter, v interface{}) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err, "internal")
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if n, err := w.Write(b); err != nil {
+		log.Error("msg", "error writing response", "bytesWritten", n, "err", err)
+	}
+}
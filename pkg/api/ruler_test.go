@@ -0,0 +1,214 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/timescale/promscale/pkg/rules"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+type mockRuleGroupStore struct {
+	namespaces map[string][]rulefmt.RuleGroup
+}
+
+func (m *mockRuleGroupStore) Namespace(_ context.Context, namespace string) ([]rulefmt.RuleGroup, error) {
+	groups, ok := m.namespaces[namespace]
+	if !ok {
+		return nil, rules.ErrNamespaceNotFound
+	}
+	return groups, nil
+}
+
+func (m *mockRuleGroupStore) Group(_ context.Context, namespace, name string) (*rulefmt.RuleGroup, error) {
+	for _, group := range m.namespaces[namespace] {
+		if group.Name == name {
+			return &group, nil
+		}
+	}
+	return nil, rules.ErrGroupNotFound
+}
+
+func (m *mockRuleGroupStore) SetGroup(ctx context.Context, namespace string, group rulefmt.RuleGroup) error {
+	if tenancy.TenantFromContext(ctx) == "unknown" {
+		return tenancy.ErrUnauthorizedTenant
+	}
+	groups := m.namespaces[namespace]
+	for i := range groups {
+		if groups[i].Name == group.Name {
+			groups[i] = group
+			return nil
+		}
+	}
+	m.namespaces[namespace] = append(groups, group)
+	return nil
+}
+
+func (m *mockRuleGroupStore) DeleteGroup(_ context.Context, namespace, name string) error {
+	groups := m.namespaces[namespace]
+	for i := range groups {
+		if groups[i].Name == name {
+			m.namespaces[namespace] = append(groups[:i], groups[i+1:]...)
+			if len(m.namespaces[namespace]) == 0 {
+				delete(m.namespaces, namespace)
+			}
+			return nil
+		}
+	}
+	return rules.ErrGroupNotFound
+}
+
+func (m *mockRuleGroupStore) DeleteNamespace(_ context.Context, namespace string) error {
+	if _, ok := m.namespaces[namespace]; !ok {
+		return rules.ErrNamespaceNotFound
+	}
+	delete(m.namespaces, namespace)
+	return nil
+}
+
+const testRuleGroup = `name: payments
+rules:
+  - record: job:http_requests:rate5m
+    expr: sum by (job) (rate(http_requests_total[5m]))
+`
+
+func newRulerTestRouter(conf *Config, store RuleGroupStore) *mux.Router {
+	metrics = createMetrics()
+	router := mux.NewRouter().UseEncodedPath()
+	registerRulerAPI(router.PathPrefix("/api/v1").Subrouter(), conf, store)
+	return router
+}
+
+func TestRulerAPI(t *testing.T) {
+	store := &mockRuleGroupStore{namespaces: map[string][]rulefmt.RuleGroup{}}
+	router := newRulerTestRouter(&Config{AdminAPIEnabled: true}, store)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodGet, "/api/v1/rules/team-a", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(http.MethodPost, "/api/v1/rules/team-a", testRuleGroup)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	require.Len(t, store.namespaces["team-a"], 1)
+
+	w = do(http.MethodGet, "/api/v1/rules/team-a", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	var namespaces map[string][]rulefmt.RuleGroup
+	require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &namespaces))
+	require.Len(t, namespaces["team-a"], 1)
+	require.Equal(t, "payments", namespaces["team-a"][0].Name)
+
+	w = do(http.MethodGet, "/api/v1/rules/team-a/payments", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var group rulefmt.RuleGroup
+	require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &group))
+	require.Equal(t, "sum by (job) (rate(http_requests_total[5m]))", group.Rules[0].Expr.Value)
+
+	w = do(http.MethodGet, "/api/v1/rules/team-a/unknown", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(http.MethodDelete, "/api/v1/rules/team-a/payments", "")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Empty(t, store.namespaces)
+
+	w = do(http.MethodDelete, "/api/v1/rules/team-a/payments", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = do(http.MethodDelete, "/api/v1/rules/team-a", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRulerSetGroup(t *testing.T) {
+	testCases := []struct {
+		name         string
+		conf         *Config
+		path         string
+		tenant       string
+		group        string
+		expectedCode int
+		expectedErr  string
+	}{
+		{
+			name:         "admin API disabled",
+			conf:         &Config{},
+			path:         "/api/v1/rules/team-a",
+			group:        testRuleGroup,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "invalid expression",
+			conf:         &Config{AdminAPIEnabled: true},
+			path:         "/api/v1/rules/team-a",
+			group:        "name: a\nrules:\n  - record: a\n    expr: sum(\n",
+			expectedCode: http.StatusBadRequest,
+			expectedErr:  "could not parse expression",
+		},
+		{
+			name:         "name does not match the path",
+			conf:         &Config{AdminAPIEnabled: true},
+			path:         "/api/v1/rules/team-a/orders",
+			group:        testRuleGroup,
+			expectedCode: http.StatusBadRequest,
+			expectedErr:  `rule group name \"payments\" does not match \"orders\"`,
+		},
+		{
+			name:         "group in the path",
+			conf:         &Config{AdminAPIEnabled: true},
+			path:         "/api/v1/rules/team-a/payments",
+			group:        testRuleGroup,
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "unauthorized tenant",
+			conf:         &Config{AdminAPIEnabled: true},
+			path:         "/api/v1/rules/team-a",
+			tenant:       "unknown",
+			group:        testRuleGroup,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "escaped namespace",
+			conf:         &Config{AdminAPIEnabled: true},
+			path:         "/api/v1/rules/team%2Fa",
+			group:        testRuleGroup,
+			expectedCode: http.StatusAccepted,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			store := &mockRuleGroupStore{namespaces: map[string][]rulefmt.RuleGroup{}}
+			router := newRulerTestRouter(c.conf, store)
+			router.Use(tenancy.TenantHandler)
+			req := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(c.group))
+			if c.tenant != "" {
+				req.Header.Set(tenancy.TenantHeader, c.tenant)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, c.expectedCode, w.Code, w.Body.String())
+			require.Contains(t, w.Body.String(), c.expectedErr)
+			if c.expectedCode != http.StatusAccepted {
+				require.Empty(t, store.namespaces)
+				return
+			}
+			require.Len(t, store.namespaces, 1)
+		})
+	}
+}
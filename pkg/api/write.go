@@ -6,10 +6,13 @@ package api
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -239,6 +242,21 @@ func ingest(
 		}
 
 		numSamples, _, err := inserter.IngestMetrics(ctx, req)
+		var overloadedErr *ingestor.OverloadedError
+		if errors.As(err, &overloadedErr) {
+			statusCode = "429"
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(overloadedErr.RetryAfter.Seconds()))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return false
+		}
+		// The rest of the write was ingested, respond with a non-retryable
+		// status so that the client does not resend the out of bounds samples.
+		var outOfBoundsErr *ingestor.OutOfBoundsError
+		if errors.As(err, &outOfBoundsErr) {
+			statusCode = "400"
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
 		if err != nil {
 			statusCode = "500"
 			log.Warn("msg", "Error sending samples to remote storage", "err", err, "num_samples", numSamples)
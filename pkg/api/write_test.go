@@ -13,6 +13,7 @@ import (
 	"strings"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/timescale/promscale/pkg/api/parser"
 	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
 	"github.com/timescale/promscale/pkg/prompb"
 )
 
@@ -93,6 +95,7 @@ func TestWrite(t *testing.T) {
 		receivedSamples int64
 		inserterErr     error
 		customHeaders   map[string]string
+		retryAfter      string
 	}{
 		{
 			name:         "write request body error",
@@ -133,6 +136,41 @@ func TestWrite(t *testing.T) {
 				},
 			),
 		},
+		{
+			name:            "overloaded",
+			receivedSamples: 1,
+			responseCode:    http.StatusTooManyRequests,
+			inserterErr:     &ingestor.OverloadedError{Kind: "metric", Reason: "queue_full", RetryAfter: 1500 * time.Millisecond},
+			retryAfter:      "2",
+			requestBody: writeRequestToString(
+				&prompb.WriteRequest{
+					Timeseries: []prompb.TimeSeries{
+						{
+							Samples: []prompb.Sample{
+								{},
+							},
+						},
+					},
+				},
+			),
+		},
+		{
+			name:            "out of bounds samples",
+			receivedSamples: 1,
+			responseCode:    http.StatusBadRequest,
+			inserterErr:     &ingestor.OutOfBoundsError{Window: ingestor.SampleWindowConfig{Past: time.Hour}, TooOld: 1},
+			requestBody: writeRequestToString(
+				&prompb.WriteRequest{
+					Timeseries: []prompb.TimeSeries{
+						{
+							Samples: []prompb.Sample{
+								{},
+							},
+						},
+					},
+				},
+			),
+		},
 		{
 			name:         "bad content type header",
 			responseCode: http.StatusBadRequest,
@@ -237,6 +275,10 @@ func TestWrite(t *testing.T) {
 				t.Errorf("Unexpected HTTP status code received: got %d wanted %d", w.Code, c.responseCode)
 			}
 
+			if got := w.Header().Get("Retry-After"); got != c.retryAfter {
+				t.Errorf("Unexpected Retry-After header: got %q wanted %q", got, c.retryAfter)
+			}
+
 			if numSamplesReceived.value != float64(c.receivedSamples) {
 				t.Errorf(
 					"num sent samples gauge not set correctly: got %v, expected %d",
@@ -273,12 +315,14 @@ func GenerateWriteHandleTester(t *testing.T, handleFunc http.Handler, headers ma
 
 type mockInserter struct {
 	ts     []prompb.TimeSeries
+	traces ptrace.Traces
 	result int64
 	err    error
 }
 
-func (m *mockInserter) IngestTraces(_ context.Context, _ ptrace.Traces) error {
-	panic("not implemented") // TODO: Implement
+func (m *mockInserter) IngestTraces(_ context.Context, tr ptrace.Traces) error {
+	m.traces = tr
+	return m.err
 }
 func (m *mockInserter) IngestMetrics(_ context.Context, r *prompb.WriteRequest) (uint64, uint64, error) {
 	m.ts = r.Timeseries
@@ -0,0 +1,120 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/translator/zipkin/zipkinv2"
+	zipkinmodel "github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/proto/zipkin_proto3"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/tenancy"
+	"github.com/timescale/promscale/pkg/tracer"
+)
+
+// maxZipkinRequestSize limits the size of the decompressed body of a Zipkin request.
+const maxZipkinRequestSize = 32 << 20
+
+// ZipkinSpans returns an http.Handler ingesting Zipkin v2 spans, sent as
+// JSON or protobuf to the /api/v2/spans endpoint of the Zipkin API.
+func ZipkinSpans(inserter ingestor.DBInserter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Default().Start(r.Context(), "ingest-zipkin-spans")
+		defer span.End()
+
+		spans, err := decodeZipkinSpans(w, r)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("zipkin request exceeds %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			invalidRequestError(w, "zipkin spans decode error", err.Error(), metrics)
+			return
+		}
+		traces, err := zipkinv2.ToTranslator{}.ToTraces(spans)
+		if err != nil {
+			invalidRequestError(w, "zipkin spans translation error", err.Error(), metrics)
+			return
+		}
+
+		err = inserter.IngestTraces(ctx, traces)
+		var overloadedErr *ingestor.OverloadedError
+		if errors.As(err, &overloadedErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(overloadedErr.RetryAfter.Seconds()))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, tenancy.ErrUnauthorizedTenant) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			log.Warn("msg", "Error ingesting zipkin spans", "err", err, "num_spans", len(spans))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func decodeZipkinSpans(w http.ResponseWriter, r *http.Request) ([]*zipkinmodel.SpanModel, error) {
+	var body io.ReadCloser = r.Body
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "":
+	case "gzip":
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		body = gr
+	case "deflate", "zlib":
+		zr, err := zlib.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, body, maxZipkinRequestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, fmt.Errorf("error parsing media type from Content-Type header: %w", err)
+		}
+	}
+	switch mediaType {
+	case "application/x-protobuf", "application/protobuf":
+		// The B3 debug flag applies to all the spans of the request.
+		return zipkin_proto3.ParseSpans(payload, r.Header.Get("X-B3-Flags") == "1")
+	case "application/json":
+		var spans []*zipkinmodel.SpanModel
+		if err = json.Unmarshal(payload, &spans); err != nil {
+			return nil, err
+		}
+		return spans, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Type %q, expected application/json or application/x-protobuf", mediaType)
+	}
+}
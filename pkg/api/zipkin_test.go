@@ -0,0 +1,167 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	zipkinmodel "github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/proto/zipkin_proto3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+const zipkinJSONSpans = `[{
+	"traceId": "5af7183fb1d4cf5f",
+	"id": "6b221d5bc9e6496c",
+	"name": "get /api",
+	"kind": "SERVER",
+	"timestamp": 1556604172355737,
+	"duration": 1431,
+	"localEndpoint": {"serviceName": "backend", "ipv4": "192.168.99.1", "port": 3306},
+	"tags": {"http.method": "GET"}
+}]`
+
+func gzipped(t *testing.T, s []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(s)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestZipkinSpans(t *testing.T) {
+	protoSpans, err := zipkin_proto3.SpanSerializer{}.Serialize([]*zipkinmodel.SpanModel{{
+		SpanContext:   zipkinmodel.SpanContext{TraceID: zipkinmodel.TraceID{Low: 1}, ID: 2},
+		Name:          "proto",
+		Timestamp:     time.Unix(1, 0),
+		Duration:      time.Second,
+		LocalEndpoint: &zipkinmodel.Endpoint{ServiceName: "frontend"},
+	}})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name            string
+		body            []byte
+		contentType     string
+		contentEncoding string
+		inserterErr     error
+		expectedCode    int
+		expectedSpans   int
+		expectedName    string
+	}{
+		{
+			name:          "json",
+			body:          []byte(zipkinJSONSpans),
+			contentType:   "application/json",
+			expectedCode:  http.StatusAccepted,
+			expectedSpans: 1,
+			expectedName:  "get /api",
+		},
+		{
+			name:          "json without content type",
+			body:          []byte(zipkinJSONSpans),
+			expectedCode:  http.StatusAccepted,
+			expectedSpans: 1,
+			expectedName:  "get /api",
+		},
+		{
+			name:            "gzipped json",
+			body:            gzipped(t, []byte(zipkinJSONSpans)),
+			contentType:     "application/json; charset=utf-8",
+			contentEncoding: "gzip",
+			expectedCode:    http.StatusAccepted,
+			expectedSpans:   1,
+			expectedName:    "get /api",
+		},
+		{
+			name:          "protobuf",
+			body:          protoSpans,
+			contentType:   "application/x-protobuf",
+			expectedCode:  http.StatusAccepted,
+			expectedSpans: 1,
+			expectedName:  "proto",
+		},
+		{
+			name:         "invalid json",
+			body:         []byte(`[{"traceId": "zz"}]`),
+			contentType:  "application/json",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unsupported content type",
+			body:         []byte(zipkinJSONSpans),
+			contentType:  "application/thrift",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:            "unsupported content encoding",
+			body:            []byte(zipkinJSONSpans),
+			contentEncoding: "br",
+			expectedCode:    http.StatusBadRequest,
+		},
+		{
+			name:            "too large",
+			body:            gzipped(t, bytes.Repeat([]byte(" "), maxZipkinRequestSize+1)),
+			contentEncoding: "gzip",
+			expectedCode:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:          "overloaded",
+			body:          []byte(zipkinJSONSpans),
+			inserterErr:   &ingestor.OverloadedError{RetryAfter: time.Second},
+			expectedCode:  http.StatusTooManyRequests,
+			expectedSpans: 1,
+			expectedName:  "get /api",
+		},
+		{
+			name:          "unauthorized tenant",
+			body:          []byte(zipkinJSONSpans),
+			inserterErr:   fmt.Errorf("traces-authorizer process: %w", tenancy.ErrUnauthorizedTenant),
+			expectedCode:  http.StatusForbidden,
+			expectedSpans: 1,
+			expectedName:  "get /api",
+		},
+		{
+			name:          "ingest error",
+			body:          []byte(zipkinJSONSpans),
+			inserterErr:   fmt.Errorf("some error"),
+			expectedCode:  http.StatusInternalServerError,
+			expectedSpans: 1,
+			expectedName:  "get /api",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			inserter := &mockInserter{err: c.inserterErr}
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/spans", bytes.NewReader(c.body))
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+			if c.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", c.contentEncoding)
+			}
+			w := httptest.NewRecorder()
+			ZipkinSpans(inserter).ServeHTTP(w, req)
+
+			require.Equal(t, c.expectedCode, w.Code, w.Body.String())
+			if c.expectedSpans == 0 {
+				return
+			}
+			require.Equal(t, c.expectedSpans, inserter.traces.SpanCount())
+			require.Equal(t, c.expectedName, inserter.traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Name())
+		})
+	}
+}
@@ -7,10 +7,13 @@ package dataset
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/blang/semver/v4"
 	"github.com/jackc/pgx/v5"
 	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/common/extension"
 	"gopkg.in/yaml.v2"
 )
 
@@ -32,6 +35,11 @@ var (
 	setDefaultTraceRetentionPeriodSQL   = "SELECT ps_trace.set_trace_retention_period($1)"
 
 	defaultMetricCompressionVar = defaultMetricCompression
+
+	// traceRetentionRulesTimescaleVersion is the first TimescaleDB version able to delete
+	// rows of compressed chunks. The trace chunks are compressed after an hour, so the
+	// spans deleted by the retention rules are in compressed chunks.
+	traceRetentionRulesTimescaleVersion = semver.MustParse("2.11.0")
 )
 
 // Config represents a dataset config.
@@ -51,31 +59,103 @@ type Metrics struct {
 
 // Traces contains dataset configuration options for traces data.
 type Traces struct {
-	RetentionPeriod DayDuration `mapstructure:"default_retention_period" yaml:"default_retention_period"`
+	RetentionPeriod DayDuration          `mapstructure:"default_retention_period" yaml:"default_retention_period"`
+	RetentionRules  []TraceRetentionRule `mapstructure:"retention_rules" yaml:"retention_rules"`
+}
+
+// TraceRetentionRule overrides the retention period of the spans of a service, or
+// with the given attributes. A span must match all the conditions of the rule.
+type TraceRetentionRule struct {
+	// Name identifies the rule in the metrics. It defaults to the position of the rule.
+	Name string `mapstructure:"name" yaml:"name"`
+	// Service is the name of the service of the spans.
+	Service string `mapstructure:"service" yaml:"service"`
+	// Attributes are the values of span or resource attributes of the spans.
+	Attributes      map[string]string `mapstructure:"attributes" yaml:"attributes"`
+	RetentionPeriod DayDuration       `mapstructure:"retention_period" yaml:"retention_period"`
+}
+
+// DefaultRetentionPeriod returns the retention period of the spans which don't match any rule.
+func (t Traces) DefaultRetentionPeriod() time.Duration {
+	if t.RetentionPeriod <= 0 {
+		return defaultTraceRetentionPeriod
+	}
+	return time.Duration(t.RetentionPeriod)
+}
+
+// MaxRetentionPeriod returns the longest retention period of the traces, which is used
+// as the retention period of the trace chunks.
+func (t Traces) MaxRetentionPeriod() time.Duration {
+	max := t.DefaultRetentionPeriod()
+	for _, r := range t.RetentionRules {
+		if time.Duration(r.RetentionPeriod) > max {
+			max = time.Duration(r.RetentionPeriod)
+		}
+	}
+	return max
+}
+
+// IsEmpty returns true if no dataset option is set.
+func (c *Config) IsEmpty() bool {
+	return c.Metrics == Metrics{} && c.Traces.RetentionPeriod == 0 && len(c.Traces.RetentionRules) == 0
+}
+
+// Validate checks the dataset configuration and names the unnamed trace retention rules.
+func (c *Config) Validate() error {
+	for i := range c.Traces.RetentionRules {
+		r := &c.Traces.RetentionRules[i]
+		if r.Name == "" {
+			r.Name = strconv.Itoa(i)
+		}
+		if r.Service == "" && len(r.Attributes) == 0 {
+			return fmt.Errorf("trace retention rule %s: at least one of service or attributes is required", r.Name)
+		}
+		if r.RetentionPeriod <= 0 {
+			return fmt.Errorf("trace retention rule %s: retention_period must be positive", r.Name)
+		}
+	}
+	return nil
 }
 
 // NewConfig creates a new dataset config based on the configuration YAML contents.
 func NewConfig(contents string) (cfg Config, err error) {
-	err = yaml.Unmarshal([]byte(contents), &cfg)
-	return cfg, err
+	if err = yaml.Unmarshal([]byte(contents), &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
 }
 
 // Apply applies the configuration to the database via the supplied DB connection.
 func (c *Config) Apply(conn *pgx.Conn) error {
 	c.applyDefaults()
 
+	if len(c.Traces.RetentionRules) > 0 {
+		timescaleVersion, _, err := extension.FetchInstalledExtensionVersion(conn, "timescaledb")
+		if err != nil {
+			return fmt.Errorf("could not get the installed timescaledb version: %w", err)
+		}
+		if err = checkTraceRetentionRulesSupport(timescaleVersion); err != nil {
+			return err
+		}
+	}
+
 	log.Info("msg", fmt.Sprintf("Setting metric dataset default chunk interval to %s", c.Metrics.ChunkInterval))
 	log.Info("msg", fmt.Sprintf("Setting metric dataset default compression to %t", *c.Metrics.Compression))
 	log.Info("msg", fmt.Sprintf("Setting metric dataset default high availability lease refresh to %s", c.Metrics.HALeaseRefresh))
 	log.Info("msg", fmt.Sprintf("Setting metric dataset default high availability lease timeout to %s", c.Metrics.HALeaseTimeout))
 	log.Info("msg", fmt.Sprintf("Setting metric dataset default retention period to %s", c.Metrics.RetentionPeriod))
 	log.Info("msg", fmt.Sprintf("Setting trace dataset default retention period to %s", c.Traces.RetentionPeriod))
+	for _, r := range c.Traces.RetentionRules {
+		log.Info("msg", fmt.Sprintf("Setting trace retention period of rule %s to %s", r.Name, r.RetentionPeriod))
+	}
 
 	queries := map[string]interface{}{
 		setDefaultMetricChunkIntervalSQL:   time.Duration(c.Metrics.ChunkInterval),
 		setDefaultMetricCompressionSQL:     c.Metrics.Compression,
 		setDefaultMetricRetentionPeriodSQL: time.Duration(c.Metrics.RetentionPeriod),
-		setDefaultTraceRetentionPeriodSQL:  time.Duration(c.Traces.RetentionPeriod),
+		// Chunks are kept for the longest retention period, and the spans with a shorter
+		// retention period are deleted by the trace retention engine.
+		setDefaultTraceRetentionPeriodSQL: c.Traces.MaxRetentionPeriod(),
 		// These need to be sent as string because the SQL does `$1::text` making
 		// PGX require a string, []byte or a TextValuer.
 		// https://github.com/jackc/pgx/blob/74f9b9f0a483f95513c621364f2c3912181ee360/pgtype/text.go#L92-L106
@@ -92,6 +172,17 @@ func (c *Config) Apply(conn *pgx.Conn) error {
 	return nil
 }
 
+// checkTraceRetentionRulesSupport returns an error if the trace retention rules can't
+// delete the spans of the compressed chunks with the TimescaleDB version. Without it,
+// the spans would silently be kept for the longest retention period.
+func checkTraceRetentionRulesSupport(timescaleVersion semver.Version) error {
+	if timescaleVersion.LT(traceRetentionRulesTimescaleVersion) {
+		return fmt.Errorf("trace retention rules require TimescaleDB %s or newer to delete spans from compressed chunks, found %s",
+			traceRetentionRulesTimescaleVersion, timescaleVersion)
+	}
+	return nil
+}
+
 func (c *Config) applyDefaults() {
 	if c.Metrics.ChunkInterval <= 0 {
 		c.Metrics.ChunkInterval = DayDuration(defaultMetricChunkInterval)
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/blang/semver/v4"
 	"github.com/stretchr/testify/require"
 )
 
@@ -75,6 +76,42 @@ traces:
 				},
 			},
 		},
+		{
+			name: "trace retention rules",
+			input: `traces:
+  default_retention_period: 7d
+  retention_rules:
+    - name: payments
+      service: payment
+      retention_period: 90d
+    - attributes:
+        deployment.environment: staging
+      retention_period: 3d`,
+			cfg: Config{
+				Traces: Traces{
+					RetentionPeriod: DayDuration(7 * 24 * time.Hour),
+					RetentionRules: []TraceRetentionRule{
+						{Name: "payments", Service: "payment", RetentionPeriod: DayDuration(90 * 24 * time.Hour)},
+						{Name: "1", Attributes: map[string]string{"deployment.environment": "staging"}, RetentionPeriod: DayDuration(3 * 24 * time.Hour)},
+					},
+				},
+			},
+		},
+		{
+			name: "trace retention rule without condition",
+			input: `traces:
+  retention_rules:
+    - name: all
+      retention_period: 3d`,
+			err: "trace retention rule all: at least one of service or attributes is required",
+		},
+		{
+			name: "trace retention rule without retention period",
+			input: `traces:
+  retention_rules:
+    - service: payment`,
+			err: "trace retention rule 0: retention_period must be positive",
+		},
 	}
 
 	for _, c := range testCases {
@@ -131,3 +168,28 @@ func TestApplyDefaults(t *testing.T) {
 
 	require.Equal(t, untouched, copyConfig)
 }
+
+func TestTraceRetentionPeriods(t *testing.T) {
+	traces := Traces{}
+	require.Equal(t, defaultTraceRetentionPeriod, traces.DefaultRetentionPeriod())
+	require.Equal(t, defaultTraceRetentionPeriod, traces.MaxRetentionPeriod())
+
+	traces.RetentionRules = []TraceRetentionRule{
+		{Service: "chatty", RetentionPeriod: DayDuration(3 * 24 * time.Hour)},
+		{Service: "payment", RetentionPeriod: DayDuration(90 * 24 * time.Hour)},
+	}
+	require.Equal(t, defaultTraceRetentionPeriod, traces.DefaultRetentionPeriod())
+	require.Equal(t, 90*24*time.Hour, traces.MaxRetentionPeriod())
+
+	cfg := Config{}
+	require.True(t, cfg.IsEmpty())
+	cfg.Traces = traces
+	require.False(t, cfg.IsEmpty())
+}
+
+func TestCheckTraceRetentionRulesSupport(t *testing.T) {
+	require.Error(t, checkTraceRetentionRulesSupport(semver.MustParse("2.6.1")))
+	require.Error(t, checkTraceRetentionRulesSupport(semver.MustParse("2.10.3")))
+	require.NoError(t, checkTraceRetentionRulesSupport(semver.MustParse("2.11.0")))
+	require.NoError(t, checkTraceRetentionRulesSupport(semver.MustParse("2.13.1")))
+}
@@ -13,7 +13,7 @@ package dataset
 func (in *Config) DeepCopyInto(out *Config) {
 	*out = *in
 	in.Metrics.DeepCopyInto(&out.Metrics)
-	out.Traces = in.Traces
+	in.Traces.DeepCopyInto(&out.Traces)
 	return
 }
 
@@ -48,9 +48,39 @@ func (in *Metrics) DeepCopy() *Metrics {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TraceRetentionRule) DeepCopyInto(out *TraceRetentionRule) {
+	*out = *in
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TraceRetentionRule.
+func (in *TraceRetentionRule) DeepCopy() *TraceRetentionRule {
+	if in == nil {
+		return nil
+	}
+	out := new(TraceRetentionRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Traces) DeepCopyInto(out *Traces) {
 	*out = *in
+	if in.RetentionRules != nil {
+		in, out := &in.RetentionRules, &out.RetentionRules
+		*out = make([]TraceRetentionRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
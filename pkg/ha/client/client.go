@@ -22,6 +22,7 @@ const (
 	updateLeaseSQL      = "SELECT * FROM " + updateLeaseFn + "($1, $2, $3, $4)"
 	tryChangeLeaderSQL  = "SELECT * FROM " + tryChangeLeaderFn + "($1, $2, $3)"
 	latestLeaseStateSQL = "SELECT leader_name, lease_start, lease_until FROM " + leasesTable + " WHERE cluster_name = $1"
+	listLeasesSQL       = "SELECT cluster_name, leader_name, lease_start, lease_until FROM " + leasesTable + " ORDER BY cluster_name"
 	getPastLeaseInfoSQL = "SELECT lease_start, lease_until FROM " + leaseLogsTable +
 		" WHERE cluster_name = $1" +
 		" AND leader_name = $2" +
@@ -61,6 +62,8 @@ type LeaseClient interface {
 	// error signifying the call couldn't be made
 	TryChangeLeader(ctx context.Context, cluster, newLeader string, maxTime time.Time) (LeaseDBState, error)
 	GetPastLeaseInfo(ctx context.Context, cluster, replica string, start, end time.Time) (LeaseDBState, error)
+	// ListLeases returns the current lease state of every known cluster.
+	ListLeases(ctx context.Context) ([]LeaseDBState, error)
 }
 
 type leaseClientDB struct {
@@ -120,6 +123,24 @@ func (l *leaseClientDB) GetPastLeaseInfo(ctx context.Context, cluster, replica s
 	return dbState, nil
 }
 
+func (l *leaseClientDB) ListLeases(ctx context.Context) ([]LeaseDBState, error) {
+	rows, err := l.dbConn.Query(ctx, listLeasesSQL)
+	if err != nil {
+		return nil, fmt.Errorf("could not list leases: %w", err)
+	}
+	defer rows.Close()
+
+	var leases []LeaseDBState
+	for rows.Next() {
+		dbState := LeaseDBState{}
+		if err = rows.Scan(&dbState.Cluster, &dbState.Leader, &dbState.LeaseStart, &dbState.LeaseUntil); err != nil {
+			return nil, fmt.Errorf("could not list leases: %w", err)
+		}
+		leases = append(leases, dbState)
+	}
+	return leases, rows.Err()
+}
+
 func (l *leaseClientDB) readLeaseState(ctx context.Context, cluster string) (LeaseDBState, error) {
 	dbState := LeaseDBState{Cluster: cluster}
 	row := l.dbConn.QueryRow(ctx, latestLeaseStateSQL, cluster)
@@ -0,0 +1,54 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ha
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/prometheus/common/model"
+)
+
+// Config holds the names of the external labels that identify the Prometheus
+// HA cluster and replica a series was sent from.
+type Config struct {
+	ClusterLabel string
+	ReplicaLabel string
+}
+
+// ParseFlags parses the configuration flags specific to Prometheus HA.
+func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
+	fs.StringVar(&cfg.ClusterLabel, "metrics.high-availability.cluster-label", ClusterNameLabel, "Name of the external label that identifies the Prometheus HA cluster.")
+	fs.StringVar(&cfg.ReplicaLabel, "metrics.high-availability.replica-label", ReplicaNameLabel, "Name of the external label that identifies the replica within a Prometheus HA cluster. "+
+		"This label is dropped from the ingested series.")
+	return cfg
+}
+
+func Validate(cfg *Config) error {
+	cluster, replica := cfg.Labels()
+	if !model.LabelName(cluster).IsValid() {
+		return fmt.Errorf("invalid HA cluster label name: %q", cluster)
+	}
+	if !model.LabelName(replica).IsValid() {
+		return fmt.Errorf("invalid HA replica label name: %q", replica)
+	}
+	if cluster == replica {
+		return fmt.Errorf("HA cluster and replica labels must be different, both are set to %q", cluster)
+	}
+	return nil
+}
+
+// Labels returns the cluster and replica label names, falling back to
+// the defaults for the ones which are not set.
+func (cfg Config) Labels() (cluster, replica string) {
+	cluster, replica = cfg.ClusterLabel, cfg.ReplicaLabel
+	if cluster == "" {
+		cluster = ClusterNameLabel
+	}
+	if replica == "" {
+		replica = ReplicaNameLabel
+	}
+	return cluster, replica
+}
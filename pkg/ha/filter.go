@@ -13,40 +13,119 @@ import (
 	"github.com/timescale/promscale/pkg/prompb"
 )
 
-const ReplicaNameLabel = "__replica__"
-const ClusterNameLabel = "cluster"
+const (
+	// ReplicaNameLabel is the default name of the label identifying the
+	// replica within a Prometheus HA cluster.
+	ReplicaNameLabel = "__replica__"
+	// ClusterNameLabel is the default name of the label identifying the
+	// Prometheus HA cluster.
+	ClusterNameLabel = "cluster"
+)
 
 // Filter is a HA filter which filters data based on lease information it
 // gets from the lease service.
 type Filter struct {
-	service *Service
+	service      *Service
+	clusterLabel string
+	replicaLabel string
 }
 
-// NewFilter creates a new Filter based on the provided Service.
+// NewFilter creates a new Filter based on the provided Service which
+// uses the default cluster and replica labels.
 func NewFilter(service *Service) *Filter {
+	return NewFilterWithConfig(service, Config{})
+}
+
+// NewFilterWithConfig creates a new Filter based on the provided Service
+// which identifies the cluster and replica using the configured labels.
+func NewFilterWithConfig(service *Service, cfg Config) *Filter {
+	cluster, replica := cfg.Labels()
 	return &Filter{
-		service: service,
+		service:      service,
+		clusterLabel: cluster,
+		replicaLabel: replica,
 	}
 }
 
+// seriesGroup holds the indexes of the series in a write request
+// that were sent by the same replica of a Prometheus HA cluster.
+type seriesGroup struct {
+	cluster string
+	replica string
+	indexes []int
+}
+
 // FilterData validates and filters timeseries based on lease info from the service.
 // When Prometheus & Promscale are running HA mode the below FilterData is used
 // to validate leader replica samples & ha_locks in TimescaleDB.
+// A single write request can contain series from multiple clusters, e.g. when
+// they are federated through one remote-write queue, so the leases are checked
+// separately for every cluster and replica found in the request.
 func (h *Filter) Process(_ *http.Request, wr *prompb.WriteRequest) error {
-	defer finalFiltering(wr)
+	defer h.finalFiltering(wr)
 	tts := wr.Timeseries
 	if len(tts) == 0 {
 		return nil
 	}
 
-	clusterName, replicaName := haLabels(tts[0].Labels)
+	groups := h.groupSeries(tts)
+	for _, g := range groups {
+		if err := h.validateClusterLabels(g.cluster, g.replica); err != nil {
+			return err
+		}
+	}
 
-	if err := validateClusterLabels(clusterName, replicaName); err != nil {
-		return err
+	if len(groups) == 1 {
+		return h.processGroup(wr, groups[0].cluster, groups[0].replica)
 	}
 
+	for _, g := range groups {
+		groupReq := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, len(g.indexes))}
+		for i, idx := range g.indexes {
+			groupReq.Timeseries[i] = tts[idx]
+		}
+		if err := h.processGroup(groupReq, g.cluster, g.replica); err != nil {
+			return err
+		}
+		// processGroup either filters the samples in place or truncates the
+		// series of the group when none of them should be inserted.
+		for i, idx := range g.indexes {
+			if i < len(groupReq.Timeseries) {
+				tts[idx].Samples = groupReq.Timeseries[i].Samples
+				continue
+			}
+			tts[idx].Samples = tts[idx].Samples[:0]
+		}
+	}
+	return nil
+}
+
+// groupSeries groups the series by their cluster and replica labels,
+// keeping the order in which the groups first appear in the request.
+func (h *Filter) groupSeries(tts []prompb.TimeSeries) []*seriesGroup {
+	var (
+		groups  []*seriesGroup
+		byLabel = make(map[[2]string]*seriesGroup)
+	)
+	for i := range tts {
+		cluster, replica := h.haLabels(tts[i].Labels)
+		key := [2]string{cluster, replica}
+		g, ok := byLabel[key]
+		if !ok {
+			g = &seriesGroup{cluster: cluster, replica: replica}
+			byLabel[key] = g
+			groups = append(groups, g)
+		}
+		g.indexes = append(g.indexes, i)
+	}
+	return groups
+}
+
+// processGroup filters the samples of a write request which only contains
+// series from the given cluster and replica.
+func (h *Filter) processGroup(wr *prompb.WriteRequest, clusterName, replicaName string) error {
 	// find samples time range
-	minTUnix, maxTUnix := findDataTimeRange(tts)
+	minTUnix, maxTUnix := findDataTimeRange(wr.Timeseries)
 
 	minT := model.Time(minTUnix).Time()
 	maxT := model.Time(maxTUnix).Time()
@@ -155,24 +234,24 @@ func filterOutSampleRange(wr *prompb.WriteRequest, timeStartIncl, timeEndExcl in
 // out any instances without any samples. If the timeseries does contain samples,
 // it filters out the HA replica labels so it won't create different series
 // based on that label value.
-func finalFiltering(wr *prompb.WriteRequest) {
+func (h *Filter) finalFiltering(wr *prompb.WriteRequest) {
 	numAccepted := 0
 	for i := range wr.Timeseries {
 		t := &wr.Timeseries[i]
 		if len(t.Samples) == 0 {
 			continue
 		}
-		wr.Timeseries[numAccepted] = *t
-		numAccepted++
-		// Drop __replica__ labelSet from samples,
+		// Drop replica labelSet from samples,
 		// we don't want samples from the same Prometheus
 		// HA set to become different series.
 		for ind, value := range t.Labels {
-			if value.Name == ReplicaNameLabel {
+			if value.Name == h.replicaLabel {
 				t.Labels = append(t.Labels[:ind], t.Labels[ind+1:]...)
 				break
 			}
 		}
+		wr.Timeseries[numAccepted] = *t
+		numAccepted++
 	}
 	for j := numAccepted; j < len(wr.Timeseries); j++ {
 		wr.Timeseries[j] = prompb.TimeSeries{}
@@ -208,33 +287,33 @@ func findDataTimeRange(tts []prompb.TimeSeries) (minTUnix int64, maxTUnix int64)
 	return minTUnix, maxTUnix
 }
 
-func haLabels(labels []prompb.Label) (cluster, replica string) {
+func (h *Filter) haLabels(labels []prompb.Label) (cluster, replica string) {
 	for _, label := range labels {
-		if label.Name == ClusterNameLabel {
+		if label.Name == h.clusterLabel {
 			cluster = label.Value
-		} else if label.Name == ReplicaNameLabel {
+		} else if label.Name == h.replicaLabel {
 			replica = label.Value
 		}
 	}
 	return cluster, replica
 }
 
-func validateClusterLabels(cluster, replica string) error {
+func (h *Filter) validateClusterLabels(cluster, replica string) error {
 	if cluster == "" && replica == "" {
 		return fmt.Errorf("HA enabled, but both %s and %s labels are empty",
-			ClusterNameLabel,
-			ReplicaNameLabel,
+			h.clusterLabel,
+			h.replicaLabel,
 		)
 	} else if cluster == "" {
 		return fmt.Errorf("HA enabled, but %s label is empty; %s set to: %s",
-			ClusterNameLabel,
-			ReplicaNameLabel,
+			h.clusterLabel,
+			h.replicaLabel,
 			replica,
 		)
 	} else if replica == "" {
 		return fmt.Errorf("HA enabled, but %s label is empty; %s set to: %s",
-			ReplicaNameLabel,
-			ClusterNameLabel,
+			h.replicaLabel,
+			h.clusterLabel,
 			cluster,
 		)
 	}
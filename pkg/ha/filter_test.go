@@ -562,3 +562,65 @@ func TestFilterSamples(t *testing.T) {
 	}
 
 }
+
+func TestHaFilterMixedClusters(t *testing.T) {
+	leaseStart := time.Unix(1, 0)
+	leaseUntil := leaseStart.Add(2 * time.Second)
+	inLeaseTimestamp := leaseStart.Add(time.Second).UnixNano() / 1000000
+
+	service := MockNewHAService()
+	SetLeaderInMockService(service, []client.LeaseDBState{
+		{Cluster: "east", Leader: "replica1", LeaseStart: leaseStart, LeaseUntil: leaseUntil},
+		{Cluster: "west", Leader: "replica1", LeaseStart: leaseStart, LeaseUntil: leaseUntil},
+	})
+	h := NewFilterWithConfig(service, Config{ClusterLabel: "prometheus", ReplicaLabel: "prometheus_replica"})
+
+	series := func(cluster, replica string, value float64) prompb.TimeSeries {
+		labels := []prompb.Label{
+			{Name: model.MetricNameLabelName, Value: "test"},
+			{Name: "prometheus", Value: cluster},
+		}
+		if replica != "" {
+			labels = append(labels, prompb.Label{Name: "prometheus_replica", Value: replica})
+		}
+		return prompb.TimeSeries{
+			Labels:  labels,
+			Samples: []prompb.Sample{{Timestamp: inLeaseTimestamp, Value: value}},
+		}
+	}
+
+	wr := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			series("east", "replica1", 1),
+			series("west", "replica2", 2),
+			series("east", "replica1", 3),
+			series("west", "replica1", 4),
+		},
+	}
+	if err := h.Process(nil, wr); err != nil {
+		t.Fatalf("Process() returned unexpected error: %s", err.Error())
+	}
+
+	wanted := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			series("east", "", 1),
+			series("east", "", 3),
+			series("west", "", 4),
+		},
+	}
+	if !reflect.DeepEqual(wanted, wr) {
+		t.Fatalf("unexpected result from Process:\ngot\n%+v\nwant\n%+v\n", wr, wanted)
+	}
+
+	wr = &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			series("east", "replica1", 1),
+			series("west", "", 2),
+		},
+	}
+	err := h.Process(nil, wr)
+	expectedErr := "HA enabled, but prometheus_replica label is empty; prometheus set to: west"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Process() error = %v, wanted %s", err, expectedErr)
+	}
+}
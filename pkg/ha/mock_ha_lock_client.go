@@ -7,6 +7,7 @@ package ha
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/timescale/promscale/pkg/ha/client"
@@ -53,16 +54,35 @@ func (m *mockLockClient) TryChangeLeader(_ context.Context, cluster, newLeader s
 	if !exists {
 		return client.LeaseDBState{}, fmt.Errorf("no leader for %s, UpdateLease never called before TryChangeLeader", cluster)
 	}
+	current := locks[len(locks)-1]
+	if current.LeaseUntil.After(maxTime) {
+		return current, nil
+	}
 	lock := client.LeaseDBState{
 		Cluster:    cluster,
 		Leader:     newLeader,
-		LeaseStart: locks[0].LeaseUntil,
+		LeaseStart: current.LeaseUntil,
 		LeaseUntil: maxTime.Add(time.Second),
 	}
 	m.leadersPerCluster[cluster] = append(locks, lock)
 	return lock, nil
 }
 
+func (m *mockLockClient) ListLeases(_ context.Context) ([]client.LeaseDBState, error) {
+	clusters := make([]string, 0, len(m.leadersPerCluster))
+	for cluster := range m.leadersPerCluster {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	leases := make([]client.LeaseDBState, 0, len(clusters))
+	for _, cluster := range clusters {
+		locks := m.leadersPerCluster[cluster]
+		leases = append(leases, locks[len(locks)-1])
+	}
+	return leases, nil
+}
+
 func newMockLockClient() *mockLockClient {
 	return &mockLockClient{leadersPerCluster: make(map[string][]client.LeaseDBState)}
 }
@@ -22,7 +22,22 @@ const (
 	failedToUpdateLeaseErrFmt = "failed to update lease for cluster %s"
 )
 
-var ErrNoLeasesInRange = fmt.Errorf("no valid leases in range found")
+var (
+	ErrNoLeasesInRange  = fmt.Errorf("no valid leases in range found")
+	ErrUnknownCluster   = fmt.Errorf("unknown cluster")
+	ErrLeaderNotChanged = fmt.Errorf("leader not changed, the lease was extended by the current leader")
+)
+
+// ClusterState describes the lease of a cluster as stored in the database,
+// together with the data last seen for the cluster by this Promscale. The
+// local fields are nil if no data for the cluster was received yet.
+type ClusterState struct {
+	client.LeaseDBState
+	MaxTimeSeen           *time.Time
+	MaxTimeInstance       string
+	MaxTimeSeenLeader     *time.Time
+	RecentLeaderWriteTime *time.Time
+}
 
 // Service contains the lease state for all prometheus clusters
 // and logic for determining if a specific sample should
@@ -133,6 +148,83 @@ func (s *Service) getLocalClusterLease(clusterName, replicaName string, minT, ma
 	return newLease, nil
 }
 
+// Clusters returns the lease state of all the clusters known to the database.
+func (s *Service) Clusters(ctx context.Context) ([]ClusterState, error) {
+	leases, err := s.leaseClient.ListLeases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The lease itself is always taken from the database, the local state
+	// is only refreshed periodically.
+	clusters := make([]ClusterState, len(leases))
+	for i, dbState := range leases {
+		clusters[i] = ClusterState{LeaseDBState: dbState}
+		l, ok := s.state.Load(dbState.Cluster)
+		if !ok {
+			continue
+		}
+		snapshot := l.(*state.Lease).Snapshot()
+		clusters[i].MaxTimeSeen = timeOrNil(snapshot.MaxTimeSeen)
+		clusters[i].MaxTimeInstance = snapshot.MaxTimeInstance
+		clusters[i].MaxTimeSeenLeader = timeOrNil(snapshot.MaxTimeSeenLeader)
+		clusters[i].RecentLeaderWriteTime = timeOrNil(snapshot.RecentLeaderWriteTime)
+	}
+	return clusters, nil
+}
+
+// ChangeLeader forces the leader of the cluster to be changed to newLeader when
+// the current lease expires. It is meant for maintenance, e.g. draining one of
+// the Prometheus replicas. ErrLeaderNotChanged is returned if the current leader
+// extended its lease before the change could be applied.
+func (s *Service) ChangeLeader(ctx context.Context, cluster, newLeader string) (client.LeaseDBState, error) {
+	var (
+		newState client.LeaseDBState
+		err      error
+	)
+	if l, ok := s.state.Load(cluster); ok {
+		lease := l.(*state.Lease)
+		if current := lease.Snapshot().LeaseDBState; current.Leader == newLeader {
+			return current, nil
+		}
+		newState, err = lease.ForceLeader(newLeader)
+	} else {
+		// No data seen for the cluster by this Promscale, use the database state.
+		newState, err = s.changeLeaderInDB(ctx, cluster, newLeader)
+	}
+	if err != nil {
+		return newState, err
+	}
+	if newState.Leader != newLeader {
+		return newState, ErrLeaderNotChanged
+	}
+	log.Info("msg", "HA leader changed manually", "cluster", cluster, "leader", newLeader, "lease_start", newState.LeaseStart, "lease_until", newState.LeaseUntil)
+	return newState, nil
+}
+
+func (s *Service) changeLeaderInDB(ctx context.Context, cluster, newLeader string) (client.LeaseDBState, error) {
+	leases, err := s.leaseClient.ListLeases(ctx)
+	if err != nil {
+		return client.LeaseDBState{}, err
+	}
+	for _, dbState := range leases {
+		if dbState.Cluster != cluster {
+			continue
+		}
+		if dbState.Leader == newLeader {
+			return dbState, nil
+		}
+		return s.leaseClient.TryChangeLeader(ctx, cluster, newLeader, dbState.LeaseUntil)
+	}
+	return client.LeaseDBState{}, ErrUnknownCluster
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 func (s *Service) GetBackfillLeaseRange(start, end time.Time, cluster string, replica string) (time.Time, time.Time, error) {
 	state, err := s.leaseClient.GetPastLeaseInfo(context.Background(), cluster, replica, start, end)
 	if err == client.ErrNoPastLease {
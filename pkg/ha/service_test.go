@@ -0,0 +1,150 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ha
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/ha/client"
+)
+
+func TestServiceClusters(t *testing.T) {
+	service := MockNewHAService()
+	leaseStart := time.Unix(1, 0)
+	leaseUntil := leaseStart.Add(time.Minute)
+	SetLeaderInMockService(service, []client.LeaseDBState{
+		{Cluster: "b", Leader: "replica1", LeaseStart: leaseStart, LeaseUntil: leaseUntil},
+		{Cluster: "a", Leader: "replica2", LeaseStart: leaseStart, LeaseUntil: leaseUntil},
+	})
+
+	maxT := leaseStart.Add(10 * time.Second)
+	allowed, _, err := service.CheckLease(leaseStart, maxT, "b", "replica1")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	clusters, err := service.Clusters(context.Background())
+	require.NoError(t, err)
+	require.Len(t, clusters, 2)
+
+	require.Equal(t, client.LeaseDBState{Cluster: "a", Leader: "replica2", LeaseStart: leaseStart, LeaseUntil: leaseUntil}, clusters[0].LeaseDBState)
+	require.Nil(t, clusters[0].MaxTimeSeen)
+	require.Nil(t, clusters[0].RecentLeaderWriteTime)
+
+	require.Equal(t, "b", clusters[1].Cluster)
+	require.Equal(t, "replica1", clusters[1].Leader)
+	require.Equal(t, maxT, *clusters[1].MaxTimeSeen)
+	require.Equal(t, "replica1", clusters[1].MaxTimeInstance)
+	require.Equal(t, maxT, *clusters[1].MaxTimeSeenLeader)
+	require.NotNil(t, clusters[1].RecentLeaderWriteTime)
+}
+
+func TestServiceChangeLeader(t *testing.T) {
+	leaseStart := time.Unix(1, 0)
+	leaseUntil := leaseStart.Add(time.Minute)
+	newService := func() *Service {
+		service := MockNewHAService()
+		SetLeaderInMockService(service, []client.LeaseDBState{
+			{Cluster: "cluster", Leader: "replica1", LeaseStart: leaseStart, LeaseUntil: leaseUntil},
+		})
+		return service
+	}
+
+	testCases := []struct {
+		name        string
+		seenLocally bool
+		cluster     string
+		newLeader   string
+		expected    client.LeaseDBState
+		expectedErr error
+	}{
+		{
+			name:      "change leader of a cluster known locally",
+			cluster:   "cluster",
+			newLeader: "replica2",
+			expected: client.LeaseDBState{
+				Cluster:    "cluster",
+				Leader:     "replica2",
+				LeaseStart: leaseUntil,
+				LeaseUntil: leaseUntil.Add(time.Second),
+			},
+			seenLocally: true,
+		},
+		{
+			name:      "change leader of a cluster known only in the database",
+			cluster:   "cluster",
+			newLeader: "replica2",
+			expected: client.LeaseDBState{
+				Cluster:    "cluster",
+				Leader:     "replica2",
+				LeaseStart: leaseUntil,
+				LeaseUntil: leaseUntil.Add(time.Second),
+			},
+		},
+		{
+			name:      "replica is already the leader",
+			cluster:   "cluster",
+			newLeader: "replica1",
+			expected: client.LeaseDBState{
+				Cluster:    "cluster",
+				Leader:     "replica1",
+				LeaseStart: leaseStart,
+				LeaseUntil: leaseUntil,
+			},
+			seenLocally: true,
+		},
+		{
+			name:        "unknown cluster",
+			cluster:     "unknown",
+			newLeader:   "replica2",
+			expectedErr: ErrUnknownCluster,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			service := newService()
+			if c.seenLocally {
+				_, _, err := service.CheckLease(leaseStart, leaseStart.Add(time.Second), "cluster", "replica1")
+				require.NoError(t, err)
+			}
+
+			newState, err := service.ChangeLeader(context.Background(), c.cluster, c.newLeader)
+			if c.expectedErr != nil {
+				require.ErrorIs(t, err, c.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, newState)
+
+			clusters, err := service.Clusters(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, c.expected, clusters[0].LeaseDBState)
+		})
+	}
+}
+
+func TestServiceChangeLeaderLeaseExtended(t *testing.T) {
+	service := MockNewHAService()
+	leaseStart := time.Unix(1, 0)
+	leaseUntil := leaseStart.Add(time.Minute)
+	SetLeaderInMockService(service, []client.LeaseDBState{
+		{Cluster: "cluster", Leader: "replica1", LeaseStart: leaseStart, LeaseUntil: leaseUntil},
+	})
+	_, _, err := service.CheckLease(leaseStart, leaseStart.Add(time.Second), "cluster", "replica1")
+	require.NoError(t, err)
+
+	// The leader extends its lease after the local state was read.
+	SetLeaderInMockService(service, []client.LeaseDBState{
+		{Cluster: "cluster", Leader: "replica1", LeaseStart: leaseStart, LeaseUntil: leaseUntil.Add(time.Minute)},
+	})
+
+	newState, err := service.ChangeLeader(context.Background(), "cluster", "replica2")
+	require.ErrorIs(t, err, ErrLeaderNotChanged)
+	require.Equal(t, "replica1", newState.Leader)
+}
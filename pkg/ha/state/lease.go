@@ -170,6 +170,44 @@ func (l *Lease) changeLeader(cluster string, leader string, maxTimeSeen time.Tim
 	return nil
 }
 
+// ForceLeader hands the lease over to newLeader when the current lease expires,
+// regardless of the data seen from the replicas. The change is applied through
+// the same database check as TryChangeLeader, so it only succeeds if the lease
+// was not extended in the meantime. The resulting lease state is returned.
+func (l *Lease) ForceLeader(newLeader string) (client.LeaseDBState, error) {
+	l._mu.RLock()
+	cluster := l.state.Cluster
+	leaseUntil := l.state.LeaseUntil
+	l._mu.RUnlock()
+
+	if err := l.changeLeader(cluster, newLeader, leaseUntil); err != nil {
+		return client.LeaseDBState{}, err
+	}
+	return l.Snapshot().LeaseDBState, nil
+}
+
+// Snapshot is a point in time copy of a Lease.
+type Snapshot struct {
+	client.LeaseDBState
+	MaxTimeSeen           time.Time
+	MaxTimeInstance       string
+	MaxTimeSeenLeader     time.Time
+	RecentLeaderWriteTime time.Time
+}
+
+// Snapshot returns a consistent copy of the lease state.
+func (l *Lease) Snapshot() Snapshot {
+	l._mu.RLock()
+	defer l._mu.RUnlock()
+	return Snapshot{
+		LeaseDBState:          l.state,
+		MaxTimeSeen:           l.MaxTimeSeen,
+		MaxTimeInstance:       l.MaxTimeInstance,
+		MaxTimeSeenLeader:     l.MaxTimeSeenLeader,
+		RecentLeaderWriteTime: l.RecentLeaderWriteTime,
+	}
+}
+
 // UpdateMaxSeenTime updates the maximum data time seen by the current leader,
 // the maximum data time seen by any Prometheus instance/replica, and writes the
 // current wall time of when the current leader last sent data samples.
@@ -1,6 +1,8 @@
 package jaeger
 
 import (
+	"net/http"
+
 	"github.com/gorilla/mux"
 	jaegerQueryApp "github.com/jaegertracing/jaeger/cmd/query/app"
 	jaegerQueryService "github.com/jaegertracing/jaeger/cmd/query/app/querysvc"
@@ -13,7 +15,10 @@ import (
 func ExtendQueryAPIs(r *mux.Router, conn pgxconn.PgxConn, reader *store.Store) {
 	handler := jaegerQueryApp.NewAPIHandler(
 		jaegerQueryService.NewQueryService(reader, reader, jaegerQueryService.QueryServiceOptions{}),
+		// Jaeger tenancy stays disabled: the tenant is read from the TENANT header by the
+		// Promscale router, and the store restricts every read to the tenants of the request.
 		tenancy.NewManager(&tenancy.Options{Enabled: false}),
 	)
 	handler.RegisterRoutes(r)
+	r.Path(ServiceGraphPath).Methods(http.MethodGet).HandlerFunc(serviceGraphHandler(reader))
 }
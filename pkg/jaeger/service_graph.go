@@ -0,0 +1,208 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package jaeger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/timescale/promscale/pkg/jaeger/store"
+	"github.com/timescale/promscale/pkg/log"
+)
+
+const (
+	// ServiceGraphPath is the path of the service graph endpoint, next to the
+	// /api/dependencies endpoint of the Jaeger HTTP API.
+	ServiceGraphPath = "/api/service-graph"
+
+	defaultServiceGraphLookback = time.Hour
+)
+
+// ServiceGraphReader is the trace storage backing the service graph endpoint.
+type ServiceGraphReader interface {
+	GetServiceGraph(ctx context.Context, endTs time.Time, lookback time.Duration) (*store.ServiceGraph, error)
+}
+
+var _ ServiceGraphReader = (*store.Store)(nil)
+
+// Frame is a Grafana data frame in its JSON representation.
+type Frame struct {
+	Schema FrameSchema `json:"schema"`
+	Data   FrameData   `json:"data"`
+}
+
+type FrameSchema struct {
+	Name   string       `json:"name"`
+	Meta   FrameMeta    `json:"meta"`
+	Fields []FrameField `json:"fields"`
+}
+
+type FrameMeta struct {
+	PreferredVisualisationType string `json:"preferredVisualisationType"`
+}
+
+type FrameField struct {
+	Name   string                 `json:"name"`
+	Type   string                 `json:"type"`
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+type FrameData struct {
+	Values [][]interface{} `json:"values"`
+}
+
+// ServiceGraphResponse is the response of the service graph endpoint: the nodes and
+// edges frames of Grafana's node graph panel.
+type ServiceGraphResponse struct {
+	Frames []Frame `json:"frames"`
+}
+
+// column is a field of a frame with a function returning its value for each row.
+type column[T any] struct {
+	field FrameField
+	value func(T) interface{}
+}
+
+func newFrame[T any](name string, columns []column[T], rows []T) Frame {
+	f := Frame{
+		Schema: FrameSchema{Name: name, Meta: FrameMeta{PreferredVisualisationType: "nodeGraph"}},
+		Data:   FrameData{Values: make([][]interface{}, len(columns))},
+	}
+	for i, c := range columns {
+		f.Schema.Fields = append(f.Schema.Fields, c.field)
+		values := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, c.value(row))
+		}
+		f.Data.Values[i] = values
+	}
+	return f
+}
+
+func stringField(name string) FrameField {
+	return FrameField{Name: name, Type: "string"}
+}
+
+func numberField(name, displayName, unit string) FrameField {
+	config := map[string]interface{}{"displayName": displayName}
+	if unit != "" {
+		config["unit"] = unit
+	}
+	return FrameField{Name: name, Type: "number", Config: config}
+}
+
+func arcField(name, displayName, color string) FrameField {
+	return FrameField{Name: name, Type: "number", Config: map[string]interface{}{
+		"displayName": displayName,
+		"color":       map[string]interface{}{"mode": "fixed", "fixedColor": color},
+	}}
+}
+
+func ratio(a, b uint64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+func milliseconds(seconds float64) float64 {
+	return seconds * 1000
+}
+
+var nodeColumns = []column[store.ServiceGraphNode]{
+	{stringField("id"), func(n store.ServiceGraphNode) interface{} { return n.Service }},
+	{stringField("title"), func(n store.ServiceGraphNode) interface{} { return n.Service }},
+	{numberField("mainstat", "Requests", ""), func(n store.ServiceGraphNode) interface{} { return n.Requests }},
+	{numberField("secondarystat", "p95 latency", "ms"), func(n store.ServiceGraphNode) interface{} { return milliseconds(n.Latency.P95) }},
+	{arcField("arc__success", "Success", "green"), func(n store.ServiceGraphNode) interface{} {
+		if n.Requests == 0 {
+			return 0
+		}
+		return 1 - ratio(n.Errors, n.Requests)
+	}},
+	{arcField("arc__failed", "Errors", "red"), func(n store.ServiceGraphNode) interface{} { return ratio(n.Errors, n.Requests) }},
+	{numberField("detail__errors", "Errors", ""), func(n store.ServiceGraphNode) interface{} { return n.Errors }},
+	{numberField("detail__p50", "p50 latency", "ms"), func(n store.ServiceGraphNode) interface{} { return milliseconds(n.Latency.P50) }},
+	{numberField("detail__p95", "p95 latency", "ms"), func(n store.ServiceGraphNode) interface{} { return milliseconds(n.Latency.P95) }},
+	{numberField("detail__p99", "p99 latency", "ms"), func(n store.ServiceGraphNode) interface{} { return milliseconds(n.Latency.P99) }},
+}
+
+var edgeColumns = []column[store.ServiceGraphEdge]{
+	{stringField("id"), func(e store.ServiceGraphEdge) interface{} { return e.Client + "->" + e.Server }},
+	{stringField("source"), func(e store.ServiceGraphEdge) interface{} { return e.Client }},
+	{stringField("target"), func(e store.ServiceGraphEdge) interface{} { return e.Server }},
+	{numberField("mainstat", "Requests", ""), func(e store.ServiceGraphEdge) interface{} { return e.Requests }},
+	{numberField("secondarystat", "Errors", ""), func(e store.ServiceGraphEdge) interface{} { return e.Errors }},
+	{numberField("detail__client_p50", "Client p50 latency", "ms"), func(e store.ServiceGraphEdge) interface{} { return milliseconds(e.ClientLatency.P50) }},
+	{numberField("detail__client_p95", "Client p95 latency", "ms"), func(e store.ServiceGraphEdge) interface{} { return milliseconds(e.ClientLatency.P95) }},
+	{numberField("detail__client_p99", "Client p99 latency", "ms"), func(e store.ServiceGraphEdge) interface{} { return milliseconds(e.ClientLatency.P99) }},
+	{numberField("detail__server_p50", "Server p50 latency", "ms"), func(e store.ServiceGraphEdge) interface{} { return milliseconds(e.ServerLatency.P50) }},
+	{numberField("detail__server_p95", "Server p95 latency", "ms"), func(e store.ServiceGraphEdge) interface{} { return milliseconds(e.ServerLatency.P95) }},
+	{numberField("detail__server_p99", "Server p99 latency", "ms"), func(e store.ServiceGraphEdge) interface{} { return milliseconds(e.ServerLatency.P99) }},
+}
+
+// NewServiceGraphResponse converts the service graph into the frames of Grafana's node graph panel.
+func NewServiceGraphResponse(graph *store.ServiceGraph) ServiceGraphResponse {
+	return ServiceGraphResponse{Frames: []Frame{
+		newFrame("nodes", nodeColumns, graph.Nodes),
+		newFrame("edges", edgeColumns, graph.Edges),
+	}}
+}
+
+// parseMillis parses a parameter in milliseconds, like the endTs and lookback parameters of /api/dependencies.
+func parseMillis(r *http.Request, name string) (int64, bool, error) {
+	s := r.FormValue(name)
+	if s == "" {
+		return 0, false, nil
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return ms, true, nil
+}
+
+// serviceGraphHandler returns the service graph over the lookback period (1h by default) before endTs
+// (now by default), both in milliseconds.
+func serviceGraphHandler(reader ServiceGraphReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endTs := time.Now()
+		ms, ok, err := parseMillis(r, "endTs")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			endTs = time.UnixMilli(ms)
+		}
+		lookback := defaultServiceGraphLookback
+		ms, ok, err = parseMillis(r, "lookback")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			if ms <= 0 {
+				http.Error(w, "lookback must be positive", http.StatusBadRequest)
+				return
+			}
+			lookback = time.Duration(ms) * time.Millisecond
+		}
+
+		graph, err := reader.GetServiceGraph(r.Context(), endTs, lookback)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(NewServiceGraphResponse(graph)); err != nil {
+			log.Error("msg", "failed to write the service graph response", "err", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package jaeger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/jaeger/store"
+)
+
+type mockServiceGraphReader struct {
+	graph    *store.ServiceGraph
+	endTs    time.Time
+	lookback time.Duration
+}
+
+func (m *mockServiceGraphReader) GetServiceGraph(_ context.Context, endTs time.Time, lookback time.Duration) (*store.ServiceGraph, error) {
+	m.endTs = endTs
+	m.lookback = lookback
+	return m.graph, nil
+}
+
+func TestServiceGraphHandler(t *testing.T) {
+	reader := &mockServiceGraphReader{graph: &store.ServiceGraph{
+		Nodes: []store.ServiceGraphNode{
+			{Service: "backend", Requests: 4, Errors: 1, Latency: store.Latency{P50: 0.01, P95: 0.02, P99: 0.03}},
+			{Service: "frontend"},
+		},
+		Edges: []store.ServiceGraphEdge{
+			{Client: "frontend", Server: "backend", Requests: 4, Errors: 1, ClientLatency: store.Latency{P50: 0.011, P95: 0.021, P99: 0.031}, ServerLatency: store.Latency{P50: 0.01, P95: 0.02, P99: 0.03}},
+		},
+	}}
+	router := mux.NewRouter()
+	router.Path(ServiceGraphPath).Methods(http.MethodGet).HandlerFunc(serviceGraphHandler(reader))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ServiceGraphPath+"?endTs=1000000&lookback=60000", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, time.UnixMilli(1000000), reader.endTs)
+	require.Equal(t, time.Minute, reader.lookback)
+
+	var resp struct {
+		Frames []struct {
+			Schema struct {
+				Name   string `json:"name"`
+				Fields []struct {
+					Name string `json:"name"`
+				} `json:"fields"`
+			} `json:"schema"`
+			Data struct {
+				Values [][]interface{} `json:"values"`
+			} `json:"data"`
+		} `json:"frames"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Frames, 2)
+
+	column := func(frame int, name string) []interface{} {
+		for i, f := range resp.Frames[frame].Schema.Fields {
+			if f.Name == name {
+				return resp.Frames[frame].Data.Values[i]
+			}
+		}
+		t.Fatalf("field %s not found", name)
+		return nil
+	}
+	require.Equal(t, "nodes", resp.Frames[0].Schema.Name)
+	require.Equal(t, []interface{}{"backend", "frontend"}, column(0, "id"))
+	require.Equal(t, []interface{}{4.0, 0.0}, column(0, "mainstat"))
+	require.Equal(t, []interface{}{0.75, 0.0}, column(0, "arc__success"))
+	require.Equal(t, []interface{}{0.25, 0.0}, column(0, "arc__failed"))
+	require.Equal(t, []interface{}{30.0, 0.0}, column(0, "detail__p99"))
+
+	require.Equal(t, "edges", resp.Frames[1].Schema.Name)
+	require.Equal(t, []interface{}{"frontend->backend"}, column(1, "id"))
+	require.Equal(t, []interface{}{"frontend"}, column(1, "source"))
+	require.Equal(t, []interface{}{"backend"}, column(1, "target"))
+	require.Equal(t, []interface{}{1.0}, column(1, "secondarystat"))
+	require.Equal(t, []interface{}{21.0}, column(1, "detail__client_p95"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ServiceGraphPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, time.Hour, reader.lookback)
+
+	for _, query := range []string{"?endTs=abc", "?lookback=0", "?lookback=1h"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ServiceGraphPath+query, nil))
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
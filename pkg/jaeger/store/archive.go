@@ -0,0 +1,163 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+const (
+	// archiveTraceTimeRangeSQL selects the archived trace. The archive tables are
+	// regular tables, so there is no need to restrict the time range of the spans.
+	archiveTraceTimeRangeSQL = `
+		SELECT
+			s.trace_id,
+			'-infinity'::timestamptz as time_low,
+			'infinity'::timestamptz as time_high
+		FROM _ps_trace.archive_span s
+		WHERE
+			s.trace_id = $1
+		LIMIT 1
+	`
+
+	// archiveSpanSQLFormat copies a span with its events and links into the archive
+	// tables, and returns the number of spans found. Spans which are already archived
+	// are left untouched. The start time of the span is only used to limit the chunks
+	// to scan, so it is matched with some tolerance for its precision.
+	archiveSpanSQLFormat = `
+	WITH source AS (
+		SELECT s.trace_id, s.span_id, s.start_time
+		FROM _ps_trace.span s
+		WHERE
+			s.trace_id = $1 AND s.span_id = $2
+			AND s.start_time >= $3::timestamptz - interval '1 second'
+			AND s.start_time <= $3::timestamptz + interval '1 second'
+			AND %s
+	), archived_span AS (
+		INSERT INTO _ps_trace.archive_span (
+			trace_id, span_id, parent_span_id, operation_id, start_time, end_time, trace_state,
+			span_tags, dropped_tags_count, event_time, dropped_events_count, dropped_link_count,
+			status_code, status_message, instrumentation_lib_id, resource_tags,
+			resource_dropped_tags_count, resource_schema_url_id)
+		SELECT
+			s.trace_id, s.span_id, s.parent_span_id, s.operation_id, s.start_time, s.end_time, s.trace_state,
+			s.span_tags, s.dropped_tags_count, s.event_time, s.dropped_events_count, s.dropped_link_count,
+			s.status_code, s.status_message, s.instrumentation_lib_id, s.resource_tags,
+			s.resource_dropped_tags_count, s.resource_schema_url_id
+		FROM _ps_trace.span s
+		INNER JOIN source src ON (s.trace_id = src.trace_id AND s.span_id = src.span_id AND s.start_time = src.start_time)
+		ON CONFLICT DO NOTHING
+	), archived_events AS (
+		INSERT INTO _ps_trace.archive_event (time, trace_id, span_id, event_nbr, name, tags, dropped_tags_count)
+		SELECT e.time, e.trace_id, e.span_id, e.event_nbr, e.name, e.tags, e.dropped_tags_count
+		FROM _ps_trace.event e
+		INNER JOIN source src ON (e.trace_id = src.trace_id AND e.span_id = src.span_id)
+		ON CONFLICT DO NOTHING
+	), archived_links AS (
+		INSERT INTO _ps_trace.archive_link (
+			trace_id, span_id, span_start_time, linked_trace_id, linked_span_id, link_nbr,
+			trace_state, tags, dropped_tags_count)
+		SELECT
+			lk.trace_id, lk.span_id, lk.span_start_time, lk.linked_trace_id, lk.linked_span_id, lk.link_nbr,
+			lk.trace_state, lk.tags, lk.dropped_tags_count
+		FROM _ps_trace.link lk
+		INNER JOIN source src ON (lk.trace_id = src.trace_id AND lk.span_id = src.span_id AND lk.span_start_time = src.start_time)
+		ON CONFLICT DO NOTHING
+	)
+	SELECT count(*) FROM source
+	`
+)
+
+var archiveTables = traceTables{span: "_ps_trace.archive_span", event: "_ps_trace.archive_event", link: "_ps_trace.archive_link"}
+
+// errArchiveNotSupported is returned by the archive reader for anything else than
+// fetching a trace, which is all Jaeger needs from an archive storage.
+var errArchiveNotSupported = fmt.Errorf("not supported by the archive storage")
+
+func (b *Builder) getArchiveTraceQuery(traceID model.TraceID, tenants *tenancy.TenantFilter) (string, []interface{}, error) {
+	traceUUID, err := getUUIDFromTraceID(traceID)
+	if err != nil {
+		return "", nil, fmt.Errorf("TraceID to UUID conversion: %w", err)
+	}
+	query, params := b.completeTraceQueryFrom(archiveTables, archiveTraceTimeRangeSQL, []interface{}{traceUUID}, tenants)
+	return query, params, nil
+}
+
+func getArchiveTrace(ctx context.Context, builder *Builder, conn pgxconn.PgxConn, traceID model.TraceID, tenants *tenancy.TenantFilter) (*model.Trace, error) {
+	query, params, err := builder.getArchiveTraceQuery(traceID, tenants)
+	if err != nil {
+		return nil, fmt.Errorf("get archive trace query: %w", err)
+	}
+	return querySingleTrace(ctx, conn, query, params)
+}
+
+func archiveSpanQuery(span *model.Span, tenants *tenancy.TenantFilter) (string, []interface{}, error) {
+	traceUUID, err := getUUIDFromTraceID(span.TraceID)
+	if err != nil {
+		return "", nil, fmt.Errorf("TraceID to UUID conversion: %w", err)
+	}
+	params := []interface{}{traceUUID, int64(span.SpanID), span.StartTime}
+	tenantQual, params := tenantClause("s", tenants, params)
+	return fmt.Sprintf(archiveSpanSQLFormat, tenantQual), params, nil
+}
+
+// archiveSpan copies the span, with its events and links, from the primary to the
+// archive tables. Jaeger archives a trace by writing the spans it has just read, so
+// the span must still be in the primary tables.
+func archiveSpan(ctx context.Context, conn pgxconn.PgxConn, span *model.Span, tenants *tenancy.TenantFilter) error {
+	query, params, err := archiveSpanQuery(span, tenants)
+	if err != nil {
+		return fmt.Errorf("archive span query: %w", err)
+	}
+	var found int64
+	if err = conn.QueryRow(ctx, query, params...).Scan(&found); err != nil {
+		return fmt.Errorf("archiving span: %w", err)
+	}
+	if found == 0 {
+		return fmt.Errorf("span %s of trace %s not found", span.SpanID, span.TraceID)
+	}
+	return nil
+}
+
+// archiveReader reads the traces from the archive tables.
+type archiveReader struct {
+	store *Store
+}
+
+func (r archiveReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	return r.store.GetArchiveTrace(ctx, traceID)
+}
+
+func (archiveReader) GetServices(context.Context) ([]string, error) {
+	return nil, errArchiveNotSupported
+}
+
+func (archiveReader) GetOperations(context.Context, spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return nil, errArchiveNotSupported
+}
+
+func (archiveReader) FindTraces(context.Context, *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	return nil, errArchiveNotSupported
+}
+
+func (archiveReader) FindTraceIDs(context.Context, *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return nil, errArchiveNotSupported
+}
+
+// archiveWriter copies the spans into the archive tables.
+type archiveWriter struct {
+	store *Store
+}
+
+func (w archiveWriter) WriteSpan(ctx context.Context, span *model.Span) error {
+	return w.store.WriteArchiveSpan(ctx, span)
+}
@@ -0,0 +1,67 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+func TestGetArchiveTraceQuery(t *testing.T) {
+	traceID := model.NewTraceID(0, 1)
+	traceUUID, err := getUUIDFromTraceID(traceID)
+	require.NoError(t, err)
+	builder := NewBuilder(&DefaultConfig)
+
+	query, params, err := builder.getArchiveTraceQuery(traceID, &tenancy.TenantFilter{Tenants: []string{"a"}})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{traceUUID, "a"}, params)
+	for _, table := range []string{archiveTables.span, archiveTables.event, archiveTables.link} {
+		require.Contains(t, query, table)
+	}
+	for _, table := range []string{primaryTables.span, primaryTables.event, primaryTables.link} {
+		require.NotContains(t, query, table+" ")
+	}
+	require.Contains(t, query, fmt.Sprintf("tag_op_equals_text('%s', $2)", tenancy.TenantLabelKey))
+
+	query, _, err = builder.getTraceQuery(traceID, nil)
+	require.NoError(t, err)
+	require.NotContains(t, query, "archive")
+}
+
+func TestArchiveSpanQuery(t *testing.T) {
+	start := time.Unix(1000, 0)
+	span := &model.Span{TraceID: model.NewTraceID(0, 1), SpanID: model.NewSpanID(2), StartTime: start}
+	traceUUID, err := getUUIDFromTraceID(span.TraceID)
+	require.NoError(t, err)
+
+	query, params, err := archiveSpanQuery(span, nil)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{traceUUID, int64(2), start}, params)
+	require.Equal(t, fmt.Sprintf(archiveSpanSQLFormat, "TRUE"), query)
+
+	query, params, err = archiveSpanQuery(span, &tenancy.TenantFilter{Tenants: []string{"a", "b"}})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{traceUUID, int64(2), start, "a", "b"}, params)
+	require.True(t, strings.Contains(query, "$4") && strings.Contains(query, "$5"))
+}
+
+func TestArchiveCapabilities(t *testing.T) {
+	store := New(nil, ingestor.ReadOnlyIngestor{}, &DefaultConfig)
+	require.NotNil(t, store.ArchiveSpanReader())
+	require.Nil(t, store.ArchiveSpanWriter())
+
+	_, err := store.ArchiveSpanReader().GetServices(context.Background())
+	require.ErrorIs(t, err, errArchiveNotSupported)
+}
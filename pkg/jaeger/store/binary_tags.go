@@ -84,11 +84,18 @@ func encodeBinaryTags(span *model.Span) {
 		}
 	}
 
-	for i, tag := range span.Process.Tags {
+	encodeProcessBinaryTags(span.Process)
+}
+
+func encodeProcessBinaryTags(process *model.Process) {
+	if process == nil {
+		return
+	}
+	for i, tag := range process.Tags {
 		if !isBinaryTag(tag) {
 			continue
 		}
-		span.Process.Tags[i] = encodeBinaryTagToStr(tag)
+		process.Tags[i] = encodeBinaryTagToStr(tag)
 	}
 }
 
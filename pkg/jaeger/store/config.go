@@ -3,6 +3,8 @@ package store
 import (
 	"flag"
 	"time"
+
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
 const (
@@ -12,6 +14,9 @@ const (
 type Config struct {
 	MaxTraceDuration    time.Duration
 	StreamingSpanWriter bool
+	// TracesAuthorizer restricts the spans read by each query to the tenants of the request.
+	// It is nil if multi-tenancy is disabled.
+	TracesAuthorizer tenancy.TracesAuthorizer
 }
 
 var DefaultConfig = Config{
@@ -0,0 +1,79 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
+	"github.com/timescale/promscale/pkg/traceql"
+)
+
+// traceQLSubqueryFormat returns the time range of the traces with spans
+// matching a TraceQL query, in the format expected by findTraceSQLFormat.
+const traceQLSubqueryFormat = `
+	SELECT
+		trace_sub.trace_id, start_time_max - $%[1]d::interval as time_low, start_time_max + $%[1]d::interval as time_high
+	FROM (
+		SELECT
+			m.trace_id,
+			max(m.start_time) as start_time_max
+		FROM (%[2]s
+		) as m
+		GROUP BY m.trace_id
+	) as trace_sub
+	ORDER BY trace_sub.start_time_max DESC
+	`
+
+// TraceQLQuery finds the traces with spans matching a TraceQL expression.
+type TraceQLQuery struct {
+	Expr         traceql.SpansetExpr
+	StartTimeMin time.Time
+	StartTimeMax time.Time
+	NumTraces    int
+}
+
+func findTracesTraceQL(ctx context.Context, builder *Builder, conn pgxconn.PgxConn, q *TraceQLQuery, tenants *tenancy.TenantFilter) ([]*model.Trace, error) {
+	query, params, err := builder.findTracesTraceQLQuery(q, tenants)
+	if err != nil {
+		return nil, fmt.Errorf("building TraceQL query: %w", err)
+	}
+	rows, err := conn.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("querying traces error: %w query:\n%s", err, query)
+	}
+	defer rows.Close()
+
+	return scanTraces(rows)
+}
+
+func (b *Builder) findTracesTraceQLQuery(q *TraceQLQuery, tenants *tenancy.TenantFilter) (string, []interface{}, error) {
+	opts := traceql.Options{
+		StartTimeMin:     q.StartTimeMin,
+		StartTimeMax:     q.StartTimeMax,
+		MaxTraceDuration: b.cfg.MaxTraceDuration,
+	}
+	if tenants != nil {
+		opts.SpanFilter = func(alias string, params []interface{}) (string, []interface{}) {
+			return tenantClause(alias, tenants, params)
+		}
+	}
+	spans, params, err := traceql.ToSQL(q.Expr, opts, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	params = append(params, b.cfg.MaxTraceDuration)
+	subquery := fmt.Sprintf(traceQLSubqueryFormat, len(params), spans)
+	if q.NumTraces != 0 {
+		subquery += fmt.Sprintf(" LIMIT %d", q.NumTraces)
+	}
+	query, params := b.completeTraceQuery(subquery, params, tenants)
+	return query, params, nil
+}
@@ -0,0 +1,31 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/traceql"
+)
+
+func TestFindTracesTraceQLQuery(t *testing.T) {
+	expr, err := traceql.Parse(`{ status = error }`)
+	require.NoError(t, err)
+	start := time.Unix(1000, 0)
+
+	builder := NewBuilder(&Config{MaxTraceDuration: time.Hour})
+	query, params, err := builder.findTracesTraceQLQuery(&TraceQLQuery{Expr: expr, StartTimeMin: start, NumTraces: 20}, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, []interface{}{start, "error", time.Hour}, params)
+	query = strings.Join(strings.Fields(query), " ")
+	require.Contains(t, query, "WHERE s.start_time >= $1 AND s.status_code = $2")
+	require.Contains(t, query, "start_time_max - $3::interval as time_low, start_time_max + $3::interval as time_high")
+	require.Contains(t, query, "ORDER BY trace_sub.start_time_max DESC LIMIT 20 )")
+}
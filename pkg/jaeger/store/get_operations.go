@@ -12,6 +12,7 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
 const (
@@ -31,9 +32,16 @@ WHERE
 	)
 	AND %s
 `
+
+	// tenantOperationSQLFormat matches the operations with spans of the allowed tenants.
+	tenantOperationSQLFormat = `EXISTS (
+		SELECT 1
+		FROM _ps_trace.span s
+		WHERE s.operation_id = o.id AND %s
+	)`
 )
 
-func getOperations(ctx context.Context, conn pgxconn.PgxConn, query spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+func getOperations(ctx context.Context, conn pgxconn.PgxConn, query spanstore.OperationQueryParameters, tenants *tenancy.TenantFilter) ([]spanstore.Operation, error) {
 	var (
 		operationNames, spanKinds []string
 		operationsResp            []spanstore.Operation
@@ -49,6 +57,11 @@ func getOperations(ctx context.Context, conn pgxconn.PgxConn, query spanstore.Op
 		args = append(args, pgEnum)
 		kindQual = "o.span_kind = $2"
 	}
+	if tenants != nil {
+		var tenantQual string
+		tenantQual, args = tenantClause("s", tenants, args)
+		kindQual += " AND " + fmt.Sprintf(tenantOperationSQLFormat, tenantQual)
+	}
 
 	sqlQuery := fmt.Sprintf(getOperationsSQLFormat, kindQual)
 
@@ -0,0 +1,203 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+// serviceGraphEdgesSQLFormat returns the calls between parent and child spans of different services
+// which started in ($1, $2). A call fails if either span has an error status.
+const serviceGraphEdgesSQLFormat = `
+SELECT
+	coalesce((SELECT value #>> '{}' FROM _ps_trace.tag WHERE id = e.client_service_id AND key = 'service.name'), '') AS client_service,
+	coalesce((SELECT value #>> '{}' FROM _ps_trace.tag WHERE id = e.server_service_id AND key = 'service.name'), '') AS server_service,
+	e.requests,
+	e.errors,
+	e.client_latency,
+	e.server_latency
+FROM (
+	SELECT
+		parent_op.service_name_id AS client_service_id,
+		child_op.service_name_id AS server_service_id,
+		count(*) AS requests,
+		count(*) FILTER (WHERE parent.status_code = 'STATUS_CODE_ERROR' OR child.status_code = 'STATUS_CODE_ERROR') AS errors,
+		percentile_cont(ARRAY[0.5, 0.95, 0.99]) WITHIN GROUP (ORDER BY extract(epoch FROM parent.end_time - parent.start_time)) AS client_latency,
+		percentile_cont(ARRAY[0.5, 0.95, 0.99]) WITHIN GROUP (ORDER BY extract(epoch FROM child.end_time - child.start_time)) AS server_latency
+	FROM
+		_ps_trace.span child
+	INNER JOIN
+		_ps_trace.span parent ON (parent.span_id = child.parent_span_id AND parent.trace_id = child.trace_id)
+	INNER JOIN _ps_trace.operation child_op ON (child.operation_id = child_op.id)
+	INNER JOIN _ps_trace.operation parent_op ON (parent.operation_id = parent_op.id)
+	WHERE
+		child.start_time > $1 AND child.start_time < $2 AND
+		parent.start_time > $1 AND parent.start_time < $2 AND
+		parent_op.service_name_id != child_op.service_name_id AND
+		%s AND %s
+	GROUP BY parent_op.service_name_id, child_op.service_name_id
+) e`
+
+// serviceGraphNodesSQLFormat returns the requests received by each service from ($1, $2), that is
+// the spans which are either roots or children of a span of another service.
+const serviceGraphNodesSQLFormat = `
+SELECT
+	coalesce((SELECT value #>> '{}' FROM _ps_trace.tag WHERE id = n.service_id AND key = 'service.name'), '') AS service,
+	n.requests,
+	n.errors,
+	n.latency
+FROM (
+	SELECT
+		op.service_name_id AS service_id,
+		count(*) AS requests,
+		count(*) FILTER (WHERE s.status_code = 'STATUS_CODE_ERROR') AS errors,
+		percentile_cont(ARRAY[0.5, 0.95, 0.99]) WITHIN GROUP (ORDER BY extract(epoch FROM s.end_time - s.start_time)) AS latency
+	FROM
+		_ps_trace.span s
+	INNER JOIN _ps_trace.operation op ON (s.operation_id = op.id)
+	LEFT JOIN
+		_ps_trace.span parent ON (parent.span_id = s.parent_span_id AND parent.trace_id = s.trace_id AND
+			parent.start_time > $1 AND parent.start_time < $2 AND %s)
+	LEFT JOIN _ps_trace.operation parent_op ON (parent.operation_id = parent_op.id)
+	WHERE
+		s.start_time > $1 AND s.start_time < $2 AND
+		(parent_op.service_name_id IS NULL OR parent_op.service_name_id != op.service_name_id) AND
+		%s
+	GROUP BY op.service_name_id
+) n`
+
+// Latency holds latency percentiles in seconds.
+type Latency struct {
+	P50 float64
+	P95 float64
+	P99 float64
+}
+
+func newLatency(percentiles []float64) Latency {
+	if len(percentiles) != 3 {
+		return Latency{}
+	}
+	return Latency{P50: percentiles[0], P95: percentiles[1], P99: percentiles[2]}
+}
+
+// ServiceGraphNode holds the requests received by a service: its root spans and the
+// spans whose parent belongs to another service.
+type ServiceGraphNode struct {
+	Service  string
+	Requests uint64
+	Errors   uint64
+	Latency  Latency
+}
+
+// ServiceGraphEdge holds the calls from the spans of the client service to the spans
+// of the server service.
+type ServiceGraphEdge struct {
+	Client        string
+	Server        string
+	Requests      uint64
+	Errors        uint64
+	ClientLatency Latency
+	ServerLatency Latency
+}
+
+// ServiceGraph is the graph of the calls between services over a time range.
+type ServiceGraph struct {
+	Nodes []ServiceGraphNode
+	Edges []ServiceGraphEdge
+}
+
+// getServiceGraph returns the services and the calls between them, with request, error and latency statistics.
+func getServiceGraph(ctx context.Context, conn pgxconn.PgxConn, endTs time.Time, lookback time.Duration, tenants *tenancy.TenantFilter) (*ServiceGraph, error) {
+	startTs := endTs.Add(-1 * lookback)
+	edges, err := getServiceGraphEdges(ctx, conn, startTs, endTs, tenants)
+	if err != nil {
+		return nil, fmt.Errorf("fetching service graph edges: %w", err)
+	}
+	nodes, err := getServiceGraphNodes(ctx, conn, startTs, endTs, tenants)
+	if err != nil {
+		return nil, fmt.Errorf("fetching service graph nodes: %w", err)
+	}
+	return &ServiceGraph{Nodes: completeNodes(nodes, edges), Edges: edges}, nil
+}
+
+func getServiceGraphEdges(ctx context.Context, conn pgxconn.PgxConn, startTs, endTs time.Time, tenants *tenancy.TenantFilter) ([]ServiceGraphEdge, error) {
+	params := []interface{}{startTs, endTs}
+	var childQual, parentQual string
+	childQual, params = tenantClause("child", tenants, params)
+	parentQual, params = tenantClause("parent", tenants, params)
+
+	rows, err := conn.Query(ctx, fmt.Sprintf(serviceGraphEdgesSQLFormat, childQual, parentQual), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edges := make([]ServiceGraphEdge, 0)
+	for rows.Next() {
+		var (
+			e                            ServiceGraphEdge
+			clientLatency, serverLatency []float64
+		)
+		if err := rows.Scan(&e.Client, &e.Server, &e.Requests, &e.Errors, &clientLatency, &serverLatency); err != nil {
+			return nil, err
+		}
+		e.ClientLatency = newLatency(clientLatency)
+		e.ServerLatency = newLatency(serverLatency)
+		edges = append(edges, e)
+	}
+	return edges, rows.Err()
+}
+
+func getServiceGraphNodes(ctx context.Context, conn pgxconn.PgxConn, startTs, endTs time.Time, tenants *tenancy.TenantFilter) ([]ServiceGraphNode, error) {
+	params := []interface{}{startTs, endTs}
+	var spanQual, parentQual string
+	parentQual, params = tenantClause("parent", tenants, params)
+	spanQual, params = tenantClause("s", tenants, params)
+
+	rows, err := conn.Query(ctx, fmt.Sprintf(serviceGraphNodesSQLFormat, parentQual, spanQual), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := make([]ServiceGraphNode, 0)
+	for rows.Next() {
+		var (
+			n       ServiceGraphNode
+			latency []float64
+		)
+		if err := rows.Scan(&n.Service, &n.Requests, &n.Errors, &latency); err != nil {
+			return nil, err
+		}
+		n.Latency = newLatency(latency)
+		nodes = append(nodes, n)
+	}
+	return nodes, rows.Err()
+}
+
+// completeNodes adds the services of the edges which did not receive any request to the
+// nodes, and sorts the nodes by service.
+func completeNodes(nodes []ServiceGraphNode, edges []ServiceGraphEdge) []ServiceGraphNode {
+	services := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		services[n.Service] = struct{}{}
+	}
+	for _, e := range edges {
+		for _, service := range []string{e.Client, e.Server} {
+			if _, ok := services[service]; !ok {
+				services[service] = struct{}{}
+				nodes = append(nodes, ServiceGraphNode{Service: service})
+			}
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Service < nodes[j].Service })
+	return nodes
+}
@@ -0,0 +1,24 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLatency(t *testing.T) {
+	require.Equal(t, Latency{P50: 1, P95: 2, P99: 3}, newLatency([]float64{1, 2, 3}))
+	require.Equal(t, Latency{}, newLatency(nil))
+}
+
+func TestCompleteServiceGraphNodes(t *testing.T) {
+	nodes := completeNodes(
+		[]ServiceGraphNode{{Service: "frontend", Requests: 2}, {Service: "backend", Requests: 1}},
+		[]ServiceGraphEdge{{Client: "frontend", Server: "backend"}, {Client: "backend", Server: "db"}},
+	)
+	require.Equal(t, []ServiceGraphNode{{Service: "backend", Requests: 1}, {Service: "db"}, {Service: "frontend", Requests: 2}}, nodes)
+}
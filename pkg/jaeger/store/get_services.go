@@ -12,19 +12,39 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/pkg/errors"
 	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
-const getServicesSQL = `
+const (
+	getServicesSQLFormat = `
 SELECT
   array_agg(value#>>'{}' ORDER BY value)
 FROM
-	_ps_trace.tag
+	_ps_trace.tag t
 WHERE
-         key='service.name' and value IS NOT NULL`
+         key='service.name' and value IS NOT NULL AND %s`
 
-func getServices(ctx context.Context, conn pgxconn.PgxConn) ([]string, error) {
-	var pgServices pgtype.FlatArray[pgtype.Text]
-	if err := conn.QueryRow(ctx, getServicesSQL).Scan(&pgServices); err != nil {
+	// tenantServiceSQLFormat matches the services with spans of the allowed tenants.
+	tenantServiceSQLFormat = `EXISTS (
+		SELECT 1
+		FROM _ps_trace.operation o
+		INNER JOIN _ps_trace.span s ON (s.operation_id = o.id)
+		WHERE o.service_name_id = t.id AND %s
+	)`
+)
+
+func getServices(ctx context.Context, conn pgxconn.PgxConn, tenants *tenancy.TenantFilter) ([]string, error) {
+	var (
+		pgServices pgtype.FlatArray[pgtype.Text]
+		params     []interface{}
+		qual       = "TRUE"
+	)
+	if tenants != nil {
+		var tenantQual string
+		tenantQual, params = tenantClause("s", tenants, params)
+		qual = fmt.Sprintf(tenantServiceSQLFormat, tenantQual)
+	}
+	if err := conn.QueryRow(ctx, fmt.Sprintf(getServicesSQLFormat, qual), params...).Scan(&pgServices); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return []string{}, nil
 		}
@@ -0,0 +1,83 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+const (
+	getTagNamesSQLFormat = `
+SELECT
+	coalesce(array_agg(key ORDER BY key), array[]::text[])
+FROM
+	_ps_trace.tag_key k
+WHERE
+	%s`
+
+	getTagValuesSQLFormat = `
+SELECT
+	coalesce(array_agg(value#>>'{}' ORDER BY value), array[]::text[])
+FROM
+	_ps_trace.tag t
+WHERE
+	key = $1 AND value#>>'{}' IS NOT NULL AND %s`
+
+	// tenantTagNameSQLFormat matches the tag keys of the spans of the allowed tenants.
+	tenantTagNameSQLFormat = `EXISTS (
+		SELECT 1
+		FROM _ps_trace.span s
+		WHERE (s.span_tags ? k.id::text OR s.resource_tags ? k.id::text)
+			AND %s
+	)`
+
+	// tenantTagValueSQLFormat matches the tags of the spans of the allowed tenants.
+	tenantTagValueSQLFormat = `EXISTS (
+		SELECT 1
+		FROM _ps_trace.span s
+		WHERE (s.span_tags @> pg_catalog.jsonb_build_object(t.key_id, t.id) OR s.resource_tags @> pg_catalog.jsonb_build_object(t.key_id, t.id))
+			AND %s
+	)`
+)
+
+func getTagNames(ctx context.Context, conn pgxconn.PgxConn, tenants *tenancy.TenantFilter) ([]string, error) {
+	var (
+		names  pgtype.FlatArray[pgtype.Text]
+		params []interface{}
+		qual   = "TRUE"
+	)
+	if tenants != nil {
+		var tenantQual string
+		tenantQual, params = tenantClause("s", tenants, params)
+		qual = fmt.Sprintf(tenantTagNameSQLFormat, tenantQual)
+	}
+	if err := conn.QueryRow(ctx, fmt.Sprintf(getTagNamesSQLFormat, qual), params...).Scan(&names); err != nil {
+		return nil, fmt.Errorf("fetching tag names: %w", err)
+	}
+	return textArraytoStringArr(names)
+}
+
+func getTagValues(ctx context.Context, conn pgxconn.PgxConn, tagName string, tenants *tenancy.TenantFilter) ([]string, error) {
+	var (
+		values pgtype.FlatArray[pgtype.Text]
+		params = []interface{}{tagName}
+		qual   = "TRUE"
+	)
+	if tenants != nil {
+		var tenantQual string
+		tenantQual, params = tenantClause("s", tenants, params)
+		qual = fmt.Sprintf(tenantTagValueSQLFormat, tenantQual)
+	}
+	if err := conn.QueryRow(ctx, fmt.Sprintf(getTagValuesSQLFormat, qual), params...).Scan(&values); err != nil {
+		return nil, fmt.Errorf("fetching tag values: %w", err)
+	}
+	return textArraytoStringArr(values)
+}
@@ -10,14 +10,22 @@ import (
 
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
 	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
-func getTrace(ctx context.Context, builder *Builder, conn pgxconn.PgxConn, traceID model.TraceID) (*model.Trace, error) {
-	query, params, err := builder.getTraceQuery(traceID)
+func getTrace(ctx context.Context, builder *Builder, conn pgxconn.PgxConn, traceID model.TraceID, tenants *tenancy.TenantFilter) (*model.Trace, error) {
+	query, params, err := builder.getTraceQuery(traceID, tenants)
 	if err != nil {
 		return nil, fmt.Errorf("get trace query: %w", err)
 	}
+	return querySingleTrace(ctx, conn, query, params)
+}
+
+// querySingleTrace returns the trace returned by the query, or ErrTraceNotFound.
+func querySingleTrace(ctx context.Context, conn pgxconn.PgxConn, query string, params []interface{}) (*model.Trace, error) {
 	rows, err := conn.Query(ctx, query, params...)
 	if err != nil {
 		return nil, fmt.Errorf("querying traces: %w", err)
@@ -38,3 +46,30 @@ func getTrace(ctx context.Context, builder *Builder, conn pgxconn.PgxConn, trace
 	}
 
 }
+
+// getTraceOTLP returns the spans of a trace in the OTLP format, without going
+// through the Jaeger model.
+func getTraceOTLP(ctx context.Context, builder *Builder, conn pgxconn.PgxConn, traceID model.TraceID, tenants *tenancy.TenantFilter) (ptrace.Traces, error) {
+	traces := ptrace.NewTraces()
+	query, params, err := builder.getTraceQuery(traceID, tenants)
+	if err != nil {
+		return traces, fmt.Errorf("get trace query: %w", err)
+	}
+	rows, err := conn.Query(ctx, query, params...)
+	if err != nil {
+		return traces, fmt.Errorf("querying traces: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = ScanRow(rows, &traces); err != nil {
+			return traces, fmt.Errorf("error scanning trace: %w", err)
+		}
+	}
+	if rows.Err() != nil {
+		return traces, fmt.Errorf("trace row iterator: %w", rows.Err())
+	}
+	if traces.SpanCount() == 0 {
+		return traces, spanstore.ErrTraceNotFound
+	}
+	return traces, nil
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
 	"github.com/timescale/promscale/pkg/pgmodel/metrics"
 	"github.com/timescale/promscale/pkg/pgxconn"
+	"go.opentelemetry.io/collector/pdata/ptrace"
 )
 
 type Store struct {
@@ -46,6 +47,19 @@ func (p *Store) StreamingSpanWriter() spanstore.Writer {
 	return p
 }
 
+// ArchiveSpanReader returns the reader of the archived traces.
+func (p *Store) ArchiveSpanReader() spanstore.Reader {
+	return archiveReader{p}
+}
+
+// ArchiveSpanWriter returns the writer archiving traces, or nil if the store is read-only.
+func (p *Store) ArchiveSpanWriter() spanstore.Writer {
+	if _, readOnly := p.inserter.(ingestor.ReadOnlyIngestor); readOnly {
+		return nil
+	}
+	return archiveWriter{p}
+}
+
 func (p *Store) WriteSpan(ctx context.Context, span *model.Span) error {
 	traces, err := ProtoToTraces(span)
 	if err != nil {
@@ -70,7 +84,11 @@ func (p *Store) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Tra
 		delete(labels, "reason")
 		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
 	}()
-	res, err := getTrace(ctx, p.builder, p.conn, traceID)
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := getTrace(ctx, p.builder, p.conn, traceID, tenants)
 
 	if err != nil {
 		if !errors.Is(err, spanstore.ErrTraceNotFound) {
@@ -84,6 +102,83 @@ func (p *Store) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Tra
 	return res, nil
 }
 
+// GetTraceOTLP returns the trace in the OTLP format.
+func (p *Store) GetTraceOTLP(ctx context.Context, traceID model.TraceID) (ptrace.Traces, error) {
+	code := "5xx"
+	start := time.Now()
+	defer func() {
+		labels := prometheus.Labels{"type": "trace", "handler": "Get_Trace_OTLP", "code": code, "reason": ""}
+		metrics.Query.With(labels).Inc()
+		delete(labels, "reason")
+		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
+	}()
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return ptrace.NewTraces(), err
+	}
+	res, err := getTraceOTLP(ctx, p.builder, p.conn, traceID, tenants)
+
+	if err != nil {
+		if !errors.Is(err, spanstore.ErrTraceNotFound) {
+			err = logError(err)
+		}
+		return res, err
+	}
+
+	code = "2xx"
+	traceRequestsExec.Add(1)
+	return res, nil
+}
+
+// GetArchiveTrace returns the archived trace with the given ID.
+func (p *Store) GetArchiveTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	code := "5xx"
+	start := time.Now()
+	defer func() {
+		labels := prometheus.Labels{"type": "trace", "handler": "Get_Archive_Trace", "code": code, "reason": ""}
+		metrics.Query.With(labels).Inc()
+		delete(labels, "reason")
+		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
+	}()
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := getArchiveTrace(ctx, p.builder, p.conn, traceID, tenants)
+	if err != nil {
+		if !errors.Is(err, spanstore.ErrTraceNotFound) {
+			err = logError(err)
+		}
+		return nil, err
+	}
+
+	code = "2xx"
+	traceRequestsExec.Add(1)
+	return res, nil
+}
+
+// WriteArchiveSpan copies the span, with its events and links, into the archive
+// tables, which are exempt from the trace retention.
+func (p *Store) WriteArchiveSpan(ctx context.Context, span *model.Span) error {
+	code := "5xx"
+	start := time.Now()
+	defer func() {
+		labels := prometheus.Labels{"type": "trace", "handler": "Write_Archive_Span", "code": code, "reason": ""}
+		metrics.Query.With(labels).Inc()
+		delete(labels, "reason")
+		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
+	}()
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return err
+	}
+	if err = archiveSpan(ctx, p.conn, span, tenants); err != nil {
+		return logError(err)
+	}
+	code = "2xx"
+	return nil
+}
+
 func (p *Store) GetServices(ctx context.Context) ([]string, error) {
 	code := "5xx"
 	start := time.Now()
@@ -93,7 +188,11 @@ func (p *Store) GetServices(ctx context.Context) ([]string, error) {
 		delete(labels, "reason")
 		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
 	}()
-	res, err := getServices(ctx, p.conn)
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := getServices(ctx, p.conn, tenants)
 	if err != nil {
 		return nil, logError(err)
 	}
@@ -110,7 +209,11 @@ func (p *Store) GetOperations(ctx context.Context, query spanstore.OperationQuer
 		delete(labels, "reason")
 		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
 	}()
-	res, err := getOperations(ctx, p.conn, query)
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := getOperations(ctx, p.conn, query, tenants)
 	if err != nil {
 		return nil, logError(err)
 	}
@@ -127,7 +230,34 @@ func (p *Store) FindTraces(ctx context.Context, query *spanstore.TraceQueryParam
 		delete(labels, "reason")
 		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
 	}()
-	res, err := findTraces(ctx, p.builder, p.conn, query)
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := findTraces(ctx, p.builder, p.conn, query, tenants)
+	if err != nil {
+		return nil, logError(err)
+	}
+	code = "2xx"
+	traceRequestsExec.Add(1)
+	return res, nil
+}
+
+// FindTracesTraceQL returns the traces with spans matching a TraceQL query.
+func (p *Store) FindTracesTraceQL(ctx context.Context, query *TraceQLQuery) ([]*model.Trace, error) {
+	code := "5xx"
+	start := time.Now()
+	defer func() {
+		labels := prometheus.Labels{"type": "trace", "handler": "Find_Traces_TraceQL", "code": code, "reason": ""}
+		metrics.Query.With(labels).Inc()
+		delete(labels, "reason")
+		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
+	}()
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := findTracesTraceQL(ctx, p.builder, p.conn, query, tenants)
 	if err != nil {
 		return nil, logError(err)
 	}
@@ -145,7 +275,11 @@ func (p *Store) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryPar
 		delete(labels, "reason")
 		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
 	}()
-	res, err := findTraceIDs(ctx, p.builder, p.conn, query)
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := findTraceIDs(ctx, p.builder, p.conn, query, tenants)
 	if err != nil {
 		return nil, logError(err)
 	}
@@ -164,7 +298,11 @@ func (p *Store) GetDependencies(ctx context.Context, endTs time.Time, lookback t
 		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
 	}()
 
-	res, err := getDependencies(ctx, p.conn, endTs, lookback)
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := getDependencies(ctx, p.conn, endTs, lookback, tenants)
 	if err != nil {
 		return nil, logError(err)
 	}
@@ -173,6 +311,75 @@ func (p *Store) GetDependencies(ctx context.Context, endTs time.Time, lookback t
 	return res, nil
 }
 
+// GetServiceGraph returns the services and the calls between them over the lookback
+// period before endTs, with request, error and latency statistics.
+func (p *Store) GetServiceGraph(ctx context.Context, endTs time.Time, lookback time.Duration) (*ServiceGraph, error) {
+	code := "5xx"
+	start := time.Now()
+	defer func() {
+		labels := prometheus.Labels{"type": "trace", "handler": "Get_Service_Graph", "code": code, "reason": ""}
+		metrics.Query.With(labels).Inc()
+		delete(labels, "reason")
+		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
+	}()
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := getServiceGraph(ctx, p.conn, endTs, lookback, tenants)
+	if err != nil {
+		return nil, logError(err)
+	}
+	code = "2xx"
+	return res, nil
+}
+
+// GetTagNames returns the keys of all the span, resource and event tags. With
+// multi-tenancy, only the keys of the span and resource tags of the spans of the
+// allowed tenants are returned, like the tag values.
+func (p *Store) GetTagNames(ctx context.Context) ([]string, error) {
+	code := "5xx"
+	start := time.Now()
+	defer func() {
+		labels := prometheus.Labels{"type": "trace", "handler": "Get_Tag_Names", "code": code, "reason": ""}
+		metrics.Query.With(labels).Inc()
+		delete(labels, "reason")
+		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
+	}()
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := getTagNames(ctx, p.conn, tenants)
+	if err != nil {
+		return nil, logError(err)
+	}
+	code = "2xx"
+	return res, nil
+}
+
+// GetTagValues returns the values of the tag with the given key.
+func (p *Store) GetTagValues(ctx context.Context, tagName string) ([]string, error) {
+	code := "5xx"
+	start := time.Now()
+	defer func() {
+		labels := prometheus.Labels{"type": "trace", "handler": "Get_Tag_Values", "code": code, "reason": ""}
+		metrics.Query.With(labels).Inc()
+		delete(labels, "reason")
+		metrics.QueryDuration.With(labels).Observe(time.Since(start).Seconds())
+	}()
+	tenants, err := p.readTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := getTagValues(ctx, p.conn, tagName, tenants)
+	if err != nil {
+		return nil, logError(err)
+	}
+	code = "2xx"
+	return res, nil
+}
+
 func (p *Store) GetBuilder() *Builder {
 	return p.builder
 }
@@ -0,0 +1,65 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+// readTenants returns the tenants whose spans the request of ctx can read, or nil
+// if multi-tenancy is disabled.
+func (p *Store) readTenants(ctx context.Context) (*tenancy.TenantFilter, error) {
+	if p.builder.cfg.TracesAuthorizer == nil {
+		return nil, nil
+	}
+	filter, err := p.builder.cfg.TracesAuthorizer.ReadTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filter.AllowsAll() {
+		return nil, nil
+	}
+	return &filter, nil
+}
+
+// tenantClause returns a condition restricting the spans of the given table alias to
+// the tenants of the filter, which are stored in the __tenant__ resource tag. The
+// tenant names are appended to params.
+func tenantClause(alias string, tenants *tenancy.TenantFilter, params []interface{}) (string, []interface{}) {
+	if tenants == nil || tenants.AllowsAll() {
+		return "TRUE", params
+	}
+	hasTenant := fmt.Sprintf("_ps_trace.match_jsonb_path_exists(%s.resource_tags, ps_tag.tag_op_jsonb_path_exists('%s', '$'))", alias, tenancy.TenantLabelKey)
+
+	clauses := make([]string, 0, len(tenants.Tenants)+1)
+	if tenants.Tenants == nil {
+		clauses = append(clauses, hasTenant)
+	}
+	for _, tenant := range tenants.Tenants {
+		params = append(params, tenant)
+		clauses = append(clauses, fmt.Sprintf("_ps_trace.match_equals(%s.resource_tags, ps_tag.tag_op_equals_text('%s', $%d))", alias, tenancy.TenantLabelKey, len(params)))
+	}
+	if tenants.NonTenants {
+		clauses = append(clauses, "NOT "+hasTenant)
+	}
+	if len(clauses) == 0 {
+		return "FALSE", params
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", params
+}
+
+// restrictTenants only matches the spans of the given tenants.
+func (t *tagsInfo) restrictTenants(tenants *tenancy.TenantFilter) {
+	if tenants == nil {
+		return
+	}
+	var clause string
+	clause, t.params = tenantClause("s", tenants, t.params)
+	t.spanClauses = append(t.spanClauses, clause)
+}
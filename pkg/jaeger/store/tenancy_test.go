@@ -0,0 +1,89 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/tenancy"
+	"github.com/timescale/promscale/pkg/traceql"
+)
+
+func TestTenantClause(t *testing.T) {
+	const (
+		hasTenant = "_ps_trace.match_jsonb_path_exists(s.resource_tags, ps_tag.tag_op_jsonb_path_exists('__tenant__', '$'))"
+		isTenant  = "_ps_trace.match_equals(s.resource_tags, ps_tag.tag_op_equals_text('__tenant__', $%d))"
+	)
+	testCases := []struct {
+		name           string
+		tenants        *tenancy.TenantFilter
+		expectedClause string
+		expectedParams []interface{}
+	}{
+		{
+			name:           "multi-tenancy disabled",
+			expectedClause: "TRUE",
+			expectedParams: []interface{}{"param"},
+		},
+		{
+			name:           "all spans",
+			tenants:        &tenancy.TenantFilter{NonTenants: true},
+			expectedClause: "TRUE",
+			expectedParams: []interface{}{"param"},
+		},
+		{
+			name:           "any tenant",
+			tenants:        &tenancy.TenantFilter{},
+			expectedClause: "(" + hasTenant + ")",
+			expectedParams: []interface{}{"param"},
+		},
+		{
+			name:           "valid tenants and non-tenants",
+			tenants:        &tenancy.TenantFilter{Tenants: []string{"a", "b"}, NonTenants: true},
+			expectedClause: "(" + strings.Replace(isTenant, "%d", "2", 1) + " OR " + strings.Replace(isTenant, "%d", "3", 1) + " OR NOT " + hasTenant + ")",
+			expectedParams: []interface{}{"param", "a", "b"},
+		},
+		{
+			name:           "no valid tenants",
+			tenants:        &tenancy.TenantFilter{Tenants: []string{}},
+			expectedClause: "FALSE",
+			expectedParams: []interface{}{"param"},
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			clause, params := tenantClause("s", c.tenants, []interface{}{"param"})
+			require.Equal(t, c.expectedClause, clause)
+			require.Equal(t, c.expectedParams, params)
+		})
+	}
+}
+
+func TestTenantTraceQueries(t *testing.T) {
+	builder := NewBuilder(&Config{MaxTraceDuration: time.Hour})
+	tenants := &tenancy.TenantFilter{Tenants: []string{"tenant-a"}}
+
+	expr, err := traceql.Parse(`{ status = error }`)
+	require.NoError(t, err)
+	query, params, err := builder.findTracesTraceQLQuery(&TraceQLQuery{Expr: expr}, tenants)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"tenant-a", "error", time.Hour, "tenant-a"}, params)
+	query = strings.Join(strings.Fields(query), " ")
+	require.Contains(t, query, "WHERE (_ps_trace.match_equals(s.resource_tags, ps_tag.tag_op_equals_text('__tenant__', $1))) AND s.status_code = $2")
+	require.Contains(t, query, "AND s.start_time > trace_ids.time_low AND s.start_time < trace_ids.time_high AND (_ps_trace.match_equals(s.resource_tags, ps_tag.tag_op_equals_text('__tenant__', $4)))")
+
+	tInfo := &tagsInfo{}
+	tInfo.restrictTenants(tenants)
+	require.Equal(t, []interface{}{"tenant-a"}, tInfo.params)
+	require.Equal(t, []string{"(_ps_trace.match_equals(s.resource_tags, ps_tag.tag_op_equals_text('__tenant__', $1)))"}, tInfo.spanClauses)
+
+	tInfo = &tagsInfo{}
+	tInfo.restrictTenants(nil)
+	require.Empty(t, tInfo.spanClauses)
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
+
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
 const (
@@ -62,7 +64,7 @@ const (
 	// - Without GROUP BY https://explain.dalibo.com/plan/f09259cd21g57dh3
 	findTraceSQLFormat = `
 	WITH trace_ids AS (
-		%s
+		%[1]s
 	)
 	SELECT
 		complete_trace.*
@@ -99,7 +101,7 @@ const (
 			links_dropped_tags_count,
 			links_tags
 		FROM
-			_ps_trace.span s
+			%[3]s s
 		INNER JOIN
 			_ps_trace.operation o ON (s.operation_id = o.id)
 		LEFT JOIN
@@ -114,7 +116,7 @@ const (
 				array_agg(e.time ORDER BY e.event_nbr) event_times,
 				array_agg(e.dropped_tags_count ORDER BY e.event_nbr) event_dropped_tags_count,
 				array_agg(_ps_trace.tag_map_denormalize(e.tags) ORDER BY e.event_nbr) event_tags
-			FROM _ps_trace.event as e
+			FROM %[4]s as e
 			WHERE e.trace_id = s.trace_id AND e.span_id = s.span_id
 				AND e.time > trace_ids.time_low AND e.time < trace_ids.time_high
 		) as event ON (TRUE)
@@ -125,13 +127,14 @@ const (
 				array_agg(lk.trace_state ORDER BY lk.link_nbr) links_trace_states,
 				array_agg(lk.dropped_tags_count ORDER BY lk.link_nbr) links_dropped_tags_count,
 				array_agg(_ps_trace.tag_map_denormalize(lk.tags) ORDER BY lk.link_nbr) links_tags
-			FROM _ps_trace.link as lk
+			FROM %[5]s as lk
 			WHERE lk.trace_id = s.trace_id AND lk.span_id = s.span_id
 				AND lk.span_start_time > trace_ids.time_low AND lk.span_start_time < trace_ids.time_high
 		) as link ON (TRUE)
 		WHERE
 			s.trace_id = trace_ids.trace_id
 			AND s.start_time > trace_ids.time_low AND s.start_time < trace_ids.time_high
+			AND %[2]s
 		GROUP BY
 			s.trace_id,
 			s.span_id,
@@ -167,6 +170,15 @@ const (
 	TagEventName     = "event"
 )
 
+// traceTables are the tables storing the spans, events and links of traces.
+type traceTables struct {
+	span  string
+	event string
+	link  string
+}
+
+var primaryTables = traceTables{span: "_ps_trace.span", event: "_ps_trace.event", link: "_ps_trace.link"}
+
 type Builder struct {
 	cfg *Config
 }
@@ -175,9 +187,22 @@ func NewBuilder(cfg *Config) *Builder {
 	return &Builder{cfg}
 }
 
-func (b *Builder) findTracesQuery(q *spanstore.TraceQueryParameters, tInfo *tagsInfo) (string, []interface{}) {
+func (b *Builder) findTracesQuery(q *spanstore.TraceQueryParameters, tInfo *tagsInfo, tenants *tenancy.TenantFilter) (string, []interface{}) {
 	subquery, params := b.BuildTraceIDSubquery(q, tInfo)
-	return fmt.Sprintf(findTraceSQLFormat, subquery), params
+	return b.completeTraceQuery(subquery, params, tenants)
+}
+
+// completeTraceQuery returns the query fetching all the spans of the traces returned
+// by subquery, which belong to the given tenants.
+func (b *Builder) completeTraceQuery(subquery string, params []interface{}, tenants *tenancy.TenantFilter) (string, []interface{}) {
+	return b.completeTraceQueryFrom(primaryTables, subquery, params, tenants)
+}
+
+// completeTraceQueryFrom is completeTraceQuery reading the spans, events and links
+// from the given tables.
+func (b *Builder) completeTraceQueryFrom(tables traceTables, subquery string, params []interface{}, tenants *tenancy.TenantFilter) (string, []interface{}) {
+	tenantQual, params := tenantClause("s", tenants, params)
+	return fmt.Sprintf(findTraceSQLFormat, subquery, tenantQual, tables.span, tables.event, tables.link), params
 }
 
 func (b *Builder) findTraceIDsQuery(q *spanstore.TraceQueryParameters, tInfo *tagsInfo) (string, []interface{}) {
@@ -195,7 +220,7 @@ func getUUIDFromTraceID(traceID model.TraceID) (pgtype.UUID, error) {
 	return pgtype.UUID{Bytes: buf, Valid: true}, nil
 }
 
-func (b *Builder) getTraceQuery(traceID model.TraceID) (string, []interface{}, error) {
+func (b *Builder) getTraceQuery(traceID model.TraceID, tenants *tenancy.TenantFilter) (string, []interface{}, error) {
 	traceUUID, err := getUUIDFromTraceID(traceID)
 	if err != nil {
 		return "", nil, fmt.Errorf("TraceID to UUID conversion: %w", err)
@@ -204,7 +229,8 @@ func (b *Builder) getTraceQuery(traceID model.TraceID) (string, []interface{}, e
 	//it may seem silly to build a traceID subquery when we know the traceID
 	//but, this allows us to get the time range of the trace for the rest of the query.
 	subquery, params := b.BuildTraceTimeRangeSubqueryForTraceID(traceUUID)
-	return fmt.Sprintf(findTraceSQLFormat, subquery), params, nil
+	query, params := b.completeTraceQuery(subquery, params, tenants)
+	return query, params, nil
 }
 
 func (b *Builder) buildOperationSubquery(q *spanstore.TraceQueryParameters, tInfo *tagsInfo, params []interface{}) (string, []interface{}) {
@@ -107,27 +107,60 @@ func jSpanKindToInternal(spanKind string) string {
 }
 
 func ProtoToTraces(span *model.Span) (ptrace.Traces, error) {
-	encodeBinaryTags(span)
-	batches := []*model.Batch{
-		{
-			Spans: []*model.Span{span},
-		},
+	return BatchToTraces(&model.Batch{
+		Spans: []*model.Span{span},
+	})
+}
+
+// BatchToTraces translates a batch of Jaeger spans, as sent by Jaeger agents
+// and clients, to traces. Spans without a process belong to the process of
+// the batch.
+func BatchToTraces(batch *model.Batch) (ptrace.Traces, error) {
+	encodeProcessBinaryTags(batch.Process)
+	for _, span := range batch.Spans {
+		encodeBinaryTags(span)
 	}
-	traces, err := jaegertranslator.ProtoToTraces(batches)
+	traces, err := jaegertranslator.ProtoToTraces([]*model.Batch{batch})
 	if err != nil {
 		return ptrace.NewTraces(), err
 	}
 
 	// TODO: There's an open PR against the Jaeger translator that adds support
 	// for keeping the RefType. Once the PR is merged we can remove the following
-	// if condition and the addRefTypeAttributeToLinks function.
+	// loop and the addRefTypeAttributeToLinks function.
 	//
 	// https://github.com/open-telemetry/opentelemetry-collector-contrib/pull/14463
-	if len(span.References) > 1 {
-		links := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Links()
-		addRefTypeAttributeToLinks(span, links)
+	type spanKey struct {
+		traceID model.TraceID
+		spanID  model.SpanID
+	}
+	multipleRefs := make(map[spanKey]*model.Span)
+	for _, span := range batch.Spans {
+		if len(span.References) > 1 {
+			multipleRefs[spanKey{span.TraceID, span.SpanID}] = span
+		}
+	}
+	if len(multipleRefs) == 0 {
+		return traces, nil
+	}
+	resourceSpans := traces.ResourceSpans()
+	for i := 0; i < resourceSpans.Len(); i++ {
+		scopeSpans := resourceSpans.At(i).ScopeSpans()
+		for j := 0; j < scopeSpans.Len(); j++ {
+			spans := scopeSpans.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				otelSpan := spans.At(k)
+				traceID, spanID := otelSpan.TraceID(), otelSpan.SpanID()
+				key := spanKey{
+					traceID: model.NewTraceID(binary.BigEndian.Uint64(traceID[:8]), binary.BigEndian.Uint64(traceID[8:])),
+					spanID:  model.NewSpanID(binary.BigEndian.Uint64(spanID[:])),
+				}
+				if span, ok := multipleRefs[key]; ok {
+					addRefTypeAttributeToLinks(span, otelSpan.Links())
+				}
+			}
+		}
 	}
-
 	return traces, nil
 }
 
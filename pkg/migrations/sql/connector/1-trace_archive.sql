@@ -0,0 +1,17 @@
+-- The tables of the Jaeger archive storage. They have the columns of the span,
+-- event and link hypertables, but are regular tables so that neither the chunk
+-- retention nor the trace retention rules delete the archived traces.
+CREATE TABLE IF NOT EXISTS _ps_trace.archive_span (
+    LIKE _ps_trace.span INCLUDING DEFAULTS INCLUDING GENERATED INCLUDING CONSTRAINTS,
+    PRIMARY KEY (trace_id, span_id)
+);
+CREATE TABLE IF NOT EXISTS _ps_trace.archive_event (
+    LIKE _ps_trace.event INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+    PRIMARY KEY (trace_id, span_id, event_nbr)
+);
+CREATE TABLE IF NOT EXISTS _ps_trace.archive_link (
+    LIKE _ps_trace.link INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+    PRIMARY KEY (trace_id, span_id, link_nbr)
+);
+GRANT SELECT ON TABLE _ps_trace.archive_span, _ps_trace.archive_event, _ps_trace.archive_link TO prom_reader;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE _ps_trace.archive_span, _ps_trace.archive_event, _ps_trace.archive_link TO prom_writer;
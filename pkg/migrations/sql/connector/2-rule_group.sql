@@ -0,0 +1,11 @@
+-- The rule groups managed through the ruler API. Every group is stored as its
+-- YAML definition and belongs to a namespace.
+CREATE TABLE IF NOT EXISTS _ps_catalog.rule_group (
+    namespace text NOT NULL,
+    name text NOT NULL,
+    content text NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (namespace, name)
+);
+GRANT SELECT ON TABLE _ps_catalog.rule_group TO prom_reader;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE _ps_catalog.rule_group TO prom_writer;
@@ -0,0 +1,5 @@
+-- Rule groups belong to a namespace of a tenant. The groups created without
+-- multi-tenancy have an empty tenant.
+ALTER TABLE _ps_catalog.rule_group ADD COLUMN IF NOT EXISTS tenant text NOT NULL DEFAULT '';
+ALTER TABLE _ps_catalog.rule_group DROP CONSTRAINT IF EXISTS rule_group_pkey;
+ALTER TABLE _ps_catalog.rule_group ADD PRIMARY KEY (tenant, namespace, name);
@@ -0,0 +1,20 @@
+-- The state transitions of the alerts evaluated by the rule manager. A transition
+-- is identified by its time, rule group, alert labels and new state, so that the
+-- same transition recorded twice, such as by Promscale instances evaluating the
+-- same rules, is stored once.
+CREATE TABLE IF NOT EXISTS _ps_catalog.alert_history (
+    time timestamptz NOT NULL,
+    tenant text NOT NULL DEFAULT '',
+    rule_group_file text NOT NULL,
+    rule_group text NOT NULL,
+    alertname text NOT NULL,
+    state text NOT NULL,
+    labels jsonb NOT NULL,
+    annotations jsonb NOT NULL,
+    value double precision NOT NULL,
+    UNIQUE (time, rule_group_file, rule_group, labels, state)
+);
+CREATE INDEX IF NOT EXISTS alert_history_alertname_time_idx ON _ps_catalog.alert_history (alertname, time);
+CREATE INDEX IF NOT EXISTS alert_history_time_idx ON _ps_catalog.alert_history (time);
+GRANT SELECT ON TABLE _ps_catalog.alert_history TO prom_reader;
+GRANT SELECT, INSERT, DELETE ON TABLE _ps_catalog.alert_history TO prom_writer;
@@ -56,6 +56,8 @@ type Client struct {
 	metricCache  cache.MetricCache
 	labelsCache  cache.LabelsCache
 	seriesCache  cache.SeriesCache
+	exemplarPos  cache.PositionCache
+	authorizer   tenancy.Authorizer
 	closePool    bool
 	sigClose     chan struct{}
 	haService    *ha.Service
@@ -231,6 +233,12 @@ func NewClientWithPool(r prometheus.Registerer, cfg *Config, numCopiers int, wri
 		TracesBatchTimeout:      cfg.TracesBatchTimeout,
 		TracesMaxBatchSize:      cfg.TracesMaxBatchSize,
 		TracesBatchWorkers:      cfg.TracesBatchWorkers,
+		MetricsAdmission:        cfg.MetricsAdmission,
+		TracesAdmission:         cfg.TracesAdmission,
+		Cardinality:             cfg.Cardinality,
+		SampleWindow:            cfg.SampleWindow,
+		TracesPreprocessing:     cfg.TracesPreprocessing,
+		TracesAuthorizer:        mt.TracesAuthorizer(),
 	}
 
 	var (
@@ -271,6 +279,8 @@ func NewClientWithPool(r prometheus.Registerer, cfg *Config, numCopiers int, wri
 		metricCache: metricsCache,
 		labelsCache: labelsCache,
 		seriesCache: seriesCache,
+		exemplarPos: exemplarKeyPosCache,
+		authorizer:  mt,
 		sigClose:    sigClose,
 	}
 
@@ -387,3 +397,20 @@ func (c *Client) HealthCheck() error {
 func (c *Client) Queryable() promql.Queryable {
 	return c.queryable
 }
+
+// TenantQueryable returns a promql.Queryable that only reads the data of the given
+// tenant, sharing the caches of the Client.
+func (c *Client) TenantQueryable(tenant string) (promql.Queryable, error) {
+	rAuth, err := c.authorizer.TenantReadAuthorizer(tenant)
+	if err != nil {
+		return nil, err
+	}
+	labelsReader := lreader.NewLabelsReader(c.readerPool, c.labelsCache, rAuth)
+	dbQuerier := querier.NewQuerier(c.readerPool, c.metricCache, labelsReader, c.exemplarPos, rAuth)
+	return query.NewQueryable(dbQuerier, labelsReader), nil
+}
+
+// Authorizer returns the multi-tenancy authorizer of the Client.
+func (c *Client) Authorizer() tenancy.Authorizer {
+	return c.authorizer
+}
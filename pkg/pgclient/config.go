@@ -17,6 +17,7 @@ import (
 	"github.com/timescale/promscale/pkg/limits"
 	"github.com/timescale/promscale/pkg/log"
 	"github.com/timescale/promscale/pkg/pgmodel/cache"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
 	"github.com/timescale/promscale/pkg/pgmodel/ingestor/trace"
 	"github.com/timescale/promscale/pkg/version"
 )
@@ -47,6 +48,12 @@ type Config struct {
 	TracesBatchTimeout      time.Duration
 	TracesMaxBatchSize      int
 	TracesBatchWorkers      int
+	MetricsAdmission        ingestor.AdmissionConfig
+	TracesAdmission         ingestor.AdmissionConfig
+	Cardinality             ingestor.CardinalityConfig
+	SampleWindow            ingestor.SampleWindowConfig
+	TracesPreprocessingFile string
+	TracesPreprocessing     *ingestor.TracePreprocessingConfig
 }
 
 const (
@@ -107,13 +114,102 @@ func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
 	fs.IntVar(&cfg.TracesMaxBatchSize, "tracing.max-batch-size", trace.DefaultBatchSize, "Maximum size of trace batch that is written to DB")
 	fs.DurationVar(&cfg.TracesBatchTimeout, "tracing.batch-timeout", trace.DefaultBatchTimeout, "Timeout after new trace batch is created")
 	fs.IntVar(&cfg.TracesBatchWorkers, "tracing.batch-workers", trace.DefaultBatchWorkers, "Number of workers responsible for creating trace batches. Defaults to number of CPUs.")
+	parseAdmissionFlags(fs, &cfg.MetricsAdmission, "metrics")
+	parseAdmissionFlags(fs, &cfg.TracesAdmission, "tracing")
+	fs.Int64Var(&cfg.Cardinality.MaxSeriesPerMetric, "metrics.cardinality.max-series-per-metric", 0, "Maximum number of series of a single metric. "+
+		"Samples of new series over the limit are dropped, while samples of existing series are still ingested. Setting it to 0 disables the check.")
+	fs.IntVar(&cfg.Cardinality.MaxLabelsPerSeries, "metrics.cardinality.max-labels-per-series", 0, "Maximum number of labels, including the metric name, of a new series. "+
+		"Samples of new series with more labels are dropped. Setting it to 0 disables the check.")
+	fs.IntVar(&cfg.Cardinality.MaxLabelValueLength, "metrics.cardinality.max-label-value-length", 0, "Maximum length in bytes of a label value of a new series. "+
+		"Samples of new series with longer label values are dropped. Setting it to 0 disables the check.")
+	fs.DurationVar(&cfg.Cardinality.SeriesCountRefreshInterval, "metrics.cardinality.series-count-refresh-interval", ingestor.DefaultSeriesCountRefreshInterval, "How often the number of series of a metric "+
+		"is re-estimated from the database statistics when metrics.cardinality.max-series-per-metric is set.")
+	fs.DurationVar(&cfg.SampleWindow.Past, "metrics.sample-window.past", 0, "Maximum age of samples and exemplars, relative to the time the write is received. "+
+		"Older samples are dropped and the write responds with 400 Bad Request. Setting it to 0 disables the check.")
+	fs.DurationVar(&cfg.SampleWindow.Future, "metrics.sample-window.future", 0, "Maximum time in the future of samples and exemplars, relative to the time the write is received. "+
+		"Newer samples are dropped and the write responds with 400 Bad Request. Setting it to 0 disables the check.")
+	fs.StringVar(&cfg.TracesPreprocessingFile, "tracing.preprocessing.config-file", "", "Path to a YAML file with the rules dropping spans and traces, "+
+		"hashing, masking or removing attributes, and limiting the spans per second of each service before they are written to the database. "+
+		"Preprocessing is disabled if it is empty.")
 	return cfg
 }
 
+func parseAdmissionFlags(fs *flag.FlagSet, cfg *ingestor.AdmissionConfig, prefix string) {
+	fs.Float64Var(&cfg.MaxQueueUtilization, prefix+".backpressure.max-queue-utilization", 0, "Fraction of the ingest queue that can be filled before "+
+		"new writes are rejected with 429 Too Many Requests, e.g. 0.9. Setting it to 0 disables the check.")
+	fs.Int64Var(&cfg.MaxInflightBytes, prefix+".backpressure.max-inflight-bytes", 0, "Maximum size in bytes of write requests that can be ingested at once "+
+		"before new writes are rejected with 429 Too Many Requests. Setting it to 0 disables the check.")
+	fs.Float64Var(&cfg.MaxMemoryUtilization, prefix+".backpressure.max-memory-utilization", 0, "Fraction of the cache.memory-target that the heap can use "+
+		"before new writes are rejected with 429 Too Many Requests, e.g. 1.0. Setting it to 0 disables the check.")
+	fs.DurationVar(&cfg.RetryAfter, prefix+".backpressure.retry-after", ingestor.DefaultRetryAfter, "Delay sent in the Retry-After header to clients whose writes were rejected.")
+}
+
+func validateAdmission(cfg *ingestor.AdmissionConfig, prefix string, lcfg limits.Config) error {
+	if cfg.MaxQueueUtilization < 0 || cfg.MaxQueueUtilization > 1 {
+		return fmt.Errorf("%s.backpressure.max-queue-utilization must be in the [0,1] range", prefix)
+	}
+	if cfg.MaxInflightBytes < 0 {
+		return fmt.Errorf("%s.backpressure.max-inflight-bytes cannot be negative", prefix)
+	}
+	if cfg.MaxMemoryUtilization < 0 {
+		return fmt.Errorf("%s.backpressure.max-memory-utilization cannot be negative", prefix)
+	}
+	if cfg.RetryAfter < time.Second {
+		return fmt.Errorf("%s.backpressure.retry-after must be at least 1s", prefix)
+	}
+	cfg.MemoryTargetBytes = lcfg.TargetMemoryBytes
+	return nil
+}
+
+func validateCardinality(cfg ingestor.CardinalityConfig) error {
+	if cfg.MaxSeriesPerMetric < 0 {
+		return fmt.Errorf("metrics.cardinality.max-series-per-metric cannot be negative")
+	}
+	if cfg.MaxLabelsPerSeries < 0 {
+		return fmt.Errorf("metrics.cardinality.max-labels-per-series cannot be negative")
+	}
+	if cfg.MaxLabelValueLength < 0 {
+		return fmt.Errorf("metrics.cardinality.max-label-value-length cannot be negative")
+	}
+	if cfg.SeriesCountRefreshInterval <= 0 {
+		return fmt.Errorf("metrics.cardinality.series-count-refresh-interval must be positive")
+	}
+	return nil
+}
+
+func validateSampleWindow(cfg ingestor.SampleWindowConfig) error {
+	if cfg.Past < 0 {
+		return fmt.Errorf("metrics.sample-window.past cannot be negative")
+	}
+	if cfg.Future < 0 {
+		return fmt.Errorf("metrics.sample-window.future cannot be negative")
+	}
+	return nil
+}
+
 func Validate(cfg *Config, lcfg limits.Config) error {
 	if err := cfg.validateConnectionSettings(); err != nil {
 		return err
 	}
+	if err := validateAdmission(&cfg.MetricsAdmission, "metrics", lcfg); err != nil {
+		return err
+	}
+	if err := validateAdmission(&cfg.TracesAdmission, "tracing", lcfg); err != nil {
+		return err
+	}
+	if err := validateCardinality(cfg.Cardinality); err != nil {
+		return err
+	}
+	if err := validateSampleWindow(cfg.SampleWindow); err != nil {
+		return err
+	}
+	if cfg.TracesPreprocessingFile != "" {
+		preprocessing, err := ingestor.LoadTracePreprocessingConfig(cfg.TracesPreprocessingFile)
+		if err != nil {
+			return err
+		}
+		cfg.TracesPreprocessing = preprocessing
+	}
 	return cache.Validate(&cfg.CacheConfig, lcfg)
 }
 
@@ -0,0 +1,157 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"fmt"
+	"runtime/metrics"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+
+	"github.com/timescale/promscale/pkg/log"
+	pgMetrics "github.com/timescale/promscale/pkg/pgmodel/metrics"
+)
+
+const (
+	shedReasonQueue    = "queue_full"
+	shedReasonInflight = "inflight_bytes"
+	shedReasonMemory   = "memory"
+
+	heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+	DefaultRetryAfter = 5 * time.Second
+)
+
+// AdmissionConfig configures the admission control applied to a single kind
+// of ingest (metrics or traces) before any data is queued for the database.
+// A zero value of any of the limits disables the corresponding check, which
+// is the default of all of them.
+type AdmissionConfig struct {
+	// MaxQueueUtilization is the fraction (0, 1] of the ingest queue that may
+	// be filled before new writes are rejected.
+	MaxQueueUtilization float64
+	// MaxInflightBytes is the maximum size of the write requests that are
+	// being processed at once.
+	MaxInflightBytes int64
+	// MaxMemoryUtilization is the fraction of MemoryTargetBytes that the heap
+	// may use before new writes are rejected.
+	MaxMemoryUtilization float64
+	MemoryTargetBytes    uint64
+	// RetryAfter is the delay suggested to the clients whose writes were rejected.
+	RetryAfter time.Duration
+}
+
+// OverloadedError is returned when a write is rejected by the admission
+// control. Clients are expected to retry the write after RetryAfter.
+type OverloadedError struct {
+	Kind       string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("%s ingest is overloaded (%s), retry after %s", e.Kind, e.Reason, e.RetryAfter)
+}
+
+// admissionController decides whether a write request can be accepted based on
+// the ingest queue depth, the bytes of the requests currently being processed
+// and the memory used by the heap.
+type admissionController struct {
+	kind             string
+	cfg              AdmissionConfig
+	queueUtilization func() float64
+	heapBytes        func() uint64
+	inflightBytes    *atomic.Int64
+	lastLogged       *atomic.Int64
+}
+
+func newAdmissionController(kind string, cfg AdmissionConfig, queueUtilization func() float64) *admissionController {
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = DefaultRetryAfter
+	}
+	pgMetrics.IngestorInflightBytesLimit.With(prometheus.Labels{"type": kind}).Set(float64(cfg.MaxInflightBytes))
+	return &admissionController{
+		kind:             kind,
+		cfg:              cfg,
+		queueUtilization: queueUtilization,
+		heapBytes:        readHeapBytes,
+		inflightBytes:    atomic.NewInt64(0),
+		lastLogged:       atomic.NewInt64(0),
+	}
+}
+
+// admit checks whether a request of the given size can be accepted. On success
+// it returns a function that must be called once the request is done. A nil
+// controller admits every request.
+func (a *admissionController) admit(size int) (release func(), err error) {
+	if a == nil {
+		return func() {}, nil
+	}
+	reason := a.overloaded()
+	if reason == "" && !a.addInflight(int64(size)) {
+		reason = shedReasonInflight
+	}
+	if reason != "" {
+		a.reportShed(reason, size)
+		return nil, &OverloadedError{Kind: a.kind, Reason: reason, RetryAfter: a.cfg.RetryAfter}
+	}
+	pgMetrics.IngestorInflightBytes.With(prometheus.Labels{"type": a.kind}).Add(float64(size))
+	return func() {
+		a.inflightBytes.Sub(int64(size))
+		pgMetrics.IngestorInflightBytes.With(prometheus.Labels{"type": a.kind}).Sub(float64(size))
+	}, nil
+}
+
+func (a *admissionController) overloaded() string {
+	if a.cfg.MaxQueueUtilization > 0 && a.queueUtilization != nil && a.queueUtilization() >= a.cfg.MaxQueueUtilization {
+		return shedReasonQueue
+	}
+	if a.cfg.MaxMemoryUtilization > 0 && a.cfg.MemoryTargetBytes > 0 &&
+		float64(a.heapBytes()) >= float64(a.cfg.MemoryTargetBytes)*a.cfg.MaxMemoryUtilization {
+		return shedReasonMemory
+	}
+	return ""
+}
+
+// addInflight adds size to the in-flight bytes, unless that exceeds the limit.
+// The check and the addition are a single compare-and-swap, so that concurrent
+// requests cannot exceed the limit together.
+func (a *admissionController) addInflight(size int64) bool {
+	for {
+		inflight := a.inflightBytes.Load()
+		// A single request larger than the limit is still accepted when nothing
+		// else is in flight, otherwise it could never be ingested.
+		if a.cfg.MaxInflightBytes > 0 && inflight > 0 && inflight+size > a.cfg.MaxInflightBytes {
+			return false
+		}
+		if a.inflightBytes.CAS(inflight, inflight+size) {
+			return true
+		}
+	}
+}
+
+func (a *admissionController) reportShed(reason string, size int) {
+	pgMetrics.IngestorShedRequests.With(prometheus.Labels{"type": a.kind, "reason": reason}).Inc()
+	pgMetrics.IngestorShedBytes.With(prometheus.Labels{"type": a.kind, "reason": reason}).Add(float64(size))
+
+	// Shedding happens under heavy load, avoid flooding the logs.
+	now := time.Now().Unix()
+	last := a.lastLogged.Load()
+	if now-last < 10 || !a.lastLogged.CAS(last, now) {
+		return
+	}
+	log.Warn("msg", "rejecting writes, ingest is overloaded", "type", a.kind, "reason", reason, "retry_after", a.cfg.RetryAfter)
+}
+
+func readHeapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,134 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestAdmissionController(t *testing.T) {
+	testCases := []struct {
+		name             string
+		cfg              AdmissionConfig
+		queueUtilization float64
+		heapBytes        uint64
+		inflight         int
+		size             int
+		expectedReason   string
+	}{
+		{
+			name:             "all checks disabled",
+			queueUtilization: 1,
+			heapBytes:        1e9,
+			inflight:         1e9,
+			size:             1e9,
+		},
+		{
+			name:             "queue below the limit",
+			cfg:              AdmissionConfig{MaxQueueUtilization: 0.9},
+			queueUtilization: 0.5,
+		},
+		{
+			name:             "queue full",
+			cfg:              AdmissionConfig{MaxQueueUtilization: 0.9},
+			queueUtilization: 0.9,
+			expectedReason:   shedReasonQueue,
+		},
+		{
+			name:     "inflight bytes below the limit",
+			cfg:      AdmissionConfig{MaxInflightBytes: 100},
+			inflight: 50,
+			size:     50,
+		},
+		{
+			name:           "inflight bytes over the limit",
+			cfg:            AdmissionConfig{MaxInflightBytes: 100},
+			inflight:       50,
+			size:           51,
+			expectedReason: shedReasonInflight,
+		},
+		{
+			name: "single request bigger than the inflight limit",
+			cfg:  AdmissionConfig{MaxInflightBytes: 100},
+			size: 1000,
+		},
+		{
+			name:      "memory below the target",
+			cfg:       AdmissionConfig{MaxMemoryUtilization: 1, MemoryTargetBytes: 100},
+			heapBytes: 99,
+		},
+		{
+			name:           "memory over the target",
+			cfg:            AdmissionConfig{MaxMemoryUtilization: 0.5, MemoryTargetBytes: 100},
+			heapBytes:      50,
+			expectedReason: shedReasonMemory,
+		},
+		{
+			name:      "memory target unknown",
+			cfg:       AdmissionConfig{MaxMemoryUtilization: 0.5},
+			heapBytes: 50,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			a := newAdmissionController("metric", c.cfg, func() float64 { return c.queueUtilization })
+			a.heapBytes = func() uint64 { return c.heapBytes }
+			a.inflightBytes.Store(int64(c.inflight))
+
+			release, err := a.admit(c.size)
+			if c.expectedReason == "" {
+				require.NoError(t, err)
+				require.Equal(t, int64(c.inflight+c.size), a.inflightBytes.Load())
+				release()
+				require.Equal(t, int64(c.inflight), a.inflightBytes.Load())
+				return
+			}
+
+			var overloadedErr *OverloadedError
+			require.True(t, errors.As(err, &overloadedErr))
+			require.Equal(t, c.expectedReason, overloadedErr.Reason)
+			require.Equal(t, DefaultRetryAfter, overloadedErr.RetryAfter)
+			require.Equal(t, int64(c.inflight), a.inflightBytes.Load())
+		})
+	}
+}
+
+func TestAdmissionControllerRetryAfter(t *testing.T) {
+	a := newAdmissionController("trace", AdmissionConfig{MaxQueueUtilization: 0.1, RetryAfter: time.Minute}, func() float64 { return 1 })
+	_, err := a.admit(1)
+	require.Equal(t, &OverloadedError{Kind: "trace", Reason: shedReasonQueue, RetryAfter: time.Minute}, err)
+}
+
+func TestAdmissionControllerConcurrentInflight(t *testing.T) {
+	a := newAdmissionController("metric", AdmissionConfig{MaxInflightBytes: 100}, nil)
+	// Keep a request in flight, so that the others are checked against the limit.
+	release, err := a.admit(10)
+	require.NoError(t, err)
+	defer release()
+
+	var (
+		wg       sync.WaitGroup
+		admitted atomic.Int64
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.admit(10); err == nil {
+				admitted.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(9), admitted.Load())
+	require.Equal(t, int64(100), a.inflightBytes.Load())
+}
@@ -0,0 +1,351 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/cache"
+	pgMetrics "github.com/timescale/promscale/pkg/pgmodel/metrics"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgxconn"
+)
+
+const (
+	cardinalityReasonSeriesLimit      = "series_limit"
+	cardinalityReasonLabelCount       = "label_count"
+	cardinalityReasonLabelValueLength = "label_value_length"
+
+	// DefaultSeriesCountRefreshInterval is how often the number of series of
+	// a metric is re-read from the database.
+	DefaultSeriesCountRefreshInterval = 5 * time.Minute
+
+	// seriesCountSQL reads the row estimate of the series table of a metric
+	// from the catalog statistics, like prom_info.metric_stats, instead of
+	// scanning the table. The estimate is -1 until the table is analyzed.
+	seriesCountSQL = "SELECT greatest(_prom_catalog.safe_approximate_row_count(format('prom_data_series.%I', m.table_name)::regclass), 0) " +
+		"FROM _prom_catalog.metric m WHERE m.metric_name = $1"
+	// existingLabelIDsSQL is a read-only version of get_or_create_label_ids.
+	// Labels or key positions that do not exist are not returned.
+	existingLabelIDsSQL = `SELECT lkp.pos, l.id, l.key, l.value
+FROM ROWS FROM(unnest($2::text[]), unnest($3::text[])) AS kv(key, value)
+INNER JOIN _prom_catalog.label l ON (l.key = kv.key AND l.value = kv.value)
+INNER JOIN _prom_catalog.label_key_position lkp ON (lkp.metric_name = $1 AND lkp.key = kv.key)`
+	existingSeriesSQL = "SELECT series.id, l.nr FROM unnest($1::prom_api.label_array[]) WITH ORDINALITY l(elem, nr) " +
+		"INNER JOIN prom_data_series.%s series ON (series.labels = l.elem AND series.delete_epoch IS NULL)"
+)
+
+// CardinalityConfig limits the series that can be created for a single metric.
+// Samples of series that already exist are always accepted. A zero value of
+// any of the limits disables the corresponding check.
+type CardinalityConfig struct {
+	MaxSeriesPerMetric  int64
+	MaxLabelsPerSeries  int
+	MaxLabelValueLength int
+	// SeriesCountRefreshInterval is how often the number of series of
+	// a metric is synced with the database.
+	SeriesCountRefreshInterval time.Duration
+}
+
+func (cfg CardinalityConfig) enabled() bool {
+	return cfg.MaxSeriesPerMetric > 0 || cfg.MaxLabelsPerSeries > 0 || cfg.MaxLabelValueLength > 0
+}
+
+type metricSeriesCount struct {
+	count       int64
+	refreshedAt time.Time
+}
+
+// cardinalityLimiter rejects new series that would exceed the limits of
+// CardinalityConfig. The number of series per metric is estimated from the
+// catalog statistics and incremented locally as series are created, so it is
+// only approximate in between refreshes.
+type cardinalityLimiter struct {
+	cfg  CardinalityConfig
+	conn pgxconn.PgxConn
+
+	mu           sync.Mutex
+	seriesCounts map[string]*metricSeriesCount
+
+	lastLogged *atomic.Int64
+	now        func() time.Time
+}
+
+func newCardinalityLimiter(conn pgxconn.PgxConn, cfg CardinalityConfig) *cardinalityLimiter {
+	if !cfg.enabled() {
+		return nil
+	}
+	if cfg.SeriesCountRefreshInterval <= 0 {
+		cfg.SeriesCountRefreshInterval = DefaultSeriesCountRefreshInterval
+	}
+	return &cardinalityLimiter{
+		cfg:          cfg,
+		conn:         conn,
+		seriesCounts: make(map[string]*metricSeriesCount),
+		lastLogged:   atomic.NewInt64(0),
+		now:          time.Now,
+	}
+}
+
+// validateLabels returns the reason for rejecting a new series based on its
+// labels, or an empty string if the series is within the limits.
+func (c *cardinalityLimiter) validateLabels(series *model.Series) string {
+	names, values, ok := series.NameValues()
+	if !ok {
+		return ""
+	}
+	if c.cfg.MaxLabelsPerSeries > 0 && len(names) > c.cfg.MaxLabelsPerSeries {
+		return cardinalityReasonLabelCount
+	}
+	if c.cfg.MaxLabelValueLength > 0 {
+		for _, value := range values {
+			if len(value) > c.cfg.MaxLabelValueLength {
+				return cardinalityReasonLabelValueLength
+			}
+		}
+	}
+	return ""
+}
+
+func (c *cardinalityLimiter) validLabels(series []*model.Series) bool {
+	for _, s := range series {
+		if c.validateLabels(s) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// reserve tries to reserve room for n new series of the metric. It returns the
+// number of series that can still be created, which is less than n if the
+// limit would be exceeded.
+func (c *cardinalityLimiter) reserve(ctx context.Context, metricName string, n int) (int, error) {
+	if c.cfg.MaxSeriesPerMetric <= 0 || n == 0 {
+		return n, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counter, ok := c.seriesCounts[metricName]
+	if !ok || c.now().Sub(counter.refreshedAt) >= c.cfg.SeriesCountRefreshInterval {
+		count, err := c.readSeriesCount(ctx, metricName)
+		if err != nil {
+			return 0, err
+		}
+		counter = &metricSeriesCount{count: count, refreshedAt: c.now()}
+		c.seriesCounts[metricName] = counter
+	}
+
+	available := c.cfg.MaxSeriesPerMetric - counter.count
+	if available <= 0 {
+		return 0, nil
+	}
+	if int64(n) > available {
+		n = int(available)
+	}
+	counter.count += int64(n)
+	return n, nil
+}
+
+// release returns room for n series reserved but not created.
+func (c *cardinalityLimiter) release(metricName string, n int) {
+	if c == nil || c.cfg.MaxSeriesPerMetric <= 0 || n == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if counter, ok := c.seriesCounts[metricName]; ok {
+		counter.count -= int64(n)
+	}
+}
+
+func (c *cardinalityLimiter) readSeriesCount(ctx context.Context, metricName string) (int64, error) {
+	var count int64
+	err := c.conn.QueryRow(ctx, seriesCountSQL, metricName).Scan(&count)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("error reading series count: %w", err)
+	}
+	return count, nil
+}
+
+func (c *cardinalityLimiter) reportRejected(metricName, reason string, numSeries int) {
+	if numSeries == 0 {
+		return
+	}
+	pgMetrics.IngestorCardinalityRejectedSeries.With(prometheus.Labels{"metric": metricName, "reason": reason}).Add(float64(numSeries))
+
+	// A misbehaving target keeps sending the same series, avoid flooding the logs.
+	now := c.now().Unix()
+	last := c.lastLogged.Load()
+	if now-last < 10 || !c.lastLogged.CAS(last, now) {
+		return
+	}
+	log.Warn("msg", "rejecting new series over the cardinality limits", "metric", metricName, "reason", reason, "series", numSeries)
+}
+
+// applyCardinalityLimits removes the new series that are over the cardinality
+// limits from infos, so that they are not created. The series that already
+// exist in the database get their IDs set and are removed from infos as well,
+// so their samples are still accepted and they do not count against the
+// series limit. It returns the number of series reserved per metric, which
+// must be released for the series that end up not being created.
+func (h *seriesWriter) applyCardinalityLimits(ctx context.Context, infos map[string]*perMetricInfo) (map[string]int, error) {
+	if h.limiter == nil {
+		return nil, nil
+	}
+	reserved := make(map[string]int, len(infos))
+	for metricName, info := range infos {
+		if h.limiter.cfg.MaxSeriesPerMetric <= 0 && h.limiter.validLabels(info.series) {
+			continue
+		}
+
+		newSeries, err := h.setExistingSeriesIDs(ctx, info)
+		if err != nil {
+			h.releaseSeries(reserved)
+			return nil, err
+		}
+		accepted := newSeries[:0]
+		for _, series := range newSeries {
+			if reason := h.limiter.validateLabels(series); reason != "" {
+				h.limiter.reportRejected(metricName, reason, 1)
+				continue
+			}
+			accepted = append(accepted, series)
+		}
+		available, err := h.limiter.reserve(ctx, metricName, len(accepted))
+		if err != nil {
+			h.releaseSeries(reserved)
+			return nil, err
+		}
+		reserved[metricName] = available
+		h.limiter.reportRejected(metricName, cardinalityReasonSeriesLimit, len(accepted)-available)
+
+		info.series = accepted[:available]
+		if len(info.series) == 0 {
+			delete(infos, metricName)
+		}
+	}
+	return reserved, nil
+}
+
+// releaseSeries releases the series reserved by applyCardinalityLimits for
+// the metrics whose series were not created.
+func (h *seriesWriter) releaseSeries(reserved map[string]int) {
+	for metricName, n := range reserved {
+		h.limiter.release(metricName, n)
+	}
+}
+
+// setExistingSeriesIDs sets the IDs of the series of info that exist in the
+// database, without creating any labels or series. The series that do not
+// exist are returned.
+func (h *seriesWriter) setExistingSeriesIDs(ctx context.Context, info *perMetricInfo) ([]*model.Series, error) {
+	labelList := model.NewLabelList(len(info.series))
+	seen := make(map[cache.LabelKey]struct{})
+	for _, series := range info.series {
+		names, values, _ := series.NameValues()
+		for i := range names {
+			key := cache.NewLabelKey(info.metricName, names[i], values[i])
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			if err := labelList.Add(names[i], values[i]); err != nil {
+				return nil, fmt.Errorf("failed to add label to labelList: %w", err)
+			}
+		}
+	}
+
+	var dbEpoch model.SeriesEpoch
+	if err := h.conn.QueryRow(ctx, getEpochSQL).Scan(&dbEpoch); err != nil {
+		return nil, fmt.Errorf("error reading series epoch: %w", err)
+	}
+
+	names, values := labelList.Get()
+	rows, err := h.conn.Query(ctx, existingLabelIDsSQL, info.metricName, names, values)
+	if err != nil {
+		return nil, fmt.Errorf("error reading existing labels: %w", err)
+	}
+	labelMap := make(map[cache.LabelKey]cache.LabelInfo, len(seen))
+	maxPos := 0
+	for rows.Next() {
+		var (
+			pos, id    int32
+			key, value string
+		)
+		if err = rows.Scan(&pos, &id, &key, &value); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading existing labels: %w", err)
+		}
+		labelMap[cache.NewLabelKey(info.metricName, key, value)] = cache.NewLabelInfo(id, pos)
+		if int(pos) > maxPos {
+			maxPos = int(pos)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading existing labels: %w", err)
+	}
+
+	// A series can only exist if all of its labels do.
+	var candidates []*model.Series
+	for _, series := range info.series {
+		names, values, _ := series.NameValues()
+		exists := true
+		for i := range names {
+			if _, ok := labelMap[cache.NewLabelKey(info.metricName, names[i], values[i])]; !ok {
+				exists = false
+				break
+			}
+		}
+		if exists {
+			candidates = append(candidates, series)
+		}
+	}
+	if len(candidates) == 0 {
+		return info.series, nil
+	}
+
+	labelArrays, candidates, err := createLabelArrays(candidates, labelMap, maxPos)
+	if err != nil {
+		return nil, fmt.Errorf("error building label array: %w", err)
+	}
+	sql := fmt.Sprintf(existingSeriesSQL, pgx.Identifier{info.metricInfo.TableName}.Sanitize())
+	rows, err = h.conn.Query(ctx, sql, labelArrays)
+	if err != nil {
+		return nil, fmt.Errorf("error reading existing series: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id         model.SeriesID
+			ordinality int64
+		)
+		if err = rows.Scan(&id, &ordinality); err != nil {
+			return nil, fmt.Errorf("error reading existing series: %w", err)
+		}
+		candidates[int(ordinality)-1].SetSeriesID(id, dbEpoch)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading existing series: %w", err)
+	}
+
+	var newSeries []*model.Series
+	for _, series := range info.series {
+		if !series.IsSeriesIDSet() {
+			newSeries = append(newSeries, series)
+		}
+	}
+	return newSeries, nil
+}
@@ -0,0 +1,186 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/pgmodel/cache"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func newTestSeries(t *testing.T, scache *cache.SeriesCacheImpl, lbls ...string) *model.Series {
+	series, err := scache.GetSeriesFromLabels(labels.FromStrings(lbls...))
+	require.NoError(t, err)
+	return series
+}
+
+func TestCardinalityLimiterValidateLabels(t *testing.T) {
+	require.NoError(t, os.Setenv("IS_TEST", "true"))
+	scache := cache.NewSeriesCache(cache.DefaultConfig, nil)
+	testCases := []struct {
+		name           string
+		cfg            CardinalityConfig
+		labels         []string
+		expectedReason string
+	}{
+		{
+			name:   "within the limits",
+			cfg:    CardinalityConfig{MaxLabelsPerSeries: 2, MaxLabelValueLength: 6},
+			labels: []string{"__name__", "metric", "job", "foo"},
+		},
+		{
+			name:           "too many labels",
+			cfg:            CardinalityConfig{MaxLabelsPerSeries: 2},
+			labels:         []string{"__name__", "metric", "job", "foo", "instance", "bar"},
+			expectedReason: cardinalityReasonLabelCount,
+		},
+		{
+			name:           "label value too long",
+			cfg:            CardinalityConfig{MaxLabelValueLength: 6},
+			labels:         []string{"__name__", "metric", "request_id", "e7a1d3c0"},
+			expectedReason: cardinalityReasonLabelValueLength,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			limiter := newCardinalityLimiter(nil, c.cfg)
+			require.Equal(t, c.expectedReason, limiter.validateLabels(newTestSeries(t, scache, c.labels...)))
+		})
+	}
+}
+
+func TestCardinalityLimiterDisabled(t *testing.T) {
+	require.Nil(t, newCardinalityLimiter(nil, CardinalityConfig{SeriesCountRefreshInterval: time.Minute}))
+}
+
+func TestCardinalityLimiterReserve(t *testing.T) {
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: seriesCountSQL, Args: []interface{}{"metric"}, Results: model.RowResults{{int64(8)}}},
+		{Sql: seriesCountSQL, Args: []interface{}{"metric"}, Results: model.RowResults{{int64(2)}}},
+	}, t)
+
+	now := time.Unix(0, 0)
+	limiter := newCardinalityLimiter(mock, CardinalityConfig{MaxSeriesPerMetric: 10, SeriesCountRefreshInterval: time.Minute})
+	limiter.now = func() time.Time { return now }
+
+	reserve := func(n int) int {
+		available, err := limiter.reserve(context.Background(), "metric", n)
+		require.NoError(t, err)
+		return available
+	}
+	require.Equal(t, 1, reserve(1))
+	require.Equal(t, 1, reserve(5))
+	require.Equal(t, 0, reserve(1))
+
+	limiter.release("metric", 1)
+	require.Equal(t, 1, reserve(3))
+
+	// The series count is re-read from the database after the refresh interval.
+	now = now.Add(time.Minute)
+	require.Equal(t, 8, reserve(10))
+}
+
+func TestApplyCardinalityLimits(t *testing.T) {
+	require.NoError(t, os.Setenv("IS_TEST", "true"))
+	scache := cache.NewSeriesCache(cache.DefaultConfig, nil)
+	lcache := cache.NewInvertedLabelsCache(cache.DefaultConfig, nil)
+
+	existing := newTestSeries(t, scache, "__name__", "metric", "id", "1")
+	created := newTestSeries(t, scache, "__name__", "metric", "id", "2")
+	rejected := newTestSeries(t, scache, "__name__", "metric", "id", "3")
+	tooLong := newTestSeries(t, scache, "__name__", "metric", "id", strings.Repeat("x", 20))
+
+	labelList := model.NewLabelList(4)
+	for _, value := range []string{"1", "2", "3", strings.Repeat("x", 20)} {
+		require.NoError(t, labelList.Add("__name__", "metric"))
+		require.NoError(t, labelList.Add("id", value))
+	}
+	names, values := labelList.Get()
+	// __name__ is the same for every series, so it is only looked up once.
+	names = append(names[:1], names[1], names[3], names[5], names[7])
+	values = append(values[:1], values[1], values[3], values[5], values[7])
+
+	mock := model.NewSqlRecorder([]model.SqlQuery{
+		{Sql: getEpochSQL, Results: model.RowResults{{int64(1)}}},
+		{
+			Sql:  existingLabelIDsSQL,
+			Args: []interface{}{"metric", names, values},
+			Results: model.RowResults{
+				{int32(1), int32(1), "__name__", "metric"},
+				{int32(2), int32(2), "id", "1"},
+				{int32(2), int32(3), "id", "2"},
+			},
+		},
+		{
+			Sql:     fmt.Sprintf(existingSeriesSQL, pgx.Identifier{tableName}.Sanitize()),
+			Args:    []interface{}{getTestLabelArray(t, [][]int32{{1, 2}, {1, 3}})},
+			Results: model.RowResults{{int64(5), int64(1)}},
+		},
+		{Sql: seriesCountSQL, Args: []interface{}{"metric"}, Results: model.RowResults{{int64(10)}}},
+	}, t)
+
+	sw := NewSeriesWriter(mock, lcache, CardinalityConfig{MaxSeriesPerMetric: 11, MaxLabelValueLength: 10})
+	infos := map[string]*perMetricInfo{
+		"metric": {
+			metricName: "metric",
+			series:     []*model.Series{existing, created, rejected, tooLong},
+			metricInfo: &model.MetricInfo{MetricID: metricID, TableName: tableName},
+		},
+	}
+	reserved, err := sw.applyCardinalityLimits(context.Background(), infos)
+	require.NoError(t, err)
+	// The existing series is not counted as a new one.
+	require.Equal(t, map[string]int{"metric": 1}, reserved)
+
+	id, _, err := existing.GetSeriesID()
+	require.NoError(t, err)
+	require.Equal(t, model.SeriesID(5), id)
+
+	require.Equal(t, []*model.Series{created}, infos["metric"].series)
+	require.False(t, rejected.IsSeriesIDSet())
+	require.False(t, tooLong.IsSeriesIDSet())
+
+	// No room left for new series.
+	available, err := sw.limiter.reserve(context.Background(), "metric", 1)
+	require.NoError(t, err)
+	require.Equal(t, 0, available)
+
+	// Series that are not created are released.
+	sw.releaseSeries(reserved)
+	available, err = sw.limiter.reserve(context.Background(), "metric", 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, available)
+}
+
+func TestDropRejectedSeries(t *testing.T) {
+	scache := cache.NewSeriesCache(cache.DefaultConfig, nil)
+	accepted := newTestSeries(t, scache, "__name__", "metric", "id", "1")
+	accepted.SetSeriesID(1, 1)
+	rejected := newTestSeries(t, scache, "__name__", "metric", "id", "2")
+
+	req := copyRequest{data: &pendingBuffer{batch: model.NewBatch()}, info: &model.MetricInfo{TableName: tableName}}
+	req.data.batch.AppendSlice([]model.Insertable{
+		model.NewPromSamples(accepted, []prompb.Sample{{Timestamp: 1, Value: 1}}),
+		model.NewPromSamples(rejected, []prompb.Sample{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}}),
+	})
+
+	dropRejectedSeries(&req)
+	require.Equal(t, 1, req.data.batch.CountSeries())
+	numSamples, _ := req.data.batch.Count()
+	require.Equal(t, 1, numSamples)
+	require.Equal(t, accepted, req.data.batch.Data()[0].Series())
+}
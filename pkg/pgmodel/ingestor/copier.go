@@ -149,6 +149,11 @@ func persistBatch(ctx context.Context, conn pgxconn.PgxConn, sw *seriesWriter, e
 	if err != nil {
 		return fmt.Errorf("copier: writing series: %w", err)
 	}
+	if sw.limiter != nil {
+		for i := range insertBatch {
+			dropRejectedSeries(&insertBatch[i])
+		}
+	}
 	err = elf.orderExemplarLabelValues(batch)
 	if err != nil {
 		return fmt.Errorf("copier: formatting exemplar label values: %w", err)
@@ -158,6 +163,18 @@ func persistBatch(ctx context.Context, conn pgxconn.PgxConn, sw *seriesWriter, e
 	return nil
 }
 
+// dropRejectedSeries removes the data of the series that were rejected by the
+// cardinality limits, i.e. the ones whose IDs were not set.
+func dropRejectedSeries(req *copyRequest) {
+	req.data.batch.Filter(func(i pgmodel.Insertable) bool {
+		if i.Series().IsSeriesIDSet() {
+			return true
+		}
+		metrics.IngestorCardinalityRejectedSamples.With(prometheus.Labels{"metric": i.Series().MetricName()}).Add(float64(i.Count()))
+		return false
+	})
+}
+
 func copierGetBatch(ctx context.Context, batch []readRequest, in <-chan readRequest) ([]readRequest, bool) {
 	_, span := tracer.Default().Start(ctx, "get-batch")
 	defer span.End()
@@ -71,7 +71,7 @@ func newPgxDispatcher(conn pgxconn.PgxConn, mCache cache.MetricCache, scache cac
 		handleDecompression = skipDecompression
 	}
 
-	sw := NewSeriesWriter(conn, lCache)
+	sw := NewSeriesWriter(conn, lCache, cfg.Cardinality)
 	elf := NewExamplarLabelFormatter(conn, eCache)
 
 	for i := 0; i < numCopiers; i++ {
@@ -184,6 +184,12 @@ func (p *pgxDispatcher) CompleteMetricCreation(ctx context.Context) error {
 	return err
 }
 
+// queueUtilization returns the fraction of the copier queue that is
+// currently filled with pending read requests.
+func (p *pgxDispatcher) queueUtilization() float64 {
+	return float64(len(p.copierReadRequestCh)) / float64(cap(p.copierReadRequestCh))
+}
+
 func (p *pgxDispatcher) Close() {
 	if p.closed.Load() {
 		return
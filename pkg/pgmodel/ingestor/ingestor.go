@@ -21,9 +21,13 @@ import (
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/pgxconn"
 	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
 	"github.com/timescale/promscale/pkg/tracer"
 )
 
+// tracesMarshaller computes the size of the traces checked by the admission control.
+var tracesMarshaller = ptrace.NewProtoMarshaler()
+
 type Cfg struct {
 	MetricsAsyncAcks        bool
 	TracesAsyncAcks         bool
@@ -34,6 +38,14 @@ type Cfg struct {
 	TracesBatchTimeout      time.Duration
 	TracesMaxBatchSize      int
 	TracesBatchWorkers      int
+	MetricsAdmission        AdmissionConfig
+	TracesAdmission         AdmissionConfig
+	Cardinality             CardinalityConfig
+	SampleWindow            SampleWindowConfig
+	// TracesAuthorizer applies multi-tenancy to ingested traces. It is nil if multi-tenancy is disabled.
+	TracesAuthorizer tenancy.TracesAuthorizer
+	// TracesPreprocessing filters, scrubs and rate limits ingested traces. It is nil if disabled.
+	TracesPreprocessing *TracePreprocessingConfig
 }
 
 // DBIngestor ingest the TimeSeries data into Timescale database.
@@ -42,11 +54,22 @@ type DBIngestor struct {
 	dispatcher model.Dispatcher
 	tWriter    trace.Writer
 	closed     *atomic.Bool
+
+	metricsAdmission  *admissionController
+	tracesAdmission   *admissionController
+	sampleWindow      *sampleWindow
+	tracesAuthorizer  tenancy.TracesAuthorizer
+	tracePreprocessor *tracePreprocessor
 }
 
 // NewPgxIngestor returns a new Ingestor that uses connection pool and a metrics cache
 // for caching metric table names.
 func NewPgxIngestor(conn pgxconn.PgxConn, cache cache.MetricCache, sCache cache.SeriesCache, eCache cache.PositionCache, lCache *cache.InvertedLabelsCache, cfg *Cfg) (*DBIngestor, error) {
+	preprocessor, err := newTracePreprocessor(cfg.TracesPreprocessing)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trace preprocessing config: %w", err)
+	}
+
 	dispatcher, err := newPgxDispatcher(conn, cache, sCache, eCache, lCache, cfg)
 	if err != nil {
 		return nil, err
@@ -58,11 +81,17 @@ func NewPgxIngestor(conn pgxconn.PgxConn, cache cache.MetricCache, sCache cache.
 		Writers:      cfg.NumCopiers,
 	}
 	traceWriter := trace.NewWriter(conn)
+	traceDispatcher := trace.NewDispatcher(traceWriter, cfg.TracesAsyncAcks, batcherConfg)
 	return &DBIngestor{
-		sCache:     sCache,
-		dispatcher: dispatcher,
-		tWriter:    trace.NewDispatcher(traceWriter, cfg.TracesAsyncAcks, batcherConfg),
-		closed:     atomic.NewBool(false),
+		sCache:            sCache,
+		dispatcher:        dispatcher,
+		tWriter:           traceDispatcher,
+		closed:            atomic.NewBool(false),
+		metricsAdmission:  newAdmissionController("metric", cfg.MetricsAdmission, dispatcher.queueUtilization),
+		tracesAdmission:   newAdmissionController("trace", cfg.TracesAdmission, traceDispatcher.QueueUtilization),
+		sampleWindow:      newSampleWindow(cfg.SampleWindow),
+		tracesAuthorizer:  cfg.TracesAuthorizer,
+		tracePreprocessor: preprocessor,
 	}, nil
 }
 
@@ -86,7 +115,30 @@ func (ingestor *DBIngestor) IngestTraces(ctx context.Context, traces ptrace.Trac
 	}
 	_, span := tracer.Default().Start(ctx, "ingest-traces")
 	defer span.End()
-	return ingestor.tWriter.InsertTraces(ctx, traces)
+	if ingestor.tracesAuthorizer != nil {
+		if err := ingestor.tracesAuthorizer.ProcessTraces(ctx, traces); err != nil {
+			return err
+		}
+	}
+	// The traces are admitted before they are preprocessed, so that the rejected writes
+	// don't take the rate limit tokens of the spans that are written.
+	release, err := ingestor.tracesAdmission.admit(tracesMarshaller.TracesSize(traces))
+	if err != nil {
+		return err
+	}
+	defer release()
+	if ingestor.tracePreprocessor == nil {
+		return ingestor.tWriter.InsertTraces(ctx, traces)
+	}
+	restore := ingestor.tracePreprocessor.process(traces)
+	if traces.SpanCount() == 0 {
+		return nil
+	}
+	if err = ingestor.tWriter.InsertTraces(ctx, traces); err != nil {
+		restore()
+		return err
+	}
+	return nil
 }
 
 // IngestMetrics transforms and ingests the timeseries data into Timescale database.
@@ -115,6 +167,12 @@ func (ingestor *DBIngestor) IngestMetrics(ctx context.Context, r *prompb.WriteRe
 	// samples) must no longer be reachable from req.
 	defer FinishWriteRequest(r)
 
+	release, err := ingestor.metricsAdmission.admit(size)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer release()
+
 	defer func(size int) {
 		if err == nil {
 			metrics.IngestorBytes.With(prometheus.Labels{"type": "metric"}).Add(float64(size))
@@ -124,7 +182,11 @@ func (ingestor *DBIngestor) IngestMetrics(ctx context.Context, r *prompb.WriteRe
 	switch numTs, numMeta := len(timeseries), len(metadata); {
 	case numTs > 0 && numMeta == 0:
 		// Write request contains only time-series.
-		numInsertablesIngested, err = ingestor.ingestTimeseries(ctx, timeseries)
+		var outOfBounds *OutOfBoundsError
+		numInsertablesIngested, outOfBounds, err = ingestor.ingestTimeseries(ctx, timeseries)
+		if err == nil && outOfBounds != nil {
+			err = outOfBounds
+		}
 		return numInsertablesIngested, 0, err
 	case numTs == 0 && numMeta == 0:
 		return 0, 0, nil
@@ -135,10 +197,14 @@ func (ingestor *DBIngestor) IngestMetrics(ctx context.Context, r *prompb.WriteRe
 	default:
 	}
 
+	// The out of bounds samples are not a failure of the write, so they must
+	// not cancel the ingestion of the metadata.
+	var outOfBounds *OutOfBoundsError
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error {
-		n, err := ingestor.ingestTimeseries(ctx, timeseries)
+		n, oob, err := ingestor.ingestTimeseries(ctx, timeseries)
 		numInsertablesIngested = n
+		outOfBounds = oob
 		return err
 	})
 	g.Go(func() error {
@@ -148,10 +214,16 @@ func (ingestor *DBIngestor) IngestMetrics(ctx context.Context, r *prompb.WriteRe
 	})
 
 	err = g.Wait()
+	if err == nil && outOfBounds != nil {
+		err = outOfBounds
+	}
 	return numInsertablesIngested, numMetadataIngested, err
 }
 
-func (ingestor *DBIngestor) ingestTimeseries(ctx context.Context, timeseries []prompb.TimeSeries) (uint64, error) {
+// ingestTimeseries ingests the samples and exemplars of timeseries. The samples
+// and exemplars outside of the sample window are dropped and reported in the
+// returned OutOfBoundsError, without failing the ingestion of the others.
+func (ingestor *DBIngestor) ingestTimeseries(ctx context.Context, timeseries []prompb.TimeSeries) (uint64, *OutOfBoundsError, error) {
 	ctx, span := tracer.Default().Start(ctx, "ingest-timeseries")
 	defer span.End()
 	var (
@@ -159,6 +231,9 @@ func (ingestor *DBIngestor) ingestTimeseries(ctx context.Context, timeseries []p
 
 		insertables = make(map[string][]model.Insertable)
 	)
+	// Out of bounds samples are dropped before batching, the rest of the write
+	// is still ingested and the rejection is reported once it is done.
+	outOfBounds := ingestor.sampleWindow.filter(timeseries)
 
 	for i := range timeseries {
 		var (
@@ -175,16 +250,16 @@ func (ingestor *DBIngestor) ingestTimeseries(ctx context.Context, timeseries []p
 		// After this point ts.Labels should never be used again.
 		series, metricName, err = ingestor.sCache.GetSeriesFromProtos(ts.Labels)
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 		if metricName == "" {
-			return 0, errors.ErrNoMetricName
+			return 0, nil, errors.ErrNoMetricName
 		}
 
 		if len(ts.Samples) > 0 {
 			samples, count, err := ingestor.samples(series, ts)
 			if err != nil {
-				return 0, fmt.Errorf("samples: %w", err)
+				return 0, nil, fmt.Errorf("samples: %w", err)
 			}
 			totalRowsExpected += uint64(count)
 			insertables[metricName] = append(insertables[metricName], samples)
@@ -192,7 +267,7 @@ func (ingestor *DBIngestor) ingestTimeseries(ctx context.Context, timeseries []p
 		if len(ts.Exemplars) > 0 {
 			exemplars, count, err := ingestor.exemplars(series, ts)
 			if err != nil {
-				return 0, fmt.Errorf("exemplars: %w", err)
+				return 0, nil, fmt.Errorf("exemplars: %w", err)
 			}
 			totalRowsExpected += uint64(count)
 			insertables[metricName] = append(insertables[metricName], exemplars)
@@ -205,9 +280,12 @@ func (ingestor *DBIngestor) ingestTimeseries(ctx context.Context, timeseries []p
 
 	numInsertablesIngested, errSamples := ingestor.dispatcher.InsertTs(ctx, model.Data{Rows: insertables, ReceivedTime: time.Now()})
 	if errSamples == nil && numInsertablesIngested != totalRowsExpected {
-		return numInsertablesIngested, fmt.Errorf("failed to insert all the data! Expected: %d, Got: %d", totalRowsExpected, numInsertablesIngested)
+		return numInsertablesIngested, nil, fmt.Errorf("failed to insert all the data! Expected: %d, Got: %d", totalRowsExpected, numInsertablesIngested)
+	}
+	if errSamples != nil {
+		return numInsertablesIngested, nil, errSamples
 	}
-	return numInsertablesIngested, errSamples
+	return numInsertablesIngested, outOfBounds, nil
 }
 
 func (ingestor *DBIngestor) samples(l *model.Series, ts *prompb.TimeSeries) (model.Insertable, int, error) {
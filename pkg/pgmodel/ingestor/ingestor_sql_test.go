@@ -289,7 +289,7 @@ func TestPGXInserterInsertSeries(t *testing.T) {
 			scache := cache.NewSeriesCache(cache.DefaultConfig, nil)
 			scache.Reset()
 			lCache := cache.NewInvertedLabelsCache(cache.DefaultConfig, nil)
-			sw := NewSeriesWriter(mock, lCache)
+			sw := NewSeriesWriter(mock, lCache, CardinalityConfig{})
 			lsi := make([]model.Insertable, 0)
 			for _, ser := range c.series {
 				ls, err := scache.GetSeriesFromLabels(ser)
@@ -452,7 +452,7 @@ func TestPGXInserterCacheReset(t *testing.T) {
 	mock := model.NewSqlRecorder(sqlQueries, t)
 	scache := cache.NewSeriesCache(cache.DefaultConfig, nil)
 	lcache := cache.NewInvertedLabelsCache(cache.DefaultConfig, nil)
-	sw := NewSeriesWriter(mock, lcache)
+	sw := NewSeriesWriter(mock, lcache, CardinalityConfig{})
 	inserter := pgxDispatcher{
 		conn:                mock,
 		scache:              scache,
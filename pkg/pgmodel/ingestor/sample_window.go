@@ -0,0 +1,168 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+
+	"github.com/timescale/promscale/pkg/log"
+	pgMetrics "github.com/timescale/promscale/pkg/pgmodel/metrics"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+const (
+	outOfBoundsTooOld   = "too_old"
+	outOfBoundsTooNew   = "too_far_in_future"
+	outOfBoundsSample   = "sample"
+	outOfBoundsExemplar = "exemplar"
+)
+
+// SampleWindowConfig defines the time window, relative to the time a write is
+// received, in which samples and exemplars are accepted. A zero value of
+// any of the fields disables the corresponding check.
+type SampleWindowConfig struct {
+	// Past is how far in the past a sample can be.
+	Past time.Duration
+	// Future is how far in the future a sample can be.
+	Future time.Duration
+}
+
+func (cfg SampleWindowConfig) enabled() bool {
+	return cfg.Past > 0 || cfg.Future > 0
+}
+
+// OutOfBoundsError is returned when some of the samples or exemplars of a write
+// were rejected for being outside the accepted time window. The rest of the
+// write was ingested.
+type OutOfBoundsError struct {
+	Window         SampleWindowConfig
+	TooOld         int
+	TooFarInFuture int
+}
+
+func (e *OutOfBoundsError) Error() string {
+	var reasons []string
+	if e.TooOld > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d older than %s", e.TooOld, e.Window.Past))
+	}
+	if e.TooFarInFuture > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d more than %s in the future", e.TooFarInFuture, e.Window.Future))
+	}
+	return fmt.Sprintf("rejected %d samples and exemplars outside the accepted time window (%s), the rest of the write was ingested",
+		e.TooOld+e.TooFarInFuture, strings.Join(reasons, ", "))
+}
+
+// sampleWindow drops the samples and exemplars outside of the accepted time window.
+type sampleWindow struct {
+	cfg        SampleWindowConfig
+	lastLogged *atomic.Int64
+	now        func() time.Time
+}
+
+func newSampleWindow(cfg SampleWindowConfig) *sampleWindow {
+	if !cfg.enabled() {
+		return nil
+	}
+	return &sampleWindow{cfg: cfg, lastLogged: atomic.NewInt64(0), now: time.Now}
+}
+
+// bounds returns the minimum and maximum timestamps, in milliseconds, that are
+// accepted for a write received now.
+func (s *sampleWindow) bounds() (minT, maxT int64) {
+	now := s.now()
+	minT, maxT = int64(-1<<63), int64(1<<63-1)
+	if s.cfg.Past > 0 {
+		minT = now.Add(-s.cfg.Past).UnixMilli()
+	}
+	if s.cfg.Future > 0 {
+		maxT = now.Add(s.cfg.Future).UnixMilli()
+	}
+	return minT, maxT
+}
+
+// filter removes the samples and exemplars of the timeseries that are outside
+// of the window and returns the error describing them, or nil if everything
+// was accepted. A nil sampleWindow accepts everything.
+func (s *sampleWindow) filter(timeseries []prompb.TimeSeries) *OutOfBoundsError {
+	if s == nil {
+		return nil
+	}
+	minT, maxT := s.bounds()
+	var (
+		samples   outOfBoundsCounts
+		exemplars outOfBoundsCounts
+	)
+	for i := range timeseries {
+		ts := &timeseries[i]
+		ts.Samples = filterSamples(ts.Samples, minT, maxT, &samples)
+		ts.Exemplars = filterExemplars(ts.Exemplars, minT, maxT, &exemplars)
+	}
+	samples.report(outOfBoundsSample)
+	exemplars.report(outOfBoundsExemplar)
+
+	tooOld, tooNew := samples.tooOld+exemplars.tooOld, samples.tooNew+exemplars.tooNew
+	if tooOld+tooNew == 0 {
+		return nil
+	}
+	err := &OutOfBoundsError{Window: s.cfg, TooOld: tooOld, TooFarInFuture: tooNew}
+	// A client with a misconfigured clock keeps sending the same data, avoid flooding the logs.
+	now := s.now().Unix()
+	last := s.lastLogged.Load()
+	if now-last >= 10 && s.lastLogged.CAS(last, now) {
+		log.Warn("msg", "rejecting out of bounds samples", "err", err.Error())
+	}
+	return err
+}
+
+type outOfBoundsCounts struct {
+	tooOld int
+	tooNew int
+}
+
+func (c outOfBoundsCounts) report(kind string) {
+	if c.tooOld > 0 {
+		pgMetrics.IngestorOutOfBounds.With(prometheus.Labels{"kind": kind, "reason": outOfBoundsTooOld}).Add(float64(c.tooOld))
+	}
+	if c.tooNew > 0 {
+		pgMetrics.IngestorOutOfBounds.With(prometheus.Labels{"kind": kind, "reason": outOfBoundsTooNew}).Add(float64(c.tooNew))
+	}
+}
+
+func (c *outOfBoundsCounts) accept(t, minT, maxT int64) bool {
+	switch {
+	case t < minT:
+		c.tooOld++
+		return false
+	case t > maxT:
+		c.tooNew++
+		return false
+	}
+	return true
+}
+
+func filterSamples(samples []prompb.Sample, minT, maxT int64, counts *outOfBoundsCounts) []prompb.Sample {
+	kept := samples[:0]
+	for _, s := range samples {
+		if counts.accept(s.Timestamp, minT, maxT) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+func filterExemplars(exemplars []prompb.Exemplar, minT, maxT int64, counts *outOfBoundsCounts) []prompb.Exemplar {
+	kept := exemplars[:0]
+	for _, e := range exemplars {
+		if counts.accept(e.Timestamp, minT, maxT) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,166 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/timescale/promscale/pkg/pgmodel/cache"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func TestSampleWindowDisabled(t *testing.T) {
+	window := newSampleWindow(SampleWindowConfig{})
+	require.Nil(t, window)
+
+	timeseries := []prompb.TimeSeries{{Samples: []prompb.Sample{{Timestamp: 0}}}}
+	require.Nil(t, window.filter(timeseries))
+	require.Len(t, timeseries[0].Samples, 1)
+}
+
+func TestSampleWindowFilter(t *testing.T) {
+	now := time.Unix(10000, 0)
+	ms := func(d time.Duration) int64 { return now.Add(d).UnixMilli() }
+
+	testCases := []struct {
+		name              string
+		cfg               SampleWindowConfig
+		expectedSamples   []int64
+		expectedExemplars []int64
+		expectedErr       *OutOfBoundsError
+	}{
+		{
+			name:              "past and future",
+			cfg:               SampleWindowConfig{Past: time.Hour, Future: time.Minute},
+			expectedSamples:   []int64{ms(-time.Hour), ms(0), ms(time.Minute)},
+			expectedExemplars: []int64{ms(0)},
+			expectedErr:       &OutOfBoundsError{Window: SampleWindowConfig{Past: time.Hour, Future: time.Minute}, TooOld: 2, TooFarInFuture: 2},
+		},
+		{
+			name:              "past only",
+			cfg:               SampleWindowConfig{Past: time.Hour},
+			expectedSamples:   []int64{ms(-time.Hour), ms(0), ms(time.Minute), ms(time.Hour)},
+			expectedExemplars: []int64{ms(0), ms(time.Hour)},
+			expectedErr:       &OutOfBoundsError{Window: SampleWindowConfig{Past: time.Hour}, TooOld: 2},
+		},
+		{
+			name:              "future only",
+			cfg:               SampleWindowConfig{Future: 2 * time.Hour},
+			expectedSamples:   []int64{ms(-2 * time.Hour), ms(-time.Hour), ms(0), ms(time.Minute), ms(time.Hour)},
+			expectedExemplars: []int64{ms(-2 * time.Hour), ms(0), ms(time.Hour)},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			window := newSampleWindow(c.cfg)
+			window.now = func() time.Time { return now }
+			timeseries := []prompb.TimeSeries{
+				{
+					Samples: []prompb.Sample{
+						{Timestamp: ms(-2 * time.Hour)},
+						{Timestamp: ms(-time.Hour)},
+						{Timestamp: ms(0)},
+					},
+					Exemplars: []prompb.Exemplar{
+						{Timestamp: ms(-2 * time.Hour)},
+						{Timestamp: ms(0)},
+					},
+				},
+				{
+					Samples: []prompb.Sample{
+						{Timestamp: ms(time.Minute)},
+						{Timestamp: ms(time.Hour)},
+					},
+					Exemplars: []prompb.Exemplar{
+						{Timestamp: ms(time.Hour)},
+					},
+				},
+			}
+
+			err := window.filter(timeseries)
+			if c.expectedErr == nil {
+				require.Nil(t, err)
+			} else {
+				require.Equal(t, c.expectedErr, err)
+			}
+
+			var samples, exemplars []int64
+			for _, ts := range timeseries {
+				for _, s := range ts.Samples {
+					samples = append(samples, s.Timestamp)
+				}
+				for _, e := range ts.Exemplars {
+					exemplars = append(exemplars, e.Timestamp)
+				}
+			}
+			require.Equal(t, c.expectedSamples, samples)
+			require.Equal(t, c.expectedExemplars, exemplars)
+		})
+	}
+}
+
+func TestOutOfBoundsErrorMessage(t *testing.T) {
+	err := &OutOfBoundsError{Window: SampleWindowConfig{Past: time.Hour, Future: time.Minute}, TooOld: 2, TooFarInFuture: 1}
+	require.Equal(t, "rejected 3 samples and exemplars outside the accepted time window (2 older than 1h0m0s, 1 more than 1m0s in the future), the rest of the write was ingested", err.Error())
+}
+
+// orderedInserter ingests the metadata once the samples are ingested, and fails
+// it if the context was canceled in between.
+type orderedInserter struct {
+	*model.MockInserter
+	samplesDone chan struct{}
+}
+
+func (o *orderedInserter) InsertTs(ctx context.Context, data model.Data) (uint64, error) {
+	defer close(o.samplesDone)
+	return o.MockInserter.InsertTs(ctx, data)
+}
+
+func (o *orderedInserter) InsertMetadata(ctx context.Context, metadata []model.Metadata) (uint64, error) {
+	<-o.samplesDone
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return o.MockInserter.InsertMetadata(ctx, metadata)
+}
+
+func TestIngestMetricsOutOfBoundsWithMetadata(t *testing.T) {
+	now := time.Now()
+	window := newSampleWindow(SampleWindowConfig{Past: time.Hour})
+	window.now = func() time.Time { return now }
+	i := DBIngestor{
+		dispatcher: &orderedInserter{
+			MockInserter: &model.MockInserter{InsertedSeries: make(map[string]model.SeriesID)},
+			samplesDone:  make(chan struct{}),
+		},
+		sCache:       cache.NewSeriesCache(cache.DefaultConfig, nil),
+		closed:       atomic.NewBool(false),
+		sampleWindow: window,
+	}
+
+	wr := NewWriteRequest()
+	wr.Timeseries = []prompb.TimeSeries{{
+		Labels: []prompb.Label{{Name: model.MetricNameLabelName, Value: "test"}},
+		Samples: []prompb.Sample{
+			{Timestamp: now.Add(-2 * time.Hour).UnixMilli(), Value: 1},
+			{Timestamp: now.UnixMilli(), Value: 2},
+		},
+	}}
+	wr.Metadata = []prompb.MetricMetadata{{MetricFamilyName: "test", Type: prompb.MetricMetadata_GAUGE}}
+
+	numSamples, numMetadata, err := i.IngestMetrics(context.Background(), wr)
+	var outOfBounds *OutOfBoundsError
+	require.ErrorAs(t, err, &outOfBounds)
+	require.Equal(t, 1, outOfBounds.TooOld)
+	require.Equal(t, uint64(1), numSamples)
+	require.Equal(t, uint64(1), numMetadata)
+}
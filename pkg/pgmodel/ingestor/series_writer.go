@@ -26,14 +26,15 @@ const (
 type seriesWriter struct {
 	conn        pgxconn.PgxConn
 	labelsCache *cache.InvertedLabelsCache
+	limiter     *cardinalityLimiter
 }
 
 type SeriesVisitor interface {
 	VisitSeries(func(info *pgmodel.MetricInfo, s *model.Series) error) error
 }
 
-func NewSeriesWriter(conn pgxconn.PgxConn, labelsCache *cache.InvertedLabelsCache) *seriesWriter {
-	return &seriesWriter{conn, labelsCache}
+func NewSeriesWriter(conn pgxconn.PgxConn, labelsCache *cache.InvertedLabelsCache, cardinality CardinalityConfig) *seriesWriter {
+	return &seriesWriter{conn, labelsCache, newCardinalityLimiter(conn, cardinality)}
 }
 
 type perMetricInfo struct {
@@ -49,7 +50,8 @@ type perMetricInfo struct {
 // PopulateOrCreateSeries examines all series in SeriesVisitor, checking if the labels or
 // series are present in the inverted label or series caches. If not present,
 // it creates them in the database (if they have not been created), or fetches
-// their IDs if already created populating the respective caches.
+// their IDs if already created populating the respective caches. New series
+// over the cardinality limits are not created and keep their IDs unset.
 func (h *seriesWriter) PopulateOrCreateSeries(ctx context.Context, sv SeriesVisitor) error {
 	ctx, span := tracer.Default().Start(ctx, "write-series")
 	defer span.End()
@@ -76,6 +78,12 @@ func (h *seriesWriter) PopulateOrCreateSeries(ctx context.Context, sv SeriesVisi
 	if err != nil {
 		return err
 	}
+	reserved, err := h.applyCardinalityLimits(ctx, infos)
+	if err != nil {
+		return fmt.Errorf("error applying cardinality limits: %w", err)
+	}
+	// Only the series whose creation is committed count against the limits.
+	defer h.releaseSeries(reserved)
 	if len(infos) == 0 {
 		return nil
 	}
@@ -188,6 +196,7 @@ func (h *seriesWriter) PopulateOrCreateSeries(ctx context.Context, sv SeriesVisi
 		if _, err := br.Exec(); err != nil {
 			return fmt.Errorf("error setting series_id commit: %w", err)
 		}
+		delete(reserved, info.metricName)
 	}
 	return nil
 }
@@ -111,6 +111,18 @@ func (b *Batcher) send(req insertTracesReq, batcherIdx int) {
 	b.in[batcherIdx] <- req
 }
 
+func (b *Batcher) queueUtilization() float64 {
+	var length, capacity int
+	for _, in := range b.in {
+		length += len(in)
+		capacity += cap(in)
+	}
+	if capacity == 0 {
+		return 0
+	}
+	return float64(length) / float64(capacity)
+}
+
 func validateConfig(config *BatcherConfig) {
 	if config.Batchers == 0 {
 		config.Batchers = DefaultBatchWorkers
@@ -104,6 +104,12 @@ func (td *Dispatcher) getBatcherIdx(ctx context.Context, traces ptrace.Traces) (
 	return next % numberOfBatchers, nil
 }
 
+// QueueUtilization returns the fraction of the batcher queues that is
+// currently filled with pending requests.
+func (td *Dispatcher) QueueUtilization() float64 {
+	return td.batcher.queueUtilization()
+}
+
 func (td *Dispatcher) Close() {
 	td.stopped.Store(true)
 	td.batcher.Stop()
@@ -0,0 +1,517 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v2"
+
+	pgMetrics "github.com/timescale/promscale/pkg/pgmodel/metrics"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+const (
+	droppedByRule      = "drop_rule"
+	droppedByRateLimit = "rate_limit"
+
+	AttributeActionHash   = "hash"
+	AttributeActionMask   = "mask"
+	AttributeActionRemove = "remove"
+
+	defaultMask        = "****"
+	serviceNameAttrKey = "service.name"
+)
+
+// TracePreprocessingConfig defines how the traces are filtered, scrubbed and rate
+// limited before they are batched and written to the database.
+type TracePreprocessingConfig struct {
+	// Drop are the rules selecting the spans or traces to drop.
+	Drop []TraceDropRule `yaml:"drop"`
+	// Attributes are the rules hashing, masking or removing attributes.
+	Attributes []AttributeRule `yaml:"attributes"`
+	// HashKey is the secret key of the HMAC computed by the hash action.
+	HashKey string `yaml:"hash_key"`
+	// HashKeyFile is the path of a file holding HashKey, so that the key can be kept
+	// out of the configuration file.
+	HashKeyFile string `yaml:"hash_key_file"`
+	// RateLimits limits the number of spans per second of each service.
+	RateLimits SpanRateLimitConfig `yaml:"rate_limits"`
+}
+
+// TraceDropRule drops the spans matching all of its conditions. The service, operation
+// and attribute values are regular expressions matching the whole value.
+type TraceDropRule struct {
+	// Name identifies the rule in the metrics. It defaults to the position of the rule.
+	Name      string `yaml:"name"`
+	Service   string `yaml:"service"`
+	Operation string `yaml:"operation"`
+	// Attributes maps span attribute keys to regular expressions of their value. If the
+	// span doesn't have the attribute, the resource attribute is used.
+	Attributes map[string]string `yaml:"attributes"`
+	// Trace drops all the spans of the trace of a matching span, instead of only the span.
+	// Only the spans of the same write are dropped.
+	Trace bool `yaml:"trace"`
+}
+
+// AttributeRule hashes, masks or removes the span, event, link, instrumentation scope
+// and resource attributes whose key is Key or fully matches KeyRegex.
+type AttributeRule struct {
+	// Name identifies the rule in the metrics. It defaults to the position of the rule.
+	Name     string `yaml:"name"`
+	Action   string `yaml:"action"`
+	Key      string `yaml:"key"`
+	KeyRegex string `yaml:"key_regex"`
+	// ValueRegex restricts the mask action to the parts of the value matching the
+	// regular expression. The whole value is masked if it is empty.
+	ValueRegex string `yaml:"value_regex"`
+	// Mask is the replacement of masked values. It defaults to "****".
+	Mask string `yaml:"mask"`
+}
+
+// SpanRateLimitConfig limits the spans ingested per second for each service. Spans
+// over the limit are dropped.
+type SpanRateLimitConfig struct {
+	// SpansPerSecond is the limit of every service. Zero means unlimited.
+	SpansPerSecond float64 `yaml:"spans_per_second"`
+	// Burst is the number of spans a service can send at once. It defaults to the
+	// limit, rounded up.
+	Burst int `yaml:"burst"`
+	// Services overrides the limit of specific services. Zero means unlimited.
+	Services map[string]float64 `yaml:"services"`
+}
+
+// LoadTracePreprocessingConfig reads and validates the trace preprocessing configuration file.
+func LoadTracePreprocessingConfig(path string) (*TracePreprocessingConfig, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading trace preprocessing config: %w", err)
+	}
+	cfg := &TracePreprocessingConfig{}
+	if err = yaml.UnmarshalStrict(contents, cfg); err != nil {
+		return nil, fmt.Errorf("parsing trace preprocessing config: %w", err)
+	}
+	if _, err = newTracePreprocessor(cfg); err != nil {
+		return nil, fmt.Errorf("invalid trace preprocessing config: %w", err)
+	}
+	return cfg, nil
+}
+
+// compileAnchored compiles a regular expression matching the whole string, like relabeling rules.
+func compileAnchored(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+type dropRule struct {
+	name       string
+	service    *regexp.Regexp
+	operation  *regexp.Regexp
+	attributes map[string]*regexp.Regexp
+	trace      bool
+}
+
+func newDropRule(i int, r TraceDropRule) (dropRule, error) {
+	rule := dropRule{name: r.Name, attributes: make(map[string]*regexp.Regexp, len(r.Attributes)), trace: r.Trace}
+	if rule.name == "" {
+		rule.name = strconv.Itoa(i)
+	}
+	if r.Service == "" && r.Operation == "" && len(r.Attributes) == 0 {
+		return rule, fmt.Errorf("drop rule %s: at least one of service, operation or attributes is required", rule.name)
+	}
+	var err error
+	if r.Service != "" {
+		if rule.service, err = compileAnchored(r.Service); err != nil {
+			return rule, fmt.Errorf("drop rule %s: invalid service: %w", rule.name, err)
+		}
+	}
+	if r.Operation != "" {
+		if rule.operation, err = compileAnchored(r.Operation); err != nil {
+			return rule, fmt.Errorf("drop rule %s: invalid operation: %w", rule.name, err)
+		}
+	}
+	for key, value := range r.Attributes {
+		if rule.attributes[key], err = compileAnchored(value); err != nil {
+			return rule, fmt.Errorf("drop rule %s: invalid value of attribute %s: %w", rule.name, key, err)
+		}
+	}
+	return rule, nil
+}
+
+func (r dropRule) matches(service string, resourceAttrs pcommon.Map, span ptrace.Span) bool {
+	if r.service != nil && !r.service.MatchString(service) {
+		return false
+	}
+	if r.operation != nil && !r.operation.MatchString(span.Name()) {
+		return false
+	}
+	for key, re := range r.attributes {
+		v, ok := span.Attributes().Get(key)
+		if !ok {
+			v, ok = resourceAttrs.Get(key)
+		}
+		if !ok || !re.MatchString(v.AsString()) {
+			return false
+		}
+	}
+	return true
+}
+
+type attributeRule struct {
+	name     string
+	action   string
+	key      string
+	keyRegex *regexp.Regexp
+	value    *regexp.Regexp
+	mask     string
+	hashKey  []byte
+	modified prometheus.Counter
+}
+
+func newAttributeRule(i int, r AttributeRule, hashKey []byte) (*attributeRule, error) {
+	rule := &attributeRule{name: r.Name, action: r.Action, key: r.Key, mask: r.Mask}
+	if rule.name == "" {
+		rule.name = strconv.Itoa(i)
+	}
+	switch r.Action {
+	case AttributeActionHash, AttributeActionMask, AttributeActionRemove:
+	default:
+		return nil, fmt.Errorf("attribute rule %s: unknown action %q, must be one of %s, %s or %s",
+			rule.name, r.Action, AttributeActionHash, AttributeActionMask, AttributeActionRemove)
+	}
+	if (r.Key == "") == (r.KeyRegex == "") {
+		return nil, fmt.Errorf("attribute rule %s: exactly one of key or key_regex is required", rule.name)
+	}
+	var err error
+	if r.KeyRegex != "" {
+		if rule.keyRegex, err = compileAnchored(r.KeyRegex); err != nil {
+			return nil, fmt.Errorf("attribute rule %s: invalid key_regex: %w", rule.name, err)
+		}
+	}
+	if r.Action == AttributeActionHash {
+		if len(hashKey) == 0 {
+			return nil, fmt.Errorf("attribute rule %s: hash_key or hash_key_file is required by the %s action", rule.name, AttributeActionHash)
+		}
+		rule.hashKey = hashKey
+	}
+	if r.ValueRegex != "" {
+		if r.Action != AttributeActionMask {
+			return nil, fmt.Errorf("attribute rule %s: value_regex is only supported by the %s action", rule.name, AttributeActionMask)
+		}
+		if rule.value, err = regexp.Compile(r.ValueRegex); err != nil {
+			return nil, fmt.Errorf("attribute rule %s: invalid value_regex: %w", rule.name, err)
+		}
+	}
+	if rule.mask == "" {
+		rule.mask = defaultMask
+	}
+	rule.modified = pgMetrics.IngestorTraceAttributesModified.With(prometheus.Labels{"action": rule.action, "rule": rule.name})
+	return rule, nil
+}
+
+func (r *attributeRule) matchesKey(key string) bool {
+	if key == tenancy.TenantLabelKey {
+		// The tenant of the spans is needed to isolate the tenants.
+		return false
+	}
+	if r.keyRegex != nil {
+		return r.keyRegex.MatchString(key)
+	}
+	return key == r.key
+}
+
+// apply modifies the matching attributes of m.
+func (r *attributeRule) apply(m pcommon.Map) {
+	if r.action == AttributeActionRemove {
+		if r.keyRegex == nil && r.matchesKey(r.key) {
+			if m.Remove(r.key) {
+				r.modified.Inc()
+			}
+			return
+		}
+		m.RemoveIf(func(k string, _ pcommon.Value) bool {
+			if r.matchesKey(k) {
+				r.modified.Inc()
+				return true
+			}
+			return false
+		})
+		return
+	}
+	m.Range(func(k string, v pcommon.Value) bool {
+		if !r.matchesKey(k) {
+			return true
+		}
+		old := v.AsString()
+		var updated string
+		switch {
+		case r.action == AttributeActionHash:
+			mac := hmac.New(sha256.New, r.hashKey)
+			mac.Write([]byte(old))
+			updated = hex.EncodeToString(mac.Sum(nil))
+		case r.value != nil:
+			updated = r.value.ReplaceAllLiteralString(old, r.mask)
+		default:
+			updated = r.mask
+		}
+		if updated != old || v.Type() != pcommon.ValueTypeStr {
+			v.SetStr(updated)
+			r.modified.Inc()
+		}
+		return true
+	})
+}
+
+// spanRateLimiter keeps a token bucket per service.
+type spanRateLimiter struct {
+	cfg      SpanRateLimitConfig
+	lock     sync.Mutex
+	limiters map[string]*rate.Limiter
+	dropped  prometheus.Counter
+}
+
+func newSpanRateLimiter(cfg SpanRateLimitConfig) (*spanRateLimiter, error) {
+	if cfg.SpansPerSecond < 0 {
+		return nil, fmt.Errorf("rate_limits.spans_per_second cannot be negative")
+	}
+	if cfg.Burst < 0 {
+		return nil, fmt.Errorf("rate_limits.burst cannot be negative")
+	}
+	for service, limit := range cfg.Services {
+		if limit < 0 {
+			return nil, fmt.Errorf("rate limit of service %s cannot be negative", service)
+		}
+	}
+	if cfg.SpansPerSecond == 0 && len(cfg.Services) == 0 {
+		return nil, nil
+	}
+	return &spanRateLimiter{
+		cfg:      cfg,
+		limiters: make(map[string]*rate.Limiter),
+		dropped:  pgMetrics.IngestorTraceSpansDropped.With(prometheus.Labels{"reason": droppedByRateLimit, "rule": ""}),
+	}, nil
+}
+
+func (l *spanRateLimiter) limiter(service string) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if limiter, ok := l.limiters[service]; ok {
+		return limiter
+	}
+	limit, ok := l.cfg.Services[service]
+	if !ok {
+		limit = l.cfg.SpansPerSecond
+	}
+	var limiter *rate.Limiter
+	if limit > 0 {
+		burst := l.cfg.Burst
+		if burst == 0 {
+			burst = int(math.Ceil(limit))
+		}
+		limiter = rate.NewLimiter(rate.Limit(limit), burst)
+	}
+	l.limiters[service] = limiter
+	return limiter
+}
+
+// reserve reports whether a span of the service can be ingested at the given time. The
+// token of an ingested span is returned by canceling its reservation, which is nil for
+// the services without a limit.
+func (l *spanRateLimiter) reserve(service string, now time.Time) (*rate.Reservation, bool) {
+	limiter := l.limiter(service)
+	if limiter == nil {
+		return nil, true
+	}
+	r := limiter.ReserveN(now, 1)
+	if r.OK() && r.DelayFrom(now) == 0 {
+		return r, true
+	}
+	r.CancelAt(now)
+	l.dropped.Inc()
+	return nil, false
+}
+
+// tracePreprocessor applies the trace preprocessing configuration to the traces of a write.
+type tracePreprocessor struct {
+	drop        []dropRule
+	dropCounter []prometheus.Counter
+	attributes  []*attributeRule
+	limiter     *spanRateLimiter
+	now         func() time.Time
+}
+
+func newTracePreprocessor(cfg *TracePreprocessingConfig) (*tracePreprocessor, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	p := &tracePreprocessor{now: time.Now}
+	for i, r := range cfg.Drop {
+		rule, err := newDropRule(i, r)
+		if err != nil {
+			return nil, err
+		}
+		p.drop = append(p.drop, rule)
+		p.dropCounter = append(p.dropCounter, pgMetrics.IngestorTraceSpansDropped.With(prometheus.Labels{"reason": droppedByRule, "rule": rule.name}))
+	}
+	hashKey, err := readHashKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range cfg.Attributes {
+		rule, err := newAttributeRule(i, r, hashKey)
+		if err != nil {
+			return nil, err
+		}
+		p.attributes = append(p.attributes, rule)
+	}
+	limiter, err := newSpanRateLimiter(cfg.RateLimits)
+	if err != nil {
+		return nil, err
+	}
+	p.limiter = limiter
+	if len(p.drop) == 0 && len(p.attributes) == 0 && p.limiter == nil {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// readHashKey returns the key of the hash action, read from the hash key file if set.
+func readHashKey(cfg *TracePreprocessingConfig) ([]byte, error) {
+	if cfg.HashKeyFile == "" {
+		return []byte(cfg.HashKey), nil
+	}
+	if cfg.HashKey != "" {
+		return nil, fmt.Errorf("at most one of hash_key or hash_key_file can be set")
+	}
+	contents, err := os.ReadFile(cfg.HashKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading hash_key_file: %w", err)
+	}
+	return []byte(strings.TrimSpace(string(contents))), nil
+}
+
+func serviceName(resourceAttrs pcommon.Map) string {
+	if v, ok := resourceAttrs.Get(serviceNameAttrKey); ok {
+		return v.AsString()
+	}
+	return ""
+}
+
+// matchingDropRule returns the index of the first drop rule matching the span, or -1.
+func (p *tracePreprocessor) matchingDropRule(service string, resourceAttrs pcommon.Map, span ptrace.Span) int {
+	for i, rule := range p.drop {
+		if rule.matches(service, resourceAttrs, span) {
+			return i
+		}
+	}
+	return -1
+}
+
+// process drops, rate limits and scrubs the spans of traces in place. The returned
+// function gives back the rate limit tokens taken by the remaining spans, for the
+// writes that fail.
+func (p *tracePreprocessor) process(traces ptrace.Traces) (restore func()) {
+	now := p.now()
+	droppedTraces := p.droppedTraces(traces)
+	var reservations []*rate.Reservation
+
+	traces.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		resourceAttrs := rs.Resource().Attributes()
+		service := serviceName(resourceAttrs)
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				if i, ok := droppedTraces[span.TraceID()]; ok {
+					p.dropCounter[i].Inc()
+					return true
+				}
+				if i := p.matchingDropRule(service, resourceAttrs, span); i >= 0 {
+					p.dropCounter[i].Inc()
+					return true
+				}
+				if p.limiter != nil {
+					r, ok := p.limiter.reserve(service, now)
+					if !ok {
+						return true
+					}
+					if r != nil {
+						reservations = append(reservations, r)
+					}
+				}
+				for _, rule := range p.attributes {
+					rule.apply(span.Attributes())
+					for i := 0; i < span.Events().Len(); i++ {
+						rule.apply(span.Events().At(i).Attributes())
+					}
+					for i := 0; i < span.Links().Len(); i++ {
+						rule.apply(span.Links().At(i).Attributes())
+					}
+				}
+				return false
+			})
+			if ss.Spans().Len() == 0 {
+				return true
+			}
+			for _, rule := range p.attributes {
+				rule.apply(ss.Scope().Attributes())
+			}
+			return false
+		})
+		if rs.ScopeSpans().Len() == 0 {
+			return true
+		}
+		for _, rule := range p.attributes {
+			rule.apply(resourceAttrs)
+		}
+		return false
+	})
+	return func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+}
+
+// droppedTraces returns the IDs of the traces with a span matching a rule dropping whole
+// traces, with the index of the rule.
+func (p *tracePreprocessor) droppedTraces(traces ptrace.Traces) map[pcommon.TraceID]int {
+	var dropped map[pcommon.TraceID]int
+	for i := 0; i < traces.ResourceSpans().Len(); i++ {
+		rs := traces.ResourceSpans().At(i)
+		resourceAttrs := rs.Resource().Attributes()
+		service := serviceName(resourceAttrs)
+		for j := 0; j < rs.ScopeSpans().Len(); j++ {
+			spans := rs.ScopeSpans().At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				if _, ok := dropped[span.TraceID()]; ok {
+					continue
+				}
+				for r, rule := range p.drop {
+					if rule.trace && rule.matches(service, resourceAttrs, span) {
+						if dropped == nil {
+							dropped = make(map[pcommon.TraceID]int)
+						}
+						dropped[span.TraceID()] = r
+						break
+					}
+				}
+			}
+		}
+	}
+	return dropped
+}
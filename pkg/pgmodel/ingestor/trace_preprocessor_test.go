@@ -0,0 +1,310 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package ingestor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	pgMetrics "github.com/timescale/promscale/pkg/pgmodel/metrics"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+type testSpan struct {
+	service string
+	name    string
+	traceID byte
+	attrs   map[string]interface{}
+}
+
+func newTestTraces(spans ...testSpan) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	for _, s := range spans {
+		rs := traces.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutString(serviceNameAttrKey, s.service)
+		span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+		span.SetName(s.name)
+		span.SetTraceID(pcommon.TraceID([16]byte{15: s.traceID}))
+		span.Attributes().FromRaw(s.attrs)
+	}
+	return traces
+}
+
+func spanNames(traces ptrace.Traces) []string {
+	var names []string
+	for i := 0; i < traces.ResourceSpans().Len(); i++ {
+		rs := traces.ResourceSpans().At(i)
+		for j := 0; j < rs.ScopeSpans().Len(); j++ {
+			spans := rs.ScopeSpans().At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				names = append(names, spans.At(k).Name())
+			}
+		}
+	}
+	return names
+}
+
+func TestTracePreprocessorDisabled(t *testing.T) {
+	p, err := newTracePreprocessor(nil)
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	p, err = newTracePreprocessor(&TracePreprocessingConfig{})
+	require.NoError(t, err)
+	require.Nil(t, p)
+}
+
+func TestTracePreprocessorInvalidConfig(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cfg         TracePreprocessingConfig
+		expectedErr string
+	}{
+		{
+			name:        "empty drop rule",
+			cfg:         TracePreprocessingConfig{Drop: []TraceDropRule{{Name: "empty"}}},
+			expectedErr: "drop rule empty: at least one of service, operation or attributes is required",
+		},
+		{
+			name:        "invalid service",
+			cfg:         TracePreprocessingConfig{Drop: []TraceDropRule{{Service: "("}}},
+			expectedErr: "drop rule 0: invalid service: error parsing regexp: missing closing ): `^(?:()$`",
+		},
+		{
+			name:        "unknown action",
+			cfg:         TracePreprocessingConfig{Attributes: []AttributeRule{{Action: "encrypt", Key: "a"}}},
+			expectedErr: `attribute rule 0: unknown action "encrypt", must be one of hash, mask or remove`,
+		},
+		{
+			name:        "key and key regex",
+			cfg:         TracePreprocessingConfig{Attributes: []AttributeRule{{Action: AttributeActionRemove, Key: "a", KeyRegex: "a.*"}}},
+			expectedErr: "attribute rule 0: exactly one of key or key_regex is required",
+		},
+		{
+			name:        "value regex with hash",
+			cfg:         TracePreprocessingConfig{HashKey: "key", Attributes: []AttributeRule{{Action: AttributeActionHash, Key: "a", ValueRegex: "[0-9]+"}}},
+			expectedErr: "attribute rule 0: value_regex is only supported by the mask action",
+		},
+		{
+			name:        "hash without key",
+			cfg:         TracePreprocessingConfig{Attributes: []AttributeRule{{Action: AttributeActionHash, Key: "a"}}},
+			expectedErr: "attribute rule 0: hash_key or hash_key_file is required by the hash action",
+		},
+		{
+			name:        "hash key and hash key file",
+			cfg:         TracePreprocessingConfig{HashKey: "key", HashKeyFile: "key.txt", Attributes: []AttributeRule{{Action: AttributeActionHash, Key: "a"}}},
+			expectedErr: "at most one of hash_key or hash_key_file can be set",
+		},
+		{
+			name:        "negative rate limit",
+			cfg:         TracePreprocessingConfig{RateLimits: SpanRateLimitConfig{Services: map[string]float64{"a": -1}}},
+			expectedErr: "rate limit of service a cannot be negative",
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := newTracePreprocessor(&c.cfg)
+			require.EqualError(t, err, c.expectedErr)
+		})
+	}
+}
+
+func TestTracePreprocessorDrop(t *testing.T) {
+	p, err := newTracePreprocessor(&TracePreprocessingConfig{Drop: []TraceDropRule{
+		{Name: "health", Operation: "GET /health.*"},
+		{Name: "debug", Service: "debug-.*", Trace: true},
+		{Name: "bots", Attributes: map[string]string{"http.user_agent": ".*bot.*", "deployment.environment": "dev"}},
+	}})
+	require.NoError(t, err)
+
+	traces := newTestTraces(
+		testSpan{service: "frontend", name: "GET /healthz", traceID: 1},
+		testSpan{service: "frontend", name: "GET /", traceID: 1},
+		testSpan{service: "debug-proxy", name: "proxy", traceID: 2},
+		testSpan{service: "frontend", name: "GET /debug", traceID: 2},
+		testSpan{service: "frontend", name: "GET /bot", traceID: 3, attrs: map[string]interface{}{"http.user_agent": "googlebot", "deployment.environment": "dev"}},
+		testSpan{service: "frontend", name: "GET /prod-bot", traceID: 3, attrs: map[string]interface{}{"http.user_agent": "googlebot", "deployment.environment": "prod"}},
+	)
+	health := testutil.ToFloat64(pgMetrics.IngestorTraceSpansDropped.With(prometheus.Labels{"reason": droppedByRule, "rule": "health"}))
+	debug := testutil.ToFloat64(pgMetrics.IngestorTraceSpansDropped.With(prometheus.Labels{"reason": droppedByRule, "rule": "debug"}))
+
+	p.process(traces)
+	require.Equal(t, []string{"GET /", "GET /prod-bot"}, spanNames(traces))
+	require.Equal(t, 2, traces.ResourceSpans().Len())
+	require.Equal(t, health+1, testutil.ToFloat64(pgMetrics.IngestorTraceSpansDropped.With(prometheus.Labels{"reason": droppedByRule, "rule": "health"})))
+	require.Equal(t, debug+2, testutil.ToFloat64(pgMetrics.IngestorTraceSpansDropped.With(prometheus.Labels{"reason": droppedByRule, "rule": "debug"})))
+}
+
+func TestTracePreprocessorAttributes(t *testing.T) {
+	p, err := newTracePreprocessor(&TracePreprocessingConfig{HashKey: "secret", Attributes: []AttributeRule{
+		{Name: "cards", Action: AttributeActionMask, Key: "http.url", ValueRegex: `\b[0-9]{4}(-?[0-9]{4}){3}\b`},
+		{Action: AttributeActionHash, Key: "user.email"},
+		{Action: AttributeActionRemove, KeyRegex: `.*\.secret|__.*`},
+		{Action: AttributeActionMask, Key: "ssn", Mask: "<redacted>"},
+	}})
+	require.NoError(t, err)
+
+	traces := newTestTraces(testSpan{service: "frontend", name: "GET /pay", attrs: map[string]interface{}{
+		"http.url":   "https://shop/pay?card=1234-5678-9012-3456&id=1",
+		"user.email": "a@b.c",
+		"db.secret":  "hunter2",
+		"ssn":        int64(123456789),
+		"__other":    "x",
+	}})
+	rs := traces.ResourceSpans().At(0)
+	rs.Resource().Attributes().PutString("token.secret", "abc")
+	rs.Resource().Attributes().PutString(tenancy.TenantLabelKey, "tenant-a")
+	event := rs.ScopeSpans().At(0).Spans().At(0).Events().AppendEmpty()
+	event.Attributes().PutString("user.email", "a@b.c")
+	link := rs.ScopeSpans().At(0).Spans().At(0).Links().AppendEmpty()
+	link.Attributes().PutString("user.email", "a@b.c")
+	scope := rs.ScopeSpans().At(0).Scope()
+	scope.Attributes().PutString("db.secret", "hunter2")
+
+	removed := testutil.ToFloat64(pgMetrics.IngestorTraceAttributesModified.With(prometheus.Labels{"action": AttributeActionRemove, "rule": "2"}))
+	p.process(traces)
+
+	attrs := rs.ScopeSpans().At(0).Spans().At(0).Attributes().AsRaw()
+	require.Equal(t, "https://shop/pay?card=****&id=1", attrs["http.url"])
+	// HMAC-SHA256 of the value with the hash key.
+	require.Equal(t, "0ce3629b4ac1ef1367b15f9d7659135a1c8663659b98cfd72c175d86612f7879", attrs["user.email"])
+	require.Equal(t, "<redacted>", attrs["ssn"])
+	require.NotContains(t, attrs, "db.secret")
+	require.NotContains(t, attrs, "__other")
+	require.Equal(t, attrs["user.email"], event.Attributes().AsRaw()["user.email"])
+	require.Equal(t, attrs["user.email"], link.Attributes().AsRaw()["user.email"])
+	require.Empty(t, scope.Attributes().AsRaw())
+	require.Equal(t, map[string]interface{}{serviceNameAttrKey: "frontend", tenancy.TenantLabelKey: "tenant-a"}, rs.Resource().Attributes().AsRaw())
+	require.Equal(t, removed+4, testutil.ToFloat64(pgMetrics.IngestorTraceAttributesModified.With(prometheus.Labels{"action": AttributeActionRemove, "rule": "2"})))
+}
+
+func TestTracePreprocessorRateLimits(t *testing.T) {
+	p, err := newTracePreprocessor(&TracePreprocessingConfig{RateLimits: SpanRateLimitConfig{
+		SpansPerSecond: 2,
+		Services:       map[string]float64{"unlimited": 0, "slow": 1},
+	}})
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	p.now = func() time.Time { return now }
+
+	newSpans := func(service string, n int) []testSpan {
+		spans := make([]testSpan, n)
+		for i := range spans {
+			spans[i] = testSpan{service: service, name: service}
+		}
+		return spans
+	}
+	spans := append(newSpans("frontend", 3), newSpans("unlimited", 5)...)
+	spans = append(spans, newSpans("slow", 2)...)
+	traces := newTestTraces(spans...)
+	p.process(traces)
+	require.Equal(t, 2+5+1, traces.SpanCount())
+
+	now = now.Add(time.Second)
+	traces = newTestTraces(newSpans("frontend", 3)...)
+	restore := p.process(traces)
+	require.Equal(t, 2, traces.SpanCount())
+
+	// The tokens of the spans that fail to be written are given back.
+	restore()
+	traces = newTestTraces(newSpans("frontend", 3)...)
+	p.process(traces)
+	require.Equal(t, 2, traces.SpanCount())
+	traces = newTestTraces(newSpans("frontend", 1)...)
+	p.process(traces)
+	require.Equal(t, 0, traces.SpanCount())
+}
+
+type failingTraceWriter struct {
+	err     error
+	written int
+}
+
+func (w *failingTraceWriter) InsertTraces(_ context.Context, traces ptrace.Traces) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.written += traces.SpanCount()
+	return nil
+}
+
+func (w *failingTraceWriter) Close() {}
+
+func TestIngestTracesRateLimitTokens(t *testing.T) {
+	p, err := newTracePreprocessor(&TracePreprocessingConfig{RateLimits: SpanRateLimitConfig{SpansPerSecond: 2}})
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	p.now = func() time.Time { return now }
+	queueUtilization := 1.0
+	writer := &failingTraceWriter{}
+	ingestor := &DBIngestor{
+		tWriter:           writer,
+		closed:            atomic.NewBool(false),
+		tracesAdmission:   newAdmissionController("trace", AdmissionConfig{MaxQueueUtilization: 0.5}, func() float64 { return queueUtilization }),
+		tracePreprocessor: p,
+	}
+	spans := []testSpan{{service: "frontend", name: "a"}, {service: "frontend", name: "b"}}
+
+	// The writes rejected by the admission control and the failed writes don't take
+	// the tokens of the rate limit.
+	var overloaded *OverloadedError
+	require.ErrorAs(t, ingestor.IngestTraces(context.Background(), newTestTraces(spans...)), &overloaded)
+	queueUtilization = 0
+	writer.err = errors.New("write failed")
+	require.Error(t, ingestor.IngestTraces(context.Background(), newTestTraces(spans...)))
+
+	writer.err = nil
+	require.NoError(t, ingestor.IngestTraces(context.Background(), newTestTraces(spans...)))
+	require.Equal(t, 2, writer.written)
+	require.NoError(t, ingestor.IngestTraces(context.Background(), newTestTraces(spans...)))
+	require.Equal(t, 2, writer.written)
+}
+
+func TestLoadTracePreprocessingConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preprocessing.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+drop:
+  - name: health
+    operation: GET /health
+attributes:
+  - action: remove
+    key: http.user_agent
+rate_limits:
+  spans_per_second: 100
+  services:
+    frontend: 1000
+`), 0600))
+	cfg, err := LoadTracePreprocessingConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, &TracePreprocessingConfig{
+		Drop:       []TraceDropRule{{Name: "health", Operation: "GET /health"}},
+		Attributes: []AttributeRule{{Action: AttributeActionRemove, Key: "http.user_agent"}},
+		RateLimits: SpanRateLimitConfig{SpansPerSecond: 100, Services: map[string]float64{"frontend": 1000}},
+	}, cfg)
+
+	keyPath := filepath.Join(t.TempDir(), "hash.key")
+	require.NoError(t, os.WriteFile(keyPath, []byte("secret\n"), 0600))
+	require.NoError(t, os.WriteFile(path, []byte("hash_key_file: "+keyPath+"\nattributes:\n  - action: hash\n    key: user.email\n"), 0600))
+	cfg, err = LoadTracePreprocessingConfig(path)
+	require.NoError(t, err)
+	hashKey, err := readHashKey(cfg)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), hashKey)
+
+	require.NoError(t, os.WriteFile(path, []byte("drop:\n  - services: a\n"), 0600))
+	_, err = LoadTracePreprocessingConfig(path)
+	require.ErrorContains(t, err, "field services not found")
+}
@@ -45,3 +45,25 @@ func MetricQuery(ctx context.Context, conn pgxconn.PgxConn, metric string, limit
 	}
 	return metricFamilies, nil
 }
+
+// MetricsQuery returns the metadata of the metric families, the latest first.
+func MetricsQuery(ctx context.Context, conn pgxconn.PgxConn, metrics []string) (map[string][]model.Metadata, error) {
+	rows, err := conn.Query(ctx, "SELECT metric_family, type, unit, help from _prom_catalog.metadata WHERE metric_family = ANY($1) ORDER BY metric_family, last_seen DESC", metrics)
+	if err != nil {
+		return nil, fmt.Errorf("query metric metadata: %w", err)
+	}
+	defer rows.Close()
+	metricFamilies := make(map[string][]model.Metadata)
+	for rows.Next() {
+		var metricFamily, typ, unit, help string
+		if err := rows.Scan(&metricFamily, &typ, &unit, &help); err != nil {
+			return nil, fmt.Errorf("query result: %w", err)
+		}
+		metricFamilies[metricFamily] = append(metricFamilies[metricFamily], model.Metadata{
+			Unit: unit,
+			Type: typ,
+			Help: help,
+		})
+	}
+	return metricFamilies, rows.Err()
+}
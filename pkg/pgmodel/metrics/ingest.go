@@ -201,6 +201,78 @@ var (
 			Help:      "Number of active user requests in queue.",
 		}, []string{"type", "queue_idx"},
 	)
+	IngestorShedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "shed_requests_total",
+			Help:      "Total number of write requests rejected because the ingest was overloaded.",
+		}, []string{"type", "reason"},
+	)
+	IngestorShedBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "shed_bytes_total",
+			Help:      "Total bytes of write requests rejected because the ingest was overloaded.",
+		}, []string{"type", "reason"},
+	)
+	IngestorInflightBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "inflight_bytes",
+			Help:      "Bytes of write requests that are currently being ingested.",
+		}, []string{"type"},
+	)
+	IngestorInflightBytesLimit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "inflight_bytes_limit",
+			Help:      "Maximum bytes of write requests that can be ingested at once. Zero means unlimited.",
+		}, []string{"type"},
+	)
+	IngestorCardinalityRejectedSeries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "cardinality_rejected_series_total",
+			Help:      "Total number of new series rejected by the cardinality limits.",
+		}, []string{"metric", "reason"},
+	)
+	IngestorCardinalityRejectedSamples = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "cardinality_rejected_samples_total",
+			Help:      "Total number of samples and exemplars dropped because their series were rejected by the cardinality limits.",
+		}, []string{"metric"},
+	)
+	IngestorOutOfBounds = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "out_of_bounds_total",
+			Help:      "Total number of samples and exemplars rejected for being outside the accepted time window.",
+		}, []string{"kind", "reason"},
+	)
+	IngestorTraceSpansDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "trace_spans_dropped_total",
+			Help:      "Total number of spans dropped by the trace preprocessing drop rules and rate limits.",
+		}, []string{"reason", "rule"},
+	)
+	IngestorTraceAttributesModified = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: util.PromNamespace,
+			Subsystem: "ingest",
+			Name:      "trace_attributes_modified_total",
+			Help:      "Total number of span, event and resource attributes hashed, masked or removed by the trace preprocessing attribute rules.",
+		}, []string{"action", "rule"},
+	)
 )
 
 func init() {
@@ -227,6 +299,15 @@ func init() {
 		IngestorBatchFlushTotal,
 		IngestorPendingBatches,
 		IngestorRequestsQueued,
+		IngestorShedRequests,
+		IngestorShedBytes,
+		IngestorInflightBytes,
+		IngestorInflightBytesLimit,
+		IngestorCardinalityRejectedSeries,
+		IngestorCardinalityRejectedSamples,
+		IngestorOutOfBounds,
+		IngestorTraceSpansDropped,
+		IngestorTraceAttributesModified,
 	)
 }
 
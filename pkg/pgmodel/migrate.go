@@ -30,6 +30,14 @@ const (
 	preinstallScripts = "preinstall"
 	versionScripts    = "versions/dev"
 	idempotentScripts = "idempotent"
+	connectorScripts  = "connector"
+
+	createConnectorMigrationsTable = `CREATE TABLE IF NOT EXISTS _ps_catalog.connector_migration (
+	version int NOT NULL PRIMARY KEY,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`
+	getConnectorVersion = "SELECT coalesce(max(version), 0) FROM _ps_catalog.connector_migration"
+	setConnectorVersion = "INSERT INTO _ps_catalog.connector_migration (version) VALUES ($1)"
 )
 
 var (
@@ -171,6 +179,60 @@ func (t *Migrator) Migrate(appVersion semver.Version) error {
 	return nil
 }
 
+// MigrateConnector applies the migration scripts of the objects owned by the
+// connector rather than by the Promscale extension. The scripts are numbered and
+// each of them is applied once, in order, recording its number in
+// _ps_catalog.connector_migration.
+func (t *Migrator) MigrateConnector() error {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+
+	if _, err = tx.Exec(context.Background(), createConnectorMigrationsTable); err != nil {
+		return fmt.Errorf("error creating connector migration table: %w", err)
+	}
+	if _, err = tx.Exec(context.Background(), "GRANT SELECT ON _ps_catalog.connector_migration TO prom_reader"); err != nil {
+		return fmt.Errorf("error creating connector migration table: %w", err)
+	}
+	var applied int
+	if err = tx.QueryRow(context.Background(), getConnectorVersion).Scan(&applied); err != nil {
+		return fmt.Errorf("error getting connector migration version: %w", err)
+	}
+
+	f, err := t.sqlFiles.Open(connectorScripts)
+	if err != nil {
+		return fmt.Errorf("unable to get migration scripts: name %s, err %w", connectorScripts, err)
+	}
+	fileEntries, err := f.Readdir(-1)
+	if err != nil {
+		return fmt.Errorf("unable to read migration scripts directory: name %s, err %w", connectorScripts, err)
+	}
+	for _, name := range orderFilesNaturally(fileEntries) {
+		var version int
+		if _, err = fmt.Sscanf(name, "%d-", &version); err != nil {
+			return fmt.Errorf("unable to parse the migration file name %v: %w", name, err)
+		}
+		if version <= applied {
+			continue
+		}
+		if err = t.execMigrationFile(tx, filepath.Join(connectorScripts, name)); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(context.Background(), setConnectorVersion, version); err != nil {
+			return fmt.Errorf("error setting connector migration version: %w", err)
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("unable to commit migration transaction: %w", err)
+	}
+	return nil
+}
+
 func ensureVersionTable(db *pgx.Conn) error {
 	_, err := db.Exec(context.Background(), createMigrationsTable)
 	if err != nil {
@@ -65,6 +65,30 @@ func (t *Batch) AppendSlice(s []Insertable) {
 	}
 }
 
+// Filter removes the insertables for which keep returns false. It returns the
+// number of samples and exemplars removed.
+func (t *Batch) Filter(keep func(Insertable) bool) (numSamples, numExemplars int) {
+	kept := t.data[:0]
+	for _, d := range t.data {
+		if keep(d) {
+			kept = append(kept, d)
+			continue
+		}
+		if d.IsOfType(Sample) {
+			numSamples += d.Count()
+		} else {
+			numExemplars += d.Count()
+		}
+	}
+	for i := len(kept); i < len(t.data); i++ {
+		t.data[i] = nil
+	}
+	t.data = kept
+	t.numSamples -= numSamples
+	t.numExemplars -= numExemplars
+	return numSamples, numExemplars
+}
+
 func (t *Batch) Visitor() *batchVisitor {
 	return getBatchVisitor(t)
 }
@@ -149,6 +149,9 @@ func Migrate(conn *pgx.Conn, appVersion VersionInfo, leaseLock *util.PgAdvisoryL
 			return err
 		}
 	}
+	if err = NewMigrator(conn, migrations.MigrationFiles, TableOfContents).MigrateConnector(); err != nil {
+		return fmt.Errorf("error applying the connector migrations: %w", err)
+	}
 	return nil
 }
 
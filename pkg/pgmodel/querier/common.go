@@ -47,6 +47,9 @@ func fromLabelMatchers(matchers []*prompb.LabelMatcher) ([]*labels.Matcher, erro
 type QueryHints struct {
 	CurrentNode parser.Node
 	Lookback    time.Duration
+	// SeriesLimit is the maximum number of series returned by the selects of
+	// SeriesFunc. Zero means no limit.
+	SeriesLimit int
 }
 
 func GetMetricNameSeriesIds(ctx context.Context, conn pgxconn.PgxConn, metadata *evalMetadata) (metrics, schemas []string, correspondingSeriesIDs [][]model.SeriesID, err error) {
@@ -25,6 +25,9 @@ func newQuerySamples(ctx context.Context, qr *pgxQuerier) *querySamples {
 // Select implements the SamplesQuerier interface. It is the entry point for our
 // own version of the Prometheus engine.
 func (q *querySamples) Select(mint, maxt int64, _ bool, hints *storage.SelectHints, qh *QueryHints, path []parser.Node, ms ...*labels.Matcher) (seriesSet SeriesSet, node parser.Node) {
+	if hints != nil && hints.Func == SeriesFunc {
+		return q.selectSeries(mint, maxt, hints, qh, ms), nil
+	}
 	sampleRows, topNode, err := q.fetchSamplesRows(mint, maxt, hints, qh, path, ms)
 	if err != nil {
 		return errorSeriesSet{err: err}, nil
@@ -0,0 +1,217 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/timescale/promscale/pkg/pgmodel/common/errors"
+	"github.com/timescale/promscale/pkg/pgmodel/common/schema"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+const (
+	// SeriesFunc is the storage.SelectHints Func of the selects that only need the
+	// labels of the series, like the series API of Prometheus. Their samples are
+	// not read.
+	SeriesFunc = "series"
+
+	// seriesSQLFormat selects the labels of the series of a metric that have a
+	// sample in the time range, which is an index lookup per series instead of
+	// reading all of their samples.
+	seriesSQLFormat = `SELECT series.labels
+	FROM %[2]s series
+	WHERE %[3]s
+	AND EXISTS (
+		SELECT 1 FROM %[1]s metric
+		WHERE metric.series_id = series.id
+		AND metric.time >= '%[4]s'
+		AND metric.time <= '%[5]s'
+	)
+	%[6]s`
+)
+
+// selectSeries returns the series matching ms that have samples between mint and
+// maxt, without their samples. At most qh.SeriesLimit series are returned if it
+// is set.
+func (q *querySamples) selectSeries(mint, maxt int64, hints *storage.SelectHints, qh *QueryHints, ms []*labels.Matcher) SeriesSet {
+	metadata, err := getEvaluationMetadata(q.tools, mint, maxt, GetPromQLMetadata(ms, hints, qh, nil))
+	if err != nil {
+		return errorSeriesSet{err: fmt.Errorf("get evaluation metadata: %w", err)}
+	}
+	limit := 0
+	if qh != nil {
+		limit = qh.SeriesLimit
+	}
+
+	var rows []seriesRow
+	if metadata.isSingleMetric {
+		filter := metadata.timeFilter
+		mInfo, err := q.tools.getMetricTableName(q.ctx, filter.schema, filter.metric, false)
+		if err != nil {
+			if err == errors.ErrMissingTableName {
+				return &labelsSeriesSet{idx: -1}
+			}
+			return errorSeriesSet{err: fmt.Errorf("get metric table name: %w", err)}
+		}
+		filter.metric, filter.schema, filter.seriesTable = mInfo.TableName, mInfo.TableSchema, mInfo.SeriesTable
+		rows, err = fetchSeriesRows(q.ctx, q.tools, filter, metadata.clauses, metadata.values, limit)
+		if err != nil {
+			return errorSeriesSet{err: err}
+		}
+	} else {
+		metrics, schemas, seriesIDs, err := GetMetricNameSeriesIds(q.ctx, q.tools.conn, metadata)
+		if err != nil {
+			return errorSeriesSet{err: err}
+		}
+		for i := range metrics {
+			if limit > 0 && len(rows) >= limit {
+				break
+			}
+			mInfo, err := q.tools.getMetricTableName(q.ctx, schemas[i], metrics[i], false)
+			if err != nil {
+				if err == errors.ErrMissingTableName {
+					continue
+				}
+				return errorSeriesSet{err: err}
+			}
+			filter := timeFilter{
+				metric:      mInfo.TableName,
+				schema:      mInfo.TableSchema,
+				seriesTable: mInfo.SeriesTable,
+				start:       metadata.timeFilter.start,
+				end:         metadata.timeFilter.end,
+			}
+			ids := make([]int64, len(seriesIDs[i]))
+			for j, id := range seriesIDs[i] {
+				ids[j] = int64(id)
+			}
+			remaining := 0
+			if limit > 0 {
+				remaining = limit - len(rows)
+			}
+			metricRows, err := fetchSeriesRows(q.ctx, q.tools, filter, []string{"series.id = ANY($1)"}, []interface{}{ids}, remaining)
+			if err != nil {
+				return errorSeriesSet{err: err}
+			}
+			rows = append(rows, metricRows...)
+		}
+	}
+	return buildLabelsSeriesSet(rows, q.tools.labelsReader)
+}
+
+// seriesRow is the label IDs of a series, and the metric name replacing the one
+// of the labels for the metric views sharing the series table of another metric.
+type seriesRow struct {
+	labelIDs       []*int64
+	metricOverride string
+	schema         string
+	column         string
+}
+
+func fetchSeriesRows(ctx context.Context, tools *queryTools, filter timeFilter, clauses []string, values []interface{}, limit int) ([]seriesRow, error) {
+	limitClause := ""
+	if limit > 0 {
+		limitClause = fmt.Sprintf("LIMIT %d", limit)
+	}
+	sql := fmt.Sprintf(seriesSQLFormat,
+		pgx.Identifier{filter.schema, filter.metric}.Sanitize(),
+		pgx.Identifier{schema.PromDataSeries, filter.seriesTable}.Sanitize(),
+		strings.Join(clauses, " AND "),
+		filter.start,
+		filter.end,
+		limitClause,
+	)
+	rows, err := tools.conn.Query(ctx, sql, values...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching series: %w", err)
+	}
+	defer rows.Close()
+
+	metricOverride := ""
+	if filter.metric != filter.seriesTable {
+		metricOverride = filter.metric
+	}
+	var result []seriesRow
+	for rows.Next() {
+		row := seriesRow{metricOverride: metricOverride, schema: filter.schema, column: filter.column}
+		if err = rows.Scan(&row.labelIDs); err != nil {
+			return nil, fmt.Errorf("fetching series: %w", err)
+		}
+		result = append(result, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("fetching series: %w", err)
+	}
+	return result, nil
+}
+
+func buildLabelsSeriesSet(rows []seriesRow, querier labelQuerier) SeriesSet {
+	labelIDMap := make(map[int64]labels.Label)
+	for _, row := range rows {
+		for _, id := range row.labelIDs {
+			if id != nil && *id != 0 {
+				labelIDMap[*id] = labels.Label{}
+			}
+		}
+	}
+	if len(labelIDMap) > 0 {
+		if err := querier.LabelsForIdMap(labelIDMap); err != nil {
+			return errorSeriesSet{err: err}
+		}
+	}
+
+	set := &labelsSeriesSet{idx: -1, series: make([]labels.Labels, 0, len(rows))}
+	for _, row := range rows {
+		lset, err := getLabelsFromLabelIds(row.labelIDs, labelIDMap)
+		if err != nil {
+			return errorSeriesSet{err: err}
+		}
+		if row.metricOverride != "" {
+			for i := range lset {
+				if lset[i].Name == model.MetricNameLabelName {
+					lset[i].Value = row.metricOverride
+					break
+				}
+			}
+		}
+		sr := sampleRow{schema: row.schema, column: row.column}
+		lset = append(lset, sr.GetAdditionalLabels()...)
+		sort.Sort(lset)
+		set.series = append(set.series, lset)
+	}
+	sort.Slice(set.series, func(i, j int) bool {
+		return labels.Compare(set.series[i], set.series[j]) < 0
+	})
+	return set
+}
+
+// labelsSeriesSet is a sorted set of series without samples.
+type labelsSeriesSet struct {
+	idx    int
+	series []labels.Labels
+}
+
+func (s *labelsSeriesSet) Next() bool {
+	if s.idx < len(s.series) {
+		s.idx++
+	}
+	return s.idx < len(s.series)
+}
+
+func (s *labelsSeriesSet) At() storage.Series {
+	return storage.NewListSeries(s.series[s.idx], nil)
+}
+
+func (s *labelsSeriesSet) Err() error                 { return nil }
+func (s *labelsSeriesSet) Warnings() storage.Warnings { return nil }
+func (s *labelsSeriesSet) Close()                     {}
@@ -0,0 +1,154 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package querier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+func TestSelectSeries(t *testing.T) {
+	testCases := []struct {
+		name       string
+		matchers   []*labels.Matcher
+		limit      int
+		result     []labels.Labels
+		sqlQueries []model.SqlQuery
+	}{
+		{
+			name:     "single metric",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabelName, "bar")},
+			limit:    2,
+			result: []labels.Labels{
+				labels.FromStrings(model.MetricNameLabelName, "bar", "job", "a"),
+				labels.FromStrings(model.MetricNameLabelName, "bar", "job", "b"),
+			},
+			sqlQueries: []model.SqlQuery{
+				{
+					Sql:     "SELECT id, table_schema, table_name, series_table FROM _prom_catalog.get_metric_table_name_if_exists($1, $2)",
+					Args:    []interface{}{"", "bar"},
+					Results: model.RowResults{{int64(1), "prom_data", "bar", "bar"}},
+				},
+				{
+					Sql: `SELECT series.labels
+					FROM "prom_data_series"."bar" series
+					WHERE TRUE
+					AND EXISTS (
+						SELECT 1 FROM "prom_data"."bar" metric
+						WHERE metric.series_id = series.id
+						AND metric.time >= '1970-01-01T00:00:01Z'
+						AND metric.time <= '1970-01-01T00:00:02Z'
+					)
+					LIMIT 2`,
+					Results: model.RowResults{
+						{[]*int64{util.Pointer(int64(3)), util.Pointer(int64(4))}},
+						{[]*int64{util.Pointer(int64(3)), util.Pointer(int64(2))}},
+					},
+				},
+			},
+		},
+		{
+			name:     "several metrics",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "a")},
+			result: []labels.Labels{
+				labels.FromStrings(model.MetricNameLabelName, "bar", "job", "a"),
+				labels.FromStrings(model.MetricNameLabelName, "foo", "job", "a"),
+			},
+			sqlQueries: []model.SqlQuery{
+				{
+					Sql: "SELECT m.table_schema, m.metric_name, array_agg(s.id)\n\t" +
+						"FROM _prom_catalog.series s\n\t" +
+						"INNER JOIN _prom_catalog.metric m\n\t" +
+						"ON (m.id = s.metric_id)\n\t" +
+						"WHERE labels && (SELECT COALESCE(array_agg(l.id), array[]::int[]) FROM _prom_catalog.label l WHERE l.key = $1 and l.value = $2)\n\t" +
+						"GROUP BY m.metric_name, m.table_schema\n\t" +
+						"ORDER BY m.metric_name, m.table_schema",
+					Args:    []interface{}{"job", "a"},
+					Results: model.RowResults{{"prom_data", "foo", []int64{4}}, {"prom_data", "bar", []int64{5}}},
+				},
+				{
+					Sql:     "SELECT id, table_schema, table_name, series_table FROM _prom_catalog.get_metric_table_name_if_exists($1, $2)",
+					Args:    []interface{}{"prom_data", "foo"},
+					Results: model.RowResults{{int64(1), "prom_data", "foo", "foo"}},
+				},
+				{
+					Sql: `SELECT series.labels
+					FROM "prom_data_series"."foo" series
+					WHERE series.id = ANY($1)
+					AND EXISTS (
+						SELECT 1 FROM "prom_data"."foo" metric
+						WHERE metric.series_id = series.id
+						AND metric.time >= '1970-01-01T00:00:01Z'
+						AND metric.time <= '1970-01-01T00:00:02Z'
+					)`,
+					Args:    []interface{}{[]int64{4}},
+					Results: model.RowResults{{[]*int64{util.Pointer(int64(1)), util.Pointer(int64(2))}}},
+				},
+				{
+					Sql:     "SELECT id, table_schema, table_name, series_table FROM _prom_catalog.get_metric_table_name_if_exists($1, $2)",
+					Args:    []interface{}{"prom_data", "bar"},
+					Results: model.RowResults{{int64(2), "prom_data", "bar", "bar"}},
+				},
+				{
+					Sql: `SELECT series.labels
+					FROM "prom_data_series"."bar" series
+					WHERE series.id = ANY($1)
+					AND EXISTS (
+						SELECT 1 FROM "prom_data"."bar" metric
+						WHERE metric.series_id = series.id
+						AND metric.time >= '1970-01-01T00:00:01Z'
+						AND metric.time <= '1970-01-01T00:00:02Z'
+					)`,
+					Args:    []interface{}{[]int64{5}},
+					Results: model.RowResults{{[]*int64{util.Pointer(int64(3)), util.Pointer(int64(2))}}},
+				},
+			},
+		},
+	}
+
+	labelsStub := stubLabelsReader{mapQuerier{mapping: map[int64]struct {
+		k string
+		v string
+	}{
+		1: {model.MetricNameLabelName, "foo"},
+		2: {"job", "a"},
+		3: {model.MetricNameLabelName, "bar"},
+		4: {"job", "b"},
+	}}}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			mock := model.NewSqlRecorder(c.sqlQueries, t)
+			mockMetrics := &model.MockMetricCache{MetricCache: make(map[string]model.MetricInfo)}
+			querier := pgxQuerier{&queryTools{conn: mock, metricTableNames: mockMetrics, labelsReader: labelsStub}}
+
+			hints := &storage.SelectHints{Start: 1000, End: 2000, Func: SeriesFunc}
+			ss, _ := querier.SamplesQuerier(context.Background()).Select(1000, 2000, false, hints, &QueryHints{SeriesLimit: c.limit}, nil, c.matchers...)
+			defer ss.Close()
+
+			var result []labels.Labels
+			for ss.Next() {
+				s := ss.At()
+				result = append(result, s.Labels())
+				require.False(t, s.Iterator().Next(), "series should have no samples")
+			}
+			require.NoError(t, ss.Err())
+			require.Equal(t, c.result, result)
+		})
+	}
+}
+
+type stubLabelsReader struct {
+	mapQuerier
+}
+
+func (stubLabelsReader) LabelNames() ([]string, error)        { return nil, nil }
+func (stubLabelsReader) LabelValues(string) ([]string, error) { return nil, nil }
@@ -0,0 +1,201 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package promql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	pgquerier "github.com/timescale/promscale/pkg/pgmodel/querier"
+)
+
+// exemplarFunctions are the functions whose result carries the exemplars of their
+// argument. The value tells if the function drops the metric name, as the
+// evaluation of the function does.
+var exemplarFunctions = map[string]bool{
+	"avg_over_time":      true,
+	"delta":              true,
+	"histogram_quantile": true,
+	"idelta":             true,
+	"increase":           true,
+	"irate":              true,
+	"last_over_time":     false,
+	"max_over_time":      true,
+	"min_over_time":      true,
+	"quantile_over_time": true,
+	"rate":               true,
+	"sum_over_time":      true,
+}
+
+// exemplarAggregations are the aggregations whose result carries the exemplars of
+// the aggregated series.
+var exemplarAggregations = map[parser.ItemType]struct{}{
+	parser.AVG:   {},
+	parser.COUNT: {},
+	parser.MAX:   {},
+	parser.MIN:   {},
+	parser.SUM:   {},
+}
+
+// QueryExemplars returns the exemplars of the series selected by the instant query qs
+// at ts, labeled with the series of the query result they contribute to.
+//
+// The exemplars are carried through the functions in exemplarFunctions, the
+// aggregations in exemplarAggregations, and the arithmetic and comparison operations
+// with one-to-one vector matching. The selectors used in any other expression, such as
+// subqueries, do not contribute exemplars to the result. The result is not filtered by
+// the values of the series, so it may contain series missing in the query result.
+func (ng *Engine) QueryExemplars(ctx context.Context, q Queryable, qs string, ts time.Time) ([]model.ExemplarQueryResult, error) {
+	expr, err := parser.ParseExpr(qs)
+	if err != nil {
+		return nil, err
+	}
+	querier := q.ExemplarsQuerier(ctx)
+	if querier == nil {
+		return nil, nil
+	}
+	s := &parser.EvalStmt{
+		Expr:          PreprocessExpr(expr, ts, ts),
+		Start:         ts,
+		End:           ts,
+		LookbackDelta: ng.lookbackDelta,
+	}
+	results, err := ng.carryExemplars(querier, s, s.Expr, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		sort.Slice(r.Exemplars, func(i, j int) bool {
+			return r.Exemplars[i].Ts < r.Exemplars[j].Ts
+		})
+	}
+	return results, nil
+}
+
+// carryExemplars returns the exemplars of the series of the result of expr. evalRange
+// is the range of the matrix selector being evaluated, if any.
+func (ng *Engine) carryExemplars(querier pgquerier.ExemplarQuerier, s *parser.EvalStmt, expr parser.Expr, evalRange time.Duration) ([]model.ExemplarQueryResult, error) {
+	switch n := expr.(type) {
+	case *parser.ParenExpr:
+		return ng.carryExemplars(querier, s, n.Expr, evalRange)
+	case *parser.StepInvariantExpr:
+		return ng.carryExemplars(querier, s, n.Expr, evalRange)
+	case *parser.MatrixSelector:
+		return ng.carryExemplars(querier, s, n.VectorSelector, n.Range)
+	case *parser.VectorSelector:
+		start, end := ng.getTimeRangesForSelector(s, n, nil, evalRange)
+		results, err := querier.Select(timestamp.Time(start), timestamp.Time(end), n.LabelMatchers)
+		if err != nil {
+			return nil, fmt.Errorf("selecting exemplars: %w", err)
+		}
+		return results, nil
+	case *parser.Call:
+		dropName, ok := exemplarFunctions[n.Func.Name]
+		if !ok {
+			return nil, nil
+		}
+		var results []model.ExemplarQueryResult
+		for _, arg := range n.Args {
+			if t := arg.Type(); t != parser.ValueTypeVector && t != parser.ValueTypeMatrix {
+				continue
+			}
+			argResults, err := ng.carryExemplars(querier, s, arg, evalRange)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, argResults...)
+		}
+		return relabelExemplars(results, func(lb *labels.Builder) {
+			if dropName {
+				lb.Del(labels.MetricName)
+			}
+			if n.Func.Name == "histogram_quantile" {
+				lb.Del(labels.BucketLabel)
+			}
+		}), nil
+	case *parser.AggregateExpr:
+		if _, ok := exemplarAggregations[n.Op]; !ok {
+			return nil, nil
+		}
+		results, err := ng.carryExemplars(querier, s, n.Expr, evalRange)
+		if err != nil {
+			return nil, err
+		}
+		return relabelExemplars(results, func(lb *labels.Builder) {
+			if n.Without {
+				lb.Del(n.Grouping...)
+				lb.Del(labels.MetricName)
+			} else {
+				lb.Keep(n.Grouping...)
+			}
+		}), nil
+	case *parser.BinaryExpr:
+		if n.Op.IsSetOperator() {
+			return nil, nil
+		}
+		lhsVector, rhsVector := n.LHS.Type() == parser.ValueTypeVector, n.RHS.Type() == parser.ValueTypeVector
+		if lhsVector && rhsVector && n.VectorMatching.Card != parser.CardOneToOne {
+			return nil, nil
+		}
+		var results []model.ExemplarQueryResult
+		for _, side := range []parser.Expr{n.LHS, n.RHS} {
+			if side.Type() != parser.ValueTypeVector {
+				continue
+			}
+			sideResults, err := ng.carryExemplars(querier, s, side, evalRange)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, sideResults...)
+		}
+		return relabelExemplars(results, func(lb *labels.Builder) {
+			if shouldDropMetricName(n.Op) || n.ReturnBool {
+				lb.Del(labels.MetricName)
+			}
+			if lhsVector && rhsVector {
+				if n.VectorMatching.On {
+					lb.Keep(n.VectorMatching.MatchingLabels...)
+				} else {
+					lb.Del(n.VectorMatching.MatchingLabels...)
+				}
+			}
+		}), nil
+	default:
+		return nil, nil
+	}
+}
+
+// relabelExemplars changes the labels of the series of the results with relabel,
+// merging the exemplars of the series that end up with the same labels.
+func relabelExemplars(results []model.ExemplarQueryResult, relabel func(lb *labels.Builder)) []model.ExemplarQueryResult {
+	var (
+		merged  []model.ExemplarQueryResult
+		indexes = make(map[uint64]int, len(results))
+		lb      = labels.NewBuilder(nil)
+	)
+	for _, r := range results {
+		lb.Reset(r.SeriesLabels)
+		relabel(lb)
+		lset := lb.Labels(nil)
+		hash := lset.Hash()
+		if i, ok := indexes[hash]; ok {
+			merged[i].Exemplars = append(merged[i].Exemplars, r.Exemplars...)
+			continue
+		}
+		indexes[hash] = len(merged)
+		merged = append(merged, model.ExemplarQueryResult{
+			SeriesLabels: lset,
+			Exemplars:    append([]model.ExemplarData(nil), r.Exemplars...),
+		})
+	}
+	return merged
+}
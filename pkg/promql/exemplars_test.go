@@ -0,0 +1,196 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package promql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+)
+
+type exemplarSeries struct {
+	labels labels.Labels
+	ts     []int64
+}
+
+// exemplarsQueryable has exemplars for a fixed set of series. The value of each
+// exemplar is its timestamp.
+type exemplarsQueryable struct {
+	Queryable
+	series []exemplarSeries
+}
+
+func (q exemplarsQueryable) ExemplarsQuerier(context.Context) querier.ExemplarQuerier {
+	return q
+}
+
+func (q exemplarsQueryable) Select(start, end time.Time, ms ...[]*labels.Matcher) ([]model.ExemplarQueryResult, error) {
+	var results []model.ExemplarQueryResult
+	for _, s := range q.series {
+		for _, matchers := range ms {
+			if !matchLabels(s.labels, matchers) {
+				continue
+			}
+			r := model.ExemplarQueryResult{SeriesLabels: s.labels}
+			for _, ts := range s.ts {
+				if ts >= start.UnixMilli() && ts <= end.UnixMilli() {
+					r.Exemplars = append(r.Exemplars, model.ExemplarData{
+						Labels: labels.FromStrings("trace_id", s.labels.Get("instance")),
+						Value:  float64(ts),
+						Ts:     ts,
+					})
+				}
+			}
+			if len(r.Exemplars) > 0 {
+				results = append(results, r)
+			}
+			break
+		}
+	}
+	return results, nil
+}
+
+func matchLabels(lset labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueryExemplars(t *testing.T) {
+	queryable := exemplarsQueryable{series: []exemplarSeries{
+		{labels.FromStrings("__name__", "requests_total", "job", "api", "instance", "a", "code", "200"), []int64{60_000, 240_000}},
+		{labels.FromStrings("__name__", "requests_total", "job", "api", "instance", "b", "code", "500"), []int64{270_000, 400_000}},
+		{labels.FromStrings("__name__", "requests_total", "job", "db", "instance", "c", "code", "200"), []int64{290_000}},
+		{labels.FromStrings("__name__", "latency_bucket", "job", "api", "le", "0.1"), []int64{200_000}},
+		{labels.FromStrings("__name__", "latency_bucket", "job", "api", "le", "1"), []int64{250_000}},
+	}}
+	engine := NewEngine(EngineOpts{Timeout: time.Minute})
+	ts := time.Unix(300, 0)
+
+	type expectedSeries struct {
+		labels labels.Labels
+		ts     []int64
+	}
+	testCases := []struct {
+		name     string
+		query    string
+		expected []expectedSeries
+	}{
+		{
+			name:  "vector selector",
+			query: `requests_total{job="db"}`,
+			expected: []expectedSeries{
+				{labels.FromStrings("__name__", "requests_total", "job", "db", "instance", "c", "code", "200"), []int64{290_000}},
+			},
+		},
+		{
+			name:  "rate",
+			query: `rate(requests_total{job="api"}[1m])`,
+			expected: []expectedSeries{
+				{labels.FromStrings("job", "api", "instance", "a", "code", "200"), []int64{240_000}},
+				{labels.FromStrings("job", "api", "instance", "b", "code", "500"), []int64{270_000}},
+			},
+		},
+		{
+			name:  "offset",
+			query: `last_over_time(requests_total{instance="a"}[1m] offset 4m)`,
+			expected: []expectedSeries{
+				{labels.FromStrings("__name__", "requests_total", "job", "api", "instance", "a", "code", "200"), []int64{60_000}},
+			},
+		},
+		{
+			name:  "aggregation",
+			query: `sum by (job) (rate(requests_total[5m]))`,
+			expected: []expectedSeries{
+				{labels.FromStrings("job", "api"), []int64{60_000, 240_000, 270_000}},
+				{labels.FromStrings("job", "db"), []int64{290_000}},
+			},
+		},
+		{
+			name:  "aggregation without labels",
+			query: `sum without (instance, code) (requests_total)`,
+			expected: []expectedSeries{
+				{labels.FromStrings("job", "api"), []int64{60_000, 240_000, 270_000}},
+				{labels.FromStrings("job", "db"), []int64{290_000}},
+			},
+		},
+		{
+			name:  "histogram quantile",
+			query: `histogram_quantile(0.9, sum by (le) (rate(latency_bucket[5m])))`,
+			expected: []expectedSeries{
+				{labels.EmptyLabels(), []int64{200_000, 250_000}},
+			},
+		},
+		{
+			name:  "ratio",
+			query: `sum by (job) (rate(requests_total{code="500"}[5m])) / sum by (job) (rate(requests_total[5m]))`,
+			expected: []expectedSeries{
+				{labels.FromStrings("job", "api"), []int64{60_000, 240_000, 270_000, 270_000}},
+				{labels.FromStrings("job", "db"), []int64{290_000}},
+			},
+		},
+		{
+			name:  "scalar operation",
+			query: `(rate(requests_total{instance="c"}[5m]) * 60) > 0`,
+			expected: []expectedSeries{
+				{labels.FromStrings("job", "db", "instance", "c", "code", "200"), []int64{290_000}},
+			},
+		},
+		{
+			name:  "on matching",
+			query: `rate(requests_total{code="500"}[5m]) / on (job) sum by (job) (rate(requests_total[5m]))`,
+			expected: []expectedSeries{
+				{labels.FromStrings("job", "api"), []int64{60_000, 240_000, 270_000, 270_000}},
+				{labels.FromStrings("job", "db"), []int64{290_000}},
+			},
+		},
+		{
+			name:  "unsupported function",
+			query: `abs(requests_total)`,
+		},
+		{
+			name:  "many-to-one matching",
+			query: `requests_total / on (job) group_left sum by (job) (requests_total)`,
+		},
+		{
+			name:  "subquery",
+			query: `max_over_time(rate(requests_total[1m])[5m:1m])`,
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			results, err := engine.QueryExemplars(context.Background(), queryable, c.query, ts)
+			require.NoError(t, err)
+			require.Len(t, results, len(c.expected))
+			for i, e := range c.expected {
+				require.Equal(t, e.labels, results[i].SeriesLabels)
+				var got []int64
+				for _, exemplar := range results[i].Exemplars {
+					got = append(got, exemplar.Ts)
+				}
+				require.Equal(t, e.ts, got)
+			}
+		})
+	}
+
+	t.Run("no exemplar querier", func(t *testing.T) {
+		results, err := engine.QueryExemplars(context.Background(), &TestStorage{}, "rate(requests_total[5m])", ts)
+		require.NoError(t, err)
+		require.Empty(t, results)
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := engine.QueryExemplars(context.Background(), queryable, "rate(", ts)
+		require.Error(t, err)
+	})
+}
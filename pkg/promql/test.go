@@ -31,7 +31,6 @@ import (
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
-	"github.com/prometheus/prometheus/util/teststorage"
 	"github.com/prometheus/prometheus/util/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/timescale/promscale/pkg/pgmodel/querier"
@@ -742,7 +741,7 @@ type LazyLoader struct {
 
 	loadCmd *loadCmd
 
-	storage          storage.Storage
+	storage          *TestStorage
 	SubqueryInterval time.Duration
 
 	queryEngine *Engine
@@ -763,7 +762,8 @@ type LazyLoaderOpts struct {
 // NewLazyLoader returns an initialized empty LazyLoader.
 func NewLazyLoader(t testutil.T, input string, opts LazyLoaderOpts) (*LazyLoader, error) {
 	ll := &LazyLoader{
-		T: t,
+		T:    t,
+		opts: opts,
 	}
 	err := ll.parse(input)
 	ll.clear()
@@ -802,7 +802,7 @@ func (ll *LazyLoader) clear() {
 	if ll.cancelCtx != nil {
 		ll.cancelCtx()
 	}
-	ll.storage = teststorage.New(ll)
+	ll.storage = NewTestStorage(ll)
 
 	opts := EngineOpts{
 		Logger:                   nil,
@@ -858,6 +858,13 @@ func (ll *LazyLoader) Queryable() storage.Queryable {
 	return ll.storage
 }
 
+// SamplesQueryable allows querying the LazyLoader's data with its query engine.
+// Note: only the samples till the max timestamp used
+// in `WithSamplesTill` can be queried.
+func (ll *LazyLoader) SamplesQueryable() Queryable {
+	return ll.storage
+}
+
 // Context returns the LazyLoader's context.
 func (ll *LazyLoader) Context() context.Context {
 	return ll.context
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/prometheus/prometheus/model/metadata"
+	"net/http"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,24 +17,35 @@ import (
 	"github.com/timescale/promscale/pkg/pgmodel/metrics"
 	"github.com/timescale/promscale/pkg/pgmodel/model"
 	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
 	"github.com/timescale/promscale/pkg/util"
 )
 
-var samplesIngested = metrics.IngestorItems.With(map[string]string{"type": "metric", "kind": "sample", "subsystem": "rules"})
+var (
+	samplesIngested   = metrics.IngestorItems.With(map[string]string{"type": "metric", "kind": "sample", "subsystem": "rules"})
+	exemplarsIngested = metrics.IngestorItems.With(map[string]string{"type": "metric", "kind": "exemplar", "subsystem": "rules"})
+)
 
 type ingestAdapter struct {
-	inserter ingestor.DBInserter
+	inserter        ingestor.DBInserter
+	writeAuthorizer tenancy.WriteAuthorizer
 }
 
-// NewIngestAdapter acts as an adapter to make Promscale's DBIngestor compatible with storage.Appendable
-func NewIngestAdapter(inserter ingestor.DBInserter) *ingestAdapter {
-	return &ingestAdapter{inserter}
+// NewIngestAdapter acts as an adapter to make Promscale's DBIngestor compatible with storage.Appendable.
+// The samples appended with a tenant in the context are authorized by the writeAuthorizer, if any.
+func NewIngestAdapter(inserter ingestor.DBInserter, writeAuthorizer tenancy.WriteAuthorizer) *ingestAdapter {
+	return &ingestAdapter{inserter, writeAuthorizer}
 }
 
 type appenderAdapter struct {
 	data     map[string][]model.Insertable
 	inserter ingestor.DBInserter
 	closed   bool
+	// numExemplars is the number of exemplars in data.
+	numExemplars int
+	// tenantRequest carries the tenant of the samples to the writeAuthorizer.
+	tenantRequest   *http.Request
+	writeAuthorizer tenancy.WriteAuthorizer
 }
 
 func (app *appenderAdapter) UpdateMetadata(ref storage.SeriesRef, l labels.Labels, m metadata.Metadata) (storage.SeriesRef, error) {
@@ -51,41 +63,74 @@ func (app *appenderAdapter) UpdateMetadata(ref storage.SeriesRef, l labels.Label
 // Rollback() is called, after which, the appender must never be used.
 //
 // Note: The rule manager does not call Rollback() yet.
-func (a ingestAdapter) Appender(_ context.Context) storage.Appender {
-	return &appenderAdapter{
+func (a ingestAdapter) Appender(ctx context.Context) storage.Appender {
+	app := &appenderAdapter{
 		data:     make(map[string][]model.Insertable),
 		inserter: a.inserter,
 	}
+	if tenant := tenancy.TenantFromContext(ctx); tenant != "" && a.writeAuthorizer != nil {
+		app.tenantRequest = &http.Request{Header: http.Header{tenancy.TenantHeader: []string{tenant}}}
+		app.writeAuthorizer = a.writeAuthorizer
+	}
+	return app
 }
 
 func (app *appenderAdapter) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
-	if err := app.shouldAppend(); err != nil {
+	series, metricName, err := app.series(l)
+	if err != nil {
 		return 0, err
 	}
+	app.data[metricName] = append(app.data[metricName], model.NewPromSamples(series, []prompb.Sample{{Timestamp: t, Value: v}}))
+	return 0, nil
+}
+
+// series returns the series of the labels, authorized for the tenant of the appender.
+func (app *appenderAdapter) series(l labels.Labels) (*model.Series, string, error) {
+	if err := app.shouldAppend(); err != nil {
+		return nil, "", err
+	}
 	dbIngestor, err := getIngestor(app.inserter)
 	if err != nil {
-		return 0, fmt.Errorf("get ingestor: %w", err)
+		return nil, "", fmt.Errorf("get ingestor: %w", err)
+	}
+	lbls, err := app.authorize(util.LabelToPrompbLabels(l))
+	if err != nil {
+		return nil, "", err
 	}
-	series, metricName, err := dbIngestor.SeriesCache().GetSeriesFromProtos(util.LabelToPrompbLabels(l))
+	series, metricName, err := dbIngestor.SeriesCache().GetSeriesFromProtos(lbls)
 	if err != nil {
-		return 0, fmt.Errorf("get series from protos: %w", err)
+		return nil, "", fmt.Errorf("get series from protos: %w", err)
 	}
+	return series, metricName, nil
+}
 
-	samples := model.NewPromSamples(series, []prompb.Sample{{Timestamp: t, Value: v}})
-	if _, found := app.data[metricName]; !found {
-		app.data[metricName] = make([]model.Insertable, 0)
+// authorize labels the series with the tenant of the appender, failing if the series
+// belongs to another tenant.
+func (app *appenderAdapter) authorize(lbls []prompb.Label) ([]prompb.Label, error) {
+	if app.writeAuthorizer == nil {
+		return lbls, nil
 	}
-	app.data[metricName] = append(app.data[metricName], samples)
-	return 0, nil
+	wr := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{Labels: lbls}}}
+	if err := app.writeAuthorizer.Process(app.tenantRequest, wr); err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	return wr.Timeseries[0].Labels, nil
 }
 
+// AppendExemplar buffers the exemplar of the series with the samples, to be inserted on Commit().
 func (app *appenderAdapter) AppendExemplar(_ storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
-	if err := app.shouldAppend(); err != nil {
+	series, metricName, err := app.series(l)
+	if err != nil {
 		return 0, err
 	}
-	// We do not support appending exemplars in recording rules since this is not yet implemented upstream.
-	// Once upstream implements this feature, we can modify this function.
-	return 0, fmt.Errorf("promscale: appending exemplars in rules not implemented")
+	exemplars := model.NewPromExemplars(series, []prompb.Exemplar{{
+		Labels:    util.LabelToPrompbLabels(e.Labels),
+		Value:     e.Value,
+		Timestamp: e.Ts,
+	}})
+	app.data[metricName] = append(app.data[metricName], exemplars)
+	app.numExemplars++
+	return 0, nil
 }
 
 func (app *appenderAdapter) Commit() error {
@@ -94,7 +139,7 @@ func (app *appenderAdapter) Commit() error {
 	}
 	// Note: InsertTs does 2 things:
 	// 1. Ingest series
-	// 2. Ingest samples
+	// 2. Ingest samples and exemplars
 	//
 	// An error might occur while ingesting samples, so Prometheus will call the app.Rollback(). Do note that we cannot
 	// rollback the ingested series, rather only ingested samples since they were the last step that created the error.
@@ -104,7 +149,8 @@ func (app *appenderAdapter) Commit() error {
 	}
 	numInsertablesIngested, err := dbIngestor.Dispatcher().InsertTs(context.Background(), model.Data{Rows: app.data, ReceivedTime: time.Now()})
 	if err == nil {
-		samplesIngested.Add(float64(numInsertablesIngested))
+		samplesIngested.Add(float64(numInsertablesIngested) - float64(app.numExemplars))
+		exemplarsIngested.Add(float64(app.numExemplars))
 	}
 	return errors.WithMessage(err, "rules: error ingesting data into db-ingestor")
 }
@@ -119,6 +165,7 @@ func (app *appenderAdapter) shouldAppend() error {
 func (app *appenderAdapter) Rollback() error {
 	app.closed = true
 	app.data = map[string][]model.Insertable{}
+	app.numExemplars = 0
 	app.inserter = nil
 	return nil
 }
@@ -0,0 +1,316 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
+	prom_rules "github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgclient"
+	"github.com/timescale/promscale/pkg/rules/adapters"
+)
+
+// BackfillConfig configures the backfill of recording rules.
+type BackfillConfig struct {
+	Start        time.Time
+	End          time.Time
+	EvalInterval time.Duration
+	BatchSize    int
+	ProgressFile string
+
+	start, end string
+	// defaultEnd is set when the end of the time range isn't given, so that a resumed
+	// backfill ends where it was meant to end.
+	defaultEnd bool
+}
+
+var DefaultBackfillConfig = BackfillConfig{
+	EvalInterval: time.Minute,
+	BatchSize:    10000,
+	ProgressFile: "promscale-rules-backfill.json",
+}
+
+func ParseBackfillFlags(fs *flag.FlagSet, cfg *BackfillConfig) *BackfillConfig {
+	fs.StringVar(&cfg.start, "start", "", "Start of the time range to backfill, as a RFC3339 or Unix timestamp. Required.")
+	fs.StringVar(&cfg.end, "end", "", "End of the time range to backfill, as a RFC3339 or Unix timestamp. Defaults to the current time.")
+	fs.DurationVar(&cfg.EvalInterval, "eval-interval", DefaultBackfillConfig.EvalInterval, "Evaluation interval of the rule groups that don't define an interval.")
+	fs.IntVar(&cfg.BatchSize, "batch-size", DefaultBackfillConfig.BatchSize, "Number of samples written to the database at once. A batch always holds all the samples of an evaluation.")
+	fs.StringVar(&cfg.ProgressFile, "progress-file", DefaultBackfillConfig.ProgressFile, "File recording the progress of the backfill, to resume it where it stopped. Leave empty to always backfill the whole time range.")
+	return cfg
+}
+
+func ValidateBackfill(cfg *BackfillConfig) error {
+	if cfg.start == "" && cfg.Start.IsZero() {
+		return fmt.Errorf("the start of the time range is required")
+	}
+	var err error
+	if cfg.start != "" {
+		if cfg.Start, err = parseTime(cfg.start); err != nil {
+			return fmt.Errorf("invalid start: %w", err)
+		}
+	}
+	if cfg.end != "" {
+		if cfg.End, err = parseTime(cfg.end); err != nil {
+			return fmt.Errorf("invalid end: %w", err)
+		}
+	}
+	if cfg.End.IsZero() {
+		cfg.End = time.Now()
+		cfg.defaultEnd = true
+	}
+	if !cfg.End.After(cfg.Start) {
+		return fmt.Errorf("the end of the time range must be after its start")
+	}
+	if cfg.EvalInterval <= 0 {
+		return fmt.Errorf("the evaluation interval must be positive")
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("the batch size must be positive")
+	}
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+	}
+	return t, nil
+}
+
+// Backfill evaluates the recording rules of the rule files over the configured time
+// range, and writes their results into the database.
+func Backfill(ctx context.Context, client *pgclient.Client, cfg *BackfillConfig, files []string) error {
+	b := &backfiller{
+		cfg:        cfg,
+		queryFunc:  engineQueryFunc(client.QueryEngine(), client.Queryable()),
+		appendable: adapters.NewIngestAdapter(client.Inserter(), nil),
+	}
+	return b.run(ctx, files)
+}
+
+type backfiller struct {
+	cfg        *BackfillConfig
+	queryFunc  prom_rules.QueryFunc
+	appendable storage.Appendable
+	progress   *backfillProgress
+}
+
+// backfillProgress records the last evaluation written for each rule group.
+type backfillProgress struct {
+	Start  int64            `json:"start"`
+	End    int64            `json:"end"`
+	Groups map[string]int64 `json:"groups"`
+}
+
+// backfillGroup holds the recording rules of a rule group.
+type backfillGroup struct {
+	key      string
+	interval time.Duration
+	limit    int
+	rules    []*prom_rules.RecordingRule
+}
+
+func (b *backfiller) run(ctx context.Context, files []string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("no rule files to backfill")
+	}
+	var groups []backfillGroup
+	for _, file := range files {
+		fileGroups, err := b.loadGroups(file)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, fileGroups...)
+	}
+	if err := b.loadProgress(); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err := b.backfillGroup(ctx, group); err != nil {
+			return fmt.Errorf("backfilling rule group %s: %w", group.key, err)
+		}
+	}
+	return nil
+}
+
+func (b *backfiller) loadGroups(file string) ([]backfillGroup, error) {
+	ruleGroups, errs := rulefmt.ParseFile(file)
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return nil, fmt.Errorf("loading rule file %s: %s", file, strings.Join(msgs, "; "))
+	}
+	groups := make([]backfillGroup, 0, len(ruleGroups.Groups))
+	for _, g := range ruleGroups.Groups {
+		group := backfillGroup{
+			key:      file + ";" + g.Name,
+			interval: b.cfg.EvalInterval,
+			limit:    g.Limit,
+		}
+		if g.Interval != 0 {
+			group.interval = time.Duration(g.Interval)
+		}
+		for _, r := range g.Rules {
+			if r.Record.Value == "" {
+				log.Warn("msg", "Skipping alerting rule, only recording rules are backfilled", "group", group.key, "alert", r.Alert.Value)
+				continue
+			}
+			expr, err := parser.ParseExpr(r.Expr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("parsing expression of rule %s: %w", r.Record.Value, err)
+			}
+			group.rules = append(group.rules, prom_rules.NewRecordingRule(r.Record.Value, expr, labels.FromMap(r.Labels)))
+		}
+		if len(group.rules) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// backfillGroup evaluates the rules of the group at every multiple of its interval
+// within the time range. The samples are committed in batches, and the progress is
+// saved after each batch.
+func (b *backfiller) backfillGroup(ctx context.Context, group backfillGroup) error {
+	var (
+		interval = group.interval.Milliseconds()
+		end      = b.cfg.End.UnixMilli()
+		first    = b.cfg.Start.UnixMilli()
+	)
+	if rem := first % interval; rem != 0 {
+		first += interval - rem
+	}
+	if done, ok := b.progress.Groups[group.key]; ok {
+		first = done + interval
+	}
+	if first > end {
+		log.Info("msg", "Rule group already backfilled", "group", group.key)
+		return nil
+	}
+
+	var (
+		app     = b.appendable.Appender(ctx)
+		pending = 0
+		total   = 0
+	)
+	for ts := first; ts <= end; ts += interval {
+		for _, rule := range group.rules {
+			vector, err := rule.Eval(ctx, time.UnixMilli(ts), b.queryFunc, nil, group.limit)
+			if err != nil {
+				return fmt.Errorf("evaluating rule %s at %s: %w", rule.Name(), time.UnixMilli(ts).UTC().Format(time.RFC3339), err)
+			}
+			for _, s := range vector {
+				if _, err = app.Append(0, s.Metric, s.T, s.V); err != nil {
+					return fmt.Errorf("appending sample of rule %s: %w", rule.Name(), err)
+				}
+			}
+			pending += len(vector)
+		}
+		if pending < b.cfg.BatchSize && ts+interval <= end {
+			continue
+		}
+		if pending > 0 {
+			if err := app.Commit(); err != nil {
+				return err
+			}
+			app = b.appendable.Appender(ctx)
+			total += pending
+			pending = 0
+		}
+		b.progress.Groups[group.key] = ts
+		if err := b.saveProgress(); err != nil {
+			return err
+		}
+		log.Info("msg", "Backfilling rule group", "group", group.key,
+			"progress", fmt.Sprintf("%.1f%%", float64(ts-first+interval)*100/float64(end-first+interval)),
+			"until", time.UnixMilli(ts).UTC().Format(time.RFC3339), "samples", total)
+	}
+	return nil
+}
+
+func (b *backfiller) loadProgress() error {
+	b.progress = &backfillProgress{
+		Start:  b.cfg.Start.UnixMilli(),
+		End:    b.cfg.End.UnixMilli(),
+		Groups: make(map[string]int64),
+	}
+	if b.cfg.ProgressFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(b.cfg.ProgressFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading progress file: %w", err)
+	}
+	var progress backfillProgress
+	if err = json.Unmarshal(content, &progress); err != nil {
+		return fmt.Errorf("decoding progress file %s: %w", b.cfg.ProgressFile, err)
+	}
+	if b.cfg.defaultEnd && progress.Start == b.progress.Start && progress.End > progress.Start {
+		// Without -end, the backfill resumes up to the end recorded when it started.
+		b.cfg.End = time.UnixMilli(progress.End).UTC()
+		b.progress.End = progress.End
+	}
+	if progress.Start != b.progress.Start || progress.End != b.progress.End {
+		return fmt.Errorf("progress file %s records the backfill of another time range, remove it to start a new backfill", b.cfg.ProgressFile)
+	}
+	if progress.Groups != nil {
+		b.progress.Groups = progress.Groups
+	}
+	log.Info("msg", "Resuming backfill", "progress-file", b.cfg.ProgressFile)
+	return nil
+}
+
+// saveProgress replaces the progress file, so that it is never partially written.
+func (b *backfiller) saveProgress() error {
+	if b.cfg.ProgressFile == "" {
+		return nil
+	}
+	content, err := json.Marshal(b.progress)
+	if err != nil {
+		return fmt.Errorf("encoding progress: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(b.cfg.ProgressFile), filepath.Base(b.cfg.ProgressFile)+".*")
+	if err != nil {
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), b.cfg.ProgressFile); err != nil {
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+const backfillRules = `groups:
+  - name: fast
+    interval: 30s
+    rules:
+      - record: job:up:sum
+        expr: sum by (job) (up)
+        labels:
+          source: backfill
+      - alert: Down
+        expr: up == 0
+  - name: alerts
+    rules:
+      - alert: Down
+        expr: up == 0
+`
+
+type backfillSample struct {
+	labels labels.Labels
+	t      int64
+	v      float64
+}
+
+// testAppendable records the committed samples and exemplars, and the number of commits.
+type testAppendable struct {
+	committed []backfillSample
+	exemplars map[string]exemplar.Exemplar
+	commits   int
+	failAt    int64
+}
+
+func (a *testAppendable) Appender(context.Context) storage.Appender {
+	return &testAppender{appendable: a}
+}
+
+type testAppender struct {
+	appendable *testAppendable
+	pending    []backfillSample
+	exemplars  map[string]exemplar.Exemplar
+}
+
+func (a *testAppender) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	a.pending = append(a.pending, backfillSample{l, t, v})
+	return 0, nil
+}
+
+func (a *testAppender) Commit() error {
+	for _, s := range a.pending {
+		if a.appendable.failAt != 0 && s.t >= a.appendable.failAt {
+			return fmt.Errorf("commit failed")
+		}
+	}
+	a.appendable.committed = append(a.appendable.committed, a.pending...)
+	for series, e := range a.exemplars {
+		if a.appendable.exemplars == nil {
+			a.appendable.exemplars = make(map[string]exemplar.Exemplar)
+		}
+		a.appendable.exemplars[series] = e
+	}
+	a.appendable.commits++
+	return nil
+}
+
+func (a *testAppender) Rollback() error { return nil }
+
+func (a *testAppender) AppendExemplar(_ storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	if a.exemplars == nil {
+		a.exemplars = make(map[string]exemplar.Exemplar)
+	}
+	a.exemplars[l.String()] = e
+	return 0, nil
+}
+
+func (a *testAppender) UpdateMetadata(storage.SeriesRef, labels.Labels, metadata.Metadata) (storage.SeriesRef, error) {
+	return 0, nil
+}
+
+// testQueryFunc returns a sample for each of two jobs, whose value is the evaluation time.
+func testQueryFunc(_ context.Context, _ string, t time.Time) (promql.Vector, error) {
+	return promql.Vector{
+		{Point: promql.Point{T: t.UnixMilli(), V: float64(t.Unix())}, Metric: labels.FromStrings("job", "a")},
+		{Point: promql.Point{T: t.UnixMilli(), V: float64(t.Unix())}, Metric: labels.FromStrings("job", "b")},
+	}, nil
+}
+
+func TestBackfill(t *testing.T) {
+	dir := t.TempDir()
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(backfillRules), 0o600))
+
+	cfg := DefaultBackfillConfig
+	cfg.start = "1000"
+	cfg.end = "1970-01-01T00:20:00Z"
+	cfg.BatchSize = 8
+	cfg.ProgressFile = filepath.Join(dir, "progress.json")
+	require.NoError(t, ValidateBackfill(&cfg))
+	require.Equal(t, time.Unix(1000, 0).UTC(), cfg.Start)
+	require.Equal(t, time.Unix(1200, 0).UTC(), cfg.End)
+
+	// The commits of the evaluations at or after 1090s fail.
+	appendable := &testAppendable{failAt: 1090 * 1000}
+	b := &backfiller{cfg: &cfg, queryFunc: testQueryFunc, appendable: appendable}
+	require.Error(t, b.run(context.Background(), []string{rulesFile}))
+	// The evaluations at 1020s, 1050s, 1080s and 1110s make a batch.
+	require.Len(t, appendable.committed, 0)
+
+	appendable.failAt = 1140 * 1000
+	require.Error(t, b.run(context.Background(), []string{rulesFile}))
+	require.Len(t, appendable.committed, 8)
+	require.Equal(t, labels.FromStrings(labels.MetricName, "job:up:sum", "job", "a", "source", "backfill"), appendable.committed[0].labels)
+	require.Equal(t, int64(1020*1000), appendable.committed[0].t)
+	require.Equal(t, float64(1110), appendable.committed[7].v)
+
+	// The backfill resumes after the last committed batch.
+	appendable.failAt = 0
+	require.NoError(t, b.run(context.Background(), []string{rulesFile}))
+	require.Len(t, appendable.committed, 14)
+	require.Equal(t, 2, appendable.commits)
+	require.Equal(t, int64(1140*1000), appendable.committed[8].t)
+	require.Equal(t, int64(1200*1000), appendable.committed[13].t)
+
+	require.NoError(t, b.run(context.Background(), []string{rulesFile}))
+	require.Len(t, appendable.committed, 14)
+
+	// The progress file only applies to the same time range.
+	other := cfg
+	other.End = time.Unix(1300, 0)
+	b = &backfiller{cfg: &other, queryFunc: testQueryFunc, appendable: appendable}
+	require.ErrorContains(t, b.run(context.Background(), []string{rulesFile}), "another time range")
+}
+
+func TestBackfillResumeDefaultEnd(t *testing.T) {
+	dir := t.TempDir()
+	rulesFile := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(backfillRules), 0o600))
+
+	start := time.Now().Add(-10 * time.Minute).Truncate(time.Minute)
+	newConfig := func() *BackfillConfig {
+		cfg := DefaultBackfillConfig
+		cfg.start = strconv.FormatInt(start.Unix(), 10)
+		cfg.BatchSize = 2
+		cfg.ProgressFile = filepath.Join(dir, "progress.json")
+		require.NoError(t, ValidateBackfill(&cfg))
+		return &cfg
+	}
+
+	cfg := newConfig()
+	end := cfg.End
+	appendable := &testAppendable{failAt: start.Add(5 * time.Minute).UnixMilli()}
+	b := &backfiller{cfg: cfg, queryFunc: testQueryFunc, appendable: appendable}
+	require.Error(t, b.run(context.Background(), []string{rulesFile}))
+	require.NotEmpty(t, appendable.committed)
+
+	// Without -end, the resumed backfill ends at the end of the interrupted one, and
+	// not at the time it is resumed.
+	time.Sleep(10 * time.Millisecond)
+	cfg = newConfig()
+	require.True(t, cfg.End.After(end))
+	appendable.failAt = 0
+	b = &backfiller{cfg: cfg, queryFunc: testQueryFunc, appendable: appendable}
+	require.NoError(t, b.run(context.Background(), []string{rulesFile}))
+	require.Equal(t, end.UnixMilli(), cfg.End.UnixMilli())
+	last := appendable.committed[len(appendable.committed)-1].t
+	require.LessOrEqual(t, last, end.UnixMilli())
+	require.Greater(t, last, end.Add(-30*time.Second).UnixMilli())
+}
+
+func TestValidateBackfill(t *testing.T) {
+	testCases := []struct {
+		name        string
+		cfg         BackfillConfig
+		expectedErr string
+	}{
+		{
+			name:        "no start",
+			cfg:         BackfillConfig{EvalInterval: time.Minute, BatchSize: 1},
+			expectedErr: "start of the time range is required",
+		},
+		{
+			name:        "invalid start",
+			cfg:         BackfillConfig{start: "yesterday", EvalInterval: time.Minute, BatchSize: 1},
+			expectedErr: "cannot parse",
+		},
+		{
+			name:        "end before start",
+			cfg:         BackfillConfig{start: "2000", end: "1000", EvalInterval: time.Minute, BatchSize: 1},
+			expectedErr: "must be after its start",
+		},
+		{
+			name:        "no batch size",
+			cfg:         BackfillConfig{start: "1000", EvalInterval: time.Minute},
+			expectedErr: "batch size must be positive",
+		},
+		{
+			name: "end defaults to now",
+			cfg:  BackfillConfig{start: "1000.5", EvalInterval: time.Minute, BatchSize: 1},
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateBackfill(&c.cfg)
+			if c.expectedErr != "" {
+				require.ErrorContains(t, err, c.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, time.Unix(1000, 5e8).UTC(), c.cfg.Start)
+			require.WithinDuration(t, time.Now(), c.cfg.End, time.Minute)
+		})
+	}
+}
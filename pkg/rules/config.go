@@ -7,6 +7,8 @@ package rules
 import (
 	"flag"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	prometheus_config "github.com/prometheus/prometheus/config"
@@ -19,6 +21,8 @@ var DefaultConfig = Config{
 	OutageTolerance:           time.Hour,
 	ForGracePeriod:            time.Minute * 10,
 	ResendDelay:               time.Minute,
+	DatabaseSyncInterval:      10 * time.Second,
+	AlertHistoryRetention:     90 * 24 * time.Hour,
 }
 
 type Config struct {
@@ -26,6 +30,9 @@ type Config struct {
 	OutageTolerance           time.Duration
 	ForGracePeriod            time.Duration
 	ResendDelay               time.Duration
+	DatabaseSyncInterval      time.Duration
+	AlertHistoryRetention     time.Duration
+	ExternalURL               string
 	PrometheusConfigAddress   string
 	PrometheusConfig          *prometheus_config.Config
 }
@@ -43,13 +50,30 @@ func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
 	fs.DurationVar(&cfg.OutageTolerance, "metrics.rules.alert.for-outage-tolerance", DefaultConfig.OutageTolerance, "Max time to tolerate Promscale outage for restoring \"for\" state of alert.")
 	fs.DurationVar(&cfg.ForGracePeriod, "metrics.rules.alert.for-grace-period", DefaultConfig.ForGracePeriod, "Minimum duration between alert and restored \"for\" state. This is maintained only for alerts with configured \"for\" time greater than grace period.")
 	fs.DurationVar(&cfg.ResendDelay, "metrics.rules.alert.resend-delay", DefaultConfig.ResendDelay, "Minimum amount of time to wait before resending an alert to Alertmanager.")
+	fs.DurationVar(&cfg.DatabaseSyncInterval, "metrics.rules.database-sync-interval", DefaultConfig.DatabaseSyncInterval, "How often the rule groups stored in the database through the ruler API are checked for changes.")
+	fs.DurationVar(&cfg.AlertHistoryRetention, "metrics.rules.alert-history.retention", DefaultConfig.AlertHistoryRetention, "How long the state transitions of the alerts are kept in the alert history. 0 keeps them forever.")
+	fs.StringVar(&cfg.ExternalURL, "metrics.rules.external-url", "", "The URL under which the alerts evaluated by Promscale can be browsed, such as the one of a Prometheus querying Promscale. "+
+		"It prefixes the generator URL of the alerts sent to Alertmanager, and is the `$externalURL` of the rule templates.")
 	fs.StringVar(&cfg.PrometheusConfigAddress, "metrics.rules.config-file", "", "Path to configuration file in Prometheus-format, containing `rule_files` and optional `alerting`, `global` fields. "+
 		"For more details, see https://prometheus.io/docs/prometheus/latest/configuration/configuration/. "+
-		"Note: If this is flag empty or `rule_files` is empty, Promscale rule-manager will not start. If `alertmanagers` is empty, alerting will not be initialized.")
+		"Note: If this is flag empty or `rule_files` is empty, Promscale rule-manager only evaluates the rule groups of the ruler API. If `alertmanagers` is empty, alerting will not be initialized.")
 	return cfg
 }
 
 func Validate(cfg *Config) error {
+	if cfg.AlertHistoryRetention < 0 {
+		return fmt.Errorf("invalid metrics.rules.alert-history.retention %s: must not be negative", cfg.AlertHistoryRetention)
+	}
+	if cfg.ExternalURL != "" {
+		u, err := url.Parse(cfg.ExternalURL)
+		if err != nil {
+			return fmt.Errorf("invalid metrics.rules.external-url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid metrics.rules.external-url %q: an absolute http or https URL is required", cfg.ExternalURL)
+		}
+		cfg.ExternalURL = strings.TrimSuffix(u.String(), "/")
+	}
 	if cfg.PrometheusConfigAddress == "" {
 		cfg.PrometheusConfig = &prometheus_config.DefaultConfig
 		return nil
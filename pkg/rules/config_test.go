@@ -6,6 +6,7 @@ package rules
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -108,6 +109,13 @@ func TestValidate(t *testing.T) {
 			},
 			containsRules: true,
 		},
+		{
+			name: "negative alert history retention",
+			config: Config{
+				AlertHistoryRetention: -time.Hour,
+			},
+			shouldError: true,
+		},
 	}
 	for _, c := range cases {
 		err := Validate(&c.config)
@@ -130,3 +138,44 @@ func prometheusConfigWithRules(files ...string) *prometheus_config.Config {
 	c.RuleFiles = files
 	return &c
 }
+
+func TestValidateAlertmanagerDiscovery(t *testing.T) {
+	cfg := Config{PrometheusConfigAddress: "./testdata/alertmanager_sd.good.config.yaml"}
+	require.NoError(t, Validate(&cfg))
+	require.True(t, cfg.ContainsAlertingConfig())
+
+	var sdConfigs []string
+	for _, am := range cfg.PrometheusConfig.AlertingConfig.AlertmanagerConfigs {
+		for _, sd := range am.ServiceDiscoveryConfigs {
+			sdConfigs = append(sdConfigs, sd.Name())
+		}
+	}
+	require.Equal(t, []string{"static", "file", "dns"}, sdConfigs)
+	require.Len(t, cfg.PrometheusConfig.AlertingConfig.AlertRelabelConfigs, 1)
+	require.Equal(t, "eu-1", cfg.PrometheusConfig.GlobalConfig.ExternalLabels.Get("cluster"))
+}
+
+func TestValidateExternalURL(t *testing.T) {
+	cases := []struct {
+		externalURL string
+		expected    string
+		shouldError bool
+	}{
+		{externalURL: "", expected: ""},
+		{externalURL: "https://prometheus.example/", expected: "https://prometheus.example"},
+		{externalURL: "http://prometheus.example:9090/prom/", expected: "http://prometheus.example:9090/prom"},
+		{externalURL: "prometheus.example", shouldError: true},
+		{externalURL: "ftp://prometheus.example", shouldError: true},
+		{externalURL: "http://%zz", shouldError: true},
+	}
+	for _, c := range cases {
+		cfg := Config{ExternalURL: c.externalURL}
+		err := Validate(&cfg)
+		if c.shouldError {
+			require.Error(t, err, c.externalURL)
+			continue
+		}
+		require.NoError(t, err, c.externalURL)
+		require.Equal(t, c.expected, cfg.ExternalURL)
+	}
+}
@@ -0,0 +1,12 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+// Registers the service discovery mechanisms of the Alertmanagers of the
+// `alerting.alertmanagers` configuration, besides `static_configs`.
+import (
+	_ "github.com/prometheus/prometheus/discovery/dns"  // Registers dns_sd_configs.
+	_ "github.com/prometheus/prometheus/discovery/file" // Registers file_sd_configs.
+)
@@ -0,0 +1,193 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	prometheus_promql "github.com/prometheus/prometheus/promql"
+	prom_rules "github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+// exemplarQueryFunc returns the exemplars carried to the series of the result of the
+// instant query qs at t.
+type exemplarQueryFunc func(ctx context.Context, qs string, t time.Time) ([]model.ExemplarQueryResult, error)
+
+// exemplarCarrier carries the exemplars of the series selected by the recording rules
+// to the series they record, so that the recorded series keep pointers to example traces.
+//
+// The rules of a group are evaluated one after the other, each with a query followed by
+// the append of its result. After the query of a recording rule, the exemplars of the
+// recorded series are kept until the appender of the rule group is created.
+type exemplarCarrier struct {
+	query exemplarQueryFunc
+
+	mu      sync.Mutex
+	groups  map[string]*prom_rules.Group
+	pending map[string]map[uint64]exemplar.Exemplar
+}
+
+func newExemplarCarrier(query exemplarQueryFunc) *exemplarCarrier {
+	return &exemplarCarrier{
+		query:   query,
+		groups:  make(map[string]*prom_rules.Group),
+		pending: make(map[string]map[uint64]exemplar.Exemplar),
+	}
+}
+
+// setGroups sets the rule groups evaluated by the rule manager.
+func (c *exemplarCarrier) setGroups(groups []*prom_rules.Group) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.groups = make(map[string]*prom_rules.Group, len(groups))
+	for _, g := range groups {
+		c.groups[prom_rules.GroupKey(g.File(), g.Name())] = g
+	}
+	for key := range c.pending {
+		if _, ok := c.groups[key]; !ok {
+			delete(c.pending, key)
+		}
+	}
+}
+
+// queryFunc returns a QueryFunc that evaluates the rules with next, and keeps the
+// exemplars of the series recorded by the recording rules whose expression is the query.
+func (c *exemplarCarrier) queryFunc(next prom_rules.QueryFunc) prom_rules.QueryFunc {
+	return func(ctx context.Context, qs string, t time.Time) (prometheus_promql.Vector, error) {
+		key := prom_rules.GroupKey(groupOrigin(ctx))
+		vector, err := next(ctx, qs, t)
+		if err != nil {
+			c.setPending(key, nil)
+			return nil, err
+		}
+		c.setPending(key, c.recordedExemplars(ctx, key, qs, t, vector))
+		return vector, nil
+	}
+}
+
+// recordedExemplars returns the latest exemplar of each series recorded from the
+// vector, keyed by the hash of the labels of the recorded series. Only the exemplars
+// newer than the previous evaluation of the group are carried, so that each of them is
+// recorded once.
+func (c *exemplarCarrier) recordedExemplars(ctx context.Context, key, qs string, t time.Time, vector prometheus_promql.Vector) map[uint64]exemplar.Exemplar {
+	c.mu.Lock()
+	group, ok := c.groups[key]
+	c.mu.Unlock()
+	if !ok || len(vector) == 0 {
+		return nil
+	}
+	var rules []*prom_rules.RecordingRule
+	for _, r := range group.Rules() {
+		if rule, ok := r.(*prom_rules.RecordingRule); ok && rule.Query().String() == qs {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	results, err := c.query(ctx, qs, t)
+	if err != nil {
+		log.WarnRateLimited("msg", "Failed to query the exemplars of a recording rule", "group", group.Name(), "query", qs, "err", err)
+		return nil
+	}
+	latest := make(map[uint64]model.ExemplarData, len(results))
+	mint, maxt := t.Add(-group.Interval()).UnixMilli(), t.UnixMilli()
+	for _, r := range results {
+		for i := len(r.Exemplars) - 1; i >= 0; i-- {
+			if e := r.Exemplars[i]; e.Ts > mint && e.Ts <= maxt {
+				latest[r.SeriesLabels.Hash()] = e
+				break
+			}
+		}
+	}
+	if len(latest) == 0 {
+		return nil
+	}
+
+	exemplars := make(map[uint64]exemplar.Exemplar)
+	lb := labels.NewBuilder(nil)
+	for _, s := range vector {
+		e, ok := latest[s.Metric.Hash()]
+		if !ok {
+			continue
+		}
+		for _, rule := range rules {
+			// The labels of the recorded series are set the same way as in the evaluation of the rule.
+			lb.Reset(s.Metric)
+			lb.Set(labels.MetricName, rule.Name())
+			for _, l := range rule.Labels() {
+				lb.Set(l.Name, l.Value)
+			}
+			exemplars[lb.Labels(nil).Hash()] = exemplar.Exemplar{Labels: e.Labels, Value: e.Value, Ts: e.Ts, HasTs: true}
+		}
+	}
+	return exemplars
+}
+
+func (c *exemplarCarrier) setPending(key string, exemplars map[uint64]exemplar.Exemplar) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(exemplars) == 0 {
+		delete(c.pending, key)
+		return
+	}
+	c.pending[key] = exemplars
+}
+
+// takePending returns the exemplars kept for the rule group, and forgets them.
+func (c *exemplarCarrier) takePending(key string) map[uint64]exemplar.Exemplar {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exemplars := c.pending[key]
+	delete(c.pending, key)
+	return exemplars
+}
+
+// exemplarAppendable makes the appenders append the exemplars carried to the series
+// recorded by the rule group.
+type exemplarAppendable struct {
+	storage.Appendable
+	carrier *exemplarCarrier
+}
+
+func (a exemplarAppendable) Appender(ctx context.Context) storage.Appender {
+	app := a.Appendable.Appender(ctx)
+	exemplars := a.carrier.takePending(prom_rules.GroupKey(groupOrigin(ctx)))
+	if len(exemplars) == 0 {
+		return app
+	}
+	return &exemplarAppender{Appender: app, exemplars: exemplars}
+}
+
+type exemplarAppender struct {
+	storage.Appender
+	exemplars map[uint64]exemplar.Exemplar
+}
+
+func (app *exemplarAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	ref, err := app.Appender.Append(ref, l, t, v)
+	if err != nil || value.IsStaleNaN(v) {
+		return ref, err
+	}
+	e, ok := app.exemplars[l.Hash()]
+	if !ok {
+		return ref, nil
+	}
+	if _, err := app.Appender.AppendExemplar(ref, l, e); err != nil {
+		// The sample is recorded even if its exemplar cannot be.
+		log.WarnRateLimited("msg", "Failed to append the exemplar of a recorded series", "series", l.String(), "err", err)
+	}
+	return ref, nil
+}
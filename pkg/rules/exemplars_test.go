@@ -0,0 +1,106 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	prom_rules "github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestExemplarCarrier(t *testing.T) {
+	var (
+		queries  []string
+		queryErr error
+	)
+	carrier := newExemplarCarrier(func(_ context.Context, qs string, _ time.Time) ([]model.ExemplarQueryResult, error) {
+		queries = append(queries, qs)
+		if queryErr != nil {
+			return nil, queryErr
+		}
+		traceExemplar := func(traceID string, ts int64) model.ExemplarData {
+			return model.ExemplarData{Labels: labels.FromStrings("trace_id", traceID), Value: 1, Ts: ts * 1000}
+		}
+		return []model.ExemplarQueryResult{
+			{SeriesLabels: labels.FromStrings("job", "api"), Exemplars: []model.ExemplarData{traceExemplar("a", 500), traceExemplar("b", 560), traceExemplar("c", 620)}},
+			{SeriesLabels: labels.FromStrings("job", "db"), Exemplars: []model.ExemplarData{traceExemplar("d", 500)}},
+		}, nil
+	})
+	queryFunc := carrier.queryFunc(func(_ context.Context, _ string, ts time.Time) (promql.Vector, error) {
+		return promql.Vector{
+			{Point: promql.Point{T: ts.UnixMilli(), V: 1}, Metric: labels.FromStrings("job", "api")},
+			{Point: promql.Point{T: ts.UnixMilli(), V: 2}, Metric: labels.FromStrings("job", "db")},
+		}, nil
+	})
+
+	recordingExpr, err := parser.ParseExpr(`sum by (job) (rate(requests_total[5m]))`)
+	require.NoError(t, err)
+	alertingExpr, err := parser.ParseExpr(`requests_total > 0`)
+	require.NoError(t, err)
+	appendable := &testAppendable{}
+	group := prom_rules.NewGroup(prom_rules.GroupOptions{
+		Name:     "requests",
+		File:     "rules.yaml",
+		Interval: time.Minute,
+		Rules: []prom_rules.Rule{
+			prom_rules.NewRecordingRule("job:requests:rate5m", recordingExpr, labels.FromStrings("source", "rules")),
+			prom_rules.NewAlertingRule("Requests", alertingExpr, 0, nil, nil, nil, "", true, log.NewNopLogger()),
+		},
+		Opts: &prom_rules.ManagerOptions{
+			QueryFunc:  queryFunc,
+			Appendable: exemplarAppendable{appendable, carrier},
+			Context:    context.Background(),
+			Logger:     log.NewNopLogger(),
+			NotifyFunc: func(context.Context, string, ...*prom_rules.Alert) {},
+		},
+	})
+	ctx := promql.NewOriginContext(context.Background(), map[string]interface{}{
+		"ruleGroup": map[string]string{"file": "rules.yaml", "name": "requests"},
+	})
+	eval := func() {
+		queries, appendable.exemplars = nil, nil
+		group.Eval(ctx, time.Unix(600, 0))
+	}
+
+	// The groups are unknown until they are set.
+	eval()
+	require.Empty(t, queries)
+	require.Empty(t, appendable.exemplars)
+	carrier.setGroups([]*prom_rules.Group{group})
+
+	// Only the latest exemplar since the previous evaluation is carried to the recorded series.
+	eval()
+	require.Equal(t, []string{recordingExpr.String()}, queries)
+	require.Equal(t, map[string]exemplar.Exemplar{
+		`{__name__="job:requests:rate5m", job="api", source="rules"}`: {Labels: labels.FromStrings("trace_id", "b"), Value: 1, Ts: 560_000, HasTs: true},
+	}, appendable.exemplars)
+	require.Empty(t, carrier.pending)
+
+	// The samples are recorded without exemplars if they cannot be queried.
+	queryErr = fmt.Errorf("query failed")
+	committed := len(appendable.committed)
+	eval()
+	require.Len(t, queries, 1)
+	require.Empty(t, appendable.exemplars)
+	require.Greater(t, len(appendable.committed), committed)
+
+	// The exemplars of removed groups are not queried.
+	queryErr = nil
+	carrier.setGroups(nil)
+	eval()
+	require.Empty(t, queries)
+	require.Empty(t, appendable.exemplars)
+}
@@ -0,0 +1,275 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	prom_rules "github.com/prometheus/prometheus/rules"
+	"gopkg.in/yaml.v3"
+
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+const (
+	// DatabaseRulesPrefix prefixes the namespaces of the rule groups stored in the
+	// database, to tell them apart from rule files in the rule manager.
+	DatabaseRulesPrefix = "db:"
+
+	selectNamespaceSQL = "SELECT content FROM _ps_catalog.rule_group WHERE tenant = $1 AND namespace = $2 ORDER BY name"
+	selectGroupSQL     = "SELECT content FROM _ps_catalog.rule_group WHERE tenant = $1 AND namespace = $2 AND name = $3"
+	selectAllGroupsSQL = "SELECT tenant, namespace, content FROM _ps_catalog.rule_group ORDER BY tenant, namespace, name"
+	upsertGroupSQL     = `INSERT INTO _ps_catalog.rule_group (tenant, namespace, name, content) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (tenant, namespace, name) DO UPDATE SET content = excluded.content, updated_at = now()`
+	deleteGroupSQL     = "DELETE FROM _ps_catalog.rule_group WHERE tenant = $1 AND namespace = $2 AND name = $3"
+	deleteNamespaceSQL = "DELETE FROM _ps_catalog.rule_group WHERE tenant = $1 AND namespace = $2"
+)
+
+var (
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrGroupNotFound     = errors.New("rule group not found")
+)
+
+// ParseGroup parses and validates the YAML definition of a rule group with the
+// upstream rule parser.
+func ParseGroup(content []byte) (rulefmt.RuleGroup, []error) {
+	var group rulefmt.RuleGroup
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&group); err != nil {
+		return group, []error{err}
+	}
+	if _, errs := parseGroups([]rulefmt.RuleGroup{group}); len(errs) > 0 {
+		return group, errs
+	}
+	return group, nil
+}
+
+// parseGroups validates the rule groups by running them through the upstream rule parser.
+func parseGroups(groups []rulefmt.RuleGroup) (*rulefmt.RuleGroups, []error) {
+	content, err := yaml.Marshal(rulefmt.RuleGroups{Groups: groups})
+	if err != nil {
+		return nil, []error{err}
+	}
+	return rulefmt.Parse(content)
+}
+
+// NamespaceIdentifier returns the identifier of a namespace of the tenant in the rule
+// manager, which is used as the file of its rule groups.
+func NamespaceIdentifier(tenant, namespace string) string {
+	if tenant == "" {
+		return DatabaseRulesPrefix + url.PathEscape(namespace)
+	}
+	return DatabaseRulesPrefix + url.PathEscape(tenant) + "/" + url.PathEscape(namespace)
+}
+
+// GroupStore stores rule groups, organized in namespaces, in the database. The
+// rule groups belong to the tenant of the request context, if any.
+type GroupStore struct {
+	conn pgxconn.PgxConn
+}
+
+func NewGroupStore(conn pgxconn.PgxConn) *GroupStore {
+	return &GroupStore{conn: conn}
+}
+
+// Namespace returns the rule groups of the namespace, sorted by name.
+func (s *GroupStore) Namespace(ctx context.Context, namespace string) ([]rulefmt.RuleGroup, error) {
+	rows, err := s.conn.Query(ctx, selectNamespaceSQL, tenancy.TenantFromContext(ctx), namespace)
+	if err != nil {
+		return nil, fmt.Errorf("querying rule groups: %w", err)
+	}
+	defer rows.Close()
+	var groups []rulefmt.RuleGroup
+	for rows.Next() {
+		var content string
+		if err = rows.Scan(&content); err != nil {
+			return nil, fmt.Errorf("scanning rule group: %w", err)
+		}
+		var group rulefmt.RuleGroup
+		if err = yaml.Unmarshal([]byte(content), &group); err != nil {
+			return nil, fmt.Errorf("decoding rule group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying rule groups: %w", err)
+	}
+	if len(groups) == 0 {
+		return nil, ErrNamespaceNotFound
+	}
+	return groups, nil
+}
+
+// Group returns a rule group of the namespace.
+func (s *GroupStore) Group(ctx context.Context, namespace, name string) (*rulefmt.RuleGroup, error) {
+	var content string
+	err := s.conn.QueryRow(ctx, selectGroupSQL, tenancy.TenantFromContext(ctx), namespace, name).Scan(&content)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying rule group: %w", err)
+	}
+	var group rulefmt.RuleGroup
+	if err = yaml.Unmarshal([]byte(content), &group); err != nil {
+		return nil, fmt.Errorf("decoding rule group: %w", err)
+	}
+	return &group, nil
+}
+
+// SetGroup creates or replaces a rule group of the namespace.
+func (s *GroupStore) SetGroup(ctx context.Context, namespace string, group rulefmt.RuleGroup) error {
+	content, err := yaml.Marshal(group)
+	if err != nil {
+		return fmt.Errorf("encoding rule group: %w", err)
+	}
+	if _, err = s.conn.Exec(ctx, upsertGroupSQL, tenancy.TenantFromContext(ctx), namespace, group.Name, string(content)); err != nil {
+		return fmt.Errorf("storing rule group: %w", err)
+	}
+	return nil
+}
+
+// DeleteGroup deletes a rule group of the namespace.
+func (s *GroupStore) DeleteGroup(ctx context.Context, namespace, name string) error {
+	tag, err := s.conn.Exec(ctx, deleteGroupSQL, tenancy.TenantFromContext(ctx), namespace, name)
+	if err != nil {
+		return fmt.Errorf("deleting rule group: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// DeleteNamespace deletes all the rule groups of the namespace.
+func (s *GroupStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	tag, err := s.conn.Exec(ctx, deleteNamespaceSQL, tenancy.TenantFromContext(ctx), namespace)
+	if err != nil {
+		return fmt.Errorf("deleting rule groups: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNamespaceNotFound
+	}
+	return nil
+}
+
+// storedNamespace holds the rule groups of a namespace, in the format of a rule file.
+type storedNamespace struct {
+	tenant  string
+	content string
+}
+
+// all returns all the namespaces of all the tenants, by identifier.
+func (s *GroupStore) all(ctx context.Context) (map[string]storedNamespace, error) {
+	rows, err := s.conn.Query(ctx, selectAllGroupsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("querying rule groups: %w", err)
+	}
+	defer rows.Close()
+	tenants := make(map[string]string)
+	groups := make(map[string][]rulefmt.RuleGroup)
+	for rows.Next() {
+		var tenant, namespace, content string
+		if err = rows.Scan(&tenant, &namespace, &content); err != nil {
+			return nil, fmt.Errorf("scanning rule group: %w", err)
+		}
+		id := NamespaceIdentifier(tenant, namespace)
+		var group rulefmt.RuleGroup
+		if err = yaml.Unmarshal([]byte(content), &group); err != nil {
+			return nil, fmt.Errorf("decoding rule group of %s: %w", id, err)
+		}
+		tenants[id] = tenant
+		groups[id] = append(groups[id], group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying rule groups: %w", err)
+	}
+	namespaces := make(map[string]storedNamespace, len(groups))
+	for id, g := range groups {
+		content, err := yaml.Marshal(rulefmt.RuleGroups{Groups: g})
+		if err != nil {
+			return nil, fmt.Errorf("encoding rule groups of %s: %w", id, err)
+		}
+		namespaces[id] = storedNamespace{tenant: tenants[id], content: string(content)}
+	}
+	return namespaces, nil
+}
+
+// groupLoader loads the rule groups of the rule files, and of the namespaces stored
+// in the database as of the last sync.
+type groupLoader struct {
+	prom_rules.FileLoader
+
+	mu         sync.RWMutex
+	namespaces map[string]storedNamespace
+}
+
+func (l *groupLoader) Load(identifier string) (*rulefmt.RuleGroups, []error) {
+	if !strings.HasPrefix(identifier, DatabaseRulesPrefix) {
+		return l.FileLoader.Load(identifier)
+	}
+	l.mu.RLock()
+	namespace, ok := l.namespaces[identifier]
+	l.mu.RUnlock()
+	if !ok {
+		return nil, []error{fmt.Errorf("%s: %w", identifier, ErrNamespaceNotFound)}
+	}
+	groups, errs := rulefmt.Parse([]byte(namespace.content))
+	for i := range errs {
+		errs[i] = fmt.Errorf("%s: %w", identifier, errs[i])
+	}
+	return groups, errs
+}
+
+// identifiers returns the identifiers of the namespaces, sorted.
+func (l *groupLoader) identifiers() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	ids := make([]string, 0, len(l.namespaces))
+	for id := range l.namespaces {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// tenant returns the tenant owning the rule groups of the identifier. Rule files
+// are not owned by any tenant.
+func (l *groupLoader) tenant(identifier string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.namespaces[identifier].tenant
+}
+
+// update replaces the namespaces, and returns true if they changed.
+func (l *groupLoader) update(namespaces map[string]storedNamespace) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(namespaces) == len(l.namespaces) {
+		changed := false
+		for id, namespace := range namespaces {
+			if current, ok := l.namespaces[id]; !ok || current != namespace {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return false
+		}
+	}
+	l.namespaces = namespaces
+	return true
+}
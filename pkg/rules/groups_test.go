@@ -0,0 +1,120 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const testGroup = `name: payments
+interval: 30s
+rules:
+  - record: job:http_requests:rate5m
+    expr: sum by (job) (rate(http_requests_total[5m]))
+  - alert: HighErrorRate
+    expr: job:http_errors:rate5m > 0.1
+    for: 10m
+    labels:
+      severity: page
+`
+
+func TestParseGroup(t *testing.T) {
+	group, errs := ParseGroup([]byte(testGroup))
+	require.Empty(t, errs)
+	require.Equal(t, "payments", group.Name)
+	require.Len(t, group.Rules, 2)
+	require.Equal(t, "job:http_requests:rate5m", group.Rules[0].Record.Value)
+	require.Equal(t, "HighErrorRate", group.Rules[1].Alert.Value)
+
+	testCases := []struct {
+		name        string
+		group       string
+		expectedErr string
+	}{
+		{
+			name:        "unknown field",
+			group:       "name: a\nrule: []\n",
+			expectedErr: "field rule not found",
+		},
+		{
+			name:        "no name",
+			group:       "rules:\n  - record: a\n    expr: up\n",
+			expectedErr: "Groupname must not be empty",
+		},
+		{
+			name:        "invalid expression",
+			group:       "name: a\nrules:\n  - record: a\n    expr: sum(\n",
+			expectedErr: "could not parse expression",
+		},
+		{
+			name:        "record and alert",
+			group:       "name: a\nrules:\n  - record: a\n    alert: b\n    expr: up\n",
+			expectedErr: "only one of 'record' and 'alert' must be set",
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			_, errs := ParseGroup([]byte(c.group))
+			require.NotEmpty(t, errs)
+			require.ErrorContains(t, errs[0], c.expectedErr)
+		})
+	}
+}
+
+func TestNamespaceIdentifier(t *testing.T) {
+	require.Equal(t, "db:team-a", NamespaceIdentifier("", "team-a"))
+	require.Equal(t, "db:tenant-a/team-a", NamespaceIdentifier("tenant-a", "team-a"))
+	require.Equal(t, "db:a%2Fb", NamespaceIdentifier("", "a/b"))
+	require.NotEqual(t, NamespaceIdentifier("", "a/b"), NamespaceIdentifier("a", "b"))
+}
+
+func TestGroupLoader(t *testing.T) {
+	group, errs := ParseGroup([]byte(testGroup))
+	require.Empty(t, errs)
+	content, err := yaml.Marshal(rulefmt.RuleGroups{Groups: []rulefmt.RuleGroup{group}})
+	require.NoError(t, err)
+	teamA := NamespaceIdentifier("", "team-a")
+	teamB := NamespaceIdentifier("tenant-b", "team-b")
+
+	loader := &groupLoader{}
+	require.False(t, loader.update(map[string]storedNamespace{}))
+	require.Empty(t, loader.identifiers())
+	namespaces := map[string]storedNamespace{
+		teamB: {tenant: "tenant-b", content: string(content)},
+		teamA: {content: string(content)},
+	}
+	require.True(t, loader.update(namespaces))
+	require.False(t, loader.update(map[string]storedNamespace{
+		teamB: {tenant: "tenant-b", content: string(content)},
+		teamA: {content: string(content)},
+	}))
+	require.Equal(t, []string{teamA, teamB}, loader.identifiers())
+	require.Equal(t, "", loader.tenant(teamA))
+	require.Equal(t, "tenant-b", loader.tenant(teamB))
+	require.Equal(t, "", loader.tenant("testdata/rules.yaml"))
+
+	groups, errs := loader.Load(teamA)
+	require.Empty(t, errs)
+	require.Len(t, groups.Groups, 1)
+	require.Equal(t, "payments", groups.Groups[0].Name)
+	require.Equal(t, "sum by (job) (rate(http_requests_total[5m]))", groups.Groups[0].Rules[0].Expr.Value)
+	require.Equal(t, "page", groups.Groups[0].Rules[1].Labels["severity"])
+
+	_, errs = loader.Load(NamespaceIdentifier("", "team-c"))
+	require.ErrorIs(t, errs[0], ErrNamespaceNotFound)
+
+	groups, errs = loader.Load("testdata/rules.yaml")
+	require.Empty(t, errs)
+	require.NotEmpty(t, groups.Groups)
+
+	require.True(t, loader.update(map[string]storedNamespace{teamA: {content: string(content)}}))
+	require.Equal(t, []string{teamA}, loader.identifiers())
+	require.True(t, loader.update(map[string]storedNamespace{teamA: {tenant: "tenant-a", content: string(content)}}))
+	require.True(t, loader.update(map[string]storedNamespace{teamA: {content: "groups: []\n"}}))
+}
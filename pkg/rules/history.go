@@ -0,0 +1,429 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	prom_rules "github.com/prometheus/prometheus/rules"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+const (
+	// AlertStateResolved is the state of an alert that stopped being active.
+	AlertStateResolved = "resolved"
+
+	// alertHistoryQueueSize is the number of alert evaluations whose transitions
+	// wait to be written to the database.
+	alertHistoryQueueSize = 1024
+
+	// alertHistoryCleanupInterval is how often the transitions older than the
+	// retention are deleted.
+	alertHistoryCleanupInterval = time.Hour
+
+	insertAlertTransitionSQL = `INSERT INTO _ps_catalog.alert_history
+	(time, tenant, rule_group_file, rule_group, alertname, state, labels, annotations, value)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT DO NOTHING`
+	selectAlertHistorySQL = `SELECT time, rule_group_file, rule_group, state, labels, annotations, value
+	FROM _ps_catalog.alert_history WHERE tenant = $1`
+	deleteAlertHistorySQL = `DELETE FROM _ps_catalog.alert_history WHERE time < $1`
+)
+
+// ErrAlertHistoryDisabled is returned when the alert history is not recorded, since
+// Promscale has no database connection to store it.
+var ErrAlertHistoryDisabled = errors.New("alert history is not available")
+
+// AlertTransition is a change of the state of an alert: it became pending, firing,
+// or was resolved.
+type AlertTransition struct {
+	Time        time.Time
+	Tenant      string
+	GroupFile   string
+	Group       string
+	State       string
+	Labels      labels.Labels
+	Annotations labels.Labels
+	Value       float64
+}
+
+// AlertHistory stores the state transitions of the alerts in the database.
+type AlertHistory struct {
+	conn pgxconn.PgxConn
+}
+
+func NewAlertHistory(conn pgxconn.PgxConn) *AlertHistory {
+	return &AlertHistory{conn: conn}
+}
+
+// Record writes the transitions to the database. Transitions that are already
+// recorded are skipped.
+func (h *AlertHistory) Record(ctx context.Context, transitions []AlertTransition) error {
+	if len(transitions) == 0 {
+		return nil
+	}
+	batch := h.conn.NewBatch()
+	for _, t := range transitions {
+		batch.Queue(insertAlertTransitionSQL, t.Time, t.Tenant, t.GroupFile, t.Group, t.Labels.Get(labels.AlertName),
+			t.State, t.Labels.Map(), t.Annotations.Map(), t.Value)
+	}
+	results, err := h.conn.SendBatch(ctx, batch)
+	if err != nil {
+		return fmt.Errorf("recording alert transitions: %w", err)
+	}
+	defer results.Close()
+	for range transitions {
+		if _, err = results.Exec(); err != nil {
+			return fmt.Errorf("recording alert transitions: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteBefore deletes the transitions that happened before the given time, and
+// returns the number of deleted transitions.
+func (h *AlertHistory) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := h.conn.Exec(ctx, deleteAlertHistorySQL, before)
+	if err != nil {
+		return 0, fmt.Errorf("deleting alert transitions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Query returns the transitions of the alerts matching all the matchers within the
+// time range, sorted by time. A zero start or end leaves the time range open on that
+// side. With multi-tenancy, only the alerts of the rule groups owned by the tenant of
+// the context are returned.
+func (h *AlertHistory) Query(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) ([]AlertTransition, error) {
+	tenant := tenancy.TenantFromContext(ctx)
+	var (
+		sql  strings.Builder
+		args = []interface{}{tenant}
+	)
+	sql.WriteString(selectAlertHistorySQL)
+	if !start.IsZero() {
+		args = append(args, start)
+		fmt.Fprintf(&sql, " AND time >= $%d", len(args))
+	}
+	if !end.IsZero() {
+		args = append(args, end)
+		fmt.Fprintf(&sql, " AND time <= $%d", len(args))
+	}
+	for _, m := range matchers {
+		value := m.Value
+		var op string
+		switch m.Type {
+		case labels.MatchEqual:
+			op = "="
+		case labels.MatchNotEqual:
+			op = "<>"
+		case labels.MatchRegexp:
+			op, value = "~", "^(?:"+m.Value+")$"
+		case labels.MatchNotRegexp:
+			op, value = "!~", "^(?:"+m.Value+")$"
+		default:
+			return nil, fmt.Errorf("unsupported matcher type %s", m.Type)
+		}
+		args = append(args, m.Name, value)
+		fmt.Fprintf(&sql, " AND coalesce(labels->>$%d, '') %s $%d", len(args)-1, op, len(args))
+	}
+	sql.WriteString(" ORDER BY time, alertname")
+
+	rows, err := h.conn.Query(ctx, sql.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying alert history: %w", err)
+	}
+	defer rows.Close()
+	transitions := []AlertTransition{}
+	for rows.Next() {
+		var (
+			t                  = AlertTransition{Tenant: tenant}
+			lbls, annotations  []byte
+			lblsMap, annotsMap map[string]string
+		)
+		if err = rows.Scan(&t.Time, &t.GroupFile, &t.Group, &t.State, &lbls, &annotations, &t.Value); err != nil {
+			return nil, fmt.Errorf("scanning alert transition: %w", err)
+		}
+		if err = json.Unmarshal(lbls, &lblsMap); err != nil {
+			return nil, fmt.Errorf("decoding alert labels: %w", err)
+		}
+		if err = json.Unmarshal(annotations, &annotsMap); err != nil {
+			return nil, fmt.Errorf("decoding alert annotations: %w", err)
+		}
+		t.Time = t.Time.UTC()
+		t.Labels, t.Annotations = labels.FromMap(lblsMap), labels.FromMap(annotsMap)
+		transitions = append(transitions, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying alert history: %w", err)
+	}
+	return transitions, nil
+}
+
+// trackedAlert is the last observed state of an alert.
+type trackedAlert struct {
+	state       prom_rules.AlertState
+	labels      labels.Labels
+	annotations labels.Labels
+	value       float64
+}
+
+// groupEvaluation is the evaluation of a rule group in progress: its timestamp, and
+// the position in the group of the rule after the last notified alerting rule.
+type groupEvaluation struct {
+	ts   time.Time
+	next int
+}
+
+// alertTracker detects the state transitions of the alerts, by comparing the alerts
+// of an alerting rule after each evaluation with the ones of the previous evaluation.
+//
+// The rules of a group are evaluated one after the other, each with a query at the
+// evaluation timestamp of the group, followed by the notification of the alerts for the
+// alerting rules. The notifications only carry the expression of the rule, so the rule
+// is the next alerting rule of the group with that expression that evaluated without
+// error, and the transitions are timed at the evaluation timestamp of the group. This
+// timestamp is slotted the same way by all the Promscale instances evaluating the group.
+type alertTracker struct {
+	loader *groupLoader
+
+	mu          sync.Mutex
+	groups      map[string]*prom_rules.Group
+	evaluations map[string]*groupEvaluation
+	alerts      map[*prom_rules.AlertingRule]map[uint64]trackedAlert
+}
+
+func newAlertTracker(loader *groupLoader) *alertTracker {
+	return &alertTracker{
+		loader:      loader,
+		groups:      make(map[string]*prom_rules.Group),
+		evaluations: make(map[string]*groupEvaluation),
+		alerts:      make(map[*prom_rules.AlertingRule]map[uint64]trackedAlert),
+	}
+}
+
+// setGroups sets the rule groups evaluated by the rule manager. The alerts of the
+// removed rules are forgotten.
+func (t *alertTracker) setGroups(groups []*prom_rules.Group) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.groups = make(map[string]*prom_rules.Group, len(groups))
+	rules := make(map[*prom_rules.AlertingRule]struct{})
+	for _, g := range groups {
+		t.groups[prom_rules.GroupKey(g.File(), g.Name())] = g
+		for _, r := range g.Rules() {
+			if rule, ok := r.(*prom_rules.AlertingRule); ok {
+				rules[rule] = struct{}{}
+			}
+		}
+	}
+	for key := range t.evaluations {
+		if _, ok := t.groups[key]; !ok {
+			delete(t.evaluations, key)
+		}
+	}
+	for rule := range t.alerts {
+		if _, ok := rules[rule]; !ok {
+			delete(t.alerts, rule)
+		}
+	}
+}
+
+// queryFunc returns a QueryFunc that evaluates the rules with next, and starts a new
+// evaluation of the group when the query is at a new evaluation timestamp.
+func (t *alertTracker) queryFunc(next prom_rules.QueryFunc) prom_rules.QueryFunc {
+	return func(ctx context.Context, qs string, ts time.Time) (promql.Vector, error) {
+		key := prom_rules.GroupKey(groupOrigin(ctx))
+		t.mu.Lock()
+		if e, ok := t.evaluations[key]; !ok || !e.ts.Equal(ts) {
+			t.evaluations[key] = &groupEvaluation{ts: ts}
+		}
+		t.mu.Unlock()
+		return next(ctx, qs, ts)
+	}
+}
+
+// observe returns the transitions of the alerts of the alerting rule of the group
+// being evaluated whose alerts are notified, and whose expression is expr.
+func (t *alertTracker) observe(ctx context.Context, expr string) []AlertTransition {
+	file, name := groupOrigin(ctx)
+	key := prom_rules.GroupKey(file, name)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	group, ok := t.groups[key]
+	evaluation, evaluating := t.evaluations[key]
+	if !ok || !evaluating {
+		// The groups are not set yet after an update of the rules. The transitions
+		// are detected at the next evaluation.
+		return nil
+	}
+	var rule *prom_rules.AlertingRule
+	rules := group.Rules()
+	for i := evaluation.next; i < len(rules); i++ {
+		// The rules that failed are not notified.
+		r, ok := rules[i].(*prom_rules.AlertingRule)
+		if ok && r.Health() == prom_rules.HealthGood && r.Query().String() == expr {
+			rule, evaluation.next = r, i+1
+			break
+		}
+	}
+	if rule == nil {
+		return nil
+	}
+
+	var (
+		transitions []AlertTransition
+		ts          = evaluation.ts
+		previous    = t.alerts[rule]
+		current     = make(map[uint64]trackedAlert)
+	)
+	record := func(a trackedAlert, state string, at time.Time) {
+		transitions = append(transitions, AlertTransition{
+			Time:        at,
+			Tenant:      t.loader.tenant(file),
+			GroupFile:   file,
+			Group:       name,
+			State:       state,
+			Labels:      a.labels,
+			Annotations: a.annotations,
+			Value:       a.value,
+		})
+	}
+	rule.ForEachActiveAlert(func(alert *prom_rules.Alert) {
+		a := trackedAlert{
+			state:       alert.State,
+			labels:      alert.Labels.Copy(),
+			annotations: alert.Annotations.Copy(),
+			value:       alert.Value,
+		}
+		hash := alert.Labels.Hash()
+		current[hash] = a
+		prev, seen := previous[hash]
+		if seen && prev.state == a.state {
+			return
+		}
+		// The alerts seen for the first time, such as after a restart, are recorded
+		// at the evaluation that made them pending or firing.
+		switch a.state {
+		case prom_rules.StatePending:
+			at := ts
+			if !seen {
+				at = alert.ActiveAt
+			}
+			record(a, a.state.String(), at)
+		case prom_rules.StateFiring:
+			at := ts
+			if !seen {
+				at = alert.FiredAt
+			}
+			record(a, a.state.String(), at)
+		case prom_rules.StateInactive:
+			// Resolved alerts are kept for a while after they are resolved.
+			// The ones never seen active are not recorded.
+			if seen {
+				record(a, AlertStateResolved, ts)
+			}
+		}
+	})
+	for hash, prev := range previous {
+		if _, ok := current[hash]; !ok && prev.state != prom_rules.StateInactive {
+			// Pending alerts are dropped as soon as their condition stops holding.
+			record(prev, AlertStateResolved, ts)
+		}
+	}
+	if len(current) > 0 {
+		t.alerts[rule] = current
+	} else {
+		delete(t.alerts, rule)
+	}
+	return transitions
+}
+
+// alertHistoryRecorder writes the transitions of the alerts evaluated by the rule
+// manager to the alert history, and deletes the ones older than the retention.
+type alertHistoryRecorder struct {
+	history   *AlertHistory
+	tracker   *alertTracker
+	queue     chan []AlertTransition
+	retention time.Duration
+}
+
+func newAlertHistoryRecorder(history *AlertHistory, loader *groupLoader, retention time.Duration) *alertHistoryRecorder {
+	return &alertHistoryRecorder{
+		history:   history,
+		tracker:   newAlertTracker(loader),
+		queue:     make(chan []AlertTransition, alertHistoryQueueSize),
+		retention: retention,
+	}
+}
+
+// queryFunc returns a QueryFunc that evaluates the rules with next, and keeps track
+// of the evaluations of the rule groups.
+func (r *alertHistoryRecorder) queryFunc(next prom_rules.QueryFunc) prom_rules.QueryFunc {
+	return r.tracker.queryFunc(next)
+}
+
+// notifyFunc returns a NotifyFunc that records the transitions of the alerts of an
+// alerting rule after each of its evaluations, and then calls next.
+func (r *alertHistoryRecorder) notifyFunc(next prom_rules.NotifyFunc) prom_rules.NotifyFunc {
+	return func(ctx context.Context, expr string, alerts ...*prom_rules.Alert) {
+		next(ctx, expr, alerts...)
+		transitions := r.tracker.observe(ctx, expr)
+		if len(transitions) == 0 {
+			return
+		}
+		select {
+		case r.queue <- transitions:
+		default:
+			log.WarnRateLimited("msg", "Alert history queue is full, dropping alert state transitions", "count", len(transitions))
+		}
+	}
+}
+
+// run writes the recorded transitions, and regularly deletes the expired ones,
+// until the context is done. A zero retention keeps the transitions forever.
+func (r *alertHistoryRecorder) run(ctx context.Context) {
+	var cleanup <-chan time.Time
+	if r.retention > 0 {
+		r.cleanup(ctx)
+		ticker := time.NewTicker(alertHistoryCleanupInterval)
+		defer ticker.Stop()
+		cleanup = ticker.C
+	}
+	for {
+		select {
+		case transitions := <-r.queue:
+			if err := r.history.Record(ctx, transitions); err != nil {
+				log.Error("msg", "failed to record alert state transitions", "err", err)
+			}
+		case <-cleanup:
+			r.cleanup(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// cleanup deletes the transitions older than the retention.
+func (r *alertHistoryRecorder) cleanup(ctx context.Context) {
+	deleted, err := r.history.DeleteBefore(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		log.Error("msg", "failed to delete expired alert state transitions", "err", err)
+		return
+	}
+	if deleted > 0 {
+		log.Debug("msg", "Deleted expired alert state transitions", "count", deleted)
+	}
+}
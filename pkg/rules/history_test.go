@@ -0,0 +1,202 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	prom_rules "github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestAlertTracker(t *testing.T) {
+	file := NamespaceIdentifier("tenant-a", "team-a")
+	loader := &groupLoader{}
+	loader.update(map[string]storedNamespace{
+		file: {tenant: "tenant-a", content: "groups: []\n"},
+	})
+	tracker := newAlertTracker(loader)
+
+	// The expression returns a sample for each of the active instances.
+	var active []string
+	queryFunc := func(_ context.Context, _ string, ts time.Time) (promql.Vector, error) {
+		var v promql.Vector
+		for _, instance := range active {
+			v = append(v, promql.Sample{
+				Point:  promql.Point{T: ts.UnixMilli(), V: 1},
+				Metric: labels.FromStrings("instance", instance),
+			})
+		}
+		return v, nil
+	}
+
+	var transitions []AlertTransition
+	expr, err := parser.ParseExpr("up == 0")
+	require.NoError(t, err)
+	rule := prom_rules.NewAlertingRule("InstanceDown", expr, 2*time.Minute, labels.FromStrings("severity", "page"),
+		labels.FromStrings("summary", "down"), nil, "", true, log.NewNopLogger())
+	group := prom_rules.NewGroup(prom_rules.GroupOptions{
+		Name:     "instances",
+		File:     file,
+		Interval: time.Minute,
+		Rules:    []prom_rules.Rule{rule},
+		Opts: &prom_rules.ManagerOptions{
+			QueryFunc:  tracker.queryFunc(queryFunc),
+			Appendable: &testAppendable{},
+			Context:    context.Background(),
+			Logger:     log.NewNopLogger(),
+			NotifyFunc: func(ctx context.Context, expr string, _ ...*prom_rules.Alert) {
+				transitions = append(transitions, tracker.observe(ctx, expr)...)
+			},
+		},
+	})
+	ctx := promql.NewOriginContext(context.Background(), map[string]interface{}{
+		"ruleGroup": map[string]string{"file": file, "name": "instances"},
+	})
+	eval := func(minute int64) []AlertTransition {
+		transitions = nil
+		group.Eval(ctx, time.Unix(minute*60, 0))
+		return transitions
+	}
+	type transition struct {
+		state    string
+		instance string
+		minute   int64
+	}
+	requireTransitions := func(expected []transition, got []AlertTransition) {
+		t.Helper()
+		require.Len(t, got, len(expected))
+		for i, e := range expected {
+			require.Equal(t, e.state, got[i].State)
+			require.Equal(t, e.instance, got[i].Labels.Get("instance"))
+			require.Equal(t, time.Unix(e.minute*60, 0), got[i].Time)
+			require.Equal(t, "tenant-a", got[i].Tenant)
+			require.Equal(t, file, got[i].GroupFile)
+			require.Equal(t, "instances", got[i].Group)
+			require.Equal(t, "InstanceDown", got[i].Labels.Get(labels.AlertName))
+			require.Equal(t, "page", got[i].Labels.Get("severity"))
+			require.Equal(t, labels.FromStrings("summary", "down"), got[i].Annotations)
+		}
+	}
+
+	// The groups are unknown until they are set.
+	active = []string{"a"}
+	require.Empty(t, eval(0))
+	tracker.setGroups([]*prom_rules.Group{group})
+
+	// The alert seen pending at the first evaluation is recorded from when it became active.
+	requireTransitions([]transition{{"pending", "a", 0}}, eval(1))
+	requireTransitions([]transition{{"firing", "a", 2}}, eval(2))
+	require.Empty(t, eval(3))
+
+	// A pending alert that stops being active is resolved at the evaluation.
+	active = []string{"a", "b"}
+	requireTransitions([]transition{{"pending", "b", 4}}, eval(4))
+	active = []string{"a"}
+	requireTransitions([]transition{{"resolved", "b", 5}}, eval(5))
+
+	// A firing alert is resolved when its condition stops holding.
+	active = nil
+	requireTransitions([]transition{{"resolved", "a", 6}}, eval(6))
+	require.Empty(t, eval(7))
+
+	// The alerts of removed groups are forgotten.
+	tracker.setGroups(nil)
+	require.Empty(t, tracker.alerts)
+}
+
+func TestAlertTrackerSharedExpression(t *testing.T) {
+	file := NamespaceIdentifier("tenant-a", "team-a")
+	loader := &groupLoader{}
+	loader.update(map[string]storedNamespace{
+		file: {tenant: "tenant-a", content: "groups: []\n"},
+	})
+	tracker := newAlertTracker(loader)
+
+	var failing bool
+	queryFunc := func(_ context.Context, _ string, ts time.Time) (promql.Vector, error) {
+		if failing {
+			return nil, errors.New("query failed")
+		}
+		return promql.Vector{{
+			Point:  promql.Point{T: ts.UnixMilli(), V: 1},
+			Metric: labels.FromStrings("instance", "a"),
+		}}, nil
+	}
+
+	// The rules share their name and expression, and only differ by their labels
+	// and how long the alerts stay pending.
+	expr, err := parser.ParseExpr("up == 0")
+	require.NoError(t, err)
+	warning := prom_rules.NewAlertingRule("InstanceDown", expr, 0, labels.FromStrings("severity", "warning"),
+		nil, nil, "", true, log.NewNopLogger())
+	page := prom_rules.NewAlertingRule("InstanceDown", expr, 2*time.Minute, labels.FromStrings("severity", "page"),
+		nil, nil, "", true, log.NewNopLogger())
+	var transitions []AlertTransition
+	group := prom_rules.NewGroup(prom_rules.GroupOptions{
+		Name:     "instances",
+		File:     file,
+		Interval: time.Minute,
+		Rules:    []prom_rules.Rule{warning, page},
+		Opts: &prom_rules.ManagerOptions{
+			QueryFunc:  tracker.queryFunc(queryFunc),
+			Appendable: &testAppendable{},
+			Context:    context.Background(),
+			Logger:     log.NewNopLogger(),
+			NotifyFunc: func(ctx context.Context, expr string, _ ...*prom_rules.Alert) {
+				transitions = append(transitions, tracker.observe(ctx, expr)...)
+			},
+		},
+	})
+	tracker.setGroups([]*prom_rules.Group{group})
+	ctx := promql.NewOriginContext(context.Background(), map[string]interface{}{
+		"ruleGroup": map[string]string{"file": file, "name": "instances"},
+	})
+	eval := func(minute int64) []string {
+		transitions = nil
+		group.Eval(ctx, time.Unix(minute*60, 0))
+		var got []string
+		for _, tr := range transitions {
+			require.Equal(t, time.Unix(minute*60, 0), tr.Time)
+			got = append(got, tr.Labels.Get("severity")+" "+tr.State)
+		}
+		return got
+	}
+
+	require.Equal(t, []string{"warning firing", "page pending"}, eval(0))
+	require.Empty(t, eval(1))
+	require.Equal(t, []string{"page firing"}, eval(2))
+
+	// The alerts of the rules that fail to evaluate are kept.
+	failing = true
+	require.Empty(t, eval(3))
+	failing = false
+	require.Empty(t, eval(4))
+	require.Len(t, tracker.alerts, 2)
+}
+
+func TestAlertHistoryDeleteBefore(t *testing.T) {
+	before := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	conn := model.NewSqlRecorder([]model.SqlQuery{
+		{
+			Sql:     deleteAlertHistorySQL,
+			Args:    []interface{}{before},
+			Results: model.RowResults{{pgconn.NewCommandTag("DELETE 3")}},
+		},
+	}, t)
+	deleted, err := NewAlertHistory(conn).DeleteBefore(context.Background(), before)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), deleted)
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net/url"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/oklog/run"
@@ -17,6 +18,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	prometheus_config "github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
 	"github.com/prometheus/prometheus/notifier"
 	prom_rules "github.com/prometheus/prometheus/rules"
 
@@ -24,6 +27,7 @@ import (
 	"github.com/timescale/promscale/pkg/pgclient"
 	"github.com/timescale/promscale/pkg/rules/adapters"
 	"github.com/timescale/promscale/pkg/telemetry"
+	"github.com/timescale/promscale/pkg/tenancy"
 	"github.com/timescale/promscale/pkg/util"
 )
 
@@ -58,9 +62,25 @@ type Manager struct {
 	notifierManager     *notifier.Manager
 	discoveryManager    *discovery.Manager
 	postRulesProcessing prom_rules.RuleGroupPostProcessFunc
+
+	groupStore   *GroupStore
+	alertHistory *AlertHistory
+	recorder     *alertHistoryRecorder
+	carrier      *exemplarCarrier
+	groupLoader  *groupLoader
+	queryables   *tenantQueryables
+	syncInterval time.Duration
+	externalURL  string
+
+	mu sync.Mutex
+	// promConfig is the last applied configuration.
+	promConfig *prometheus_config.Config
 }
 
 func NewManager(ctx context.Context, r prometheus.Registerer, client *pgclient.Client, cfg *Config) (*Manager, func() error, error) {
+	if cfg.DatabaseSyncInterval <= 0 {
+		return nil, nil, fmt.Errorf("metrics.rules.database-sync-interval must be positive")
+	}
 	discoveryManagerNotify := discovery.NewManager(ctx, log.GetLogger(), discovery.Name("notify"))
 
 	notifierManager := notifier.NewManager(&notifier.Options{
@@ -69,24 +89,44 @@ func NewManager(ctx context.Context, r prometheus.Registerer, client *pgclient.C
 		Do:            do,
 	}, log.GetLogger())
 
-	// For the moment, we do not have any external UI url, hence we provide an empty one.
-	parsedUrl, err := url.Parse("")
+	parsedUrl, err := url.Parse(cfg.ExternalURL)
 	if err != nil {
-		return nil, nil, fmt.Errorf("parsing UI-URL: %w", err)
+		return nil, nil, fmt.Errorf("parsing external URL: %w", err)
 	}
 
+	var writeAuthorizer tenancy.WriteAuthorizer
+	if mt := client.Authorizer(); mt != nil {
+		writeAuthorizer = mt.WriteAuthorizer()
+	}
+	loader := &groupLoader{}
+	queryables := newTenantQueryables(client)
+	carrier := newExemplarCarrier(tenantExemplarQueryFunc(client.QueryEngine(), loader, queryables))
+	notifyFunc := sendAlerts(notifierManager, parsedUrl.String())
+	queryFunc := carrier.queryFunc(tenantQueryFunc(client.QueryEngine(), loader, queryables))
+	var (
+		alertHistory *AlertHistory
+		recorder     *alertHistoryRecorder
+	)
+	if conn := client.ReadOnlyConnection(); conn != nil {
+		alertHistory = NewAlertHistory(conn)
+		recorder = newAlertHistoryRecorder(alertHistory, loader, cfg.AlertHistoryRetention)
+		notifyFunc = recorder.notifyFunc(notifyFunc)
+		queryFunc = recorder.queryFunc(queryFunc)
+	}
+	appendable := tenantAppendable{adapters.NewIngestAdapter(client.Inserter(), writeAuthorizer), loader}
 	rulesManager := prom_rules.NewManager(&prom_rules.ManagerOptions{
-		Appendable:      adapters.NewIngestAdapter(client.Inserter()),
+		Appendable:      exemplarAppendable{appendable, carrier},
 		Queryable:       adapters.NewQueryAdapter(client.Queryable()),
 		Context:         ctx,
 		ExternalURL:     parsedUrl,
 		Logger:          log.GetLogger(),
-		NotifyFunc:      sendAlerts(notifierManager, parsedUrl.String()),
-		QueryFunc:       engineQueryFunc(client.QueryEngine(), client.Queryable()),
+		NotifyFunc:      notifyFunc,
+		QueryFunc:       queryFunc,
 		Registerer:      r,
 		OutageTolerance: cfg.OutageTolerance,
 		ForGracePeriod:  cfg.ForGracePeriod,
 		ResendDelay:     cfg.ResendDelay,
+		GroupLoader:     loader,
 	})
 
 	manager := &Manager{
@@ -94,6 +134,16 @@ func NewManager(ctx context.Context, r prometheus.Registerer, client *pgclient.C
 		rulesManager:     rulesManager,
 		notifierManager:  notifierManager,
 		discoveryManager: discoveryManagerNotify,
+		alertHistory:     alertHistory,
+		recorder:         recorder,
+		carrier:          carrier,
+		groupLoader:      loader,
+		queryables:       queryables,
+		syncInterval:     cfg.DatabaseSyncInterval,
+		externalURL:      parsedUrl.String(),
+	}
+	if conn := client.ReadOnlyConnection(); conn != nil {
+		manager.groupStore = NewGroupStore(conn)
 	}
 	return manager, manager.getReloader(cfg), nil
 }
@@ -114,6 +164,9 @@ func (m *Manager) getReloader(cfg *Config) func() error {
 		if err != nil {
 			return fmt.Errorf("error validating rules-config: %w", err)
 		}
+		if _, err = m.syncGroups(m.ctx); err != nil {
+			log.Warn("msg", "Rule groups stored in the database are not loaded", "err", err)
+		}
 		if err = m.ApplyConfig(cfg.PrometheusConfig); err != nil {
 			return fmt.Errorf("error applying config: %w", err)
 		}
@@ -123,7 +176,7 @@ func (m *Manager) getReloader(cfg *Config) func() error {
 }
 
 func (m *Manager) updateTelemetry(cfg *Config) {
-	if cfg.ContainsRules() {
+	if cfg.ContainsRules() || len(m.groupLoader.identifiers()) > 0 {
 		rulesEnabled.Set(1)
 		if cfg.ContainsAlertingConfig() {
 			alertingEnabled.Set(1)
@@ -149,6 +202,14 @@ func (m *Manager) ApplyConfig(cfg *prometheus_config.Config) error {
 		return err
 	}
 
+	m.mu.Lock()
+	m.promConfig = cfg
+	m.mu.Unlock()
+	return m.updateRules(cfg)
+}
+
+// updateRules loads the rule groups of the rule files and of the database.
+func (m *Manager) updateRules(cfg *prometheus_config.Config) error {
 	// Get all rule files matching the configuration paths.
 	var files []string
 	for _, pat := range cfg.RuleFiles {
@@ -158,12 +219,117 @@ func (m *Manager) ApplyConfig(cfg *prometheus_config.Config) error {
 		}
 		files = append(files, fs...)
 	}
-	if err := m.rulesManager.Update(time.Duration(cfg.GlobalConfig.EvaluationInterval), files, cfg.GlobalConfig.ExternalLabels, "", m.postRulesProcessing); err != nil {
+	files = append(files, m.groupLoader.identifiers()...)
+	if err := m.rulesManager.Update(time.Duration(cfg.GlobalConfig.EvaluationInterval), files, cfg.GlobalConfig.ExternalLabels, m.externalURL, m.postRulesProcessing); err != nil {
 		return fmt.Errorf("error updating rule-manager: %w", err)
 	}
+	groups := m.rulesManager.RuleGroups()
+	m.carrier.setGroups(groups)
+	if m.recorder != nil {
+		m.recorder.tracker.setGroups(groups)
+	}
 	return nil
 }
 
+// syncGroups fetches the rule groups stored in the database, and returns true if
+// they changed since the last sync.
+func (m *Manager) syncGroups(ctx context.Context) (bool, error) {
+	if m.groupStore == nil {
+		return false, nil
+	}
+	namespaces, err := m.groupStore.all(ctx)
+	if err != nil {
+		return false, err
+	}
+	return m.groupLoader.update(namespaces), nil
+}
+
+// SyncGroups updates the rules if the rule groups stored in the database changed,
+// possibly through another Promscale instance.
+func (m *Manager) SyncGroups(ctx context.Context) error {
+	changed, err := m.syncGroups(ctx)
+	if err != nil || !changed {
+		return err
+	}
+	m.mu.Lock()
+	cfg := m.promConfig
+	m.mu.Unlock()
+	if cfg == nil {
+		// The rules are loaded on the first reload.
+		return nil
+	}
+	log.Info("msg", "Rule groups stored in the database changed, updating the rules")
+	return m.updateRules(cfg)
+}
+
+// Namespace returns the rule groups stored in the database in the namespace of the
+// tenant of the context.
+func (m *Manager) Namespace(ctx context.Context, namespace string) ([]rulefmt.RuleGroup, error) {
+	if err := m.authorizeTenant(ctx); err != nil {
+		return nil, err
+	}
+	return m.groupStore.Namespace(ctx, namespace)
+}
+
+// Group returns a rule group stored in the database.
+func (m *Manager) Group(ctx context.Context, namespace, name string) (*rulefmt.RuleGroup, error) {
+	if err := m.authorizeTenant(ctx); err != nil {
+		return nil, err
+	}
+	return m.groupStore.Group(ctx, namespace, name)
+}
+
+// SetGroup stores a rule group in the database, and updates the rules. The rule
+// group is owned by the tenant of the context.
+func (m *Manager) SetGroup(ctx context.Context, namespace string, group rulefmt.RuleGroup) error {
+	if err := m.authorizeTenant(ctx); err != nil {
+		return err
+	}
+	if err := m.groupStore.SetGroup(ctx, namespace, group); err != nil {
+		return err
+	}
+	m.syncAfterChange(ctx)
+	return nil
+}
+
+// DeleteGroup deletes a rule group stored in the database, and updates the rules.
+func (m *Manager) DeleteGroup(ctx context.Context, namespace, name string) error {
+	if err := m.authorizeTenant(ctx); err != nil {
+		return err
+	}
+	if err := m.groupStore.DeleteGroup(ctx, namespace, name); err != nil {
+		return err
+	}
+	m.syncAfterChange(ctx)
+	return nil
+}
+
+// DeleteNamespace deletes the rule groups of a namespace, and updates the rules.
+func (m *Manager) DeleteNamespace(ctx context.Context, namespace string) error {
+	if err := m.authorizeTenant(ctx); err != nil {
+		return err
+	}
+	if err := m.groupStore.DeleteNamespace(ctx, namespace); err != nil {
+		return err
+	}
+	m.syncAfterChange(ctx)
+	return nil
+}
+
+// authorizeTenant checks that the tenant of the context, if any, is authorized.
+func (m *Manager) authorizeTenant(ctx context.Context) error {
+	_, err := m.queryables.get(tenancy.TenantFromContext(ctx))
+	return err
+}
+
+// syncAfterChange applies a change of the stored rule groups right away. If it fails,
+// the change is applied by the next periodic sync.
+func (m *Manager) syncAfterChange(ctx context.Context) {
+	if err := m.SyncGroups(ctx); err != nil {
+		log.Error("msg", "failed to update the rules after a rule group change", "err", err)
+	}
+}
+
 func (m *Manager) applyDiscoveryManagerConfig(cfg *prometheus_config.Config) error {
 	c := make(map[string]discovery.Configs)
 	for k, v := range cfg.AlertingConfig.AlertmanagerConfigs.ToMap() {
@@ -180,10 +346,28 @@ func (m *Manager) RuleGroups() []*prom_rules.Group {
 	return m.rulesManager.RuleGroups()
 }
 
+// GroupTenant returns the tenant owning the rule groups of the file. The groups of
+// the rule files and the ones created without multi-tenancy have no tenant.
+func (m *Manager) GroupTenant(file string) string {
+	return m.groupLoader.tenant(file)
+}
+
 func (m *Manager) AlertingRules() []*prom_rules.AlertingRule {
 	return m.rulesManager.AlertingRules()
 }
 
+// AlertHistory returns the state transitions of the alerts matching the matchers
+// within the time range.
+func (m *Manager) AlertHistory(ctx context.Context, start, end time.Time, matchers []*labels.Matcher) ([]AlertTransition, error) {
+	if err := m.authorizeTenant(ctx); err != nil {
+		return nil, err
+	}
+	if m.alertHistory == nil {
+		return nil, ErrAlertHistoryDisabled
+	}
+	return m.alertHistory.Query(ctx, start, end, matchers)
+}
+
 // Run runs the managers and blocks on either a graceful exit or on error.
 func (m *Manager) Run() error {
 	var g run.Group
@@ -213,6 +397,38 @@ func (m *Manager) Run() error {
 		m.rulesManager.Stop()
 	})
 
+	syncCtx, stopSync := context.WithCancel(m.ctx)
+	g.Add(func() error {
+		log.Debug("msg", "Starting rule group sync...")
+		ticker := time.NewTicker(m.syncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.SyncGroups(syncCtx); err != nil {
+					log.Error("msg", "failed to sync the rule groups stored in the database", "err", err)
+				}
+			case <-syncCtx.Done():
+				return nil
+			}
+		}
+	}, func(error) {
+		log.Debug("msg", "Stopping rule group sync")
+		stopSync()
+	})
+
+	if m.recorder != nil {
+		historyCtx, stopHistory := context.WithCancel(m.ctx)
+		g.Add(func() error {
+			log.Debug("msg", "Starting alert history recorder...")
+			m.recorder.run(historyCtx)
+			return nil
+		}, func(error) {
+			log.Debug("msg", "Stopping alert history recorder")
+			stopHistory()
+		})
+	}
+
 	g.Add(func() error {
 		// This stops all actors in the group on context done.
 		<-m.ctx.Done()
@@ -6,9 +6,21 @@ package rules
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	prom_rules "github.com/prometheus/prometheus/rules"
 	"github.com/stretchr/testify/require"
 	"github.com/timescale/promscale/pkg/pgclient"
 )
@@ -25,3 +37,84 @@ func TestRegexInConfig(t *testing.T) {
 	require.Equal(t, "g-one", ruleGroups[0].Name())
 	require.Equal(t, "g-two", ruleGroups[1].Name())
 }
+
+const alertmanagerConfig = `global:
+  external_labels:
+    cluster: eu-1
+
+alerting:
+  alert_relabel_configs:
+    - source_labels: [severity]
+      regex: debug
+      action: drop
+    - target_label: source
+      replacement: promscale
+  alertmanagers:
+    - file_sd_configs:
+        - files: [%s]
+`
+
+func TestAlertmanagerDiscovery(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []map[string]interface{}
+	)
+	alertmanager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts []map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&alerts))
+		mu.Lock()
+		received = append(received, alerts...)
+		mu.Unlock()
+	}))
+	defer alertmanager.Close()
+	amURL, err := url.Parse(alertmanager.URL)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	targetsFile := filepath.Join(dir, "alertmanagers.json")
+	require.NoError(t, os.WriteFile(targetsFile, []byte(fmt.Sprintf(`[{"targets": [%q]}]`, amURL.Host)), 0o600))
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(alertmanagerConfig, targetsFile)), 0o600))
+
+	cfg := DefaultConfig
+	cfg.PrometheusConfigAddress = configFile
+	cfg.ExternalURL = "http://prometheus.example:9090/"
+	require.NoError(t, Validate(&cfg))
+	require.Equal(t, "http://prometheus.example:9090", cfg.ExternalURL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, reloader, err := NewManager(ctx, prometheus.NewRegistry(), &pgclient.Client{}, &cfg)
+	require.NoError(t, err)
+	require.NoError(t, reloader())
+	go func() { _ = m.discoveryManager.Run() }()
+	go m.notifierManager.Run(m.discoveryManager.SyncCh())
+	defer m.notifierManager.Stop()
+
+	// The Alertmanagers are discovered after the discovery manager's first update.
+	require.Eventually(t, func() bool {
+		return len(m.notifierManager.Alertmanagers()) == 1
+	}, 20*time.Second, 100*time.Millisecond)
+
+	notify := sendAlerts(m.notifierManager, m.externalURL)
+	notify(ctx, "up == 0",
+		&prom_rules.Alert{Labels: labels.FromStrings(labels.AlertName, "InstanceDown", "severity", "page"), FiredAt: time.Now()},
+		&prom_rules.Alert{Labels: labels.FromStrings(labels.AlertName, "InstanceDown", "severity", "debug"), FiredAt: time.Now()},
+	)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) > 0
+	}, 10*time.Second, 50*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1)
+	require.Equal(t, map[string]interface{}{
+		"alertname": "InstanceDown",
+		"severity":  "page",
+		"cluster":   "eu-1",
+		"source":    "promscale",
+	}, received[0]["labels"])
+	require.True(t, strings.HasPrefix(received[0]["generatorURL"].(string), "http://prometheus.example:9090/graph?g0.expr="))
+}
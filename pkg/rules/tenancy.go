@@ -0,0 +1,114 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	prometheus_promql "github.com/prometheus/prometheus/promql"
+	prom_rules "github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/timescale/promscale/pkg/pgclient"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	promscale_promql "github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+// groupOrigin returns the file and the name of the rule group being evaluated, which
+// the rule manager attaches to the evaluation context.
+func groupOrigin(ctx context.Context) (file, name string) {
+	origin, _ := ctx.Value(prometheus_promql.QueryOrigin{}).(map[string]interface{})
+	group, _ := origin["ruleGroup"].(map[string]string)
+	return group["file"], group["name"]
+}
+
+// groupFile returns the file of the rule group being evaluated.
+func groupFile(ctx context.Context) string {
+	file, _ := groupOrigin(ctx)
+	return file
+}
+
+// withTenant returns a copy of ctx carrying the tenant owning the rule group being
+// evaluated, if any.
+func (l *groupLoader) withTenant(ctx context.Context) context.Context {
+	if tenant := l.tenant(groupFile(ctx)); tenant != "" {
+		return tenancy.WithTenant(ctx, tenant)
+	}
+	return ctx
+}
+
+// tenantAppendable makes the appenders write the results of a rule group on behalf
+// of the tenant owning it.
+type tenantAppendable struct {
+	storage.Appendable
+	loader *groupLoader
+}
+
+func (a tenantAppendable) Appender(ctx context.Context) storage.Appender {
+	return a.Appendable.Appender(a.loader.withTenant(ctx))
+}
+
+// tenantQueryables holds the queryables restricted to the data of each tenant
+// owning rule groups.
+type tenantQueryables struct {
+	client *pgclient.Client
+
+	mu         sync.Mutex
+	queryables map[string]promscale_promql.Queryable
+}
+
+func newTenantQueryables(client *pgclient.Client) *tenantQueryables {
+	return &tenantQueryables{
+		client:     client,
+		queryables: make(map[string]promscale_promql.Queryable),
+	}
+}
+
+// get returns the queryable of the tenant. Rule groups without a tenant use the
+// queryable of the client, which is restricted to the authorized tenants.
+func (q *tenantQueryables) get(tenant string) (promscale_promql.Queryable, error) {
+	if tenant == "" {
+		return q.client.Queryable(), nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if queryable, ok := q.queryables[tenant]; ok {
+		return queryable, nil
+	}
+	queryable, err := q.client.TenantQueryable(tenant)
+	if err != nil {
+		return nil, fmt.Errorf("rules of tenant %s: %w", tenant, err)
+	}
+	q.queryables[tenant] = queryable
+	return queryable, nil
+}
+
+// tenantQueryFunc evaluates the rules with the queryable of the tenant owning the
+// rule group.
+func tenantQueryFunc(engine *promscale_promql.Engine, loader *groupLoader, queryables *tenantQueryables) prom_rules.QueryFunc {
+	return func(ctx context.Context, qs string, t time.Time) (prometheus_promql.Vector, error) {
+		queryable, err := queryables.get(loader.tenant(groupFile(ctx)))
+		if err != nil {
+			return nil, err
+		}
+		return engineQueryFunc(engine, queryable)(ctx, qs, t)
+	}
+}
+
+// tenantExemplarQueryFunc queries the exemplars of the rules with the queryable of the
+// tenant owning the rule group.
+func tenantExemplarQueryFunc(engine *promscale_promql.Engine, loader *groupLoader, queryables *tenantQueryables) exemplarQueryFunc {
+	return func(ctx context.Context, qs string, t time.Time) ([]model.ExemplarQueryResult, error) {
+		queryable, err := queryables.get(loader.tenant(groupFile(ctx)))
+		if err != nil {
+			return nil, err
+		}
+		return engine.QueryExemplars(ctx, queryable, qs, t)
+	}
+}
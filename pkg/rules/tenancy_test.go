@@ -0,0 +1,36 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"context"
+	"testing"
+
+	prometheus_promql "github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+func TestGroupTenantContext(t *testing.T) {
+	tenantGroups := NamespaceIdentifier("tenant-a", "team-a")
+	loader := &groupLoader{}
+	loader.update(map[string]storedNamespace{
+		tenantGroups: {tenant: "tenant-a", content: "groups: []\n"},
+	})
+	groupContext := func(file string) context.Context {
+		return prometheus_promql.NewOriginContext(context.Background(), map[string]interface{}{
+			"ruleGroup": map[string]string{"file": file, "name": "payments"},
+		})
+	}
+
+	ctx := groupContext(tenantGroups)
+	require.Equal(t, tenantGroups, groupFile(ctx))
+	require.Equal(t, "tenant-a", tenancy.TenantFromContext(loader.withTenant(ctx)))
+
+	require.Equal(t, "", tenancy.TenantFromContext(loader.withTenant(groupContext("rules.yaml"))))
+	require.Equal(t, "", groupFile(context.Background()))
+	require.Equal(t, "", tenancy.TenantFromContext(loader.withTenant(context.Background())))
+}
@@ -0,0 +1,63 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package rules
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitTest(t *testing.T) {
+	testCases := []struct {
+		name        string
+		files       []string
+		expectedErr string
+		expectedOut []string
+	}{
+		{
+			name:        "passing tests",
+			files:       []string{"testdata/unittest/passing.test.yaml"},
+			expectedOut: []string{"SUCCESS"},
+		},
+		{
+			name:        "failing tests",
+			files:       []string{"testdata/unittest/passing.test.yaml", "testdata/unittest/failing.test.yaml"},
+			expectedErr: "1 of 2 rule test files failed",
+			expectedOut: []string{"SUCCESS", "FAILED", `expr: "test"`, "name: Failing alert test", "alertname: InstanceDown"},
+		},
+		{
+			name:        "invalid expression",
+			files:       []string{"testdata/unittest/bad-promql.test.yaml"},
+			expectedErr: "1 of 1 rule test files failed",
+			expectedOut: []string{"FAILED", `expr: "sum("`},
+		},
+		{
+			name:        "missing test file",
+			files:       []string{"testdata/unittest/missing.test.yaml"},
+			expectedErr: "1 of 1 rule test files failed",
+			expectedOut: []string{"no such file or directory"},
+		},
+		{
+			name:        "no test files",
+			expectedErr: "no rule test files",
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := UnitTest(&out, c.files...)
+			if c.expectedErr != "" {
+				require.EqualError(t, err, c.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			for _, s := range c.expectedOut {
+				require.Contains(t, out.String(), s)
+			}
+		})
+	}
+}
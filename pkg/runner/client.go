@@ -163,6 +163,7 @@ func CreateClient(r prometheus.Registerer, cfg *Config) (*pgclient.Client, error
 			return nil, fmt.Errorf("new tenancy: %w", err)
 		}
 		cfg.APICfg.MultiTenancy = multiTenancy
+		cfg.TracingCfg.TracesAuthorizer = multiTenancy.TracesAuthorizer()
 	}
 
 	if !cfg.APICfg.ReadOnly {
@@ -228,25 +229,33 @@ func isBGWLessThanDBs(conn *pgx.Conn) (bool, error) {
 }
 
 func applyDatasetConfigIfDefined(conn *pgx.Conn, cfg *Config) error {
-	if (cfg.DatasetCfg != dataset.Config{}) {
-		if cfg.DatasetConfig != "" {
-			log.Warn("msg", "Ignoring `startup.dataset.config` in favor of the newer `startup.dataset` config option since both were set.")
-		}
-		return cfg.DatasetCfg.Apply(conn)
+	if !cfg.DatasetCfg.IsEmpty() && cfg.DatasetConfig != "" {
+		log.Warn("msg", "Ignoring `startup.dataset.config` in favor of the newer `startup.dataset` config option since both were set.")
 	}
-	if cfg.DatasetConfig != "" {
-		return applyDatasetConfig(conn, cfg.DatasetConfig)
+	datasetCfg, err := datasetConfig(cfg)
+	if err != nil || datasetCfg == nil {
+		return err
 	}
-	return nil
+	return datasetCfg.Apply(conn)
 }
 
-func applyDatasetConfig(conn *pgx.Conn, cfgFilename string) error {
-	cfg, err := dataset.NewConfig(cfgFilename)
-	if err != nil {
-		return err
+// datasetConfig returns the dataset configuration from the `startup.dataset` or
+// `startup.dataset.config` option, or nil if none is set.
+func datasetConfig(cfg *Config) (*dataset.Config, error) {
+	if !cfg.DatasetCfg.IsEmpty() {
+		if err := cfg.DatasetCfg.Validate(); err != nil {
+			return nil, err
+		}
+		return &cfg.DatasetCfg, nil
 	}
-
-	return cfg.Apply(conn)
+	if cfg.DatasetConfig != "" {
+		datasetCfg, err := dataset.NewConfig(cfg.DatasetConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &datasetCfg, nil
+	}
+	return nil, nil
 }
 
 func compileAnchoredRegexString(s string) (*regexp.Regexp, error) {
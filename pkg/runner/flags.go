@@ -20,7 +20,9 @@ import (
 	"github.com/timescale/promscale/pkg/pgclient"
 	"github.com/timescale/promscale/pkg/query"
 	"github.com/timescale/promscale/pkg/rules"
+	"github.com/timescale/promscale/pkg/spanmetrics"
 	"github.com/timescale/promscale/pkg/tenancy"
+	"github.com/timescale/promscale/pkg/thanos"
 	"github.com/timescale/promscale/pkg/tracer"
 	"github.com/timescale/promscale/pkg/util"
 	"github.com/timescale/promscale/pkg/vacuum"
@@ -41,6 +43,8 @@ type Config struct {
 	RulesCfg                    rules.Config
 	TracingCfg                  jaegerStore.Config
 	VacuumCfg                   vacuum.Config
+	SpanMetricsCfg              spanmetrics.Config
+	ThanosCfg                   thanos.Config
 	ConfigFile                  string
 	DatasetConfig               string
 	DatasetCfg                  dataset.Config
@@ -143,6 +147,8 @@ func ParseFlags(cfg *Config, args []string) (*Config, error) {
 	jaegerStore.ParseFlags(fs, &cfg.TracingCfg)
 	rules.ParseFlags(fs, &cfg.RulesCfg)
 	vacuum.ParseFlags(fs, &cfg.VacuumCfg)
+	spanmetrics.ParseFlags(fs, &cfg.SpanMetricsCfg)
+	thanos.ParseFlags(fs, &cfg.ThanosCfg)
 
 	fs.StringVar(&cfg.ConfigFile, configFileFlagName, "config.yml", "YAML configuration file path for Promscale.")
 	fs.StringVar(&cfg.ListenAddr, "web.listen-address", ":9201", "Address to listen on for web endpoints.")
@@ -194,6 +200,9 @@ func ParseFlags(cfg *Config, args []string) (*Config, error) {
 	if (cfg.TLSCertFile != "") != (cfg.TLSKeyFile != "") {
 		return nil, fmt.Errorf("both TLS Ceriticate File and TLS Key File need to be provided for a valid TLS configuration")
 	}
+	if cfg.ThanosCfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("the Thanos Store API client authentication requires a TLS Certificate File and a TLS Key File")
+	}
 
 	corsOriginRegex, err := compileAnchoredRegexString(corsOriginFlag)
 	if err != nil {
@@ -269,6 +278,12 @@ func validate(cfg *Config) error {
 	if err := vacuum.Validate(&cfg.VacuumCfg); err != nil {
 		return fmt.Errorf("error validating vacuum configuration: %w", err)
 	}
+	if err := spanmetrics.Validate(&cfg.SpanMetricsCfg); err != nil {
+		return fmt.Errorf("error validating span metrics configuration: %w", err)
+	}
+	if err := thanos.Validate(&cfg.ThanosCfg); err != nil {
+		return fmt.Errorf("error validating Thanos Store API configuration: %w", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,121 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package runner
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/timescale/promscale/pkg/limits"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgclient"
+	"github.com/timescale/promscale/pkg/query"
+	"github.com/timescale/promscale/pkg/rules"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+// RulesCommand is the name of the command working with rule files.
+const RulesCommand = "rules"
+
+const rulesUsage = `usage: promscale rules <command> [flags] <files>
+
+Commands:
+  backfill  Evaluates the recording rules of rule files over a past time range and writes the results into the database.
+  test      Runs rule unit test files, in the promtool test format, against the Promscale PromQL engine.
+`
+
+// RunRulesCommand runs a subcommand of the rules command.
+func RunRulesCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Print(rulesUsage)
+		return fmt.Errorf("no rules command")
+	}
+	switch args[0] {
+	case "backfill":
+		return runBackfill(args[1:])
+	case "test":
+		return runTest(args[1:])
+	default:
+		fmt.Print(rulesUsage)
+		return fmt.Errorf("unknown rules command %q", args[0])
+	}
+}
+
+func runBackfill(args []string) error {
+	var (
+		fs          = flag.NewFlagSet("promscale rules backfill", flag.ContinueOnError)
+		cfg         = &Config{}
+		backfillCfg = rules.DefaultBackfillConfig
+	)
+	pgclient.ParseFlags(fs, &cfg.PgmodelCfg)
+	log.ParseFlags(fs, &cfg.LogCfg)
+	limits.ParseFlags(fs, &cfg.LimitsCfg)
+	query.ParseFlags(fs, &cfg.PromQLCfg)
+	rules.ParseBackfillFlags(fs, &backfillCfg)
+	fs.BoolVar(&cfg.UseVersionLease, "startup.use-schema-version-lease", true, "Use schema version lease to prevent race conditions during migration.")
+
+	if err := util.ParseEnv(envVarPrefix, fs); err != nil {
+		return fmt.Errorf("error parsing env variables: %w", err)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := log.Init(cfg.LogCfg); err != nil {
+		return fmt.Errorf("cannot start logger: %w", err)
+	}
+	if err := limits.Validate(&cfg.LimitsCfg); err != nil {
+		return fmt.Errorf("invalid limits configuration: %w", err)
+	}
+	if err := pgclient.Validate(&cfg.PgmodelCfg, cfg.LimitsCfg); err != nil {
+		return fmt.Errorf("invalid database configuration: %w", err)
+	}
+	if err := query.Validate(&cfg.PromQLCfg); err != nil {
+		return fmt.Errorf("invalid PromQL configuration: %w", err)
+	}
+	if err := rules.ValidateBackfill(&backfillCfg); err != nil {
+		return fmt.Errorf("invalid backfill configuration: %w", err)
+	}
+
+	client, err := CreateClient(prometheus.NewRegistry(), cfg)
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+	defer client.Close()
+
+	log.Info("msg", "Backfilling recording rules", "start", backfillCfg.Start, "end", backfillCfg.End)
+	if err = rules.Backfill(context.Background(), client, &backfillCfg, fs.Args()); err != nil {
+		return err
+	}
+	if backfillCfg.ProgressFile != "" {
+		if err = os.Remove(backfillCfg.ProgressFile); err != nil && !os.IsNotExist(err) {
+			log.Warn("msg", "Failed to remove the progress file", "err", err)
+		}
+	}
+	log.Info("msg", "Backfill complete")
+	return nil
+}
+
+func runTest(args []string) error {
+	var (
+		fs     = flag.NewFlagSet("promscale rules test", flag.ContinueOnError)
+		logCfg log.Config
+	)
+	log.ParseFlags(fs, &logCfg)
+
+	if err := util.ParseEnv(envVarPrefix, fs); err != nil {
+		return fmt.Errorf("error parsing env variables: %w", err)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := log.Init(logCfg); err != nil {
+		return fmt.Errorf("cannot start logger: %w", err)
+	}
+	return rules.UnitTest(os.Stdout, fs.Args()...)
+}
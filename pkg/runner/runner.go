@@ -9,6 +9,8 @@ package runner
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
@@ -31,7 +33,12 @@ import (
 	"github.com/google/uuid"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
+	"github.com/jaegertracing/jaeger/proto-gen/api_v2"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 
 	"github.com/timescale/promscale/pkg/api"
@@ -41,9 +48,12 @@ import (
 	"github.com/timescale/promscale/pkg/pgmodel/ingestor/trace"
 	dbMetrics "github.com/timescale/promscale/pkg/pgmodel/metrics/database"
 	"github.com/timescale/promscale/pkg/rules"
+	"github.com/timescale/promscale/pkg/spanmetrics"
 	"github.com/timescale/promscale/pkg/telemetry"
+	"github.com/timescale/promscale/pkg/tenancy"
 	"github.com/timescale/promscale/pkg/thanos"
 	"github.com/timescale/promscale/pkg/tracer"
+	"github.com/timescale/promscale/pkg/traceretention"
 	"github.com/timescale/promscale/pkg/util"
 	tput "github.com/timescale/promscale/pkg/util/throughput"
 	"github.com/timescale/promscale/pkg/version"
@@ -200,18 +210,32 @@ func Run(cfg *Config) error {
 	}
 
 	if len(cfg.ThanosStoreAPIListenAddr) > 0 {
-		srv := thanos.NewStorage(client.Queryable())
+		srv := thanos.NewStorage(client, client.ReadOnlyConnection(), cfg.ThanosCfg)
 		options := make([]grpc.ServerOption, 0)
 		if cfg.TLSCertFile != "" {
-			creds, err := credentials.NewServerTLSFromFile(cfg.TLSCertFile, cfg.TLSKeyFile)
+			creds, err := thanosTLSCredentials(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.ThanosCfg.TLSClientCAFile)
 			if err != nil {
 				log.Error("msg", "Setting up TLS credentials for Thanos StoreAPI failed", "err", err)
 				return err
 			}
 			options = append(options, grpc.Creds(creds))
 		}
+		if cfg.APICfg.MultiTenancy != nil {
+			options = append(options,
+				grpc.ChainUnaryInterceptor(tenancy.UnaryServerInterceptor),
+				grpc.ChainStreamInterceptor(tenancy.StreamServerInterceptor),
+			)
+		}
 		grpcServer := grpc.NewServer(options...)
 		storepb.RegisterStoreServer(grpcServer, srv)
+		var ruleGroups thanos.RuleGroups
+		if cfg.APICfg.Rules != nil {
+			ruleGroups = cfg.APICfg.Rules
+			rulespb.RegisterRulesServer(grpcServer, thanos.NewRulesServer(srv, ruleGroups))
+		}
+		infopb.RegisterInfoServer(grpcServer, thanos.NewInfoServer(srv, ruleGroups))
+		metadatapb.RegisterMetadataServer(grpcServer, thanos.NewMetadataServer(srv))
+		exemplarspb.RegisterExemplarsServer(grpcServer, thanos.NewExemplarsServer(srv))
 
 		group.Add(
 			func() error {
@@ -229,9 +253,15 @@ func Run(cfg *Config) error {
 		)
 	}
 
+	unaryInterceptors := []grpc.UnaryServerInterceptor{loggingUnaryInterceptor, grpc_prometheus.UnaryServerInterceptor}
+	streamInterceptors := []grpc.StreamServerInterceptor{loggingStreamInterceptor, grpc_prometheus.StreamServerInterceptor}
+	if cfg.APICfg.MultiTenancy != nil {
+		unaryInterceptors = append(unaryInterceptors, tenancy.UnaryServerInterceptor)
+		streamInterceptors = append(streamInterceptors, tenancy.StreamServerInterceptor)
+	}
 	options := []grpc.ServerOption{
-		grpc.ChainUnaryInterceptor(loggingUnaryInterceptor, grpc_prometheus.UnaryServerInterceptor),
-		grpc.ChainStreamInterceptor(loggingStreamInterceptor, grpc_prometheus.StreamServerInterceptor),
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
 	}
 	if cfg.TLSCertFile != "" {
 		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCertFile, cfg.TLSKeyFile)
@@ -243,9 +273,11 @@ func Run(cfg *Config) error {
 	}
 	grpcServer := grpc.NewServer(options...)
 	ptraceotlp.RegisterServer(grpcServer, api.NewTraceServer(client))
+	api_v2.RegisterCollectorServiceServer(grpcServer, api.NewJaegerCollectorServer(client))
 
 	queryPlugin := shared.StorageGRPCPlugin{
-		Impl: jaegerStore,
+		Impl:        jaegerStore,
+		ArchiveImpl: jaegerStore,
 	}
 	if cfg.TracingCfg.StreamingSpanWriter {
 		queryPlugin.StreamImpl = jaegerStore
@@ -296,6 +328,44 @@ func Run(cfg *Config) error {
 		)
 	}
 
+	if cfg.SpanMetricsCfg.Enabled && !cfg.APICfg.ReadOnly {
+		lock, err := util.NewPgAdvisoryLock(spanmetrics.LockID, cfg.PgmodelCfg.GetConnectionStr())
+		if err != nil {
+			return fmt.Errorf("error creating span metrics lock: %w", err)
+		}
+		sme := spanmetrics.NewEngine(client.ReadOnlyConnection(), client.Inserter(), lock, &cfg.SpanMetricsCfg)
+		group.Add(
+			func() error {
+				log.Info("msg", "Starting span metrics engine")
+				sme.Start()
+				return nil
+			}, func(err error) {
+				log.Info("msg", "Stopping span metrics engine")
+				sme.Stop()
+			},
+		)
+	}
+
+	if !cfg.APICfg.ReadOnly {
+		datasetCfg, err := datasetConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error parsing dataset configuration: %w", err)
+		}
+		if datasetCfg != nil && len(datasetCfg.Traces.RetentionRules) > 0 {
+			tre := traceretention.NewEngine(client.MaintenanceConnection(), datasetCfg.Traces, traceretention.DefaultRunInterval)
+			group.Add(
+				func() error {
+					log.Info("msg", "Starting trace retention engine")
+					tre.Start()
+					return nil
+				}, func(err error) {
+					log.Info("msg", "Stopping trace retention engine")
+					tre.Stop()
+				},
+			)
+		}
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle("/", router)
 
@@ -377,3 +447,28 @@ func initTelemetryEngine(client *pgclient.Client) (telemetry.Engine, error) {
 	}
 	return t, nil
 }
+
+// thanosTLSCredentials returns the TLS credentials of the Thanos StoreAPI server. The
+// client certificates are verified against the CA certificate file, if set.
+func thanosTLSCredentials(certFile, keyFile, clientCAFile string) (credentials.TransportCredentials, error) {
+	if clientCAFile == "" {
+		return credentials.NewServerTLSFromFile(certFile, keyFile)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no valid certificates in %s", clientCAFile)
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}), nil
+}
@@ -0,0 +1,114 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package spanmetrics
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultInterval = time.Minute
+	defaultDelay    = time.Minute
+	defaultExpiry   = time.Hour
+	// defaultBucketsStr are the latency buckets of the span metrics connector of the OpenTelemetry Collector, in seconds.
+	defaultBucketsStr = "0.002,0.004,0.006,0.008,0.01,0.05,0.1,0.2,0.4,0.8,1,1.4,2,5,10,15"
+)
+
+type Config struct {
+	Enabled       bool
+	Interval      time.Duration
+	Delay         time.Duration
+	SeriesExpiry  time.Duration
+	BucketsStr    string
+	Buckets       []float64
+	DimensionsStr string
+	Dimensions    []string
+}
+
+func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
+	fs.BoolVar(&cfg.Enabled, "tracing.span-metrics.enable", false, "Periodically aggregate the stored spans into request rate, error rate and duration metrics "+
+		"per service, operation, span kind and status code. Only one Promscale instance computes them at a time.")
+	fs.DurationVar(&cfg.Interval, "tracing.span-metrics.interval", defaultInterval, "Time range of the spans aggregated into each sample of the span metrics.")
+	fs.DurationVar(&cfg.Delay, "tracing.span-metrics.delay", defaultDelay, "How long to wait after the end of an interval before aggregating its spans, "+
+		"so that spans which are ingested late are still counted.")
+	fs.DurationVar(&cfg.SeriesExpiry, "tracing.span-metrics.series-expiry", defaultExpiry, "How long a span metrics series is written without new spans before it is dropped. "+
+		"Set to 0 to never drop the series.")
+	fs.StringVar(&cfg.BucketsStr, "tracing.span-metrics.buckets", defaultBucketsStr, "Comma separated upper bounds, in seconds, of the buckets of the span duration histogram.")
+	fs.StringVar(&cfg.DimensionsStr, "tracing.span-metrics.dimensions", "", "Comma separated span or resource attributes added as labels to the span metrics, e.g. 'http.method,deployment.environment'.")
+	return cfg
+}
+
+func Validate(cfg *Config) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("tracing.span-metrics.interval must be positive: %s", cfg.Interval)
+	}
+	if cfg.Delay < 0 {
+		return fmt.Errorf("tracing.span-metrics.delay cannot be negative: %s", cfg.Delay)
+	}
+	if cfg.SeriesExpiry < 0 {
+		return fmt.Errorf("tracing.span-metrics.series-expiry cannot be negative: %s", cfg.SeriesExpiry)
+	}
+	buckets, err := parseBuckets(cfg.BucketsStr)
+	if err != nil {
+		return fmt.Errorf("invalid tracing.span-metrics.buckets: %w", err)
+	}
+	cfg.Buckets = buckets
+	dimensions, err := parseDimensions(cfg.DimensionsStr)
+	if err != nil {
+		return fmt.Errorf("invalid tracing.span-metrics.dimensions: %w", err)
+	}
+	cfg.Dimensions = dimensions
+	return nil
+}
+
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, b := range strings.Split(s, ",") {
+		if b = strings.TrimSpace(b); b == "" {
+			continue
+		}
+		bound, err := strconv.ParseFloat(b, 64)
+		if err != nil {
+			return nil, err
+		}
+		if len(buckets) > 0 && bound <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("bucket bounds must be in increasing order")
+		}
+		buckets = append(buckets, bound)
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("at least one bucket is required")
+	}
+	return buckets, nil
+}
+
+func parseDimensions(s string) ([]string, error) {
+	var (
+		dimensions []string
+		labels     = make(map[string]string)
+	)
+	for _, d := range strings.Split(s, ",") {
+		if d = strings.TrimSpace(d); d == "" {
+			continue
+		}
+		label := labelName(d)
+		if _, reserved := reservedLabels[label]; reserved {
+			return nil, fmt.Errorf("dimension %s conflicts with the %s label", d, label)
+		}
+		if other, ok := labels[label]; ok {
+			return nil, fmt.Errorf("dimensions %s and %s have the same label name %s", other, d, label)
+		}
+		labels[label] = d
+		dimensions = append(dimensions, d)
+	}
+	return dimensions, nil
+}
@@ -0,0 +1,431 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package spanmetrics implements a background engine that derives
+// request rate, error rate and duration (RED) metrics from the spans
+// stored in the database.
+//
+// The engine periodically aggregates the spans which started in the last
+// complete interval, grouped by tenant, service, operation, span kind, status
+// code and the configured dimensions. The counts are accumulated in memory, and
+// the cumulative values of all the series are written at the end of every
+// interval through the metric ingestor, so that they can be queried with
+// PromQL like the metrics of the span metrics connector of the OpenTelemetry
+// Collector. Counters restart from zero when Promscale restarts, and the spans
+// of the intervals not aggregated before the restart are not counted. The series
+// which get no spans for the series expiry period are no longer written.
+//
+// The engine holds an advisory lock while it computes the span metrics, so that
+// only one Promscale instance writes them. Another instance takes over once the
+// lock is released, starting from the interval in progress with new series.
+package spanmetrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgmodel/ingestor"
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/prompb"
+	"github.com/timescale/promscale/pkg/tenancy"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+const (
+	CallsMetric    = "traces_spanmetrics_calls_total"
+	DurationMetric = "traces_spanmetrics_duration_seconds"
+
+	// LockID is the advisory lock held by the Promscale instance computing the span metrics.
+	LockID = 0x7370616e6d657472 // "spanmetr"
+
+	serviceNameLabel = "service_name"
+	spanNameLabel    = "span_name"
+	spanKindLabel    = "span_kind"
+	statusCodeLabel  = "status_code"
+	bucketLabel      = "le"
+
+	// aggregateSpansSQLFormat groups the spans which started in [$1, $2) by their labels and
+	// duration bucket. The bucket is the number of bounds in $3 below the span duration.
+	aggregateSpansSQLFormat = `
+SELECT
+	coalesce((SELECT value #>> '{}' FROM _ps_trace.tag WHERE id = o.service_name_id AND key = 'service.name'), '') AS service_name,
+	o.span_name,
+	o.span_kind::text,
+	s.status_code::text,
+	coalesce(ps_trace.val_text(s.resource_tags, '` + tenancy.TenantLabelKey + `'), '') AS tenant,
+	ARRAY[%s]::text[] AS dimensions,
+	(SELECT count(*) FROM unnest($3::float8[]) AS b(bound) WHERE b.bound < extract(epoch FROM s.end_time - s.start_time)) AS bucket,
+	count(*) AS calls,
+	sum(extract(epoch FROM s.end_time - s.start_time))::float8 AS duration_sum
+FROM _ps_trace.span s
+INNER JOIN _ps_trace.operation o ON (s.operation_id = o.id)
+WHERE s.start_time >= $1 AND s.start_time < $2
+GROUP BY 1, 2, 3, 4, 5, 6, 7`
+
+	// dimensionSQLFormat reads a dimension from the span attributes, then from the resource attributes.
+	dimensionSQLFormat = `coalesce(ps_trace.val_text(s.span_tags, $%[1]d), ps_trace.val_text(s.resource_tags, $%[1]d), '')`
+)
+
+var (
+	reservedLabels = map[string]struct{}{
+		model.MetricNameLabelName: {},
+		serviceNameLabel:          {},
+		spanNameLabel:             {},
+		spanKindLabel:             {},
+		statusCodeLabel:           {},
+		bucketLabel:               {},
+		tenancy.TenantLabelKey:    {},
+	}
+
+	spansAggregatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Subsystem: "span_metrics",
+		Name:      "spans_aggregated_total",
+		Help:      "Total number of spans aggregated into span metrics.",
+	})
+	spanMetricsErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Subsystem: "span_metrics",
+		Name:      "errors_total",
+		Help:      "Total number of errors while aggregating or writing span metrics.",
+	})
+	spanMetricsSeries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: util.PromNamespace,
+		Subsystem: "span_metrics",
+		Name:      "series",
+		Help:      "Number of span metrics series tracked by the span metrics engine.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(spansAggregatedTotal, spanMetricsErrorsTotal, spanMetricsSeries)
+}
+
+// labelName converts an attribute name into a valid Prometheus label name.
+func labelName(attribute string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, attribute)
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "key_" + name
+	}
+	return name
+}
+
+// series holds the cumulative values of the span metrics of a set of labels.
+type series struct {
+	labels []prompb.Label
+	calls  uint64
+	// buckets holds the number of spans in each bucket, the last one being +Inf.
+	buckets []uint64
+	sum     float64
+	// lastSpan is the end of the last interval with spans of the series.
+	lastSpan time.Time
+}
+
+// aggregate is a row of the span aggregation query.
+type aggregate struct {
+	service, operation, kind, status string
+	tenant                           string
+	dimensions                       []string
+	bucket                           int
+	calls                            uint64
+	sum                              float64
+}
+
+// Engine periodically aggregates the stored spans into span metrics.
+type Engine struct {
+	conn       pgxconn.PgxConn
+	inserter   ingestor.DBInserter
+	lock       util.AdvisoryLock
+	interval   time.Duration
+	delay      time.Duration
+	expiry     time.Duration
+	buckets    []float64
+	dimensions []string
+	dimLabels  []string
+	query      string
+
+	series map[string]*series
+	// windowEnd is the end of the last interval aggregated.
+	windowEnd time.Time
+	// leading is whether the engine holds the lock.
+	leading bool
+
+	mu   sync.Mutex
+	kill func()
+}
+
+// NewEngine creates a new Engine. The first interval aggregated is the one
+// in progress once the engine takes the lock. Without a lock, it is the one
+// starting once the engine is created.
+func NewEngine(conn pgxconn.PgxConn, inserter ingestor.DBInserter, lock util.AdvisoryLock, cfg *Config) *Engine {
+	dimensions := make([]string, len(cfg.Dimensions))
+	dimLabels := make([]string, len(cfg.Dimensions))
+	for i, d := range cfg.Dimensions {
+		// The first three parameters are the time range and the buckets.
+		dimensions[i] = fmt.Sprintf(dimensionSQLFormat, i+4)
+		dimLabels[i] = labelName(d)
+	}
+	return &Engine{
+		conn:       conn,
+		inserter:   inserter,
+		lock:       lock,
+		interval:   cfg.Interval,
+		delay:      cfg.Delay,
+		expiry:     cfg.SeriesExpiry,
+		buckets:    cfg.Buckets,
+		dimensions: cfg.Dimensions,
+		dimLabels:  dimLabels,
+		query:      fmt.Sprintf(aggregateSpansSQLFormat, strings.Join(dimensions, ", ")),
+		series:     make(map[string]*series),
+		windowEnd:  time.Now().Add(-cfg.Delay).Truncate(cfg.Interval),
+	}
+}
+
+// Start starts the Engine.
+// Blocks forever unless Stop is called.
+func (e *Engine) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.kill = cancel
+	}()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	if e.lock != nil {
+		// Closing the connection of the lock releases it.
+		defer e.lock.Close()
+	}
+	for {
+		select {
+		case <-ticker.C:
+			e.Run(ctx, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the engine if it is running.
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.kill != nil {
+		e.kill()
+	}
+}
+
+// Run aggregates the spans of all the complete intervals up to now minus the delay.
+// An interval which fails to be aggregated or written is retried on the next run.
+func (e *Engine) Run(ctx context.Context, now time.Time) {
+	if !e.lead(now) {
+		return
+	}
+	for {
+		start, end := e.windowEnd, e.windowEnd.Add(e.interval)
+		if end.After(now.Add(-e.delay)) {
+			return
+		}
+		aggregates, err := e.aggregateSpans(ctx, start, end)
+		if err != nil {
+			log.Error("msg", "failed to aggregate spans into span metrics", "start", start, "end", end, "err", err)
+			spanMetricsErrorsTotal.Inc()
+			return
+		}
+		updated := e.apply(aggregates, end)
+		if _, _, err = e.inserter.IngestMetrics(ctx, e.writeRequest(updated, end)); err != nil {
+			log.Error("msg", "failed to write span metrics", "start", start, "end", end, "err", err)
+			spanMetricsErrorsTotal.Inc()
+			return
+		}
+		e.commit(updated, aggregates)
+		e.windowEnd = end
+	}
+}
+
+// lead reports whether the engine holds the lock, taking it if no other instance
+// does. An engine taking the lock starts from the interval in progress with new
+// series, since the series of the previous holder are unknown.
+func (e *Engine) lead(now time.Time) bool {
+	if e.lock == nil {
+		return true
+	}
+	locked, err := e.lock.GetAdvisoryLock()
+	if err != nil {
+		log.Error("msg", "failed to take the span metrics lock", "err", err)
+		spanMetricsErrorsTotal.Inc()
+		// The lock is lost with its connection, which is opened again on the next run.
+		e.lock.Close()
+		e.leading = false
+		return false
+	}
+	if !locked {
+		log.Debug("msg", "span metrics are computed by another Promscale instance")
+		e.leading = false
+		return false
+	}
+	if e.leading {
+		// The advisory locks of a session stack, so the lock taken again is released.
+		if _, err := e.lock.Unlock(); err != nil {
+			log.Error("msg", "failed to release the span metrics lock", "err", err)
+		}
+		return true
+	}
+	e.leading = true
+	e.series = make(map[string]*series)
+	spanMetricsSeries.Set(0)
+	e.windowEnd = now.Add(-e.delay).Truncate(e.interval)
+	return true
+}
+
+func (e *Engine) aggregateSpans(ctx context.Context, start, end time.Time) ([]aggregate, error) {
+	params := []interface{}{start, end, e.buckets}
+	for _, d := range e.dimensions {
+		params = append(params, d)
+	}
+	rows, err := e.conn.Query(ctx, e.query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aggregates []aggregate
+	for rows.Next() {
+		var a aggregate
+		if err = rows.Scan(&a.service, &a.operation, &a.kind, &a.status, &a.tenant, &a.dimensions, &a.bucket, &a.calls, &a.sum); err != nil {
+			return nil, err
+		}
+		aggregates = append(aggregates, a)
+	}
+	return aggregates, rows.Err()
+}
+
+// apply returns a copy of the series with the aggregates of the interval ending at end added, leaving
+// the current series untouched until the samples are written. The series without spans for the
+// expiry period are left out.
+func (e *Engine) apply(aggregates []aggregate, end time.Time) map[string]*series {
+	updated := make(map[string]*series, len(e.series))
+	for key, s := range e.series {
+		if e.expiry > 0 && end.Sub(s.lastSpan) > e.expiry {
+			continue
+		}
+		updated[key] = s
+	}
+	copied := make(map[string]struct{})
+	for _, a := range aggregates {
+		lbls := e.labels(a)
+		key := labelsKey(lbls)
+		s, ok := updated[key]
+		if !ok {
+			s = &series{labels: lbls, buckets: make([]uint64, len(e.buckets)+1)}
+			updated[key] = s
+			copied[key] = struct{}{}
+		} else if _, ok := copied[key]; !ok {
+			c := *s
+			c.buckets = append([]uint64(nil), s.buckets...)
+			s = &c
+			updated[key] = s
+			copied[key] = struct{}{}
+		}
+		s.calls += a.calls
+		s.sum += a.sum
+		s.lastSpan = end
+		if a.bucket >= 0 && a.bucket < len(s.buckets) {
+			s.buckets[a.bucket] += a.calls
+		}
+	}
+	return updated
+}
+
+func (e *Engine) commit(updated map[string]*series, aggregates []aggregate) {
+	e.series = updated
+	spanMetricsSeries.Set(float64(len(updated)))
+	for _, a := range aggregates {
+		spansAggregatedTotal.Add(float64(a.calls))
+	}
+}
+
+func (e *Engine) labels(a aggregate) []prompb.Label {
+	lbls := []prompb.Label{
+		{Name: serviceNameLabel, Value: a.service},
+		{Name: spanNameLabel, Value: a.operation},
+		{Name: spanKindLabel, Value: a.kind},
+		{Name: statusCodeLabel, Value: a.status},
+	}
+	if a.tenant != "" {
+		// The series of a tenant belong to the tenant, like the metrics it writes.
+		lbls = append(lbls, prompb.Label{Name: tenancy.TenantLabelKey, Value: a.tenant})
+	}
+	for i, name := range e.dimLabels {
+		if i < len(a.dimensions) && a.dimensions[i] != "" {
+			lbls = append(lbls, prompb.Label{Name: name, Value: a.dimensions[i]})
+		}
+	}
+	sort.Slice(lbls, func(i, j int) bool { return lbls[i].Name < lbls[j].Name })
+	return lbls
+}
+
+func labelsKey(lbls []prompb.Label) string {
+	var b strings.Builder
+	for _, l := range lbls {
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// writeRequest returns the samples of all the series at the given time.
+func (e *Engine) writeRequest(all map[string]*series, ts time.Time) *prompb.WriteRequest {
+	wr := ingestor.NewWriteRequest()
+	t := ts.UnixMilli()
+	for _, s := range all {
+		wr.Timeseries = append(wr.Timeseries,
+			timeseries(CallsMetric, s.labels, nil, t, float64(s.calls)),
+			timeseries(DurationMetric+"_count", s.labels, nil, t, float64(s.calls)),
+			timeseries(DurationMetric+"_sum", s.labels, nil, t, s.sum),
+		)
+		var cumulative uint64
+		for i, count := range s.buckets {
+			cumulative += count
+			bound := math.Inf(1)
+			if i < len(e.buckets) {
+				bound = e.buckets[i]
+			}
+			le := &prompb.Label{Name: bucketLabel, Value: strconv.FormatFloat(bound, 'f', -1, 64)}
+			wr.Timeseries = append(wr.Timeseries, timeseries(DurationMetric+"_bucket", s.labels, le, t, float64(cumulative)))
+		}
+	}
+	return wr
+}
+
+func timeseries(metric string, lbls []prompb.Label, extra *prompb.Label, t int64, v float64) prompb.TimeSeries {
+	all := make([]prompb.Label, 0, len(lbls)+2)
+	all = append(all, prompb.Label{Name: model.MetricNameLabelName, Value: metric})
+	all = append(all, lbls...)
+	if extra != nil {
+		all = append(all, *extra)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return prompb.TimeSeries{
+		Labels:  all,
+		Samples: []prompb.Sample{{Timestamp: t, Value: v}},
+	}
+}
@@ -0,0 +1,250 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package spanmetrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/prompb"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name               string
+		cfg                Config
+		expectedBuckets    []float64
+		expectedDimensions []string
+		expectedErr        string
+	}{
+		{
+			name: "disabled",
+			cfg:  Config{BucketsStr: "invalid"},
+		},
+		{
+			name:               "valid",
+			cfg:                Config{Enabled: true, Interval: time.Minute, BucketsStr: "0.1, 1,10,", DimensionsStr: "http.method,,deployment.environment"},
+			expectedBuckets:    []float64{0.1, 1, 10},
+			expectedDimensions: []string{"http.method", "deployment.environment"},
+		},
+		{
+			name:        "invalid interval",
+			cfg:         Config{Enabled: true, BucketsStr: "1"},
+			expectedErr: "tracing.span-metrics.interval must be positive: 0s",
+		},
+		{
+			name:        "negative series expiry",
+			cfg:         Config{Enabled: true, Interval: time.Minute, SeriesExpiry: -time.Minute, BucketsStr: "1"},
+			expectedErr: "tracing.span-metrics.series-expiry cannot be negative: -1m0s",
+		},
+		{
+			name:        "unordered buckets",
+			cfg:         Config{Enabled: true, Interval: time.Minute, BucketsStr: "1,0.5"},
+			expectedErr: "invalid tracing.span-metrics.buckets: bucket bounds must be in increasing order",
+		},
+		{
+			name:        "no buckets",
+			cfg:         Config{Enabled: true, Interval: time.Minute, BucketsStr: ","},
+			expectedErr: "invalid tracing.span-metrics.buckets: at least one bucket is required",
+		},
+		{
+			name:        "reserved dimension",
+			cfg:         Config{Enabled: true, Interval: time.Minute, BucketsStr: "1", DimensionsStr: "span.name"},
+			expectedErr: "invalid tracing.span-metrics.dimensions: dimension span.name conflicts with the span_name label",
+		},
+		{
+			name:        "duplicate dimension",
+			cfg:         Config{Enabled: true, Interval: time.Minute, BucketsStr: "1", DimensionsStr: "http.method,http_method"},
+			expectedErr: "invalid tracing.span-metrics.dimensions: dimensions http.method and http_method have the same label name http_method",
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			err := Validate(&c.cfg)
+			if c.expectedErr != "" {
+				require.EqualError(t, err, c.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expectedBuckets, c.cfg.Buckets)
+			require.Equal(t, c.expectedDimensions, c.cfg.Dimensions)
+		})
+	}
+}
+
+func TestLabelName(t *testing.T) {
+	require.Equal(t, "http_method", labelName("http.method"))
+	require.Equal(t, "__tenant__", labelName("__tenant__"))
+	require.Equal(t, "key_0_a", labelName("0-a"))
+}
+
+func TestNewEngineQuery(t *testing.T) {
+	e := NewEngine(nil, nil, nil, &Config{Interval: time.Minute, Buckets: []float64{1}, Dimensions: []string{"http.method", "k8s.pod.name"}})
+	query := strings.Join(strings.Fields(e.query), " ")
+	require.Contains(t, query, "ARRAY[coalesce(ps_trace.val_text(s.span_tags, $4), ps_trace.val_text(s.resource_tags, $4), ''), "+
+		"coalesce(ps_trace.val_text(s.span_tags, $5), ps_trace.val_text(s.resource_tags, $5), '')]::text[] AS dimensions")
+	require.Equal(t, []string{"http_method", "k8s_pod_name"}, e.dimLabels)
+	require.Equal(t, time.Duration(0), e.windowEnd.Sub(e.windowEnd.Truncate(time.Minute)))
+}
+
+func samples(wr *prompb.WriteRequest) map[string]float64 {
+	res := make(map[string]float64)
+	for _, ts := range wr.Timeseries {
+		var (
+			name, le string
+			lbls     []string
+		)
+		for _, l := range ts.Labels {
+			switch l.Name {
+			case "__name__":
+				name = l.Value
+			case bucketLabel:
+				le = l.Name + "=" + l.Value
+			default:
+				lbls = append(lbls, l.Name+"="+l.Value)
+			}
+		}
+		sort.Strings(lbls)
+		if le != "" {
+			lbls = append(lbls, le)
+		}
+		res[name+"{"+strings.Join(lbls, ",")+"}"] = ts.Samples[0].Value
+	}
+	return res
+}
+
+func TestAggregation(t *testing.T) {
+	e := NewEngine(nil, nil, nil, &Config{Interval: time.Minute, Buckets: []float64{0.1, 1}, Dimensions: []string{"http.method"}})
+	const labels = "service_name=frontend,span_kind=SPAN_KIND_SERVER,span_name=get,status_code=STATUS_CODE_OK"
+
+	first := []aggregate{
+		{service: "frontend", operation: "get", kind: "SPAN_KIND_SERVER", status: "STATUS_CODE_OK", dimensions: []string{""}, bucket: 0, calls: 3, sum: 0.15},
+		{service: "frontend", operation: "get", kind: "SPAN_KIND_SERVER", status: "STATUS_CODE_OK", dimensions: []string{""}, bucket: 2, calls: 1, sum: 2},
+		{service: "frontend", operation: "get", kind: "SPAN_KIND_SERVER", status: "STATUS_CODE_OK", dimensions: []string{"GET"}, bucket: 1, calls: 1, sum: 0.5},
+	}
+	ts := time.Unix(60, 0)
+	updated := e.apply(first, ts)
+	require.Empty(t, e.series, "series must not change before the samples are written")
+	e.commit(updated, first)
+
+	wr := e.writeRequest(e.series, ts)
+	for _, s := range wr.Timeseries {
+		require.Equal(t, ts.UnixMilli(), s.Samples[0].Timestamp)
+	}
+	require.Equal(t, map[string]float64{
+		"traces_spanmetrics_calls_total{" + labels + "}":                                     4,
+		"traces_spanmetrics_duration_seconds_count{" + labels + "}":                          4,
+		"traces_spanmetrics_duration_seconds_sum{" + labels + "}":                            2.15,
+		"traces_spanmetrics_duration_seconds_bucket{" + labels + ",le=0.1}":                  3,
+		"traces_spanmetrics_duration_seconds_bucket{" + labels + ",le=1}":                    3,
+		"traces_spanmetrics_duration_seconds_bucket{" + labels + ",le=+Inf}":                 4,
+		"traces_spanmetrics_calls_total{http_method=GET," + labels + "}":                     1,
+		"traces_spanmetrics_duration_seconds_count{http_method=GET," + labels + "}":          1,
+		"traces_spanmetrics_duration_seconds_sum{http_method=GET," + labels + "}":            0.5,
+		"traces_spanmetrics_duration_seconds_bucket{http_method=GET," + labels + ",le=0.1}":  0,
+		"traces_spanmetrics_duration_seconds_bucket{http_method=GET," + labels + ",le=1}":    1,
+		"traces_spanmetrics_duration_seconds_bucket{http_method=GET," + labels + ",le=+Inf}": 1,
+	}, samples(wr))
+
+	// Counters are cumulative, and series without new spans keep their values.
+	second := []aggregate{
+		{service: "frontend", operation: "get", kind: "SPAN_KIND_SERVER", status: "STATUS_CODE_OK", dimensions: []string{""}, bucket: 1, calls: 2, sum: 1},
+	}
+	e.commit(e.apply(second, ts.Add(time.Minute)), second)
+	res := samples(e.writeRequest(e.series, ts.Add(time.Minute)))
+	require.Equal(t, float64(6), res["traces_spanmetrics_calls_total{"+labels+"}"])
+	require.Equal(t, float64(5), res["traces_spanmetrics_duration_seconds_bucket{"+labels+",le=1}"])
+	require.Equal(t, float64(1), res["traces_spanmetrics_calls_total{http_method=GET,"+labels+"}"])
+
+	// The spans of a tenant are counted in the series of the tenant.
+	third := []aggregate{
+		{service: "frontend", operation: "get", kind: "SPAN_KIND_SERVER", status: "STATUS_CODE_OK", tenant: "team-a", dimensions: []string{""}, bucket: 0, calls: 2, sum: 0.1},
+	}
+	e.commit(e.apply(third, ts.Add(2*time.Minute)), third)
+	res = samples(e.writeRequest(e.series, ts.Add(2*time.Minute)))
+	require.Equal(t, float64(2), res["traces_spanmetrics_calls_total{__tenant__=team-a,"+labels+"}"])
+	require.Equal(t, float64(6), res["traces_spanmetrics_calls_total{"+labels+"}"])
+}
+
+func TestSeriesExpiry(t *testing.T) {
+	e := NewEngine(nil, nil, nil, &Config{Interval: time.Minute, SeriesExpiry: 2 * time.Minute, Buckets: []float64{1}})
+	const labels = "service_name=frontend,span_kind=SPAN_KIND_SERVER,span_name=%s,status_code=STATUS_CODE_OK"
+	agg := func(operation string) aggregate {
+		return aggregate{service: "frontend", operation: operation, kind: "SPAN_KIND_SERVER", status: "STATUS_CODE_OK", calls: 1}
+	}
+
+	ts := time.Unix(60, 0)
+	first := []aggregate{agg("get"), agg("post")}
+	e.commit(e.apply(first, ts), first)
+	require.Len(t, e.series, 2)
+
+	// A series is still written until it has no spans for the expiry period.
+	for i := 1; i <= 2; i++ {
+		next := []aggregate{agg("get")}
+		e.commit(e.apply(next, ts.Add(time.Duration(i)*time.Minute)), next)
+	}
+	require.Len(t, e.series, 2)
+
+	next := []aggregate{agg("get")}
+	e.commit(e.apply(next, ts.Add(3*time.Minute)), next)
+	res := samples(e.writeRequest(e.series, ts.Add(3*time.Minute)))
+	require.Equal(t, float64(4), res["traces_spanmetrics_calls_total{"+fmt.Sprintf(labels, "get")+"}"])
+	require.NotContains(t, res, "traces_spanmetrics_calls_total{"+fmt.Sprintf(labels, "post")+"}")
+}
+
+type fakeLock struct {
+	locked bool
+	err    error
+	taken  int
+	closed int
+}
+
+func (l *fakeLock) GetAdvisoryLock() (bool, error) {
+	if l.err != nil {
+		return false, l.err
+	}
+	if l.locked {
+		l.taken++
+	}
+	return l.locked, nil
+}
+func (l *fakeLock) GetSharedAdvisoryLock() (bool, error) { return false, nil }
+func (l *fakeLock) Unlock() (bool, error) {
+	l.taken--
+	return true, nil
+}
+func (l *fakeLock) UnlockShared() (bool, error) { return false, nil }
+func (l *fakeLock) Close()                      { l.closed++ }
+
+func TestLead(t *testing.T) {
+	lock := &fakeLock{}
+	e := NewEngine(nil, nil, lock, &Config{Interval: time.Minute, Delay: time.Minute, Buckets: []float64{1}})
+	now := time.Unix(600, 0)
+
+	require.False(t, e.lead(now), "the lock is held by another instance")
+
+	lock.locked = true
+	e.series["stale"] = &series{}
+	require.True(t, e.lead(now))
+	require.Empty(t, e.series, "an instance taking over starts with new series")
+	require.Equal(t, time.Unix(540, 0), e.windowEnd)
+	require.Equal(t, 1, lock.taken)
+
+	e.series["kept"] = &series{}
+	require.True(t, e.lead(now.Add(time.Minute)))
+	require.Len(t, e.series, 1)
+	require.Equal(t, time.Unix(540, 0), e.windowEnd)
+	require.Equal(t, 1, lock.taken, "the lock must be held once")
+
+	lock.err = errors.New("connection lost")
+	require.False(t, e.lead(now.Add(2*time.Minute)))
+	require.Equal(t, 1, lock.closed)
+}
@@ -0,0 +1,319 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package tempo implements the read endpoints of the Grafana Tempo HTTP API,
+// so that traces can be queried with Grafana's Tempo data source.
+package tempo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logfmt/logfmt"
+	"github.com/gorilla/mux"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/timescale/promscale/pkg/jaeger/store"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/traceql"
+)
+
+const (
+	// PathPrefix is where the whole Tempo API is mounted as well. The Jaeger
+	// HTTP API also serves /api/traces/{traceID}, so a trace is only returned
+	// by Tempo at the root when protobuf is requested, which is what the
+	// Tempo data source does.
+	PathPrefix = "/tempo"
+
+	defaultSearchLimit = 20
+
+	mimeTypeProtobuf = "application/protobuf"
+	mimeTypeJSON     = "application/json"
+
+	// Tags with a special meaning in Tempo searches.
+	tagServiceName = "service.name"
+	tagSpanName    = "name"
+	tagStatus      = "status"
+)
+
+// Reader is the trace storage backing the Tempo API.
+type Reader interface {
+	GetTraceOTLP(ctx context.Context, traceID model.TraceID) (ptrace.Traces, error)
+	FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error)
+	FindTracesTraceQL(ctx context.Context, query *store.TraceQLQuery) ([]*model.Trace, error)
+	GetTagNames(ctx context.Context) ([]string, error)
+	GetTagValues(ctx context.Context, tagName string) ([]string, error)
+}
+
+var _ Reader = (*store.Store)(nil)
+
+// ExtendQueryAPIs registers the Tempo API at its own routes and under PathPrefix.
+// It must be called before the Jaeger HTTP API is registered, so that the
+// protobuf requests of /api/traces/{traceID} are routed to Tempo and the other
+// ones to Jaeger.
+func ExtendQueryAPIs(r *mux.Router, reader Reader) {
+	prefixed := r.PathPrefix(PathPrefix).Subrouter()
+	prefixed.Path("/api/traces/{traceID}").Methods(http.MethodGet).HandlerFunc(traceByIDHandler(reader))
+	registerSearchAPIs(prefixed, reader)
+
+	r.Path("/api/traces/{traceID}").Methods(http.MethodGet).HeadersRegexp("Accept", mimeTypeProtobuf).HandlerFunc(traceByIDHandler(reader))
+	registerSearchAPIs(r, reader)
+}
+
+func registerSearchAPIs(r *mux.Router, reader Reader) {
+	r.Path("/api/echo").Methods(http.MethodGet).HandlerFunc(echoHandler)
+	r.Path("/api/search").Methods(http.MethodGet).HandlerFunc(searchHandler(reader))
+	r.Path("/api/search/tags").Methods(http.MethodGet).HandlerFunc(searchTagsHandler(reader))
+	r.Path("/api/search/tag/{name}/values").Methods(http.MethodGet).HandlerFunc(searchTagValuesHandler(reader))
+}
+
+func echoHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte("echo"))
+}
+
+func traceByIDHandler(reader Reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		traceID, err := model.TraceIDFromString(mux.Vars(r)["traceID"])
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid trace id: %s", err), http.StatusBadRequest)
+			return
+		}
+		traces, err := reader.GetTraceOTLP(r.Context(), traceID)
+		if errors.Is(err, spanstore.ErrTraceNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var (
+			body        []byte
+			contentType string
+		)
+		if strings.Contains(r.Header.Get("Accept"), mimeTypeProtobuf) {
+			contentType = mimeTypeProtobuf
+			body, err = ptrace.NewProtoMarshaler().MarshalTraces(traces)
+		} else {
+			contentType = mimeTypeJSON
+			body, err = ptrace.NewJSONMarshaler().MarshalTraces(traces)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(body)
+	}
+}
+
+// TraceSummary is a trace returned by a search.
+type TraceSummary struct {
+	TraceID           string `json:"traceID"`
+	RootServiceName   string `json:"rootServiceName"`
+	RootTraceName     string `json:"rootTraceName"`
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	DurationMs        int64  `json:"durationMs"`
+}
+
+// SearchResponse is the response of /api/search.
+type SearchResponse struct {
+	Traces []TraceSummary `json:"traces"`
+}
+
+func searchHandler(reader Reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseSearchParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var traces []*model.Trace
+		if q := r.URL.Query().Get("q"); q != "" {
+			if len(query.Tags) > 0 || query.ServiceName != "" || query.OperationName != "" || query.DurationMin != 0 || query.DurationMax != 0 {
+				http.Error(w, "q cannot be combined with tags, minDuration or maxDuration", http.StatusBadRequest)
+				return
+			}
+			expr, err := traceql.Parse(q)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid query: %s", err), http.StatusBadRequest)
+				return
+			}
+			traces, err = reader.FindTracesTraceQL(r.Context(), &store.TraceQLQuery{
+				Expr:         expr,
+				StartTimeMin: query.StartTimeMin,
+				StartTimeMax: query.StartTimeMax,
+				NumTraces:    query.NumTraces,
+			})
+		} else {
+			traces, err = reader.FindTraces(r.Context(), query)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp := SearchResponse{Traces: make([]TraceSummary, 0, len(traces))}
+		for _, trace := range traces {
+			if len(trace.Spans) > 0 {
+				resp.Traces = append(resp.Traces, summarize(trace))
+			}
+		}
+		respondJSON(w, resp)
+	}
+}
+
+func searchTagsHandler(reader Reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, err := reader.GetTagNames(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, struct {
+			TagNames []string `json:"tagNames"`
+		}{names})
+	}
+}
+
+func searchTagValuesHandler(reader Reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, err := reader.GetTagValues(r.Context(), mux.Vars(r)["name"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, struct {
+			TagValues []string `json:"tagValues"`
+		}{values})
+	}
+}
+
+// parseSearchParams translates the parameters of a Tempo search into a Jaeger
+// query. Tags are logfmt encoded, e.g. tags=service.name=frontend http.status_code=500.
+func parseSearchParams(r *http.Request) (*spanstore.TraceQueryParameters, error) {
+	params := r.URL.Query()
+	query := &spanstore.TraceQueryParameters{
+		Tags:      make(map[string]string),
+		NumTraces: defaultSearchLimit,
+	}
+
+	if tags := params.Get("tags"); tags != "" {
+		decoder := logfmt.NewDecoder(strings.NewReader(tags))
+		for decoder.ScanRecord() {
+			for decoder.ScanKeyval() {
+				key, value := string(decoder.Key()), string(decoder.Value())
+				switch key {
+				case tagServiceName:
+					query.ServiceName = value
+				case tagSpanName:
+					query.OperationName = value
+				case tagStatus:
+					switch value {
+					case "error":
+						query.Tags[store.TagError] = "true"
+					case "ok", "unset":
+						query.Tags[store.TagError] = "false"
+					default:
+						return nil, fmt.Errorf("invalid status %q", value)
+					}
+				default:
+					query.Tags[key] = value
+				}
+			}
+		}
+		if err := decoder.Err(); err != nil {
+			return nil, fmt.Errorf("invalid tags: %w", err)
+		}
+	}
+
+	var err error
+	if query.DurationMin, err = parseDuration(params.Get("minDuration")); err != nil {
+		return nil, fmt.Errorf("invalid minDuration: %w", err)
+	}
+	if query.DurationMax, err = parseDuration(params.Get("maxDuration")); err != nil {
+		return nil, fmt.Errorf("invalid maxDuration: %w", err)
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if query.NumTraces, err = strconv.Atoi(limit); err != nil || query.NumTraces <= 0 {
+			return nil, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+	if query.StartTimeMin, err = parseUnixSeconds(params.Get("start")); err != nil {
+		return nil, fmt.Errorf("invalid start: %w", err)
+	}
+	if query.StartTimeMax, err = parseUnixSeconds(params.Get("end")); err != nil {
+		return nil, fmt.Errorf("invalid end: %w", err)
+	}
+	if !query.StartTimeMin.IsZero() && !query.StartTimeMax.IsZero() && query.StartTimeMax.Before(query.StartTimeMin) {
+		return nil, fmt.Errorf("end must not be before start")
+	}
+	return query, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func parseUnixSeconds(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// summarize returns the summary of a trace. The root span is the one without
+// a parent, or the earliest span if the root has not been received yet.
+func summarize(trace *model.Trace) TraceSummary {
+	spans := make([]*model.Span, len(trace.Spans))
+	copy(spans, trace.Spans)
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].StartTime.Before(spans[j].StartTime) })
+
+	root := spans[0]
+	start, end := spans[0].StartTime, spans[0].StartTime.Add(spans[0].Duration)
+	for _, span := range spans {
+		if span.ParentSpanID() == 0 && root.ParentSpanID() != 0 {
+			root = span
+		}
+		if spanEnd := span.StartTime.Add(span.Duration); spanEnd.After(end) {
+			end = spanEnd
+		}
+	}
+
+	summary := TraceSummary{
+		TraceID:           fmt.Sprintf("%016x%016x", root.TraceID.High, root.TraceID.Low),
+		RootTraceName:     root.OperationName,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		DurationMs:        end.Sub(start).Milliseconds(),
+	}
+	if root.Process != nil {
+		summary.RootServiceName = root.Process.ServiceName
+	}
+	return summary
+}
+
+func respondJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", mimeTypeJSON)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Error("msg", "error writing Tempo API response", "err", err)
+	}
+}
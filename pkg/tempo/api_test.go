@@ -0,0 +1,243 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package tempo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/timescale/promscale/pkg/jaeger/store"
+	"github.com/timescale/promscale/pkg/traceql"
+)
+
+type mockReader struct {
+	traces      map[model.TraceID]ptrace.Traces
+	found       []*model.Trace
+	query       *spanstore.TraceQueryParameters
+	traceQL     *store.TraceQLQuery
+	tagNames    []string
+	tagValues   map[string][]string
+	receivedTag string
+}
+
+func (m *mockReader) GetTraceOTLP(_ context.Context, traceID model.TraceID) (ptrace.Traces, error) {
+	traces, ok := m.traces[traceID]
+	if !ok {
+		return ptrace.NewTraces(), spanstore.ErrTraceNotFound
+	}
+	return traces, nil
+}
+
+func (m *mockReader) FindTraces(_ context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	m.query = query
+	return m.found, nil
+}
+
+func (m *mockReader) FindTracesTraceQL(_ context.Context, query *store.TraceQLQuery) ([]*model.Trace, error) {
+	m.traceQL = query
+	return m.found, nil
+}
+
+func (m *mockReader) GetTagNames(context.Context) ([]string, error) {
+	return m.tagNames, nil
+}
+
+func (m *mockReader) GetTagValues(_ context.Context, tagName string) ([]string, error) {
+	m.receivedTag = tagName
+	return m.tagValues[tagName], nil
+}
+
+func serve(t *testing.T, reader Reader, req *http.Request) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	ExtendQueryAPIs(router, reader)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTraceByID(t *testing.T) {
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("GET /")
+	span.SetTraceID([16]byte{15: 1})
+	reader := &mockReader{traces: map[model.TraceID]ptrace.Traces{model.NewTraceID(0, 1): traces}}
+
+	testCases := []struct {
+		name         string
+		prefix       string
+		traceID      string
+		accept       string
+		responseCode int
+		contentType  string
+	}{
+		{name: "json", prefix: PathPrefix, traceID: "00000000000000000000000000000001", responseCode: http.StatusOK, contentType: mimeTypeJSON},
+		{name: "protobuf", prefix: PathPrefix, traceID: "1", accept: mimeTypeProtobuf, responseCode: http.StatusOK, contentType: mimeTypeProtobuf},
+		{name: "not found", prefix: PathPrefix, traceID: "2", responseCode: http.StatusNotFound},
+		{name: "invalid id", prefix: PathPrefix, traceID: "xyz", responseCode: http.StatusBadRequest},
+		{name: "root protobuf", traceID: "1", accept: mimeTypeProtobuf, responseCode: http.StatusOK, contentType: mimeTypeProtobuf},
+		// Left to the Jaeger HTTP API, which isn't registered here.
+		{name: "root json", traceID: "1", responseCode: http.StatusNotFound},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, c.prefix+"/api/traces/"+c.traceID, nil)
+			if c.accept != "" {
+				req.Header.Set("Accept", c.accept)
+			}
+			w := serve(t, reader, req)
+			require.Equal(t, c.responseCode, w.Code, w.Body.String())
+			if c.responseCode != http.StatusOK {
+				return
+			}
+			require.Equal(t, c.contentType, w.Header().Get("Content-Type"))
+
+			var (
+				got ptrace.Traces
+				err error
+			)
+			if c.contentType == mimeTypeProtobuf {
+				got, err = ptrace.NewProtoUnmarshaler().UnmarshalTraces(w.Body.Bytes())
+			} else {
+				got, err = ptrace.NewJSONUnmarshaler().UnmarshalTraces(w.Body.Bytes())
+			}
+			require.NoError(t, err)
+			require.Equal(t, 1, got.SpanCount())
+			require.Equal(t, "GET /", got.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Name())
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	start := time.Unix(1000, 0)
+	process := &model.Process{ServiceName: "frontend"}
+	traceID := model.NewTraceID(1, 2)
+	reader := &mockReader{found: []*model.Trace{{
+		Spans: []*model.Span{
+			{
+				TraceID:       traceID,
+				SpanID:        2,
+				OperationName: "SELECT",
+				StartTime:     start.Add(time.Millisecond),
+				Duration:      250 * time.Millisecond,
+				References:    []model.SpanRef{model.NewChildOfRef(traceID, 1)},
+				Process:       &model.Process{ServiceName: "db"},
+			},
+			{
+				TraceID:       traceID,
+				SpanID:        1,
+				OperationName: "GET /",
+				StartTime:     start,
+				Duration:      100 * time.Millisecond,
+				Process:       process,
+			},
+		},
+	}}}
+
+	req := httptest.NewRequest(http.MethodGet, PathPrefix+"/api/search?tags=service.name%3Dfrontend+name%3D%22GET+%2F%22+status%3Derror+http.status_code%3D500&minDuration=10ms&limit=5&start=1000&end=2000", nil)
+	w := serve(t, reader, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	require.Equal(t, &spanstore.TraceQueryParameters{
+		ServiceName:   "frontend",
+		OperationName: "GET /",
+		Tags:          map[string]string{store.TagError: "true", "http.status_code": "500"},
+		StartTimeMin:  time.Unix(1000, 0),
+		StartTimeMax:  time.Unix(2000, 0),
+		DurationMin:   10 * time.Millisecond,
+		NumTraces:     5,
+	}, reader.query)
+
+	var resp SearchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, SearchResponse{Traces: []TraceSummary{{
+		TraceID:           "00000000000000010000000000000002",
+		RootServiceName:   "frontend",
+		RootTraceName:     "GET /",
+		StartTimeUnixNano: "1000000000000",
+		DurationMs:        251,
+	}}}, resp)
+}
+
+func TestSearchTraceQL(t *testing.T) {
+	reader := &mockReader{}
+	q := url.QueryEscape(`{ resource.service.name = "frontend" } >> { status = error }`)
+	req := httptest.NewRequest(http.MethodGet, PathPrefix+"/api/search?q="+q+"&start=1000&end=2000", nil)
+	w := serve(t, reader, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.JSONEq(t, `{"traces":[]}`, w.Body.String())
+
+	require.Nil(t, reader.query)
+	require.Equal(t, &store.TraceQLQuery{
+		Expr: &traceql.SpansetOperation{
+			Op: traceql.OpDescendant,
+			LHS: &traceql.SpansetFilter{Expr: &traceql.Comparison{
+				Field: traceql.Field{Scope: traceql.ScopeResource, Name: "service.name"},
+				Op:    traceql.OpEqual,
+				Value: traceql.Static{Type: traceql.TypeString, String: "frontend"},
+			}},
+			RHS: &traceql.SpansetFilter{Expr: &traceql.Comparison{
+				Field: traceql.Field{Intrinsic: traceql.IntrinsicStatus},
+				Op:    traceql.OpEqual,
+				Value: traceql.Static{Type: traceql.TypeEnum, String: "error"},
+			}},
+		},
+		StartTimeMin: time.Unix(1000, 0),
+		StartTimeMax: time.Unix(2000, 0),
+		NumTraces:    defaultSearchLimit,
+	}, reader.traceQL)
+}
+
+func TestSearchInvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"q=" + url.QueryEscape("{ .foo = }"),
+		"q=" + url.QueryEscape("{}") + "&tags=name%3Dfoo",
+		"tags=status%3Dbroken",
+		"minDuration=fast",
+		"limit=-1",
+		"start=yesterday",
+		"start=2000&end=1000",
+	} {
+		t.Run(query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, PathPrefix+"/api/search?"+query, nil)
+			require.Equal(t, http.StatusBadRequest, serve(t, &mockReader{}, req).Code)
+		})
+	}
+}
+
+func TestSearchTags(t *testing.T) {
+	reader := &mockReader{
+		tagNames:  []string{"http.method", "service.name"},
+		tagValues: map[string][]string{"service.name": {"db", "frontend"}},
+	}
+
+	w := serve(t, reader, httptest.NewRequest(http.MethodGet, "/api/search/tags", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"tagNames":["http.method","service.name"]}`, w.Body.String())
+
+	w = serve(t, reader, httptest.NewRequest(http.MethodGet, PathPrefix+"/api/search/tag/service.name/values", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "service.name", reader.receivedTag)
+	require.JSONEq(t, `{"tagValues":["db","frontend"]}`, w.Body.String())
+}
+
+func TestEcho(t *testing.T) {
+	for _, prefix := range []string{"", PathPrefix} {
+		w := serve(t, &mockReader{}, httptest.NewRequest(http.MethodGet, prefix+"/api/echo", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "echo", w.Body.String())
+	}
+}
@@ -4,7 +4,11 @@
 
 package tenancy
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+)
 
 // Authorizer authorizes the read/write operations in multi-tenancy.
 type Authorizer interface {
@@ -12,12 +16,18 @@ type Authorizer interface {
 	ReadAuthorizer() ReadAuthorizer
 	// WriteAuthorizer returns a authorizer that authorizes write operations.
 	WriteAuthorizer() WriteAuthorizer
+	// TracesAuthorizer returns a authorizer that authorizes trace writes and reads.
+	TracesAuthorizer() TracesAuthorizer
+	// TenantReadAuthorizer returns a authorizer that only authorizes reads of the given tenant.
+	TenantReadAuthorizer(tenant string) (ReadAuthorizer, error)
 }
 
 // multiTenancy type implements the tenancy concept in Promscale.
 type genericAuthorizer struct {
-	write WriteAuthorizer
-	read  ReadAuthorizer
+	config AuthConfig
+	write  WriteAuthorizer
+	read   ReadAuthorizer
+	traces TracesAuthorizer
 }
 
 // NewAuthorizer returns a new MultiTenancy type.
@@ -28,8 +38,10 @@ func NewAuthorizer(c AuthConfig) (Authorizer, error) {
 	}
 	writeAuthr := NewWriteAuthorizer(c)
 	return &genericAuthorizer{
-		read:  readAuthr,
-		write: writeAuthr,
+		config: c,
+		read:   readAuthr,
+		write:  writeAuthr,
+		traces: NewTracesAuthorizer(c),
 	}, nil
 }
 
@@ -41,6 +53,24 @@ func (mt *genericAuthorizer) WriteAuthorizer() WriteAuthorizer {
 	return mt.write
 }
 
+func (mt *genericAuthorizer) TracesAuthorizer() TracesAuthorizer {
+	return mt.traces
+}
+
+func (mt *genericAuthorizer) TenantReadAuthorizer(tenant string) (ReadAuthorizer, error) {
+	if !mt.config.IsTenantAllowed(tenant) {
+		return nil, fmt.Errorf("authorization error for tenant %s: %w", tenant, ErrUnauthorizedTenant)
+	}
+	matcher, err := labels.NewMatcher(labels.MatchEqual, TenantLabelKey, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("init tenant label-matcher: %w", err)
+	}
+	return &readAuthorizer{
+		AuthConfig:           mt.config,
+		mtSafetyLabelMatcher: matcher,
+	}, nil
+}
+
 type noopAuthorizer struct{}
 
 // NewNoopAuthorizer returns a No-op tenancy that is used to initialize tenancy types for no operations.
@@ -55,3 +85,11 @@ func (np *noopAuthorizer) ReadAuthorizer() ReadAuthorizer {
 func (np *noopAuthorizer) WriteAuthorizer() WriteAuthorizer {
 	return nil
 }
+
+func (np *noopAuthorizer) TracesAuthorizer() TracesAuthorizer {
+	return nil
+}
+
+func (np *noopAuthorizer) TenantReadAuthorizer(string) (ReadAuthorizer, error) {
+	return nil, nil
+}
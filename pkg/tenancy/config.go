@@ -17,6 +17,8 @@ const TenantLabelKey = "__tenant__"
 
 // AuthConfig defines configuration type for tenancy.
 type AuthConfig interface {
+	// tenants returns the sorted list of valid tenants, or nil if all tenants are valid.
+	tenants() []string
 	// allowNonTenants returns true if tenancy is asked to accept write-requests from non-multi-tenants.
 	allowNonTenants() bool
 	// getTenantSafetyMatcher returns a safety matcher that ensures queries only have data of tenants that are authorized.
@@ -112,7 +114,6 @@ func NewAllowAllTenantsConfig(allowNonTenants bool) AuthConfig {
 	return &AllowAllTenantsConfig{nonTenants: allowNonTenants}
 }
 
-//nolint:all | kept inorder to implement the interface.
 func (cfg *AllowAllTenantsConfig) tenants() []string {
 	return nil
 }
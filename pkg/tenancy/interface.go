@@ -5,10 +5,13 @@
 package tenancy
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/prometheus/prometheus/model/labels"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
 	"github.com/timescale/promscale/pkg/prompb"
 )
 
@@ -28,3 +31,11 @@ type WriteAuthorizer interface {
 	// Process processes the incoming write requests to be multi-tenancy compatible.
 	Process(*http.Request, *prompb.WriteRequest) error
 }
+
+// TracesAuthorizer tells if traces are authorized to be written and which tenants a trace query can read.
+type TracesAuthorizer interface {
+	// ProcessTraces verifies the tenant of incoming traces and applies it as a resource attribute.
+	ProcessTraces(context.Context, ptrace.Traces) error
+	// ReadTenants returns the tenants whose spans can be read by the request of the given context.
+	ReadTenants(context.Context) (TenantFilter, error)
+}
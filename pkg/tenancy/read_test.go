@@ -65,3 +65,27 @@ func getSafetyMatcher(ms []*labels.Matcher) (string, bool) {
 	}
 	return "", false
 }
+
+func TestTenantReadAuthorizer(t *testing.T) {
+	matchers := []*labels.Matcher{{Type: labels.MatchEqual, Name: "__name__", Value: "metric"}}
+
+	authr, err := NewAuthorizer(NewSelectiveTenancyConfig([]string{"tenant-a", "tenant-b"}, true, true))
+	require.NoError(t, err)
+	tenantAuthr, err := authr.TenantReadAuthorizer("tenant-b")
+	require.NoError(t, err)
+	newMatchers := tenantAuthr.AppendTenantMatcher(matchers)
+	require.Len(t, newMatchers, 2)
+	require.Equal(t, labels.MatchEqual, newMatchers[1].Type)
+	require.Equal(t, "tenant-b", newMatchers[1].Value)
+
+	_, err = authr.TenantReadAuthorizer("tenant-c")
+	require.ErrorIs(t, err, ErrUnauthorizedTenant)
+
+	authr, err = NewAuthorizer(NewAllowAllTenantsConfig(false))
+	require.NoError(t, err)
+	tenantAuthr, err = authr.TenantReadAuthorizer("tenant-c")
+	require.NoError(t, err)
+	safetyMatcher, present := getSafetyMatcher(tenantAuthr.AppendTenantMatcher(matchers))
+	require.True(t, present)
+	require.Equal(t, "tenant-c", safetyMatcher)
+}
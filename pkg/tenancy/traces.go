@@ -0,0 +1,160 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package tenancy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TenantHeader is the header carrying the tenant name of HTTP requests and gRPC calls.
+// We do not look for `X-` since it has been deprecated as mentioned in https://datatracker.ietf.org/doc/html/rfc6648.
+const TenantHeader = "TENANT"
+
+type tenantCtxKey struct{}
+
+// WithTenant returns a copy of ctx carrying the given tenant name.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant name carried by ctx, or an empty string if there is none.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantCtxKey{}).(string)
+	return tenant
+}
+
+// TenantHandler stores the tenant from the request headers into the request context,
+// so that it is available to the trace ingest and query paths.
+func TenantHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenant := getTenant(r); tenant != "" {
+			r = r.WithContext(WithTenant(r.Context(), tenant))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// UnaryServerInterceptor stores the tenant from the gRPC metadata into the call context.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(tenantFromMetadata(ctx), req)
+}
+
+// StreamServerInterceptor stores the tenant from the gRPC metadata into the stream context.
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &tenantServerStream{ServerStream: ss, ctx: tenantFromMetadata(ss.Context())})
+}
+
+type tenantServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func tenantFromMetadata(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	// gRPC metadata keys are always lowercase.
+	if values := md.Get(strings.ToLower(TenantHeader)); len(values) > 0 && values[0] != "" {
+		return WithTenant(ctx, values[0])
+	}
+	return ctx
+}
+
+// TenantFilter describes the tenants whose spans a read request is allowed to see.
+type TenantFilter struct {
+	// Tenants lists the allowed tenants. A nil slice allows every tenant.
+	Tenants []string
+	// NonTenants allows spans that do not belong to any tenant.
+	NonTenants bool
+}
+
+// AllowsAll returns true if the filter does not restrict the spans in any way.
+func (f TenantFilter) AllowsAll() bool {
+	return f.Tenants == nil && f.NonTenants
+}
+
+// tracesAuthorizer authorizes trace writes and reads using the same tenancy config as the metric authorizers.
+type tracesAuthorizer struct {
+	AuthConfig
+}
+
+// NewTracesAuthorizer returns a new authorizer for traces.
+func NewTracesAuthorizer(config AuthConfig) TracesAuthorizer {
+	return &tracesAuthorizer{config}
+}
+
+func (a *tracesAuthorizer) isAuthorized(tenantName string) error {
+	if a.IsTenantAllowed(tenantName) {
+		return nil
+	}
+	return fmt.Errorf("authorization error for tenant %s: %w", tenantName, ErrUnauthorizedTenant)
+}
+
+// ProcessTraces implements the TracesAuthorizer interface. Like metric writes, the tenant from the
+// request takes precedence and is applied as the __tenant__ resource attribute. Without one, the
+// __tenant__ resource attribute sent by the client must belong to an authorized tenant.
+func (a *tracesAuthorizer) ProcessTraces(ctx context.Context, traces ptrace.Traces) error {
+	tenantFromRequest := TenantFromContext(ctx)
+	if tenantFromRequest != "" {
+		if err := a.isAuthorized(tenantFromRequest); err != nil {
+			return fmt.Errorf("traces-authorizer process: %w", err)
+		}
+	}
+	resourceSpans := traces.ResourceSpans()
+	for i := 0; i < resourceSpans.Len(); i++ {
+		if err := a.verifyAndApplyTenantAttribute(tenantFromRequest, resourceSpans.At(i).Resource().Attributes()); err != nil {
+			return fmt.Errorf("traces-authorizer process: %w", err)
+		}
+	}
+	return nil
+}
+
+func (a *tracesAuthorizer) verifyAndApplyTenantAttribute(tenantFromRequest string, attrs pcommon.Map) error {
+	value, exists := attrs.Get(TenantLabelKey)
+	if tenantFromRequest == "" {
+		if !exists {
+			return a.isAuthorized("")
+		}
+		return a.isAuthorized(value.AsString())
+	}
+	if !exists {
+		attrs.PutString(TenantLabelKey, tenantFromRequest)
+		return nil
+	}
+	switch value.AsString() {
+	case tenantFromRequest:
+		return nil
+	case "":
+		// Tenant attribute exists but no tenant value. This is invalid.
+		return fmt.Errorf("%s exists with an empty value: %w", TenantLabelKey, ErrUnauthorizedTenant)
+	default:
+		return fmt.Errorf("%s: %w", errTenantMismatch.Error(), ErrUnauthorizedTenant)
+	}
+}
+
+// ReadTenants implements the TracesAuthorizer interface. A request carrying a tenant can only
+// read the spans of that tenant, others can read the spans of all the authorized tenants.
+func (a *tracesAuthorizer) ReadTenants(ctx context.Context) (TenantFilter, error) {
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		if err := a.isAuthorized(tenant); err != nil {
+			return TenantFilter{}, err
+		}
+		return TenantFilter{Tenants: []string{tenant}}, nil
+	}
+	return TenantFilter{Tenants: a.tenants(), NonTenants: a.allowNonTenants()}, nil
+}
@@ -0,0 +1,188 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package tenancy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func tracesWithTenants(tenants ...string) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	for _, tenant := range tenants {
+		attrs := traces.ResourceSpans().AppendEmpty().Resource().Attributes()
+		attrs.PutString("service.name", "svc")
+		if tenant != "-" {
+			attrs.PutString(TenantLabelKey, tenant)
+		}
+	}
+	return traces
+}
+
+func tenantsOf(traces ptrace.Traces) []string {
+	var tenants []string
+	for i := 0; i < traces.ResourceSpans().Len(); i++ {
+		tenant, ok := traces.ResourceSpans().At(i).Resource().Attributes().Get(TenantLabelKey)
+		if !ok {
+			tenants = append(tenants, "-")
+			continue
+		}
+		tenants = append(tenants, tenant.Str())
+	}
+	return tenants
+}
+
+func TestProcessTraces(t *testing.T) {
+	testCases := []struct {
+		name            string
+		config          AuthConfig
+		tenant          string
+		resourceTenants []string // "-" means no __tenant__ attribute.
+		expectedTenants []string
+		shouldError     bool
+	}{
+		{
+			name:            "tenant from request is applied",
+			config:          NewSelectiveTenancyConfig([]string{"tenant-a"}, false, false),
+			tenant:          "tenant-a",
+			resourceTenants: []string{"-", "tenant-a"},
+			expectedTenants: []string{"tenant-a", "tenant-a"},
+		},
+		{
+			name:            "unauthorized tenant from request",
+			config:          NewSelectiveTenancyConfig([]string{"tenant-a"}, false, false),
+			tenant:          "tenant-b",
+			resourceTenants: []string{"-"},
+			shouldError:     true,
+		},
+		{
+			name:            "tenant mismatch",
+			config:          NewAllowAllTenantsConfig(false),
+			tenant:          "tenant-a",
+			resourceTenants: []string{"tenant-b"},
+			shouldError:     true,
+		},
+		{
+			name:            "empty tenant attribute",
+			config:          NewAllowAllTenantsConfig(true),
+			tenant:          "tenant-a",
+			resourceTenants: []string{""},
+			shouldError:     true,
+		},
+		{
+			name:            "tenant from attributes",
+			config:          NewSelectiveTenancyConfig([]string{"tenant-a", "tenant-b"}, false, false),
+			resourceTenants: []string{"tenant-a", "tenant-b"},
+			expectedTenants: []string{"tenant-a", "tenant-b"},
+		},
+		{
+			name:            "unauthorized tenant from attributes",
+			config:          NewSelectiveTenancyConfig([]string{"tenant-a"}, false, false),
+			resourceTenants: []string{"tenant-a", "tenant-b"},
+			shouldError:     true,
+		},
+		{
+			name:            "non-tenants not allowed",
+			config:          NewAllowAllTenantsConfig(false),
+			resourceTenants: []string{"-"},
+			shouldError:     true,
+		},
+		{
+			name:            "non-tenants allowed",
+			config:          NewSelectiveTenancyConfig([]string{"tenant-a"}, true, false),
+			resourceTenants: []string{"-", "tenant-a"},
+			expectedTenants: []string{"-", "tenant-a"},
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			traces := tracesWithTenants(c.resourceTenants...)
+			err := NewTracesAuthorizer(c.config).ProcessTraces(WithTenant(context.Background(), c.tenant), traces)
+			if c.shouldError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expectedTenants, tenantsOf(traces))
+		})
+	}
+}
+
+func TestReadTenants(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         AuthConfig
+		tenant         string
+		expectedFilter TenantFilter
+		shouldError    bool
+	}{
+		{
+			name:           "tenant from request",
+			config:         NewSelectiveTenancyConfig([]string{"tenant-a", "tenant-b"}, true, false),
+			tenant:         "tenant-b",
+			expectedFilter: TenantFilter{Tenants: []string{"tenant-b"}},
+		},
+		{
+			name:        "unauthorized tenant from request",
+			config:      NewSelectiveTenancyConfig([]string{"tenant-a"}, true, false),
+			tenant:      "tenant-b",
+			shouldError: true,
+		},
+		{
+			name:           "valid tenants",
+			config:         NewSelectiveTenancyConfig([]string{"tenant-b", "tenant-a"}, false, false),
+			expectedFilter: TenantFilter{Tenants: []string{"tenant-a", "tenant-b"}},
+		},
+		{
+			name:           "all tenants",
+			config:         NewAllowAllTenantsConfig(false),
+			expectedFilter: TenantFilter{},
+		},
+		{
+			name:           "all tenants and non-tenants",
+			config:         NewAllowAllTenantsConfig(true),
+			expectedFilter: TenantFilter{NonTenants: true},
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := NewTracesAuthorizer(c.config).ReadTenants(WithTenant(context.Background(), c.tenant))
+			if c.shouldError {
+				require.ErrorIs(t, err, ErrUnauthorizedTenant)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expectedFilter, filter)
+		})
+	}
+	require.True(t, TenantFilter{NonTenants: true}.AllowsAll())
+	require.False(t, TenantFilter{}.AllowsAll())
+}
+
+func TestTenantFromRequest(t *testing.T) {
+	var tenant string
+	handler := TenantHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		tenant = TenantFromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/traces", nil)
+	req.Header.Set(TenantHeader, "tenant-a")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, "tenant-a", tenant)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "tenant-b"))
+	_, err := UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		tenant = TenantFromContext(ctx)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "tenant-b", tenant)
+}
@@ -61,8 +61,7 @@ func (a *writeAuthorizer) Process(r *http.Request, wr *prompb.WriteRequest) erro
 }
 
 func getTenant(r *http.Request) string {
-	// We do not look for `X-` since it has been deprecated as mentioned in https://datatracker.ietf.org/doc/html/rfc6648.
-	return r.Header.Get("TENANT")
+	return r.Header.Get(TenantHeader)
 }
 
 func (a *writeAuthorizer) getTenantLabelMatchingHeader(tenantNameFromHeader string, labels []prompb.Label) ([]prompb.Label, error) {
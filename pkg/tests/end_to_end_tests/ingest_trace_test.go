@@ -85,6 +85,7 @@ func TestQueryTraces(t *testing.T) {
 		getOperationsTest(t, q)
 		findTraceTest(t, q, fixtures)
 		getDependenciesTest(t, q)
+		getServiceGraphTest(t, q)
 		findTracePlanTest(t, q, db)
 	})
 }
@@ -689,3 +690,16 @@ func getDependenciesTest(t testing.TB, q *store.Store) {
 	require.Equal(t, "service-name-1", deps[0].Child)
 	require.Equal(t, uint64(4), deps[0].CallCount)
 }
+
+func getServiceGraphTest(t testing.TB, q *store.Store) {
+	graph, err := q.GetServiceGraph(context.Background(), testdata.TestSpanEndTime, 2*testdata.TestSpanEndTime.Sub(testdata.TestSpanStartTime))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(graph.Edges))
+	require.Equal(t, "service-name-0", graph.Edges[0].Client)
+	require.Equal(t, "service-name-1", graph.Edges[0].Server)
+	require.Equal(t, uint64(4), graph.Edges[0].Requests)
+	require.Equal(t, 2, len(graph.Nodes))
+	require.Equal(t, "service-name-0", graph.Nodes[0].Service)
+	require.Equal(t, "service-name-1", graph.Nodes[1].Service)
+	require.GreaterOrEqual(t, graph.Nodes[1].Requests, uint64(4))
+}
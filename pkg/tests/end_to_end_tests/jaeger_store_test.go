@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
 	"github.com/stretchr/testify/require"
 	"github.com/timescale/promscale/pkg/jaeger/store"
 	jaegerstore "github.com/timescale/promscale/pkg/jaeger/store"
@@ -35,5 +36,34 @@ func TestJaegerSpanIngestion(t *testing.T) {
 		getOperationsTest(t, jaegerStore)
 		findTraceTest(t, jaegerStore, fixtures)
 		getDependenciesTest(t, jaegerStore)
+		archiveTraceTest(t, db, jaegerStore, fixtures)
 	})
 }
+
+func archiveTraceTest(t testing.TB, db *pgxpool.Pool, q *store.Store, fixtures tracesFixtures) {
+	ctx := context.Background()
+	traceID := fixtures.trace1.Spans[0].TraceID
+
+	_, err := q.ArchiveSpanReader().GetTrace(ctx, traceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+
+	trace, err := q.GetTrace(ctx, traceID)
+	require.NoError(t, err)
+	for _, span := range trace.Spans {
+		require.NoError(t, q.ArchiveSpanWriter().WriteSpan(ctx, span))
+		// Archiving is idempotent.
+		require.NoError(t, q.ArchiveSpanWriter().WriteSpan(ctx, span))
+	}
+
+	// The archived trace outlives the deletion of the spans.
+	_, err = db.Exec(ctx, "DELETE FROM _ps_trace.span")
+	require.NoError(t, err)
+	_, err = q.GetTrace(ctx, traceID)
+	require.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+
+	archived, err := q.ArchiveSpanReader().GetTrace(ctx, traceID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, trace.Spans, archived.Spans)
+
+	require.Error(t, q.ArchiveSpanWriter().WriteSpan(ctx, trace.Spans[0]))
+}
@@ -12,14 +12,17 @@ import (
 	"github.com/go-kit/log"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
 	prom_rules "github.com/prometheus/prometheus/rules"
 	"github.com/stretchr/testify/require"
 	"github.com/timescale/promscale/pkg/prompb"
 
 	"github.com/timescale/promscale/pkg/pgclient"
 	"github.com/timescale/promscale/pkg/pgmodel/cache"
+	"github.com/timescale/promscale/pkg/pgxconn"
 	"github.com/timescale/promscale/pkg/query"
 	"github.com/timescale/promscale/pkg/rules"
+	"github.com/timescale/promscale/pkg/rules/adapters"
 	"github.com/timescale/promscale/pkg/tenancy"
 )
 
@@ -101,6 +104,184 @@ func TestRecordingRulesEval(t *testing.T) {
 	})
 }
 
+func TestRuleGroupsFromDatabase(t *testing.T) {
+	withDB(t, *testDatabase, func(db *pgxpool.Pool, t testing.TB) {
+		newManager := func() (*rules.Manager, context.CancelFunc) {
+			pgClient, err := pgclient.NewClientWithPool(prometheus.NewRegistry(), &pgclient.Config{
+				CacheConfig:    cache.DefaultConfig,
+				MaxConnections: -1,
+			}, 1, db, db, nil, tenancy.NewNoopAuthorizer(), false)
+			require.NoError(t, err)
+			t.Cleanup(pgClient.Close)
+
+			rulesCfg := rules.DefaultConfig
+			rulesCfg.PrometheusConfigAddress = EmptyRecordingRulesConfigPath
+			require.NoError(t, rules.Validate(&rulesCfg))
+
+			ruleCtx, stopRuler := context.WithCancel(context.Background())
+			manager, reloadRules, err := rules.NewManager(ruleCtx, prometheus.NewRegistry(), pgClient, &rulesCfg)
+			require.NoError(t, err)
+			require.NoError(t, reloadRules())
+			return manager, stopRuler
+		}
+		ctx := context.Background()
+		manager, stop := newManager()
+		defer stop()
+		replica, stopReplica := newManager()
+		defer stopReplica()
+
+		group, errs := rules.ParseGroup([]byte("name: payments\nrules:\n  - record: test_rule\n    expr: sum(firstMetric)\n"))
+		require.Empty(t, errs)
+		require.NoError(t, manager.SetGroup(ctx, "team-a", group))
+		require.Len(t, manager.RuleGroups(), 1)
+		require.Equal(t, rules.DatabaseRulesPrefix+"team-a", manager.RuleGroups()[0].File())
+
+		// The other replica picks up the change on the next sync.
+		require.Empty(t, replica.RuleGroups())
+		require.NoError(t, replica.SyncGroups(ctx))
+		require.Len(t, replica.RuleGroups(), 1)
+
+		stored, err := replica.Group(ctx, "team-a", "payments")
+		require.NoError(t, err)
+		require.Equal(t, "sum(firstMetric)", stored.Rules[0].Expr.Value)
+
+		require.NoError(t, replica.DeleteNamespace(ctx, "team-a"))
+		require.Empty(t, replica.RuleGroups())
+		require.ErrorIs(t, manager.DeleteGroup(ctx, "team-a", "payments"), rules.ErrGroupNotFound)
+		require.NoError(t, manager.SyncGroups(ctx))
+		require.Empty(t, manager.RuleGroups())
+	})
+}
+
+func TestAlertHistoryStore(t *testing.T) {
+	withDB(t, *testDatabase, func(db *pgxpool.Pool, t testing.TB) {
+		history := rules.NewAlertHistory(pgxconn.NewPgxConn(db))
+		ctx := context.Background()
+		transition := func(minute int64, tenant, instance, state string) rules.AlertTransition {
+			return rules.AlertTransition{
+				Time:        time.Unix(minute*60, 0).UTC(),
+				Tenant:      tenant,
+				GroupFile:   "rules.yaml",
+				Group:       "instances",
+				State:       state,
+				Labels:      labels.FromStrings(labels.AlertName, "InstanceDown", "instance", instance),
+				Annotations: labels.FromStrings("summary", "down"),
+				Value:       1,
+			}
+		}
+		transitions := []rules.AlertTransition{
+			transition(1, "", "a", "pending"),
+			transition(2, "", "a", "firing"),
+			transition(3, "", "b", "pending"),
+			transition(4, "", "a", rules.AlertStateResolved),
+			transition(5, "tenant-a", "a", "pending"),
+		}
+		require.NoError(t, history.Record(ctx, transitions))
+		// Transitions recorded twice, such as by two Promscale instances, are stored once.
+		require.NoError(t, history.Record(ctx, transitions[:2]))
+
+		got, err := history.Query(ctx, time.Time{}, time.Time{}, nil)
+		require.NoError(t, err)
+		require.Equal(t, transitions[:4], got)
+
+		matchers := []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchRegexp, "instance", "a|c"),
+			labels.MustNewMatcher(labels.MatchNotEqual, "job", "other"),
+		}
+		got, err = history.Query(ctx, time.Unix(2*60, 0), time.Unix(10*60, 0), matchers)
+		require.NoError(t, err)
+		require.Equal(t, []rules.AlertTransition{transitions[1], transitions[3]}, got)
+
+		got, err = history.Query(tenancy.WithTenant(ctx, "tenant-a"), time.Time{}, time.Time{}, nil)
+		require.NoError(t, err)
+		require.Equal(t, transitions[4:], got)
+	})
+}
+
+func TestTenantRuleGroups(t *testing.T) {
+	ts, tenants := generateSmallMultiTenantTimeseries()
+	withDB(t, *testDatabase, func(db *pgxpool.Pool, t testing.TB) {
+		mt, err := tenancy.NewAuthorizer(tenancy.NewSelectiveTenancyConfig(tenants[:2], false, false))
+		require.NoError(t, err)
+		pgClient, err := pgclient.NewClientWithPool(prometheus.NewRegistry(), &pgclient.Config{
+			CacheConfig:    cache.DefaultConfig,
+			MaxConnections: -1,
+		}, 1, db, db, nil, mt, false)
+		require.NoError(t, err)
+		defer pgClient.Close()
+		require.NoError(t, pgClient.InitPromQLEngine(&query.Config{
+			MaxQueryTimeout:      query.DefaultQueryTimeout,
+			SubQueryStepInterval: query.DefaultSubqueryStepInterval,
+			LookBackDelta:        query.DefaultLookBackDelta,
+			MaxSamples:           query.DefaultMaxSamples,
+			MaxPointsPerTs:       11000,
+		}))
+
+		ctx := context.Background()
+		for _, tenant := range tenants[:2] {
+			request := newWriteRequestWithTs(copyMetrics(ts))
+			require.NoError(t, mt.WriteAuthorizer().Process(requestWithHeaderTenant(tenant), request))
+			_, _, err = pgClient.IngestMetrics(ctx, request)
+			require.NoError(t, err)
+		}
+
+		// The queryable of a tenant only reads the series of the tenant.
+		queryable, err := pgClient.TenantQueryable(tenants[0])
+		require.NoError(t, err)
+		querier, err := queryable.SamplesQuerier(ctx, 0, 10)
+		require.NoError(t, err)
+		seriesSet, _ := querier.Select(false, nil, nil, nil, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "firstMetric"))
+		count := 0
+		for seriesSet.Next() {
+			require.Equal(t, tenants[0], seriesSet.At().Labels().Get(tenancy.TenantLabelKey))
+			count++
+		}
+		require.NoError(t, seriesSet.Err())
+		require.Equal(t, 1, count)
+		querier.Close()
+		_, err = pgClient.TenantQueryable(tenants[2])
+		require.ErrorIs(t, err, tenancy.ErrUnauthorizedTenant)
+
+		// The results of the rules of a tenant are labeled with the tenant.
+		appendable := adapters.NewIngestAdapter(pgClient.Inserter(), mt.WriteAuthorizer())
+		app := appendable.Appender(tenancy.WithTenant(ctx, tenants[0]))
+		_, err = app.Append(0, labels.FromStrings(labels.MetricName, "tenant_rule"), 1000, 1)
+		require.NoError(t, err)
+		require.NoError(t, app.Commit())
+		var tenant string
+		err = db.QueryRow(ctx, "SELECT jsonb(labels)->>'__tenant__' FROM _prom_catalog.series WHERE metric_name = 'tenant_rule'").Scan(&tenant)
+		require.NoError(t, err)
+		require.Equal(t, tenants[0], tenant)
+
+		app = appendable.Appender(tenancy.WithTenant(ctx, tenants[0]))
+		_, err = app.Append(0, labels.FromStrings(labels.MetricName, "tenant_rule", tenancy.TenantLabelKey, tenants[1]), 1000, 1)
+		require.Error(t, err)
+
+		// The rule groups are only visible to their tenant.
+		rulesCfg := rules.DefaultConfig
+		rulesCfg.PrometheusConfigAddress = EmptyRecordingRulesConfigPath
+		require.NoError(t, rules.Validate(&rulesCfg))
+		ruleCtx, stopRuler := context.WithCancel(ctx)
+		defer stopRuler()
+		manager, reloadRules, err := rules.NewManager(ruleCtx, prometheus.NewRegistry(), pgClient, &rulesCfg)
+		require.NoError(t, err)
+		require.NoError(t, reloadRules())
+
+		group, errs := rules.ParseGroup([]byte("name: payments\nrules:\n  - record: tenant_rule\n    expr: sum(firstMetric)\n"))
+		require.Empty(t, errs)
+		require.NoError(t, manager.SetGroup(tenancy.WithTenant(ctx, tenants[0]), "team", group))
+		require.ErrorIs(t, manager.SetGroup(tenancy.WithTenant(ctx, tenants[2]), "team", group), tenancy.ErrUnauthorizedTenant)
+		require.Len(t, manager.RuleGroups(), 1)
+		require.Equal(t, rules.NamespaceIdentifier(tenants[0], "team"), manager.RuleGroups()[0].File())
+
+		_, err = manager.Namespace(tenancy.WithTenant(ctx, tenants[1]), "team")
+		require.ErrorIs(t, err, rules.ErrNamespaceNotFound)
+		groups, err := manager.Namespace(tenancy.WithTenant(ctx, tenants[0]), "team")
+		require.NoError(t, err)
+		require.Len(t, groups, 1)
+	})
+}
+
 func tsToSeconds(ts []prompb.TimeSeries, multiplier time.Duration) []prompb.TimeSeries {
 	for i := range ts {
 		for j := range ts[i].Samples {
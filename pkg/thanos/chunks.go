@@ -0,0 +1,226 @@
+// This file contains code copied from
+// https://github.com/thanos-io/thanos/blob/v0.28.1/pkg/compact/downsample/downsample.go
+
+package thanos
+
+import (
+	"math"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+const (
+	// maxSamplesPerChunk is the number of samples of the chunks of the series, the
+	// same as the chunks of Prometheus.
+	maxSamplesPerChunk = 120
+
+	// The resolutions of the downsampled series, the same as the ones of the
+	// Thanos compactor.
+	resLevel1 = int64(5 * 60 * 1000)
+	resLevel2 = int64(60 * 60 * 1000)
+)
+
+type sample struct {
+	t int64
+	v float64
+}
+
+// rawChunks encodes the samples into XOR chunks of up to maxSamplesPerChunk samples.
+func rawChunks(samples []sample) []storepb.AggrChunk {
+	chks := make([]storepb.AggrChunk, 0, len(samples)/maxSamplesPerChunk+1)
+	for len(samples) > 0 {
+		n := maxSamplesPerChunk
+		if n > len(samples) {
+			n = len(samples)
+		}
+		chks = append(chks, storepb.AggrChunk{
+			MinTime: samples[0].t,
+			MaxTime: samples[n-1].t,
+			Raw:     encodeChunk(samples[:n]),
+		})
+		samples = samples[n:]
+	}
+	return chks
+}
+
+func encodeChunk(samples []sample) *storepb.Chunk {
+	chk := chunkenc.NewXORChunk()
+	app, _ := chk.Appender()
+	for _, s := range samples {
+		app.Append(s.t, s.v)
+	}
+	return &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chk.Bytes()}
+}
+
+// downsampleResolution returns the resolution of the series returned for a maximum
+// resolution window, or 0 for raw series.
+func downsampleResolution(maxResolutionWindow int64) int64 {
+	switch {
+	case maxResolutionWindow >= resLevel2:
+		return resLevel2
+	case maxResolutionWindow >= resLevel1:
+		return resLevel1
+	default:
+		return 0
+	}
+}
+
+// downsampledChunks aggregates the samples over windows of the resolution, and
+// encodes the requested aggregates of up to maxSamplesPerChunk windows in each
+// chunk, like the downsampled blocks of the Thanos compactor.
+func downsampledChunks(samples []sample, resolution int64, aggrs []storepb.Aggr) []storepb.AggrChunk {
+	var (
+		chks  []storepb.AggrChunk
+		valid = samples[:0]
+	)
+	for _, s := range samples {
+		if !value.IsStaleNaN(s.v) {
+			valid = append(valid, s)
+		}
+	}
+	samples = valid
+	for len(samples) > 0 {
+		// Cut the batch of the chunk at the end of a window.
+		j, windows := 0, 0
+		for j < len(samples) && windows < maxSamplesPerChunk {
+			w := currentWindow(samples[j].t, resolution)
+			for ; j < len(samples) && samples[j].t <= w; j++ {
+			}
+			windows++
+		}
+		batch := samples[:j]
+		samples = samples[j:]
+
+		var ab aggrChunkBuilder
+		// Encode first raw value; see ApplyCounterResetsSeriesIterator.
+		ab.counter = append(ab.counter, batch[0])
+		lastT := downsampleBatch(batch, resolution, ab.add)
+		// Encode last raw value; see ApplyCounterResetsSeriesIterator.
+		ab.counter = append(ab.counter, sample{lastT, batch[len(batch)-1].v})
+		chks = append(chks, ab.encode(batch[0].t, lastT, aggrs))
+	}
+	return chks
+}
+
+// currentWindow returns the end of the window of the resolution containing t.
+func currentWindow(t, r int64) int64 {
+	// The next timestamp is the next number after s.t that's aligned with window.
+	// We subtract 1 because block ranges are [from, to) and the last sample would
+	// go out of bounds otherwise.
+	return t - (t % r) + r - 1
+}
+
+// downsampleBatch aggregates the data over the given resolution and calls add each time
+// the end of a resolution was reached.
+func downsampleBatch(data []sample, resolution int64, add func(int64, *aggregator)) int64 {
+	var (
+		aggr  aggregator
+		nextT = int64(-1)
+		lastT = data[len(data)-1].t
+	)
+	// Fill up one aggregate chunk with up to m samples.
+	for _, s := range data {
+		if value.IsStaleNaN(s.v) {
+			continue
+		}
+		if s.t > nextT {
+			if nextT != -1 {
+				add(nextT, &aggr)
+			}
+			aggr.reset()
+			nextT = currentWindow(s.t, resolution)
+			// Limit next timestamp to not go beyond the batch. A subsequent batch
+			// may overlap in time range otherwise.
+			if nextT > lastT {
+				nextT = lastT
+			}
+		}
+		aggr.add(s.v)
+	}
+	// Add the last sample.
+	add(nextT, &aggr)
+
+	return nextT
+}
+
+// aggregator collects cumulative stats for a stream of values.
+type aggregator struct {
+	total   int     // Total samples processed.
+	count   int     // Samples in current window.
+	sum     float64 // Value sum of current window.
+	min     float64 // Min of current window.
+	max     float64 // Max of current window.
+	counter float64 // Total counter state since beginning.
+	resets  int     // Number of counter resets since beginning.
+	last    float64 // Last added value.
+}
+
+// reset the stats to start a new aggregation window.
+func (a *aggregator) reset() {
+	a.count = 0
+	a.sum = 0
+	a.min = math.MaxFloat64
+	a.max = -math.MaxFloat64
+}
+
+func (a *aggregator) add(v float64) {
+	if a.total > 0 {
+		if v < a.last {
+			// Counter reset, correct the value.
+			a.counter += v
+			a.resets++
+		} else {
+			// Add delta with last value to the counter.
+			a.counter += v - a.last
+		}
+	} else {
+		// First sample sets the counter.
+		a.counter = v
+	}
+	a.last = v
+
+	a.sum += v
+	a.count++
+	a.total++
+
+	if v < a.min {
+		a.min = v
+	}
+	if v > a.max {
+		a.max = v
+	}
+}
+
+// aggrChunkBuilder collects the aggregates of the windows of a chunk.
+type aggrChunkBuilder struct {
+	count, sum, min, max, counter []sample
+}
+
+func (b *aggrChunkBuilder) add(t int64, aggr *aggregator) {
+	b.sum = append(b.sum, sample{t, aggr.sum})
+	b.min = append(b.min, sample{t, aggr.min})
+	b.max = append(b.max, sample{t, aggr.max})
+	b.count = append(b.count, sample{t, float64(aggr.count)})
+	b.counter = append(b.counter, sample{t, aggr.counter})
+}
+
+func (b *aggrChunkBuilder) encode(mint, maxt int64, aggrs []storepb.Aggr) storepb.AggrChunk {
+	chk := storepb.AggrChunk{MinTime: mint, MaxTime: maxt}
+	for _, aggr := range aggrs {
+		switch aggr {
+		case storepb.Aggr_COUNT:
+			chk.Count = encodeChunk(b.count)
+		case storepb.Aggr_SUM:
+			chk.Sum = encodeChunk(b.sum)
+		case storepb.Aggr_MIN:
+			chk.Min = encodeChunk(b.min)
+		case storepb.Aggr_MAX:
+			chk.Max = encodeChunk(b.max)
+		case storepb.Aggr_COUNTER:
+			chk.Counter = encodeChunk(b.counter)
+		}
+	}
+	return chk
+}
@@ -0,0 +1,50 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+type Config struct {
+	// ExternalLabels identify the series of Promscale among the ones of the other
+	// stores of Thanos.
+	ExternalLabels  labels.Labels
+	TLSClientCAFile string
+
+	externalLabels string
+}
+
+func ParseFlags(fs *flag.FlagSet, cfg *Config) *Config {
+	fs.StringVar(&cfg.externalLabels, "thanos.store-api.external-labels", "", "Comma-separated list of name=value external labels of the Thanos Store API, such as 'cluster=eu1,replica=a'. "+
+		"The labels are added to the returned series, and requests with matchers not matching them return no series.")
+	fs.StringVar(&cfg.TLSClientCAFile, "thanos.store-api.tls-client-ca-file", "", "CA certificate file used to verify the client certificates of the Thanos Store API calls, leave blank to disable client authentication. "+
+		"Requires auth.tls-cert-file and auth.tls-key-file.")
+	return cfg
+}
+
+func Validate(cfg *Config) error {
+	if cfg.externalLabels == "" {
+		return nil
+	}
+	b := labels.NewBuilder(nil)
+	for _, pair := range strings.Split(cfg.externalLabels, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || value == "" {
+			return fmt.Errorf("invalid thanos.store-api.external-labels %q: labels must be non-empty name=value pairs", cfg.externalLabels)
+		}
+		if !model.LabelName(name).IsValid() || name == labels.MetricName {
+			return fmt.Errorf("invalid thanos.store-api.external-labels %q: invalid label name %q", cfg.externalLabels, name)
+		}
+		b.Set(name, value)
+	}
+	cfg.ExternalLabels = b.Labels(nil)
+	return nil
+}
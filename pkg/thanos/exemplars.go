@@ -0,0 +1,60 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"time"
+
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/timescale/promscale/pkg/pgmodel/exemplar"
+)
+
+// ExemplarsServer implements the Thanos Exemplars API with the exemplar querier of
+// the store.
+type ExemplarsServer struct {
+	store *Storage
+}
+
+func NewExemplarsServer(store *Storage) *ExemplarsServer {
+	return &ExemplarsServer{store: store}
+}
+
+// Exemplars returns the exemplars of the series selected by the query, with the
+// external labels added to the series labels.
+func (s *ExemplarsServer) Exemplars(req *exemplarspb.ExemplarsRequest, srv exemplarspb.Exemplars_ExemplarsServer) error {
+	if req.End < req.Start {
+		return status.Error(codes.InvalidArgument, "end timestamp must not be before start time")
+	}
+	ctx := srv.Context()
+	queryable, err := s.store.queryable(ctx)
+	if err != nil {
+		return err
+	}
+	results, err := exemplar.QueryExemplar(ctx, req.Query, queryable, time.UnixMilli(req.Start), time.UnixMilli(req.End))
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		data := &exemplarspb.ExemplarData{
+			SeriesLabels: labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(s.store.withExternalLabels(r.SeriesLabels))},
+			Exemplars:    make([]*exemplarspb.Exemplar, 0, len(r.Exemplars)),
+		}
+		for _, e := range r.Exemplars {
+			data.Exemplars = append(data.Exemplars, &exemplarspb.Exemplar{
+				Labels: labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(e.Labels)},
+				Value:  e.Value,
+				Ts:     e.Ts,
+			})
+		}
+		if err := srv.Send(exemplarspb.NewExemplarsResponse(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
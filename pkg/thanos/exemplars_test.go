@@ -0,0 +1,82 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"google.golang.org/grpc"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+	"github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/promql"
+)
+
+// exemplarsQueryable has an exemplar for each series matching the selectors, at the
+// start of the selected time range.
+type exemplarsQueryable struct {
+	promql.Queryable
+	series []labels.Labels
+}
+
+func (q exemplarsQueryable) ExemplarsQuerier(context.Context) querier.ExemplarQuerier {
+	return q
+}
+
+func (q exemplarsQueryable) Select(start, _ time.Time, ms ...[]*labels.Matcher) ([]model.ExemplarQueryResult, error) {
+	var results []model.ExemplarQueryResult
+	for _, lset := range q.series {
+		for _, matchers := range ms {
+			if matchesAny(lset, [][]*labels.Matcher{matchers}) {
+				results = append(results, model.ExemplarQueryResult{
+					SeriesLabels: lset,
+					Exemplars:    []model.ExemplarData{{Labels: labels.FromStrings("trace_id", lset.Get("instance")), Value: 1, Ts: start.UnixMilli()}},
+				})
+				break
+			}
+		}
+	}
+	return results, nil
+}
+
+type testExemplarsServer struct {
+	grpc.ServerStream
+	ctx  context.Context
+	data []*exemplarspb.ExemplarData
+}
+
+func (s *testExemplarsServer) Send(resp *exemplarspb.ExemplarsResponse) error {
+	s.data = append(s.data, resp.GetData())
+	return nil
+}
+
+func (s *testExemplarsServer) Context() context.Context {
+	return s.ctx
+}
+
+func TestExemplarsServer(t *testing.T) {
+	queryables := &testQueryables{queryable: exemplarsQueryable{series: []labels.Labels{
+		labels.FromStrings("__name__", "requests_total", "job", "api", "instance", "a"),
+		labels.FromStrings("__name__", "requests_total", "job", "db", "instance", "b"),
+	}}}
+	server := NewExemplarsServer(NewStorage(queryables, nil, Config{ExternalLabels: labels.FromStrings("cluster", "eu1")}))
+
+	srv := &testExemplarsServer{ctx: context.Background()}
+	err := server.Exemplars(&exemplarspb.ExemplarsRequest{Query: `rate(requests_total{job="api"}[5m])`, Start: 60_000, End: 120_000}, srv)
+	require.NoError(t, err)
+	require.Len(t, srv.data, 1)
+	require.Equal(t, labels.FromStrings("__name__", "requests_total", "cluster", "eu1", "job", "api", "instance", "a"), srv.data[0].SeriesLabels.PromLabels())
+	require.Len(t, srv.data[0].Exemplars, 1)
+	require.Equal(t, labels.FromStrings("trace_id", "a"), srv.data[0].Exemplars[0].Labels.PromLabels())
+	require.Equal(t, int64(60_000), srv.data[0].Exemplars[0].Ts)
+
+	err = server.Exemplars(&exemplarspb.ExemplarsRequest{Query: `requests_total`, Start: 120_000, End: 60_000}, &testExemplarsServer{ctx: context.Background()})
+	require.Error(t, err)
+}
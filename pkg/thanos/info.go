@@ -0,0 +1,52 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"context"
+	"math"
+
+	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+
+	"github.com/timescale/promscale/pkg/log"
+)
+
+// componentType is the type of Thanos component Promscale presents itself as.
+const componentType = "store"
+
+// InfoServer implements the Thanos Info API, which tells Thanos Query which of the
+// Thanos APIs Promscale serves.
+type InfoServer struct {
+	store *Storage
+	rules bool
+}
+
+// NewInfoServer returns the Info API of the store. The Rules API is only announced
+// when rules are set.
+func NewInfoServer(store *Storage, rules RuleGroups) *InfoServer {
+	return &InfoServer{store: store, rules: rules != nil}
+}
+
+func (s *InfoServer) Info(ctx context.Context, _ *infopb.InfoRequest) (*infopb.InfoResponse, error) {
+	minTime, maxTime, err := s.store.timeRange(ctx)
+	if err != nil {
+		log.Warn("msg", "Failed to get the time range of the Thanos Store API", "err", err)
+		minTime, maxTime = math.MinInt64, math.MaxInt64
+	}
+	resp := &infopb.InfoResponse{
+		ComponentType:  componentType,
+		Store:          &infopb.StoreInfo{MinTime: minTime, MaxTime: maxTime},
+		MetricMetadata: &infopb.MetricMetadataInfo{},
+		Exemplars:      &infopb.ExemplarsInfo{MinTime: math.MinInt64, MaxTime: math.MaxInt64},
+	}
+	if len(s.store.externalLabels) > 0 {
+		resp.LabelSets = labelpb.ZLabelSetsFromPromLabels(s.store.externalLabels)
+	}
+	if s.rules {
+		resp.Rules = &infopb.RulesInfo{}
+	}
+	return resp, nil
+}
@@ -0,0 +1,70 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/info/infopb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+func TestInfoServer(t *testing.T) {
+	testCases := []struct {
+		name    string
+		results model.RowResults
+		minTime int64
+		maxTime int64
+	}{
+		{
+			name:    "chunks",
+			results: model.RowResults{{int64(1_000_000), int64(3_600_000_000)}},
+			minTime: 1_000,
+			maxTime: 3_599_999,
+		},
+		{
+			name:    "no chunks",
+			results: model.RowResults{{nil, nil}},
+			minTime: math.MaxInt64,
+			maxTime: math.MinInt64,
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			conn := model.NewSqlRecorder([]model.SqlQuery{
+				{Sql: selectTimeRangeSQL, Results: c.results},
+				{Sql: selectTimeRangeSQL, Results: c.results},
+			}, t)
+			store := NewStorage(&testQueryables{}, conn, Config{ExternalLabels: labels.FromStrings("cluster", "eu1")})
+
+			info, err := NewInfoServer(store, testRuleGroups{}).Info(context.Background(), &infopb.InfoRequest{})
+			require.NoError(t, err)
+			require.Equal(t, componentType, info.ComponentType)
+			require.Equal(t, []labels.Labels{labels.FromStrings("cluster", "eu1")}, labelpb.ZLabelSetsToPromLabelSets(info.LabelSets...))
+			require.Equal(t, &infopb.StoreInfo{MinTime: c.minTime, MaxTime: c.maxTime}, info.Store)
+			require.NotNil(t, info.MetricMetadata)
+			require.NotNil(t, info.Exemplars)
+			require.NotNil(t, info.Rules)
+
+			storeInfo, err := store.Info(context.Background(), &storepb.InfoRequest{})
+			require.NoError(t, err)
+			require.Equal(t, c.minTime, storeInfo.MinTime)
+			require.Equal(t, c.maxTime, storeInfo.MaxTime)
+		})
+	}
+
+	// The Rules API is not announced without rules.
+	info, err := NewInfoServer(NewStorage(&testQueryables{}, nil, Config{}), nil).Info(context.Background(), &infopb.InfoRequest{})
+	require.NoError(t, err)
+	require.Nil(t, info.Rules)
+	require.Empty(t, info.LabelSets)
+}
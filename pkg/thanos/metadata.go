@@ -0,0 +1,39 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+
+	"github.com/timescale/promscale/pkg/pgmodel/metadata"
+)
+
+// MetadataServer implements the Thanos Metadata API with the metadata catalog.
+type MetadataServer struct {
+	store *Storage
+}
+
+func NewMetadataServer(store *Storage) *MetadataServer {
+	return &MetadataServer{store: store}
+}
+
+func (s *MetadataServer) MetricMetadata(req *metadatapb.MetricMetadataRequest, srv metadatapb.Metadata_MetricMetadataServer) error {
+	// Thanos Query asks for all the metrics with a negative limit.
+	limit := int(req.Limit)
+	if limit < 0 {
+		limit = 0
+	}
+	data, err := metadata.MetricQuery(srv.Context(), s.store.conn, req.Metric, limit)
+	if err != nil {
+		return err
+	}
+	metas := make(map[string][]metadatapb.Meta, len(data))
+	for metric, entries := range data {
+		for _, e := range entries {
+			metas[metric] = append(metas[metric], metadatapb.Meta{Type: e.Type, Help: e.Help, Unit: e.Unit})
+		}
+	}
+	return srv.Send(metadatapb.NewMetricMetadataResponse(metadatapb.FromMetadataMap(metas)))
+}
@@ -0,0 +1,54 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"google.golang.org/grpc"
+
+	"github.com/timescale/promscale/pkg/pgmodel/model"
+)
+
+type testMetadataServer struct {
+	grpc.ServerStream
+	responses []*metadatapb.MetricMetadataResponse
+}
+
+func (s *testMetadataServer) Send(resp *metadatapb.MetricMetadataResponse) error {
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+func (s *testMetadataServer) Context() context.Context {
+	return context.Background()
+}
+
+func TestMetadataServer(t *testing.T) {
+	conn := model.NewSqlRecorder([]model.SqlQuery{
+		{
+			Sql: "SELECT metric_family, type, unit, help from _prom_catalog.metadata ORDER BY metric_family, last_seen DESC",
+			Results: model.RowResults{
+				{"requests_total", "counter", "", "Total requests."},
+				{"requests_total", "counter", "", "Requests."},
+				{"up", "gauge", "", "Up."},
+			},
+		},
+	}, t)
+	srv := &testMetadataServer{}
+	err := NewMetadataServer(NewStorage(&testQueryables{}, conn, Config{})).MetricMetadata(&metadatapb.MetricMetadataRequest{Limit: -1}, srv)
+	require.NoError(t, err)
+	require.Len(t, srv.responses, 1)
+	require.Equal(t, map[string]metadatapb.MetricMetadataEntry{
+		"requests_total": {Metas: []metadatapb.Meta{
+			{Type: "counter", Help: "Total requests."},
+			{Type: "counter", Help: "Requests."},
+		}},
+		"up": {Metas: []metadatapb.Meta{{Type: "gauge", Help: "Up."}}},
+	}, srv.responses[0].GetMetadata().Metadata)
+}
@@ -0,0 +1,161 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	prom_rules "github.com/prometheus/prometheus/rules"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+// RuleGroups provides the rule groups evaluated by Promscale.
+type RuleGroups interface {
+	RuleGroups() []*prom_rules.Group
+	// GroupTenant returns the tenant owning the rule groups of the file.
+	GroupTenant(file string) string
+}
+
+// RulesServer implements the Thanos Rules API with the rule groups of the rules
+// manager.
+type RulesServer struct {
+	store *Storage
+	rules RuleGroups
+}
+
+func NewRulesServer(store *Storage, rules RuleGroups) *RulesServer {
+	return &RulesServer{store: store, rules: rules}
+}
+
+// Rules returns the rule groups, with the external labels added to the labels of
+// the rules and alerts. With matchers, only the rules whose labels match any of them
+// are returned, and the groups left without rules are left out. With multi-tenancy,
+// only the groups owned by the tenant of the request are returned.
+func (s *RulesServer) Rules(req *rulespb.RulesRequest, srv rulespb.Rules_RulesServer) error {
+	var matcherSets [][]*labels.Matcher
+	for _, m := range req.MatcherString {
+		matchers, err := parser.ParseMetricSelector(m)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+
+	tenant := tenancy.TenantFromContext(srv.Context())
+	for _, grp := range s.rules.RuleGroups() {
+		if s.rules.GroupTenant(grp.File()) != tenant {
+			continue
+		}
+		group := &rulespb.RuleGroup{
+			Name:                      grp.Name(),
+			File:                      grp.File(),
+			Interval:                  grp.Interval().Seconds(),
+			Limit:                     int64(grp.Limit()),
+			EvaluationDurationSeconds: grp.GetEvaluationTime().Seconds(),
+			LastEvaluation:            grp.GetLastEvaluation(),
+		}
+		for _, r := range grp.Rules() {
+			rule, err := s.rule(r, req.Type)
+			if err != nil {
+				return err
+			}
+			if rule == nil || !matchesAny(rule.GetLabels(), matcherSets) {
+				continue
+			}
+			group.Rules = append(group.Rules, rule)
+		}
+		if len(matcherSets) > 0 && len(group.Rules) == 0 {
+			continue
+		}
+		if err := srv.Send(rulespb.NewRuleGroupRulesResponse(group)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rule converts a rule of the type requested, and returns nil for the other rules.
+func (s *RulesServer) rule(r prom_rules.Rule, typ rulespb.RulesRequest_Type) (*rulespb.Rule, error) {
+	lastError := ""
+	if r.LastError() != nil {
+		lastError = r.LastError().Error()
+	}
+	switch rule := r.(type) {
+	case *prom_rules.AlertingRule:
+		if typ == rulespb.RulesRequest_RECORD {
+			return nil, nil
+		}
+		alert := &rulespb.Alert{
+			// The alert states of Prometheus and Thanos have the same values.
+			State:                     rulespb.AlertState(rule.State()),
+			Name:                      rule.Name(),
+			Query:                     rule.Query().String(),
+			DurationSeconds:           rule.HoldDuration().Seconds(),
+			Labels:                    s.labelSet(rule.Labels()),
+			Annotations:               labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(rule.Annotations())},
+			Health:                    string(rule.Health()),
+			LastError:                 lastError,
+			EvaluationDurationSeconds: rule.GetEvaluationDuration().Seconds(),
+			LastEvaluation:            rule.GetEvaluationTimestamp(),
+		}
+		for _, a := range rule.ActiveAlerts() {
+			activeAt := a.ActiveAt
+			alert.Alerts = append(alert.Alerts, &rulespb.AlertInstance{
+				Labels:      s.labelSet(a.Labels),
+				Annotations: labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(a.Annotations)},
+				State:       rulespb.AlertState(a.State),
+				ActiveAt:    &activeAt,
+				Value:       strconv.FormatFloat(a.Value, 'e', -1, 64),
+			})
+		}
+		return rulespb.NewAlertingRule(alert), nil
+	case *prom_rules.RecordingRule:
+		if typ == rulespb.RulesRequest_ALERT {
+			return nil, nil
+		}
+		return rulespb.NewRecordingRule(&rulespb.RecordingRule{
+			Name:                      rule.Name(),
+			Query:                     rule.Query().String(),
+			Labels:                    s.labelSet(rule.Labels()),
+			Health:                    string(rule.Health()),
+			LastError:                 lastError,
+			EvaluationDurationSeconds: rule.GetEvaluationDuration().Seconds(),
+			LastEvaluation:            rule.GetEvaluationTimestamp(),
+		}), nil
+	default:
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to assert type of rule '%v'", rule.Name()))
+	}
+}
+
+func (s *RulesServer) labelSet(lset labels.Labels) labelpb.ZLabelSet {
+	return labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(s.store.withExternalLabels(lset))}
+}
+
+func matchesAny(lset labels.Labels, matcherSets [][]*labels.Matcher) bool {
+	if len(matcherSets) == 0 {
+		return true
+	}
+	for _, matchers := range matcherSets {
+		matches := true
+		for _, m := range matchers {
+			if !m.Matches(lset.Get(m.Name)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	prom_rules "github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/rules/rulespb"
+	"google.golang.org/grpc"
+
+	promscale_promql "github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+type testRuleGroups []*prom_rules.Group
+
+func (g testRuleGroups) RuleGroups() []*prom_rules.Group {
+	return g
+}
+
+// GroupTenant returns the tenant the group files other than rules.yaml are named
+// after, such as team-a.yaml.
+func (g testRuleGroups) GroupTenant(file string) string {
+	if file == "rules.yaml" {
+		return ""
+	}
+	return strings.TrimSuffix(file, ".yaml")
+}
+
+type testRulesServer struct {
+	grpc.ServerStream
+	ctx    context.Context
+	groups []*rulespb.RuleGroup
+}
+
+func (s *testRulesServer) Send(resp *rulespb.RulesResponse) error {
+	s.groups = append(s.groups, resp.GetGroup())
+	return nil
+}
+
+func (s *testRulesServer) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func TestRulesServer(t *testing.T) {
+	recordingExpr, err := parser.ParseExpr(`sum by (job) (rate(requests_total[5m]))`)
+	require.NoError(t, err)
+	alertingExpr, err := parser.ParseExpr(`up == 0`)
+	require.NoError(t, err)
+	db := promscale_promql.NewTestStorage(t)
+	t.Cleanup(func() { require.NoError(t, db.Close()) })
+	group := prom_rules.NewGroup(prom_rules.GroupOptions{
+		Name:     "requests",
+		File:     "rules.yaml",
+		Interval: time.Minute,
+		Rules: []prom_rules.Rule{
+			prom_rules.NewRecordingRule("job:requests:rate5m", recordingExpr, labels.FromStrings("team", "api")),
+			prom_rules.NewAlertingRule("InstanceDown", alertingExpr, 0, labels.FromStrings("severity", "page"), nil, nil, "", true, log.NewNopLogger()),
+		},
+		Opts: &prom_rules.ManagerOptions{
+			QueryFunc: func(_ context.Context, _ string, ts time.Time) (promql.Vector, error) {
+				return promql.Vector{{Point: promql.Point{T: ts.UnixMilli(), V: 0}, Metric: labels.FromStrings("instance", "a")}}, nil
+			},
+			Appendable: db,
+			Context:    context.Background(),
+			Logger:     log.NewNopLogger(),
+			NotifyFunc: func(context.Context, string, ...*prom_rules.Alert) {},
+		},
+	})
+	group.Eval(context.Background(), time.Unix(600, 0))
+
+	store := NewStorage(&testQueryables{}, nil, Config{ExternalLabels: labels.FromStrings("cluster", "eu1")})
+	server := NewRulesServer(store, testRuleGroups{group})
+
+	t.Run("all rules", func(t *testing.T) {
+		srv := &testRulesServer{}
+		require.NoError(t, server.Rules(&rulespb.RulesRequest{}, srv))
+		require.Len(t, srv.groups, 1)
+		require.Equal(t, "requests", srv.groups[0].Name)
+		require.Equal(t, "rules.yaml", srv.groups[0].File)
+		require.Equal(t, float64(60), srv.groups[0].Interval)
+		require.Len(t, srv.groups[0].Rules, 2)
+
+		recording := srv.groups[0].Rules[0].GetRecording()
+		require.Equal(t, "job:requests:rate5m", recording.Name)
+		require.Equal(t, recordingExpr.String(), recording.Query)
+		require.Equal(t, labels.FromStrings("cluster", "eu1", "team", "api"), recording.Labels.PromLabels())
+		require.Equal(t, "ok", recording.Health)
+
+		alert := srv.groups[0].Rules[1].GetAlert()
+		require.Equal(t, "InstanceDown", alert.Name)
+		require.Equal(t, rulespb.AlertState_FIRING, alert.State)
+		require.Equal(t, labels.FromStrings("cluster", "eu1", "severity", "page"), alert.Labels.PromLabels())
+		require.Len(t, alert.Alerts, 1)
+		require.Equal(t, rulespb.AlertState_FIRING, alert.Alerts[0].State)
+		require.Equal(t, labels.FromStrings("alertname", "InstanceDown", "cluster", "eu1", "instance", "a", "severity", "page"), alert.Alerts[0].Labels.PromLabels())
+		require.Equal(t, time.Unix(600, 0), alert.Alerts[0].ActiveAt.Local())
+	})
+
+	t.Run("rule type", func(t *testing.T) {
+		srv := &testRulesServer{}
+		require.NoError(t, server.Rules(&rulespb.RulesRequest{Type: rulespb.RulesRequest_RECORD}, srv))
+		require.Len(t, srv.groups, 1)
+		require.Len(t, srv.groups[0].Rules, 1)
+		require.NotNil(t, srv.groups[0].Rules[0].GetRecording())
+	})
+
+	t.Run("matchers", func(t *testing.T) {
+		srv := &testRulesServer{}
+		require.NoError(t, server.Rules(&rulespb.RulesRequest{MatcherString: []string{`{severity="page"}`, `{team="db"}`}}, srv))
+		require.Len(t, srv.groups, 1)
+		require.Len(t, srv.groups[0].Rules, 1)
+		require.Equal(t, "InstanceDown", srv.groups[0].Rules[0].GetName())
+
+		srv = &testRulesServer{}
+		require.NoError(t, server.Rules(&rulespb.RulesRequest{MatcherString: []string{`{team="db"}`}}, srv))
+		require.Empty(t, srv.groups)
+
+		require.Error(t, server.Rules(&rulespb.RulesRequest{MatcherString: []string{`{team=`}}, &testRulesServer{}))
+	})
+
+	t.Run("tenant", func(t *testing.T) {
+		tenantGroup := prom_rules.NewGroup(prom_rules.GroupOptions{
+			Name:     "requests",
+			File:     "team-a.yaml",
+			Interval: time.Minute,
+			Rules: []prom_rules.Rule{
+				prom_rules.NewRecordingRule("job:requests:rate5m", recordingExpr, nil),
+			},
+			Opts: &prom_rules.ManagerOptions{Context: context.Background(), Logger: log.NewNopLogger()},
+		})
+		server := NewRulesServer(store, testRuleGroups{group, tenantGroup})
+
+		srv := &testRulesServer{ctx: tenancy.WithTenant(context.Background(), "team-a")}
+		require.NoError(t, server.Rules(&rulespb.RulesRequest{}, srv))
+		require.Len(t, srv.groups, 1)
+		require.Equal(t, "team-a.yaml", srv.groups[0].File)
+
+		srv = &testRulesServer{ctx: tenancy.WithTenant(context.Background(), "team-b")}
+		require.NoError(t, server.Rules(&rulespb.RulesRequest{}, srv))
+		require.Empty(t, srv.groups)
+
+		srv = &testRulesServer{}
+		require.NoError(t, server.Rules(&rulespb.RulesRequest{}, srv))
+		require.Len(t, srv.groups, 1)
+		require.Equal(t, "rules.yaml", srv.groups[0].File)
+	})
+}
@@ -1,155 +1,375 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
 package thanos
 
 import (
 	"context"
-	"time"
+	"fmt"
+	"math"
+	"sort"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/prometheus/prometheus/model/labels"
-	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/storage"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/timescale/promscale/pkg/log"
+	pgquerier "github.com/timescale/promscale/pkg/pgmodel/querier"
+	"github.com/timescale/promscale/pkg/pgxconn"
 	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/tenancy"
 )
 
+// selectTimeRangeSQL returns the time range of the chunks of the metric tables, in
+// microseconds since the Unix epoch.
+const selectTimeRangeSQL = `SELECT min(ds.range_start), max(ds.range_end)
+	FROM _timescaledb_catalog.dimension_slice ds
+	INNER JOIN _timescaledb_catalog.dimension d ON (d.id = ds.dimension_id)
+	INNER JOIN _timescaledb_catalog.hypertable h ON (h.id = d.hypertable_id)
+	INNER JOIN _prom_catalog.metric m ON (m.table_name = h.table_name AND m.table_schema = h.schema_name)
+	INNER JOIN _timescaledb_catalog.chunk_constraint cc ON (cc.dimension_slice_id = ds.id)
+	INNER JOIN _timescaledb_catalog.chunk c ON (c.id = cc.chunk_id)
+	WHERE d.interval_length IS NOT NULL AND NOT c.dropped`
+
+// Queryables provides the queryables the Store API reads the series from.
+type Queryables interface {
+	// Queryable returns the queryable of the requests without a tenant.
+	Queryable() promql.Queryable
+	// TenantQueryable returns a queryable that only reads the series of the tenant.
+	TenantQueryable(tenant string) (promql.Queryable, error)
+}
+
+// Storage implements the Thanos Store API on top of the Promscale database.
 type Storage struct {
-	queryable promql.Queryable
+	queryables     Queryables
+	conn           pgxconn.PgxConn
+	externalLabels labels.Labels
 }
 
-func NewStorage(queryable promql.Queryable) *Storage {
+func NewStorage(queryables Queryables, conn pgxconn.PgxConn, cfg Config) *Storage {
 	return &Storage{
-		queryable: queryable,
+		queryables:     queryables,
+		conn:           conn,
+		externalLabels: cfg.ExternalLabels,
 	}
 }
 
-func (fc *Storage) Info(ctx context.Context, req *storepb.InfoRequest) (*storepb.InfoResponse, error) {
-	return &storepb.InfoResponse{
-		MinTime:   0,
-		MaxTime:   time.Now().UnixNano() / 1000,
+// Info returns the external labels and the time range of the stored series. The time
+// range is the one of the chunks of the metric tables, which may start before the
+// oldest sample and end after the newest one.
+func (fc *Storage) Info(ctx context.Context, _ *storepb.InfoRequest) (*storepb.InfoResponse, error) {
+	minTime, maxTime, err := fc.timeRange(ctx)
+	if err != nil {
+		log.Warn("msg", "Failed to get the time range of the Thanos Store API", "err", err)
+		minTime, maxTime = math.MinInt64, math.MaxInt64
+	}
+	resp := &storepb.InfoResponse{
+		Labels:    labelpb.ZLabelsFromPromLabels(fc.externalLabels),
+		MinTime:   minTime,
+		MaxTime:   maxTime,
 		StoreType: storepb.StoreType_STORE,
-	}, nil
+	}
+	if len(fc.externalLabels) > 0 {
+		resp.LabelSets = []labelpb.ZLabelSet{{Labels: resp.Labels}}
+	}
+	return resp, nil
+}
+
+// timeRange returns the time range of the stored series in milliseconds. Without any
+// series, the range is empty: its min time is after its max time.
+func (fc *Storage) timeRange(ctx context.Context) (int64, int64, error) {
+	if fc.conn == nil {
+		return math.MinInt64, math.MaxInt64, nil
+	}
+	var start, end pgtype.Int8
+	if err := fc.conn.QueryRow(ctx, selectTimeRangeSQL).Scan(&start, &end); err != nil {
+		return 0, 0, fmt.Errorf("querying the time range of the metric chunks: %w", err)
+	}
+	if !start.Valid || !end.Valid {
+		return math.MaxInt64, math.MinInt64, nil
+	}
+	minTime, maxTime := int64(math.MinInt64), int64(math.MaxInt64)
+	if start.Int64 != math.MinInt64 {
+		minTime = start.Int64 / 1000
+	}
+	if end.Int64 != math.MaxInt64 {
+		// The end of a chunk is exclusive.
+		maxTime = (end.Int64 - 1) / 1000
+	}
+	return minTime, maxTime, nil
 }
 
 func (fc *Storage) Series(req *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
-	matchers, err := getMatchers(req.Matchers)
+	ctx := srv.Context()
+	match, matchers, err := fc.matchers(req.Matchers)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return nil
+	}
+	if len(matchers) == 0 {
+		return status.Error(codes.InvalidArgument, "no matchers specified (excluding external labels)")
+	}
+	queryable, err := fc.queryable(ctx)
 	if err != nil {
 		return err
 	}
-
-	q, err := fc.queryable.SamplesQuerier(srv.Context(), req.MinTime, req.MaxTime)
+	q, err := queryable.SamplesQuerier(ctx, req.MinTime, req.MaxTime)
 	if err != nil {
 		return err
 	}
 	defer q.Close()
 
-	ss, _ := q.Select(false, nil, nil, nil, matchers...)
-
+	hints := &storage.SelectHints{Start: req.MinTime, End: req.MaxTime}
+	if req.SkipChunks {
+		hints.Func = pgquerier.SeriesFunc
+	}
+	ss, _ := q.Select(true, hints, nil, nil, matchers...)
+
+	// Adding the external labels can change the order of the series, so the series
+	// are sorted again before they are sent.
+	var (
+		buffered []*storepb.Series
+		send     = func(s *storepb.Series) error {
+			return srv.Send(storepb.NewSeriesResponse(s))
+		}
+	)
+	if len(fc.externalLabels) > 0 {
+		send = func(s *storepb.Series) error {
+			buffered = append(buffered, s)
+			return nil
+		}
+	}
+	resolution := downsampleResolution(req.MaxResolutionWindow)
 	for ss.Next() {
 		series := ss.At()
-		lbls := series.Labels()
-
-		s := storepb.Series{Labels: make([]labelpb.ZLabel, 0, len(lbls))}
-		for _, lbl := range lbls {
-			s.Labels = append(s.Labels, labelpb.ZLabel(lbl))
+		s := &storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(fc.withExternalLabels(series.Labels()))}
+		if !req.SkipChunks {
+			var samples []sample
+			it := series.Iterator()
+			for it.Next() {
+				t, v := it.At()
+				samples = append(samples, sample{t, v})
+			}
+			if err := it.Err(); err != nil {
+				return err
+			}
+			if resolution > 0 && requestsAggregates(req.Aggregates) {
+				s.Chunks = downsampledChunks(samples, resolution, req.Aggregates)
+			} else {
+				s.Chunks = rawChunks(samples)
+			}
 		}
-
-		chunk := chunkenc.NewXORChunk()
-		appender, err := chunk.Appender()
-		if err != nil {
+		if err := send(s); err != nil {
 			return err
 		}
-
-		var minTime, maxTime int64
-
-		si := series.Iterator()
-
-		for si.Next() {
-			t, v := si.At()
-			if minTime == 0 {
-				minTime = t
-			}
-			maxTime = t
-
-			appender.Append(t, v)
+	}
+	if err := ss.Err(); err != nil {
+		return err
+	}
+	for _, w := range ss.Warnings() {
+		if err := srv.Send(storepb.NewWarnSeriesResponse(w)); err != nil {
+			return err
 		}
+	}
 
-		s.Chunks = append(
-			s.Chunks,
-			storepb.AggrChunk{
-				MinTime: minTime,
-				MaxTime: maxTime,
-				Raw: &storepb.Chunk{
-					Type: storepb.Chunk_Encoding(chunk.Encoding() - 1),
-					Data: chunk.Bytes(),
-				},
-			},
-		)
-
-		seriesResponse := storepb.NewSeriesResponse(&s)
-
-		if err := srv.Send(seriesResponse); err != nil {
+	sort.Slice(buffered, func(i, j int) bool {
+		return labels.Compare(buffered[i].PromLabels(), buffered[j].PromLabels()) < 0
+	})
+	for _, s := range buffered {
+		if err := srv.Send(storepb.NewSeriesResponse(s)); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
+// requestsAggregates tells if a request for downsampled series asks for any aggregate
+// besides the raw samples.
+func requestsAggregates(aggrs []storepb.Aggr) bool {
+	for _, aggr := range aggrs {
+		if aggr != storepb.Aggr_RAW {
+			return true
+		}
+	}
+	return false
+}
+
 func (fc *Storage) LabelNames(ctx context.Context, req *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
-	q, err := fc.queryable.SamplesQuerier(ctx, req.Start, req.End)
+	match, matchers, err := fc.matchers(req.Matchers)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return &storepb.LabelNamesResponse{}, nil
+	}
+	queryable, err := fc.queryable(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer q.Close()
-
-	names, warnings, err := q.LabelNames()
+	q, err := queryable.SamplesQuerier(ctx, req.Start, req.End)
 	if err != nil {
 		return nil, err
 	}
+	defer q.Close()
 
-	resp := &storepb.LabelNamesResponse{
-		Names: names,
+	resp := &storepb.LabelNamesResponse{}
+	var names []string
+	if len(matchers) == 0 {
+		var warnings storage.Warnings
+		names, warnings, err = q.LabelNames()
+		if err != nil {
+			return nil, err
+		}
+		resp.Warnings = warningStrings(warnings)
+	} else {
+		set := make(map[string]struct{})
+		warnings, err := selectLabels(q, req.Start, req.End, matchers, func(lset labels.Labels) {
+			for _, l := range lset {
+				set[l.Name] = struct{}{}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		for name := range set {
+			names = append(names, name)
+		}
+		resp.Warnings = warningStrings(warnings)
 	}
-
-	for _, w := range warnings {
-		resp.Warnings = append(resp.Warnings, w.Error())
+	for _, l := range fc.externalLabels {
+		names = append(names, l.Name)
 	}
-
+	resp.Names = sortedUnique(names)
 	return resp, nil
 }
 
 func (fc *Storage) LabelValues(ctx context.Context, req *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
-	q, err := fc.queryable.SamplesQuerier(ctx, req.Start, req.End)
+	match, matchers, err := fc.matchers(req.Matchers)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return &storepb.LabelValuesResponse{}, nil
+	}
+	if value := fc.externalLabels.Get(req.Label); value != "" {
+		return &storepb.LabelValuesResponse{Values: []string{value}}, nil
+	}
+	queryable, err := fc.queryable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q, err := queryable.SamplesQuerier(ctx, req.Start, req.End)
 	if err != nil {
 		return nil, err
 	}
 	defer q.Close()
 
-	values, warnings, err := q.LabelValues(req.Label)
+	resp := &storepb.LabelValuesResponse{}
+	if len(matchers) == 0 {
+		values, warnings, err := q.LabelValues(req.Label)
+		if err != nil {
+			return nil, err
+		}
+		resp.Values = values
+		resp.Warnings = warningStrings(warnings)
+		return resp, nil
+	}
+	var values []string
+	warnings, err := selectLabels(q, req.Start, req.End, matchers, func(lset labels.Labels) {
+		if value := lset.Get(req.Label); value != "" {
+			values = append(values, value)
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
+	resp.Values = sortedUnique(values)
+	resp.Warnings = warningStrings(warnings)
+	return resp, nil
+}
 
-	resp := &storepb.LabelValuesResponse{
-		Values: values,
+// matchers returns the matchers of the request to select the series with. It returns
+// false if the matchers do not match the external labels, in which case no series
+// match. The matchers of the external labels are left out.
+func (fc *Storage) matchers(ms []storepb.LabelMatcher) (bool, []*labels.Matcher, error) {
+	matchers, err := storepb.MatchersToPromMatchers(ms...)
+	if err != nil {
+		return false, nil, err
 	}
+	selectMatchers := matchers[:0]
+	for _, m := range matchers {
+		value := fc.externalLabels.Get(m.Name)
+		if value == "" {
+			selectMatchers = append(selectMatchers, m)
+			continue
+		}
+		if !m.Matches(value) {
+			return false, nil, nil
+		}
+	}
+	return true, selectMatchers, nil
+}
 
-	for _, w := range warnings {
-		resp.Warnings = append(resp.Warnings, w.Error())
+// queryable returns the queryable of the tenant of the request, if any.
+func (fc *Storage) queryable(ctx context.Context) (promql.Queryable, error) {
+	tenant := tenancy.TenantFromContext(ctx)
+	if tenant == "" {
+		return fc.queryables.Queryable(), nil
 	}
+	queryable, err := fc.queryables.TenantQueryable(tenant)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return queryable, nil
+}
 
-	return resp, nil
+// withExternalLabels adds the external labels to the labels of a series, replacing
+// the series labels of the same name.
+func (fc *Storage) withExternalLabels(lset labels.Labels) labels.Labels {
+	if len(fc.externalLabels) == 0 {
+		return lset
+	}
+	b := labels.NewBuilder(lset)
+	for _, l := range fc.externalLabels {
+		b.Set(l.Name, l.Value)
+	}
+	return b.Labels(nil)
 }
 
-func getMatchers(labelMatchers []storepb.LabelMatcher) ([]*labels.Matcher, error) {
-	matchers := make([]*labels.Matcher, 0, len(labelMatchers))
-	for _, labelMatcher := range labelMatchers {
-		m, err := labels.NewMatcher(labels.MatchType(labelMatcher.Type), labelMatcher.Name, labelMatcher.Value)
-		if err != nil {
-			return nil, err
-		}
+// selectLabels calls f with the labels of each series matching the matchers.
+func selectLabels(q promql.SamplesQuerier, start, end int64, matchers []*labels.Matcher, f func(labels.Labels)) (storage.Warnings, error) {
+	ss, _ := q.Select(false, &storage.SelectHints{Start: start, End: end, Func: pgquerier.SeriesFunc}, nil, nil, matchers...)
+	for ss.Next() {
+		f(ss.At().Labels())
+	}
+	if err := ss.Err(); err != nil {
+		return nil, err
+	}
+	return ss.Warnings(), nil
+}
 
-		matchers = append(matchers, m)
+func sortedUnique(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			unique = append(unique, v)
+		}
 	}
+	return unique
+}
 
-	return matchers, nil
+func warningStrings(warnings storage.Warnings) []string {
+	var ws []string
+	for _, w := range warnings {
+		ws = append(ws, w.Error())
+	}
+	return ws
 }
@@ -0,0 +1,285 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package thanos
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"google.golang.org/grpc"
+
+	"github.com/timescale/promscale/pkg/promql"
+	"github.com/timescale/promscale/pkg/tenancy"
+)
+
+type testQueryables struct {
+	queryable promql.Queryable
+	tenants   []string
+}
+
+func (q *testQueryables) Queryable() promql.Queryable {
+	return q.queryable
+}
+
+func (q *testQueryables) TenantQueryable(tenant string) (promql.Queryable, error) {
+	q.tenants = append(q.tenants, tenant)
+	return q.queryable, nil
+}
+
+type testSeriesServer struct {
+	grpc.ServerStream
+	ctx      context.Context
+	series   []*storepb.Series
+	warnings []string
+}
+
+func (s *testSeriesServer) Send(resp *storepb.SeriesResponse) error {
+	if series := resp.GetSeries(); series != nil {
+		s.series = append(s.series, series)
+	} else {
+		s.warnings = append(s.warnings, resp.GetWarning())
+	}
+	return nil
+}
+
+func (s *testSeriesServer) Context() context.Context {
+	return s.ctx
+}
+
+func newTestStorage(t *testing.T, externalLabels labels.Labels) (*Storage, *testQueryables) {
+	db := promql.NewTestStorage(t)
+	t.Cleanup(func() { require.NoError(t, db.Close()) })
+
+	app := db.Appender(context.Background())
+	for _, instance := range []string{"a", "b"} {
+		lset := labels.FromStrings("__name__", "requests_total", "job", "api", "instance", instance)
+		// A sample every 15s for an hour.
+		for i := int64(0); i < 240; i++ {
+			_, err := app.Append(0, lset, i*15_000, float64(i))
+			require.NoError(t, err)
+		}
+	}
+	_, err := app.Append(0, labels.FromStrings("__name__", "up", "job", "db", "zone", "eu"), 0, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	queryables := &testQueryables{queryable: db}
+	return NewStorage(queryables, nil, Config{ExternalLabels: externalLabels}), queryables
+}
+
+func seriesLabels(series []*storepb.Series) []string {
+	var lsets []string
+	for _, s := range series {
+		lsets = append(lsets, s.PromLabels().String())
+	}
+	return lsets
+}
+
+func chunkSamples(t *testing.T, chk *storepb.Chunk) []sample {
+	c, err := chunkenc.FromData(chunkenc.EncXOR, chk.Data)
+	require.NoError(t, err)
+	var samples []sample
+	it := c.Iterator(nil)
+	for it.Next() {
+		ts, v := it.At()
+		samples = append(samples, sample{ts, v})
+	}
+	require.NoError(t, it.Err())
+	return samples
+}
+
+func TestSeries(t *testing.T) {
+	store, queryables := newTestStorage(t, nil)
+	srv := &testSeriesServer{ctx: tenancy.WithTenant(context.Background(), "team-a")}
+	err := store.Series(&storepb.SeriesRequest{
+		MinTime:  0,
+		MaxTime:  math.MaxInt64,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "job", Value: "api"}},
+	}, srv)
+	require.NoError(t, err)
+	require.Equal(t, []string{"team-a"}, queryables.tenants)
+	require.Equal(t, []string{
+		`{__name__="requests_total", instance="a", job="api"}`,
+		`{__name__="requests_total", instance="b", job="api"}`,
+	}, seriesLabels(srv.series))
+
+	// The samples are split into chunks of 120 samples.
+	chks := srv.series[0].Chunks
+	require.Len(t, chks, 2)
+	for i, chk := range chks {
+		samples := chunkSamples(t, chk.Raw)
+		require.Len(t, samples, maxSamplesPerChunk)
+		require.Equal(t, samples[0].t, chk.MinTime)
+		require.Equal(t, samples[len(samples)-1].t, chk.MaxTime)
+		require.Equal(t, int64(i*maxSamplesPerChunk*15_000), chk.MinTime)
+	}
+}
+
+func TestSeriesSkipChunks(t *testing.T) {
+	store, _ := newTestStorage(t, nil)
+	srv := &testSeriesServer{ctx: context.Background()}
+	err := store.Series(&storepb.SeriesRequest{
+		MinTime:    0,
+		MaxTime:    math.MaxInt64,
+		Matchers:   []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "job", Value: ".+"}},
+		SkipChunks: true,
+	}, srv)
+	require.NoError(t, err)
+	require.Len(t, srv.series, 3)
+	for _, s := range srv.series {
+		require.Empty(t, s.Chunks)
+	}
+}
+
+func TestSeriesExternalLabels(t *testing.T) {
+	store, _ := newTestStorage(t, labels.FromStrings("cluster", "eu1", "instance", "promscale"))
+
+	testCases := []struct {
+		name     string
+		matchers []storepb.LabelMatcher
+		expected []string
+		err      bool
+	}{
+		{
+			name: "matching external labels",
+			matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "cluster", Value: "eu1"},
+				{Type: storepb.LabelMatcher_RE, Name: "job", Value: "api|db"},
+			},
+			// The external labels replace the labels of the series, and the series
+			// are sorted with them.
+			expected: []string{
+				`{__name__="requests_total", cluster="eu1", instance="promscale", job="api"}`,
+				`{__name__="requests_total", cluster="eu1", instance="promscale", job="api"}`,
+				`{__name__="up", cluster="eu1", instance="promscale", job="db", zone="eu"}`,
+			},
+		},
+		{
+			name: "not matching external labels",
+			matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "cluster", Value: "us1"},
+				{Type: storepb.LabelMatcher_RE, Name: "job", Value: "api|db"},
+			},
+		},
+		{
+			name:     "only external labels",
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "cluster", Value: "eu1"}},
+			err:      true,
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := &testSeriesServer{ctx: context.Background()}
+			err := store.Series(&storepb.SeriesRequest{MinTime: 0, MaxTime: math.MaxInt64, Matchers: c.matchers, SkipChunks: true}, srv)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, seriesLabels(srv.series))
+		})
+	}
+}
+
+func TestSeriesDownsampled(t *testing.T) {
+	store, _ := newTestStorage(t, nil)
+	srv := &testSeriesServer{ctx: context.Background()}
+	err := store.Series(&storepb.SeriesRequest{
+		MinTime:             0,
+		MaxTime:             math.MaxInt64,
+		Matchers:            []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "instance", Value: "a"}},
+		MaxResolutionWindow: resLevel1,
+		Aggregates:          []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM},
+	}, srv)
+	require.NoError(t, err)
+	require.Len(t, srv.series, 1)
+	require.Len(t, srv.series[0].Chunks, 1)
+
+	chk := srv.series[0].Chunks[0]
+	require.Nil(t, chk.Raw)
+	require.Nil(t, chk.Min)
+	require.Nil(t, chk.Max)
+	require.Nil(t, chk.Counter)
+
+	// 12 windows of 5m with 20 samples each.
+	counts := chunkSamples(t, chk.Count)
+	sums := chunkSamples(t, chk.Sum)
+	require.Len(t, counts, 12)
+	require.Len(t, sums, 12)
+	for i := range counts {
+		end := int64(i+1)*resLevel1 - 1
+		if i == len(counts)-1 {
+			// The last window ends with the last sample.
+			end = 239 * 15_000
+		}
+		require.Equal(t, end, counts[i].t)
+		require.Equal(t, float64(20), counts[i].v)
+		first := float64(i * 20)
+		require.Equal(t, 20*first+190, sums[i].v, fmt.Sprintf("window %d", i))
+	}
+}
+
+func TestLabelNamesAndValues(t *testing.T) {
+	store, _ := newTestStorage(t, labels.FromStrings("cluster", "eu1"))
+	ctx := context.Background()
+
+	names, err := store.LabelNames(ctx, &storepb.LabelNamesRequest{
+		Start:    0,
+		End:      math.MaxInt64,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "job", Value: "db"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"__name__", "cluster", "job", "zone"}, names.Names)
+
+	values, err := store.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:    "instance",
+		Start:    0,
+		End:      math.MaxInt64,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "requests_total"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, values.Values)
+
+	values, err = store.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "cluster", Start: 0, End: math.MaxInt64})
+	require.NoError(t, err)
+	require.Equal(t, []string{"eu1"}, values.Values)
+
+	// No label matches the series of other clusters.
+	names, err = store.LabelNames(ctx, &storepb.LabelNamesRequest{
+		Start:    0,
+		End:      math.MaxInt64,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "cluster", Value: "us1"}},
+	})
+	require.NoError(t, err)
+	require.Empty(t, names.Names)
+}
+
+func TestInfo(t *testing.T) {
+	store, _ := newTestStorage(t, labels.FromStrings("cluster", "eu1"))
+	info, err := store.Info(context.Background(), &storepb.InfoRequest{})
+	require.NoError(t, err)
+	require.Equal(t, storepb.StoreType_STORE, info.StoreType)
+	require.Equal(t, labels.FromStrings("cluster", "eu1"), labelpb.ZLabelsToPromLabels(info.Labels))
+	require.Len(t, info.LabelSets, 1)
+	require.Equal(t, int64(math.MinInt64), info.MinTime)
+	require.Equal(t, int64(math.MaxInt64), info.MaxTime)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{externalLabels: "cluster=eu1, replica=a"}
+	require.NoError(t, Validate(cfg))
+	require.Equal(t, labels.FromStrings("cluster", "eu1", "replica", "a"), cfg.ExternalLabels)
+
+	for _, invalid := range []string{"cluster", "cluster=", "__name__=up", "1cluster=eu1"} {
+		require.Error(t, Validate(&Config{externalLabels: invalid}), invalid)
+	}
+}
@@ -0,0 +1,163 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package traceql implements a TraceQL-style span query language and its
+// compilation to SQL over the ps_trace schema.
+//
+// A query selects spans with span filters in braces, e.g.
+//
+//	{ resource.service.name = "frontend" && span.http.status_code >= 500 }
+//
+// that can be combined with the structural operators > (child), >> (descendant),
+// < (parent) and << (ancestor), and with && and || at the trace level.
+package traceql
+
+import (
+	"time"
+)
+
+// Operator is a comparison, logical or structural operator.
+type Operator int
+
+const (
+	OpEqual Operator = iota
+	OpNotEqual
+	OpRegex
+	OpNotRegex
+	OpGreater
+	OpGreaterEqual
+	OpLess
+	OpLessEqual
+	OpAnd
+	OpOr
+	OpNot
+	OpChild
+	OpDescendant
+	OpParent
+	OpAncestor
+)
+
+var operatorNames = map[Operator]string{
+	OpEqual:        "=",
+	OpNotEqual:     "!=",
+	OpRegex:        "=~",
+	OpNotRegex:     "!~",
+	OpGreater:      ">",
+	OpGreaterEqual: ">=",
+	OpLess:         "<",
+	OpLessEqual:    "<=",
+	OpAnd:          "&&",
+	OpOr:           "||",
+	OpNot:          "!",
+	OpChild:        ">",
+	OpDescendant:   ">>",
+	OpParent:       "<",
+	OpAncestor:     "<<",
+}
+
+func (o Operator) String() string {
+	return operatorNames[o]
+}
+
+// SpansetExpr is an expression selecting a set of spans.
+type SpansetExpr interface {
+	spansetExpr()
+}
+
+// SpansetFilter selects the spans matching Expr, or all the spans if Expr is nil.
+type SpansetFilter struct {
+	Expr FieldExpr
+}
+
+// SpansetOperation combines two spansets. For structural operators the result
+// is the spans of RHS with the given relation to a span of LHS, e.g. for
+// OpChild the spans of RHS whose parent is in LHS. For OpAnd and OpOr the
+// result is the spans of both sides, in the traces that match both or either
+// of them respectively.
+type SpansetOperation struct {
+	Op  Operator
+	LHS SpansetExpr
+	RHS SpansetExpr
+}
+
+func (*SpansetFilter) spansetExpr()    {}
+func (*SpansetOperation) spansetExpr() {}
+
+// FieldExpr is a condition on the fields of a single span.
+type FieldExpr interface {
+	fieldExpr()
+}
+
+// BinaryFieldExpr is the conjunction (OpAnd) or disjunction (OpOr) of two conditions.
+type BinaryFieldExpr struct {
+	Op  Operator
+	LHS FieldExpr
+	RHS FieldExpr
+}
+
+// NotFieldExpr negates a condition.
+type NotFieldExpr struct {
+	Expr FieldExpr
+}
+
+// Comparison compares a field of the span with a static value.
+type Comparison struct {
+	Field Field
+	Op    Operator
+	Value Static
+}
+
+func (*BinaryFieldExpr) fieldExpr() {}
+func (*NotFieldExpr) fieldExpr()    {}
+func (*Comparison) fieldExpr()      {}
+
+// Intrinsic is a field stored in a column of the span rather than in its tags.
+type Intrinsic int
+
+const (
+	IntrinsicNone Intrinsic = iota
+	IntrinsicName
+	IntrinsicStatus
+	IntrinsicKind
+	IntrinsicDuration
+)
+
+// Scope tells in which tags an attribute is looked up.
+type Scope int
+
+const (
+	// ScopeAny matches span or resource tags.
+	ScopeAny Scope = iota
+	ScopeSpan
+	ScopeResource
+)
+
+// Field is an intrinsic or an attribute of a span.
+type Field struct {
+	Intrinsic Intrinsic
+	Scope     Scope
+	// Name is the tag key of attributes.
+	Name string
+}
+
+// StaticType is the type of a static value.
+type StaticType int
+
+const (
+	TypeString StaticType = iota
+	TypeNumber
+	TypeBool
+	TypeDuration
+	// TypeEnum is an unquoted status or span kind, e.g. error or server.
+	TypeEnum
+)
+
+// Static is a literal value.
+type Static struct {
+	Type     StaticType
+	String   string
+	Number   float64
+	Bool     bool
+	Duration time.Duration
+}
@@ -0,0 +1,214 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package traceql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenOpenBrace
+	tokenCloseBrace
+	tokenOpenParen
+	tokenCloseParen
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenEq
+	tokenNotEq
+	tokenRegex
+	tokenNotRegex
+	tokenGreater
+	tokenGreaterEq
+	tokenLess
+	tokenLessEq
+	tokenDescendant
+	tokenAncestor
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenDuration
+)
+
+var tokenNames = map[tokenType]string{
+	tokenEOF:        "end of query",
+	tokenOpenBrace:  "{",
+	tokenCloseBrace: "}",
+	tokenOpenParen:  "(",
+	tokenCloseParen: ")",
+	tokenAnd:        "&&",
+	tokenOr:         "||",
+	tokenNot:        "!",
+	tokenEq:         "=",
+	tokenNotEq:      "!=",
+	tokenRegex:      "=~",
+	tokenNotRegex:   "!~",
+	tokenGreater:    ">",
+	tokenGreaterEq:  ">=",
+	tokenLess:       "<",
+	tokenLessEq:     "<=",
+	tokenDescendant: ">>",
+	tokenAncestor:   "<<",
+	tokenIdentifier: "identifier",
+	tokenString:     "string",
+	tokenNumber:     "number",
+	tokenDuration:   "duration",
+}
+
+func (t tokenType) String() string {
+	return tokenNames[t]
+}
+
+type token struct {
+	typ tokenType
+	// text is the unquoted value of strings and the raw text of any other token.
+	text     string
+	number   float64
+	duration time.Duration
+	pos      int
+}
+
+// operators are matched longest first.
+var operators = []struct {
+	text string
+	typ  tokenType
+}{
+	{"&&", tokenAnd},
+	{"||", tokenOr},
+	{"!=", tokenNotEq},
+	{"!~", tokenNotRegex},
+	{"=~", tokenRegex},
+	{">>", tokenDescendant},
+	{">=", tokenGreaterEq},
+	{"<<", tokenAncestor},
+	{"<=", tokenLessEq},
+	{"{", tokenOpenBrace},
+	{"}", tokenCloseBrace},
+	{"(", tokenOpenParen},
+	{")", tokenCloseParen},
+	{"!", tokenNot},
+	{"=", tokenEq},
+	{">", tokenGreater},
+	{"<", tokenLess},
+}
+
+// lex splits the query into tokens. The last token is always tokenEOF.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for {
+		for pos < len(input) {
+			r, size := utf8.DecodeRuneInString(input[pos:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			pos += size
+		}
+		if pos == len(input) {
+			return append(tokens, token{typ: tokenEOF, pos: pos}), nil
+		}
+
+		tok, n, err := lexToken(input[pos:], pos)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		pos += n
+	}
+}
+
+// lexToken returns the token at the start of rest and its length.
+func lexToken(rest string, pos int) (token, int, error) {
+	switch c := rest[0]; {
+	case c == '"' || c == '`':
+		n := stringLen(rest)
+		if n < 0 {
+			return token{}, 0, fmt.Errorf("unterminated string at position %d", pos)
+		}
+		s, err := strconv.Unquote(rest[:n])
+		if err != nil {
+			return token{}, 0, fmt.Errorf("invalid string at position %d: %w", pos, err)
+		}
+		return token{typ: tokenString, text: s, pos: pos}, n, nil
+	case isDigit(c) || (c == '-' && len(rest) > 1 && isDigit(rest[1])):
+		tok, err := lexNumber(rest, pos)
+		return tok, len(tok.text), err
+	case isIdentifierStart(c):
+		n := 1
+		for n < len(rest) && isIdentifierChar(rest[n]) {
+			n++
+		}
+		return token{typ: tokenIdentifier, text: rest[:n], pos: pos}, n, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op.text) {
+			return token{typ: op.typ, text: op.text, pos: pos}, len(op.text), nil
+		}
+	}
+	return token{}, 0, fmt.Errorf("unexpected character %q at position %d", rest[0], pos)
+}
+
+// stringLen returns the length of the quoted string at the start of s,
+// including the quotes, or -1 if it is not terminated.
+func stringLen(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// lexNumber lexes a number or, if it is followed by a unit, a duration.
+func lexNumber(rest string, pos int) (token, error) {
+	n := 0
+	if rest[0] == '-' {
+		n++
+	}
+	for n < len(rest) && (isDigit(rest[n]) || rest[n] == '.') {
+		n++
+	}
+	unit := n
+	for n < len(rest) && ((rest[n] >= 'a' && rest[n] <= 'z') || (rest[n] >= 'A' && rest[n] <= 'Z')) {
+		n++
+	}
+	text := rest[:n]
+	if unit < n {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return token{}, fmt.Errorf("invalid duration %q at position %d", text, pos)
+		}
+		return token{typ: tokenDuration, text: text, duration: d, pos: pos}, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return token{}, fmt.Errorf("invalid number %q at position %d", text, pos)
+	}
+	return token{typ: tokenNumber, text: text, number: f, pos: pos}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '.' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || isDigit(c) || c == '-' || c == '/' || c == ':'
+}
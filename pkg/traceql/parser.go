@@ -0,0 +1,351 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package traceql
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	spanScopePrefix     = "span."
+	resourceScopePrefix = "resource."
+)
+
+var (
+	intrinsics = map[string]Intrinsic{
+		"name":     IntrinsicName,
+		"status":   IntrinsicStatus,
+		"kind":     IntrinsicKind,
+		"duration": IntrinsicDuration,
+	}
+	statusValues = map[string]struct{}{"error": {}, "ok": {}, "unset": {}}
+	kindValues   = map[string]struct{}{
+		"unspecified": {}, "internal": {}, "server": {}, "client": {}, "producer": {}, "consumer": {},
+	}
+)
+
+// Parse parses a query.
+//
+// Precedence from lowest to highest, both between spansets and within a span
+// filter, is ||, && and then the structural operators, all left associative.
+func Parse(query string) (SpansetExpr, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseSpansetOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.typ != tokenEOF {
+		return nil, p.unexpected(tok, "end of query")
+	}
+	return expr, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.typ != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(typ tokenType) (token, error) {
+	tok := p.next()
+	if tok.typ != typ {
+		return tok, p.unexpected(tok, typ.String())
+	}
+	return tok, nil
+}
+
+func (p *parser) unexpected(tok token, expected string) error {
+	found := tok.typ.String()
+	if tok.typ == tokenIdentifier || tok.typ == tokenNumber || tok.typ == tokenDuration {
+		found = fmt.Sprintf("%q", tok.text)
+	}
+	return fmt.Errorf("unexpected %s at position %d, expected %s", found, tok.pos, expected)
+}
+
+func (p *parser) parseSpansetOr() (SpansetExpr, error) {
+	lhs, err := p.parseSpansetAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenOr {
+		p.next()
+		rhs, err := p.parseSpansetAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &SpansetOperation{Op: OpOr, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseSpansetAnd() (SpansetExpr, error) {
+	lhs, err := p.parseSpansetStructural()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenAnd {
+		p.next()
+		rhs, err := p.parseSpansetStructural()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &SpansetOperation{Op: OpAnd, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+var structuralOperators = map[tokenType]Operator{
+	tokenGreater:    OpChild,
+	tokenDescendant: OpDescendant,
+	tokenLess:       OpParent,
+	tokenAncestor:   OpAncestor,
+}
+
+func (p *parser) parseSpansetStructural() (SpansetExpr, error) {
+	lhs, err := p.parseSpansetPrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := structuralOperators[p.peek().typ]
+		if !ok {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseSpansetPrimary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &SpansetOperation{Op: op, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) parseSpansetPrimary() (SpansetExpr, error) {
+	switch tok := p.next(); tok.typ {
+	case tokenOpenParen:
+		expr, err := p.parseSpansetOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokenCloseParen); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case tokenOpenBrace:
+		if p.peek().typ == tokenCloseBrace {
+			p.next()
+			return &SpansetFilter{}, nil
+		}
+		expr, err := p.parseFieldOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokenCloseBrace); err != nil {
+			return nil, err
+		}
+		return &SpansetFilter{Expr: expr}, nil
+	default:
+		return nil, p.unexpected(tok, "{ or (")
+	}
+}
+
+func (p *parser) parseFieldOr() (FieldExpr, error) {
+	lhs, err := p.parseFieldAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenOr {
+		p.next()
+		rhs, err := p.parseFieldAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryFieldExpr{Op: OpOr, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseFieldAnd() (FieldExpr, error) {
+	lhs, err := p.parseFieldUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenAnd {
+		p.next()
+		rhs, err := p.parseFieldUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryFieldExpr{Op: OpAnd, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseFieldUnary() (FieldExpr, error) {
+	switch p.peek().typ {
+	case tokenNot:
+		p.next()
+		expr, err := p.parseFieldUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotFieldExpr{Expr: expr}, nil
+	case tokenOpenParen:
+		p.next()
+		expr, err := p.parseFieldOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokenCloseParen); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	default:
+		return p.parseComparison()
+	}
+}
+
+var comparisonOperators = map[tokenType]Operator{
+	tokenEq:        OpEqual,
+	tokenNotEq:     OpNotEqual,
+	tokenRegex:     OpRegex,
+	tokenNotRegex:  OpNotRegex,
+	tokenGreater:   OpGreater,
+	tokenGreaterEq: OpGreaterEqual,
+	tokenLess:      OpLess,
+	tokenLessEq:    OpLessEqual,
+}
+
+func (p *parser) parseComparison() (FieldExpr, error) {
+	fieldTok, err := p.expect(tokenIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	field, err := parseField(fieldTok)
+	if err != nil {
+		return nil, err
+	}
+
+	opTok := p.next()
+	op, ok := comparisonOperators[opTok.typ]
+	if !ok {
+		return nil, p.unexpected(opTok, "comparison operator")
+	}
+
+	valueTok := p.next()
+	var value Static
+	switch valueTok.typ {
+	case tokenString:
+		value = Static{Type: TypeString, String: valueTok.text}
+	case tokenNumber:
+		value = Static{Type: TypeNumber, Number: valueTok.number}
+	case tokenDuration:
+		value = Static{Type: TypeDuration, Duration: valueTok.duration}
+	case tokenIdentifier:
+		switch valueTok.text {
+		case "true", "false":
+			value = Static{Type: TypeBool, Bool: valueTok.text == "true"}
+		default:
+			value = Static{Type: TypeEnum, String: valueTok.text}
+		}
+	default:
+		return nil, p.unexpected(valueTok, "value")
+	}
+
+	cmp := &Comparison{Field: field, Op: op, Value: value}
+	if err = validateComparison(cmp); err != nil {
+		return nil, fmt.Errorf("invalid comparison at position %d: %w", fieldTok.pos, err)
+	}
+	return cmp, nil
+}
+
+func parseField(tok token) (Field, error) {
+	name := tok.text
+	switch {
+	case strings.HasPrefix(name, spanScopePrefix):
+		return attributeField(ScopeSpan, strings.TrimPrefix(name, spanScopePrefix), tok)
+	case strings.HasPrefix(name, resourceScopePrefix):
+		return attributeField(ScopeResource, strings.TrimPrefix(name, resourceScopePrefix), tok)
+	case strings.HasPrefix(name, "."):
+		return attributeField(ScopeAny, strings.TrimPrefix(name, "."), tok)
+	}
+	if intrinsic, ok := intrinsics[name]; ok {
+		return Field{Intrinsic: intrinsic}, nil
+	}
+	return Field{}, fmt.Errorf("unknown field %q at position %d, attributes must start with span., resource. or .", name, tok.pos)
+}
+
+func attributeField(scope Scope, name string, tok token) (Field, error) {
+	if name == "" {
+		return Field{}, fmt.Errorf("missing attribute name at position %d", tok.pos)
+	}
+	return Field{Scope: scope, Name: name}, nil
+}
+
+func validateComparison(cmp *Comparison) error {
+	isEquality := cmp.Op == OpEqual || cmp.Op == OpNotEqual
+	isRegex := cmp.Op == OpRegex || cmp.Op == OpNotRegex
+
+	switch cmp.Field.Intrinsic {
+	case IntrinsicStatus, IntrinsicKind:
+		values := statusValues
+		if cmp.Field.Intrinsic == IntrinsicKind {
+			values = kindValues
+		}
+		if !isEquality {
+			return fmt.Errorf("only = and != are supported for status and kind")
+		}
+		if cmp.Value.Type != TypeEnum && cmp.Value.Type != TypeString {
+			return fmt.Errorf("status and kind must be compared with an identifier")
+		}
+		if _, ok := values[cmp.Value.String]; !ok {
+			return fmt.Errorf("unknown status or kind %q", cmp.Value.String)
+		}
+		return nil
+	case IntrinsicDuration:
+		if isRegex {
+			return fmt.Errorf("regular expressions are not supported for duration")
+		}
+		if cmp.Value.Type != TypeDuration {
+			return fmt.Errorf("duration must be compared with a duration, e.g. 100ms")
+		}
+		return nil
+	}
+
+	switch cmp.Value.Type {
+	case TypeEnum:
+		return fmt.Errorf("unknown value %q, strings must be quoted", cmp.Value.String)
+	case TypeDuration:
+		return fmt.Errorf("durations can only be compared with duration")
+	case TypeBool:
+		if !isEquality {
+			return fmt.Errorf("only = and != are supported for booleans")
+		}
+	case TypeNumber:
+		if isRegex {
+			return fmt.Errorf("regular expressions are only supported for strings")
+		}
+	}
+	if cmp.Field.Intrinsic == IntrinsicName && cmp.Value.Type != TypeString {
+		return fmt.Errorf("name must be compared with a string")
+	}
+	return nil
+}
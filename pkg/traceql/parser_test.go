@@ -0,0 +1,141 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package traceql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	str := func(s string) Static { return Static{Type: TypeString, String: s} }
+	enum := func(s string) Static { return Static{Type: TypeEnum, String: s} }
+	filter := func(expr FieldExpr) *SpansetFilter { return &SpansetFilter{Expr: expr} }
+
+	testCases := []struct {
+		query    string
+		expected SpansetExpr
+	}{
+		{
+			query:    "{}",
+			expected: &SpansetFilter{},
+		},
+		{
+			query: `{ .http.method = "GET" }`,
+			expected: filter(&Comparison{
+				Field: Field{Scope: ScopeAny, Name: "http.method"},
+				Op:    OpEqual,
+				Value: str("GET"),
+			}),
+		},
+		{
+			query: `{ span.http.status_code >= 500 && resource.service.name =~ "front.*" }`,
+			expected: filter(&BinaryFieldExpr{
+				Op:  OpAnd,
+				LHS: &Comparison{Field: Field{Scope: ScopeSpan, Name: "http.status_code"}, Op: OpGreaterEqual, Value: Static{Type: TypeNumber, Number: 500}},
+				RHS: &Comparison{Field: Field{Scope: ScopeResource, Name: "service.name"}, Op: OpRegex, Value: str("front.*")},
+			}),
+		},
+		{
+			query: `{ status = error || kind != server && !(duration < 1.5s) }`,
+			expected: filter(&BinaryFieldExpr{
+				Op:  OpOr,
+				LHS: &Comparison{Field: Field{Intrinsic: IntrinsicStatus}, Op: OpEqual, Value: enum("error")},
+				RHS: &BinaryFieldExpr{
+					Op:  OpAnd,
+					LHS: &Comparison{Field: Field{Intrinsic: IntrinsicKind}, Op: OpNotEqual, Value: enum("server")},
+					RHS: &NotFieldExpr{Expr: &Comparison{Field: Field{Intrinsic: IntrinsicDuration}, Op: OpLess, Value: Static{Type: TypeDuration, Duration: 1500 * time.Millisecond}}},
+				},
+			}),
+		},
+		{
+			query: `{ name != "GET /" && .error = true && .retries > -1 }`,
+			expected: filter(&BinaryFieldExpr{
+				Op: OpAnd,
+				LHS: &BinaryFieldExpr{
+					Op:  OpAnd,
+					LHS: &Comparison{Field: Field{Intrinsic: IntrinsicName}, Op: OpNotEqual, Value: str("GET /")},
+					RHS: &Comparison{Field: Field{Name: "error"}, Op: OpEqual, Value: Static{Type: TypeBool, Bool: true}},
+				},
+				RHS: &Comparison{Field: Field{Name: "retries"}, Op: OpGreater, Value: Static{Type: TypeNumber, Number: -1}},
+			}),
+		},
+		{
+			query: `{ kind = server } > { kind = client } >> {} || { status = error } && ({} << {})`,
+			expected: &SpansetOperation{
+				Op: OpOr,
+				LHS: &SpansetOperation{
+					Op: OpDescendant,
+					LHS: &SpansetOperation{
+						Op:  OpChild,
+						LHS: filter(&Comparison{Field: Field{Intrinsic: IntrinsicKind}, Op: OpEqual, Value: enum("server")}),
+						RHS: filter(&Comparison{Field: Field{Intrinsic: IntrinsicKind}, Op: OpEqual, Value: enum("client")}),
+					},
+					RHS: &SpansetFilter{},
+				},
+				RHS: &SpansetOperation{
+					Op:  OpAnd,
+					LHS: filter(&Comparison{Field: Field{Intrinsic: IntrinsicStatus}, Op: OpEqual, Value: enum("error")}),
+					RHS: &SpansetOperation{Op: OpAncestor, LHS: &SpansetFilter{}, RHS: &SpansetFilter{}},
+				},
+			},
+		},
+		{
+			query:    "{ .path = `C:\\tmp` } < {}",
+			expected: &SpansetOperation{Op: OpParent, LHS: filter(&Comparison{Field: Field{Name: "path"}, Op: OpEqual, Value: str(`C:\tmp`)}), RHS: &SpansetFilter{}},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.query, func(t *testing.T) {
+			expr, err := Parse(c.query)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, expr)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := map[string]string{
+		"":                          "unexpected end of query at position 0, expected { or (",
+		"{":                         "unexpected end of query at position 1, expected identifier",
+		`{ .foo = "bar" `:           "unexpected end of query at position 15, expected }",
+		`{ .foo = "bar }`:           "unterminated string at position 9",
+		`{ foo = "bar" }`:           `unknown field "foo" at position 2, attributes must start with span., resource. or .`,
+		`{ span. = "bar" }`:         "missing attribute name at position 2",
+		`{ .foo "bar" }`:            "unexpected string at position 7, expected comparison operator",
+		`{ .foo = bar }`:            `invalid comparison at position 2: unknown value "bar", strings must be quoted`,
+		`{ .foo =~ 5 }`:             "invalid comparison at position 2: regular expressions are only supported for strings",
+		`{ .foo > true }`:           "invalid comparison at position 2: only = and != are supported for booleans",
+		`{ .foo = 5s }`:             "invalid comparison at position 2: durations can only be compared with duration",
+		`{ status = broken }`:       `invalid comparison at position 2: unknown status or kind "broken"`,
+		`{ kind > server }`:         "invalid comparison at position 2: only = and != are supported for status and kind",
+		`{ duration > 5 }`:          "invalid comparison at position 2: duration must be compared with a duration, e.g. 100ms",
+		`{ name = 5 }`:              "invalid comparison at position 2: name must be compared with a string",
+		`{ duration > 5parsecs }`:   `invalid duration "5parsecs" at position 13`,
+		`{} {}`:                     "unexpected { at position 3, expected end of query",
+		`{ .foo = "bar" } > `:       "unexpected end of query at position 19, expected { or (",
+		`{ .foo = "bar" } # {}`:     "unexpected character '#' at position 17",
+		`({ .foo = "bar" }`:         "unexpected end of query at position 17, expected )",
+		`{ (.foo = "bar" }`:         "unexpected } at position 16, expected )",
+		`{ .foo = "bar" } >> .foo`:  `unexpected ".foo" at position 20, expected { or (`,
+		`{ .foo = "bar" && }`:       "unexpected } at position 18, expected identifier",
+		`{ .foo = "a\q" }`:          "invalid string at position 9: invalid syntax",
+		`{ .foo = 1.2.3 }`:          `invalid number "1.2.3" at position 9`,
+		`{ .foo != "a" } =~ { }`:    "unexpected =~ at position 16, expected end of query",
+		`{ resource. = "bar" }`:     "missing attribute name at position 2",
+		`{ .foo = "bar" } > ( {} `:  "unexpected end of query at position 24, expected )",
+		`{ .foo = "bar" } && { ! }`: "unexpected } at position 24, expected identifier",
+	}
+
+	for query, expectedErr := range testCases {
+		t.Run(query, func(t *testing.T) {
+			_, err := Parse(query)
+			require.EqualError(t, err, expectedErr)
+		})
+	}
+}
@@ -0,0 +1,305 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package traceql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// spansetColumns are the columns of every spanset subquery.
+	spansetColumns = "trace_id, span_id, parent_span_id, start_time"
+
+	spanFilterFormat = `
+	SELECT s.trace_id, s.span_id, s.parent_span_id, s.start_time
+	FROM _ps_trace.span s
+	INNER JOIN _ps_trace.operation o ON (s.operation_id = o.id)
+	WHERE %s`
+
+	// ancestorsFormat is a recursive query returning all the ancestors of the
+	// spans of a spanset, as (trace_id, origin_id, ancestor_id) rows. UNION
+	// removes duplicates, so it terminates even if parent links form a cycle.
+	ancestorsFormat = `
+	SELECT r.trace_id, r.span_id AS origin_id, r.parent_span_id AS ancestor_id
+	FROM %[1]s r
+	WHERE r.parent_span_id IS NOT NULL
+	UNION
+	SELECT a.trace_id, a.origin_id, p.parent_span_id
+	FROM %[2]s a
+	INNER JOIN _ps_trace.span p ON (p.trace_id = a.trace_id AND p.span_id = a.ancestor_id)
+	WHERE %[3]s`
+)
+
+// Options bound the spans scanned by a query.
+type Options struct {
+	// StartTimeMin and StartTimeMax bound the start time of the matching
+	// spans. The zero value leaves the bound open.
+	StartTimeMin time.Time
+	StartTimeMax time.Time
+	// MaxTraceDuration bounds how long before a span its ancestors started,
+	// when looking them up for the structural operators.
+	MaxTraceDuration time.Duration
+	// SpanFilter, if set, returns an additional condition on the spans of
+	// the given table alias, with its parameters appended to params.
+	SpanFilter func(alias string, params []interface{}) (string, []interface{})
+}
+
+// ToSQL compiles expr to a query returning the matching spans as
+// (trace_id, span_id, parent_span_id, start_time) rows. The placeholders of
+// the query are numbered after params, which is returned with the parameters
+// of the query appended.
+func ToSQL(expr SpansetExpr, opts Options, params []interface{}) (string, []interface{}, error) {
+	c := &compiler{opts: opts, params: params}
+	name, err := c.spanset(expr)
+	if err != nil {
+		return "", nil, err
+	}
+	recursive := ""
+	if c.recursive {
+		recursive = "RECURSIVE "
+	}
+	query := fmt.Sprintf("WITH %s%s\nSELECT %s FROM %s", recursive, strings.Join(c.ctes, ",\n"), spansetColumns, name)
+	return query, c.params, nil
+}
+
+type compiler struct {
+	opts      Options
+	params    []interface{}
+	ctes      []string
+	recursive bool
+}
+
+func (c *compiler) param(v interface{}) string {
+	c.params = append(c.params, v)
+	return fmt.Sprintf("$%d", len(c.params))
+}
+
+// nextName returns the name of the next common table expression.
+func (c *compiler) nextName() string {
+	return fmt.Sprintf("spanset_%d", len(c.ctes)+1)
+}
+
+// cte adds a common table expression and returns its name.
+func (c *compiler) cte(body string) string {
+	name := c.nextName()
+	c.ctes = append(c.ctes, fmt.Sprintf("%s AS (%s\n)", name, body))
+	return name
+}
+
+func (c *compiler) spanset(expr SpansetExpr) (string, error) {
+	switch e := expr.(type) {
+	case *SpansetFilter:
+		clauses := append(c.timeClauses("s", c.opts.StartTimeMin), c.spanFilter("s")...)
+		if e.Expr != nil {
+			cond, err := c.field(e.Expr)
+			if err != nil {
+				return "", err
+			}
+			clauses = append(clauses, cond)
+		}
+		if len(clauses) == 0 {
+			clauses = append(clauses, "TRUE")
+		}
+		return c.cte(fmt.Sprintf(spanFilterFormat, strings.Join(clauses, " AND "))), nil
+	case *SpansetOperation:
+		lhs, err := c.spanset(e.LHS)
+		if err != nil {
+			return "", err
+		}
+		rhs, err := c.spanset(e.RHS)
+		if err != nil {
+			return "", err
+		}
+		return c.spansetOperation(e.Op, lhs, rhs)
+	default:
+		return "", fmt.Errorf("unsupported spanset expression %T", expr)
+	}
+}
+
+func (c *compiler) spansetOperation(op Operator, lhs, rhs string) (string, error) {
+	var body string
+	switch op {
+	case OpOr:
+		body = fmt.Sprintf(`
+	SELECT %[1]s FROM %[2]s
+	UNION
+	SELECT %[1]s FROM %[3]s`, spansetColumns, lhs, rhs)
+	case OpAnd:
+		body = fmt.Sprintf(`
+	SELECT %[1]s FROM %[2]s WHERE trace_id IN (SELECT trace_id FROM %[3]s)
+	UNION
+	SELECT %[1]s FROM %[3]s WHERE trace_id IN (SELECT trace_id FROM %[2]s)`, spansetColumns, lhs, rhs)
+	case OpChild:
+		body = fmt.Sprintf(`
+	SELECT r.* FROM %[2]s r
+	WHERE EXISTS (SELECT 1 FROM %[1]s l WHERE l.trace_id = r.trace_id AND l.span_id = r.parent_span_id)`, lhs, rhs)
+	case OpParent:
+		body = fmt.Sprintf(`
+	SELECT r.* FROM %[2]s r
+	WHERE EXISTS (SELECT 1 FROM %[1]s l WHERE l.trace_id = r.trace_id AND l.parent_span_id = r.span_id)`, lhs, rhs)
+	case OpDescendant:
+		body = fmt.Sprintf(`
+	SELECT r.* FROM %[2]s r
+	WHERE EXISTS (
+		SELECT 1 FROM %[3]s a
+		INNER JOIN %[1]s l ON (l.trace_id = a.trace_id AND l.span_id = a.ancestor_id)
+		WHERE a.trace_id = r.trace_id AND a.origin_id = r.span_id
+	)`, lhs, rhs, c.ancestors(rhs))
+	case OpAncestor:
+		body = fmt.Sprintf(`
+	SELECT r.* FROM %[1]s r
+	WHERE EXISTS (SELECT 1 FROM %[2]s a WHERE a.trace_id = r.trace_id AND a.ancestor_id = r.span_id)`, rhs, c.ancestors(lhs))
+	default:
+		return "", fmt.Errorf("unsupported spanset operator %s", op)
+	}
+	return c.cte(body), nil
+}
+
+// ancestors adds the recursive query returning the ancestors of the spanset.
+func (c *compiler) ancestors(spanset string) string {
+	c.recursive = true
+	var minTime time.Time
+	if !c.opts.StartTimeMin.IsZero() {
+		minTime = c.opts.StartTimeMin.Add(-c.opts.MaxTraceDuration)
+	}
+	clauses := append([]string{"p.parent_span_id IS NOT NULL"}, c.timeClauses("p", minTime)...)
+	clauses = append(clauses, c.spanFilter("p")...)
+	// The recursive term refers to the CTE by its name.
+	return c.cte(fmt.Sprintf(ancestorsFormat, spanset, c.nextName(), strings.Join(clauses, " AND ")))
+}
+
+// spanFilter returns the condition of Options.SpanFilter on the spans of the given table alias.
+func (c *compiler) spanFilter(alias string) []string {
+	if c.opts.SpanFilter == nil {
+		return nil
+	}
+	var clause string
+	clause, c.params = c.opts.SpanFilter(alias, c.params)
+	return []string{clause}
+}
+
+// timeClauses bounds the start time of the spans of the given table alias.
+func (c *compiler) timeClauses(alias string, minTime time.Time) []string {
+	var clauses []string
+	if !minTime.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("%s.start_time >= %s", alias, c.param(minTime)))
+	}
+	if !c.opts.StartTimeMax.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("%s.start_time <= %s", alias, c.param(c.opts.StartTimeMax)))
+	}
+	return clauses
+}
+
+func (c *compiler) field(expr FieldExpr) (string, error) {
+	switch e := expr.(type) {
+	case *BinaryFieldExpr:
+		lhs, err := c.field(e.LHS)
+		if err != nil {
+			return "", err
+		}
+		rhs, err := c.field(e.RHS)
+		if err != nil {
+			return "", err
+		}
+		op := "AND"
+		if e.Op == OpOr {
+			op = "OR"
+		}
+		return fmt.Sprintf("(%s %s %s)", lhs, op, rhs), nil
+	case *NotFieldExpr:
+		cond, err := c.field(e.Expr)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(NOT %s)", cond), nil
+	case *Comparison:
+		return c.comparison(e)
+	default:
+		return "", fmt.Errorf("unsupported field expression %T", expr)
+	}
+}
+
+var sqlOperators = map[Operator]string{
+	OpEqual:        "=",
+	OpNotEqual:     "!=",
+	OpRegex:        "~",
+	OpNotRegex:     "!~",
+	OpGreater:      ">",
+	OpGreaterEqual: ">=",
+	OpLess:         "<",
+	OpLessEqual:    "<=",
+}
+
+func (c *compiler) comparison(cmp *Comparison) (string, error) {
+	switch cmp.Field.Intrinsic {
+	case IntrinsicName:
+		return fmt.Sprintf("o.span_name %s %s", sqlOperators[cmp.Op], c.param(cmp.Value.String)), nil
+	case IntrinsicStatus:
+		return fmt.Sprintf("s.status_code %s %s", sqlOperators[cmp.Op], c.param(cmp.Value.String)), nil
+	case IntrinsicKind:
+		return fmt.Sprintf("o.span_kind %s %s", sqlOperators[cmp.Op], c.param(cmp.Value.String)), nil
+	case IntrinsicDuration:
+		return fmt.Sprintf("(s.end_time - s.start_time) %s %s::interval", sqlOperators[cmp.Op], c.param(cmp.Value.Duration)), nil
+	}
+
+	tagOp, err := c.tagOperator(cmp)
+	if err != nil {
+		return "", err
+	}
+	switch cmp.Field.Scope {
+	case ScopeSpan:
+		return fmt.Sprintf(tagOp, "s.span_tags"), nil
+	case ScopeResource:
+		return fmt.Sprintf(tagOp, "s.resource_tags"), nil
+	default:
+		return fmt.Sprintf("(%s OR %s)", fmt.Sprintf(tagOp, "s.span_tags"), fmt.Sprintf(tagOp, "s.resource_tags")), nil
+	}
+}
+
+// tagMatchers maps the comparison operators to the ps_trace functions that
+// match a tag map, and to the ps_tag functions building their operand.
+var tagMatchers = map[Operator]struct{ match, op string }{
+	OpEqual:        {"_ps_trace.match_equals", "ps_tag.tag_op_equals"},
+	OpNotEqual:     {"_ps_trace.match_not_equals", "ps_tag.tag_op_not_equals"},
+	OpRegex:        {"_ps_trace.match_regexp_matches", "ps_tag.tag_op_regexp_matches"},
+	OpNotRegex:     {"_ps_trace.match_regexp_not_matches", "ps_tag.tag_op_regexp_not_matches"},
+	OpGreater:      {"_ps_trace.match_greater_than", "ps_tag.tag_op_greater_than"},
+	OpGreaterEqual: {"_ps_trace.match_greater_than_or_equal", "ps_tag.tag_op_greater_than_or_equal"},
+	OpLess:         {"_ps_trace.match_less_than", "ps_tag.tag_op_less_than"},
+	OpLessEqual:    {"_ps_trace.match_less_than_or_equal", "ps_tag.tag_op_less_than_or_equal"},
+}
+
+// tagOperator returns the condition on an attribute, with a %s verb for the tag map.
+func (c *compiler) tagOperator(cmp *Comparison) (string, error) {
+	matcher, ok := tagMatchers[cmp.Op]
+	if !ok {
+		return "", fmt.Errorf("unsupported operator %s", cmp.Op)
+	}
+	key := c.param(cmp.Field.Name)
+
+	var value string
+	switch cmp.Value.Type {
+	case TypeString:
+		switch cmp.Op {
+		case OpRegex, OpNotRegex:
+			// The regular expression is embedded in a jsonpath string literal.
+			value = c.param(jsonPathEscaper.Replace(cmp.Value.String))
+		default:
+			matcher.op += "_text"
+			value = c.param(cmp.Value.String)
+		}
+	case TypeNumber:
+		value = c.param(cmp.Value.Number) + "::numeric"
+	case TypeBool:
+		value = c.param(cmp.Value.Bool) + "::boolean"
+	default:
+		return "", fmt.Errorf("unsupported value for attribute %s", cmp.Field.Name)
+	}
+	return fmt.Sprintf("%s(%%s, %s(%s::text, %s))", matcher.match, matcher.op, key, value), nil
+}
+
+var jsonPathEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
@@ -0,0 +1,121 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package traceql
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+func TestToSQL(t *testing.T) {
+	start, end := time.Unix(1000, 0), time.Unix(2000, 0)
+	spanFilter := "SELECT s.trace_id, s.span_id, s.parent_span_id, s.start_time FROM _ps_trace.span s " +
+		"INNER JOIN _ps_trace.operation o ON (s.operation_id = o.id) WHERE "
+
+	testCases := []struct {
+		name           string
+		query          string
+		opts           Options
+		expectedSQL    string
+		expectedParams []interface{}
+	}{
+		{
+			name:           "match all",
+			query:          "{}",
+			expectedSQL:    "WITH spanset_1 AS ( " + spanFilter + "TRUE ) SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_1",
+			expectedParams: []interface{}{"previous"},
+		},
+		{
+			name:  "intrinsics",
+			query: `{ name =~ "GET.*" && status = error && kind != client || duration >= 1s }`,
+			opts:  Options{StartTimeMin: start, StartTimeMax: end},
+			expectedSQL: "WITH spanset_1 AS ( " + spanFilter + "s.start_time >= $2 AND s.start_time <= $3 AND " +
+				"(((o.span_name ~ $4 AND s.status_code = $5) AND o.span_kind != $6) OR (s.end_time - s.start_time) >= $7::interval) " +
+				") SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_1",
+			expectedParams: []interface{}{"previous", start, end, "GET.*", "error", "client", time.Second},
+		},
+		{
+			name:  "attributes",
+			query: `{ span.http.status_code > 499 && resource.service.name = "frontend" && .db.statement =~ "\"SELECT\\s" && !(.cached = false) }`,
+			expectedSQL: "WITH spanset_1 AS ( " + spanFilter +
+				"(((_ps_trace.match_greater_than(s.span_tags, ps_tag.tag_op_greater_than($2::text, $3::numeric)) AND " +
+				"_ps_trace.match_equals(s.resource_tags, ps_tag.tag_op_equals_text($4::text, $5))) AND " +
+				"(_ps_trace.match_regexp_matches(s.span_tags, ps_tag.tag_op_regexp_matches($6::text, $7)) OR " +
+				"_ps_trace.match_regexp_matches(s.resource_tags, ps_tag.tag_op_regexp_matches($6::text, $7)))) AND " +
+				"(NOT (_ps_trace.match_equals(s.span_tags, ps_tag.tag_op_equals($8::text, $9::boolean)) OR " +
+				"_ps_trace.match_equals(s.resource_tags, ps_tag.tag_op_equals($8::text, $9::boolean))))) " +
+				") SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_1",
+			expectedParams: []interface{}{"previous", "http.status_code", float64(499), "service.name", "frontend", "db.statement", `\"SELECT\\s`, "cached", false},
+		},
+		{
+			name:  "child and parent",
+			query: `({ kind = server } > { kind = client }) < {}`,
+			expectedSQL: "WITH spanset_1 AS ( " + spanFilter + "o.span_kind = $2 ), " +
+				"spanset_2 AS ( " + spanFilter + "o.span_kind = $3 ), " +
+				"spanset_3 AS ( SELECT r.* FROM spanset_2 r WHERE EXISTS (SELECT 1 FROM spanset_1 l WHERE l.trace_id = r.trace_id AND l.span_id = r.parent_span_id) ), " +
+				"spanset_4 AS ( " + spanFilter + "TRUE ), " +
+				"spanset_5 AS ( SELECT r.* FROM spanset_4 r WHERE EXISTS (SELECT 1 FROM spanset_3 l WHERE l.trace_id = r.trace_id AND l.parent_span_id = r.span_id) ) " +
+				"SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_5",
+			expectedParams: []interface{}{"previous", "server", "client"},
+		},
+		{
+			name:  "descendant",
+			query: `{ kind = server } >> { status = error }`,
+			opts:  Options{StartTimeMin: start, MaxTraceDuration: time.Hour},
+			expectedSQL: "WITH RECURSIVE spanset_1 AS ( " + spanFilter + "s.start_time >= $2 AND o.span_kind = $3 ), " +
+				"spanset_2 AS ( " + spanFilter + "s.start_time >= $4 AND s.status_code = $5 ), " +
+				"spanset_3 AS ( SELECT r.trace_id, r.span_id AS origin_id, r.parent_span_id AS ancestor_id FROM spanset_2 r WHERE r.parent_span_id IS NOT NULL " +
+				"UNION SELECT a.trace_id, a.origin_id, p.parent_span_id FROM spanset_3 a " +
+				"INNER JOIN _ps_trace.span p ON (p.trace_id = a.trace_id AND p.span_id = a.ancestor_id) WHERE p.parent_span_id IS NOT NULL AND p.start_time >= $6 ), " +
+				"spanset_4 AS ( SELECT r.* FROM spanset_2 r WHERE EXISTS ( SELECT 1 FROM spanset_3 a " +
+				"INNER JOIN spanset_1 l ON (l.trace_id = a.trace_id AND l.span_id = a.ancestor_id) WHERE a.trace_id = r.trace_id AND a.origin_id = r.span_id ) ) " +
+				"SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_4",
+			expectedParams: []interface{}{"previous", start, "server", start, "error", start.Add(-time.Hour)},
+		},
+		{
+			name:  "ancestor",
+			query: `{ status = error } << {}`,
+			expectedSQL: "WITH RECURSIVE spanset_1 AS ( " + spanFilter + "s.status_code = $2 ), " +
+				"spanset_2 AS ( " + spanFilter + "TRUE ), " +
+				"spanset_3 AS ( SELECT r.trace_id, r.span_id AS origin_id, r.parent_span_id AS ancestor_id FROM spanset_1 r WHERE r.parent_span_id IS NOT NULL " +
+				"UNION SELECT a.trace_id, a.origin_id, p.parent_span_id FROM spanset_3 a " +
+				"INNER JOIN _ps_trace.span p ON (p.trace_id = a.trace_id AND p.span_id = a.ancestor_id) WHERE p.parent_span_id IS NOT NULL ), " +
+				"spanset_4 AS ( SELECT r.* FROM spanset_2 r WHERE EXISTS (SELECT 1 FROM spanset_3 a WHERE a.trace_id = r.trace_id AND a.ancestor_id = r.span_id) ) " +
+				"SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_4",
+			expectedParams: []interface{}{"previous", "error"},
+		},
+		{
+			name:  "and or",
+			query: `{ status = error } && { kind = server } || {}`,
+			expectedSQL: "WITH spanset_1 AS ( " + spanFilter + "s.status_code = $2 ), " +
+				"spanset_2 AS ( " + spanFilter + "o.span_kind = $3 ), " +
+				"spanset_3 AS ( SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_1 WHERE trace_id IN (SELECT trace_id FROM spanset_2) " +
+				"UNION SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_2 WHERE trace_id IN (SELECT trace_id FROM spanset_1) ), " +
+				"spanset_4 AS ( " + spanFilter + "TRUE ), " +
+				"spanset_5 AS ( SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_3 " +
+				"UNION SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_4 ) " +
+				"SELECT trace_id, span_id, parent_span_id, start_time FROM spanset_5",
+			expectedParams: []interface{}{"previous", "error", "server"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			expr, err := Parse(c.query)
+			require.NoError(t, err)
+			sql, params, err := ToSQL(expr, c.opts, []interface{}{"previous"})
+			require.NoError(t, err)
+			require.Equal(t, c.expectedSQL, normalizeSQL(sql))
+			require.Equal(t, c.expectedParams, params)
+		})
+	}
+}
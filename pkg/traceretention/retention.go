@@ -0,0 +1,268 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+// Package traceretention implements a background engine that enforces the
+// per-service and per-attribute trace retention rules of the dataset config.
+//
+// The trace chunks are dropped once they are older than the longest retention
+// period. The engine periodically deletes, with their events and links, the
+// spans that are older than the shorter retention period of the first rule
+// they match, or of the default retention period if they don't match any rule.
+// The deletions take an advisory lock, so that only one Promscale instance
+// runs them at a time. Each run only scans the spans that started since the
+// previous one, and a daily full pass over the retained spans deletes the spans
+// that were ingested late. Since the trace chunks are compressed, the deletions
+// require TimescaleDB 2.11 or newer, which is checked when applying the
+// dataset config.
+package traceretention
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/timescale/promscale/pkg/dataset"
+	"github.com/timescale/promscale/pkg/log"
+	"github.com/timescale/promscale/pkg/pgxconn"
+	"github.com/timescale/promscale/pkg/util"
+)
+
+const (
+	// DefaultRunInterval is how often the retention rules are enforced.
+	DefaultRunInterval = 30 * time.Minute
+
+	// DefaultRuleName identifies the spans which don't match any rule in the metrics.
+	DefaultRuleName = "default"
+
+	// fullPassInterval is how often the deletions scan all the retained spans, to
+	// also delete the spans ingested after the run covering their start time.
+	fullPassInterval = 24 * time.Hour
+
+	// lockID is the advisory lock serializing the deletions of the Promscale instances.
+	lockID = 0x7472616365726574 // "traceret"
+
+	sqlTryLock = "SELECT pg_try_advisory_xact_lock($1)"
+
+	// deleteSpansSQLFormat deletes the spans which started in [$1, $2) and match the
+	// condition, with their events and links. The events of a span happen after its
+	// start, so bounding their time lets the chunks before $1 be excluded.
+	deleteSpansSQLFormat = `
+WITH deleted AS (
+	DELETE FROM _ps_trace.span s
+	WHERE s.start_time >= $1 AND s.start_time < $2 AND %s
+	RETURNING s.trace_id, s.span_id, s.start_time
+), deleted_events AS (
+	DELETE FROM _ps_trace.event e
+	USING deleted d
+	WHERE e.time >= $1 AND e.trace_id = d.trace_id AND e.span_id = d.span_id
+), deleted_links AS (
+	DELETE FROM _ps_trace.link l
+	USING deleted d
+	WHERE l.trace_id = d.trace_id AND l.span_id = d.span_id AND l.span_start_time = d.start_time
+)
+SELECT count(*) FROM deleted`
+
+	serviceConditionFormat   = "_ps_trace.match_equals(s.resource_tags, ps_tag.tag_op_equals_text('service.name', $%d))"
+	attributeConditionFormat = "(_ps_trace.match_equals(s.span_tags, ps_tag.tag_op_equals_text($%[1]d, $%[2]d)) OR " +
+		"_ps_trace.match_equals(s.resource_tags, ps_tag.tag_op_equals_text($%[1]d, $%[2]d)))"
+)
+
+var (
+	spansPurgedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Subsystem: "trace_retention",
+		Name:      "spans_purged_total",
+		Help:      "Total number of spans deleted by the trace retention rules.",
+	}, []string{"rule"})
+	retentionErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: util.PromNamespace,
+		Subsystem: "trace_retention",
+		Name:      "errors_total",
+		Help:      "Total number of errors while enforcing the trace retention rules.",
+	}, []string{"rule"})
+)
+
+func init() {
+	prometheus.MustRegister(spansPurgedTotal, retentionErrorsTotal)
+}
+
+// ruleCondition returns the condition matching the spans of the rule, with the parameters
+// numbered after the existing params.
+func ruleCondition(rule dataset.TraceRetentionRule, params []interface{}) (string, []interface{}) {
+	var conditions []string
+	if rule.Service != "" {
+		params = append(params, rule.Service)
+		conditions = append(conditions, fmt.Sprintf(serviceConditionFormat, len(params)))
+	}
+	keys := make([]string, 0, len(rule.Attributes))
+	for key := range rule.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		params = append(params, key, rule.Attributes[key])
+		conditions = append(conditions, fmt.Sprintf(attributeConditionFormat, len(params)-1, len(params)))
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", params
+}
+
+// deletion deletes the spans of a rule older than its retention period.
+type deletion struct {
+	rule   string
+	period time.Duration
+	query  string
+	params []interface{}
+	// lowerBound is the start time from which spans are deleted. It is the cutoff of the
+	// previous run minus the run interval, to also delete the spans ingested late.
+	lowerBound time.Time
+	// nextFullPass is when the deletion next scans all the retained spans. It is zero
+	// until the first deletion, e.g. after a restart or while another instance holds
+	// the lock, since the spans deleted so far are unknown.
+	nextFullPass time.Time
+}
+
+// Engine periodically deletes the spans older than the retention period of their rule.
+type Engine struct {
+	conn      pgxconn.PgxConn
+	interval  time.Duration
+	deletions []*deletion
+	// maxPeriod is the retention period of the trace chunks. Older spans are dropped
+	// with their chunks.
+	maxPeriod time.Duration
+
+	mu   sync.Mutex
+	kill func()
+}
+
+// NewEngine creates a new Engine enforcing the retention rules of cfg.
+func NewEngine(conn pgxconn.PgxConn, cfg dataset.Traces, interval time.Duration) *Engine {
+	max := cfg.MaxRetentionPeriod()
+	e := &Engine{conn: conn, interval: interval, maxPeriod: max}
+	for i, rule := range cfg.RetentionRules {
+		if period := time.Duration(rule.RetentionPeriod); period < max {
+			e.deletions = append(e.deletions, newDeletion(rule.Name, period, &cfg.RetentionRules[i], cfg.RetentionRules[:i]))
+		}
+	}
+	if period := cfg.DefaultRetentionPeriod(); period < max && len(cfg.RetentionRules) > 0 {
+		e.deletions = append(e.deletions, newDeletion(DefaultRuleName, period, nil, cfg.RetentionRules))
+	}
+	return e
+}
+
+// newDeletion returns the deletion of the spans matching the rule, or all the spans if it is
+// nil, but none of the previous rules, since a span belongs to the first rule it matches.
+func newDeletion(name string, period time.Duration, rule *dataset.TraceRetentionRule, previous []dataset.TraceRetentionRule) *deletion {
+	// The first two parameters are the time range.
+	params := []interface{}{nil, nil}
+	conditions := make([]string, 0, len(previous)+1)
+	var condition string
+	if rule != nil {
+		condition, params = ruleCondition(*rule, params)
+		conditions = append(conditions, condition)
+	}
+	for _, p := range previous {
+		condition, params = ruleCondition(p, params)
+		conditions = append(conditions, "NOT "+condition)
+	}
+	return &deletion{
+		rule:   name,
+		period: period,
+		query:  fmt.Sprintf(deleteSpansSQLFormat, strings.Join(conditions, " AND ")),
+		params: params[2:],
+	}
+}
+
+// Start starts the Engine.
+// Blocks forever unless Stop is called.
+func (e *Engine) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.kill = cancel
+	}()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		e.Run(ctx, time.Now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop stops the engine if it is running.
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.kill != nil {
+		e.kill()
+	}
+}
+
+// Run deletes the spans older than the retention period of their rule.
+func (e *Engine) Run(ctx context.Context, now time.Time) {
+	for _, d := range e.deletions {
+		if ctx.Err() != nil {
+			return
+		}
+		start, cutoff, fullPass := e.timeRange(d, now)
+		purged, locked, err := e.delete(ctx, d, start, cutoff)
+		if err != nil {
+			log.Error("msg", "failed to enforce trace retention rule", "rule", d.rule, "err", err)
+			retentionErrorsTotal.WithLabelValues(d.rule).Inc()
+			continue
+		}
+		if !locked {
+			log.Debug("msg", "trace retention is enforced by another Promscale instance")
+			return
+		}
+		spansPurgedTotal.WithLabelValues(d.rule).Add(float64(purged))
+		d.lowerBound = cutoff.Add(-e.interval)
+		if fullPass {
+			d.nextFullPass = now.Add(fullPassInterval)
+		}
+		if purged > 0 {
+			log.Debug("msg", "deleted spans past their retention period", "rule", d.rule, "spans", purged)
+		}
+	}
+}
+
+// timeRange returns the start times of the spans deleted by a run. A full pass starts
+// at the retention period of the trace chunks, the other runs just before the cutoff
+// of the previous one.
+func (e *Engine) timeRange(d *deletion, now time.Time) (start, cutoff time.Time, fullPass bool) {
+	cutoff = now.Add(-d.period)
+	if now.Before(d.nextFullPass) {
+		return d.lowerBound, cutoff, false
+	}
+	return now.Add(-e.maxPeriod), cutoff, true
+}
+
+// delete deletes the spans of the rule which started in [start, cutoff), if no other
+// instance is running the deletions.
+func (e *Engine) delete(ctx context.Context, d *deletion, start, cutoff time.Time) (purged int64, locked bool, err error) {
+	tx, err := e.conn.BeginTx(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	if err = tx.QueryRow(ctx, sqlTryLock, lockID).Scan(&locked); err != nil || !locked {
+		return 0, false, err
+	}
+	params := append([]interface{}{start, cutoff}, d.params...)
+	if err = tx.QueryRow(ctx, d.query, params...).Scan(&purged); err != nil {
+		return 0, true, err
+	}
+	return purged, true, tx.Commit(ctx)
+}
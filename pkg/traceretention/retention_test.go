@@ -0,0 +1,129 @@
+// This file and its contents are licensed under the Apache License 2.0.
+// Please see the included NOTICE for copyright information and
+// LICENSE for a copy of the license.
+
+package traceretention
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/timescale/promscale/pkg/dataset"
+)
+
+const day = 24 * time.Hour
+
+func TestRuleCondition(t *testing.T) {
+	condition, params := ruleCondition(dataset.TraceRetentionRule{
+		Service:    "payment",
+		Attributes: map[string]string{"b": "2", "a": "1"},
+	}, []interface{}{nil, nil})
+	require.Equal(t, "("+
+		fmt.Sprintf(serviceConditionFormat, 3)+" AND "+
+		fmt.Sprintf(attributeConditionFormat, 4, 5)+" AND "+
+		fmt.Sprintf(attributeConditionFormat, 6, 7)+")", condition)
+	require.Equal(t, []interface{}{nil, nil, "payment", "a", "1", "b", "2"}, params)
+}
+
+func TestNewEngine(t *testing.T) {
+	payment := dataset.TraceRetentionRule{Name: "payment", Service: "payment", RetentionPeriod: dataset.DayDuration(90 * day)}
+	chatty := dataset.TraceRetentionRule{Name: "chatty", Service: "chatty", RetentionPeriod: dataset.DayDuration(3 * day)}
+	staging := dataset.TraceRetentionRule{Name: "staging", Attributes: map[string]string{"deployment.environment": "staging"}, RetentionPeriod: dataset.DayDuration(day)}
+
+	testCases := []struct {
+		name     string
+		cfg      dataset.Traces
+		expected []*deletion
+	}{
+		{
+			name: "no rules",
+			cfg:  dataset.Traces{RetentionPeriod: dataset.DayDuration(7 * day)},
+		},
+		{
+			name: "longest rule is enforced by the chunk retention",
+			cfg:  dataset.Traces{RetentionPeriod: dataset.DayDuration(7 * day), RetentionRules: []dataset.TraceRetentionRule{payment}},
+			expected: []*deletion{{
+				rule:   DefaultRuleName,
+				period: 7 * day,
+				query:  fmt.Sprintf(deleteSpansSQLFormat, "NOT ("+fmt.Sprintf(serviceConditionFormat, 3)+")"),
+				params: []interface{}{"payment"},
+			}},
+		},
+		{
+			name: "first matching rule wins",
+			cfg:  dataset.Traces{RetentionRules: []dataset.TraceRetentionRule{payment, chatty, staging}},
+			expected: []*deletion{
+				{
+					rule:   "chatty",
+					period: 3 * day,
+					query: fmt.Sprintf(deleteSpansSQLFormat, "("+fmt.Sprintf(serviceConditionFormat, 3)+") AND "+
+						"NOT ("+fmt.Sprintf(serviceConditionFormat, 4)+")"),
+					params: []interface{}{"chatty", "payment"},
+				},
+				{
+					rule:   "staging",
+					period: day,
+					query: fmt.Sprintf(deleteSpansSQLFormat, "("+fmt.Sprintf(attributeConditionFormat, 3, 4)+") AND "+
+						"NOT ("+fmt.Sprintf(serviceConditionFormat, 5)+") AND "+
+						"NOT ("+fmt.Sprintf(serviceConditionFormat, 6)+")"),
+					params: []interface{}{"deployment.environment", "staging", "payment", "chatty"},
+				},
+				{
+					rule:   DefaultRuleName,
+					period: dataset.Traces{}.DefaultRetentionPeriod(),
+					query: fmt.Sprintf(deleteSpansSQLFormat, "NOT ("+fmt.Sprintf(serviceConditionFormat, 3)+") AND "+
+						"NOT ("+fmt.Sprintf(serviceConditionFormat, 4)+") AND "+
+						"NOT ("+fmt.Sprintf(attributeConditionFormat, 5, 6)+")"),
+					params: []interface{}{"payment", "chatty", "deployment.environment", "staging"},
+				},
+			},
+		},
+		{
+			name: "default retention is the longest",
+			cfg:  dataset.Traces{RetentionPeriod: dataset.DayDuration(90 * day), RetentionRules: []dataset.TraceRetentionRule{chatty}},
+			expected: []*deletion{{
+				rule:   "chatty",
+				period: 3 * day,
+				query:  fmt.Sprintf(deleteSpansSQLFormat, "("+fmt.Sprintf(serviceConditionFormat, 3)+")"),
+				params: []interface{}{"chatty"},
+			}},
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			e := NewEngine(nil, c.cfg, DefaultRunInterval)
+			require.Equal(t, c.expected, e.deletions)
+		})
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	chatty := dataset.TraceRetentionRule{Name: "chatty", Service: "chatty", RetentionPeriod: dataset.DayDuration(3 * day)}
+	e := NewEngine(nil, dataset.Traces{RetentionPeriod: dataset.DayDuration(90 * day), RetentionRules: []dataset.TraceRetentionRule{chatty}}, time.Hour)
+	d := e.deletions[0]
+	now := time.Unix(1000*60*60*24, 0)
+
+	// The first run, e.g. after a restart, scans the spans of the trace chunks.
+	start, cutoff, fullPass := e.timeRange(d, now)
+	require.Equal(t, now.Add(-90*day), start)
+	require.Equal(t, now.Add(-3*day), cutoff)
+	require.True(t, fullPass)
+	d.lowerBound = cutoff.Add(-e.interval)
+	d.nextFullPass = now.Add(fullPassInterval)
+
+	// The next runs start before the cutoff of the previous one.
+	now = now.Add(time.Hour)
+	start, cutoff, fullPass = e.timeRange(d, now)
+	require.Equal(t, now.Add(-3*day-2*time.Hour), start)
+	require.Equal(t, now.Add(-3*day), cutoff)
+	require.False(t, fullPass)
+
+	// A full pass deletes the spans ingested late.
+	now = now.Add(fullPassInterval)
+	start, _, fullPass = e.timeRange(d, now)
+	require.Equal(t, now.Add(-90*day), start)
+	require.True(t, fullPass)
+}